@@ -1,17 +1,27 @@
 package agent
 
 import (
+	"maps"
 	"strings"
+	"sync"
 	"text/template"
+	"time"
 
 	"github.com/casualjim/bubo/api"
+	"github.com/casualjim/bubo/provider"
 	"github.com/casualjim/bubo/provider/openai"
 	"github.com/casualjim/bubo/tool"
 	"github.com/casualjim/bubo/types"
 	"github.com/fogfish/opts"
 )
 
-var _ api.Agent = (*defaultAgent)(nil)
+var (
+	_ api.Agent            = (*defaultAgent)(nil)
+	_ api.HandoffPolicy    = (*defaultAgent)(nil)
+	_ api.ModelTuning      = (*defaultAgent)(nil)
+	_ api.InstructionClock = (*defaultAgent)(nil)
+	_ api.InstructionFuncs = (*defaultAgent)(nil)
+)
 
 // defaultAgent represents an agent with specific attributes and capabilities.
 // It includes the agent's name, model, instructions, function definitions, tool choice,
@@ -22,6 +32,12 @@ type defaultAgent struct {
 	instructions      string
 	tools             []tool.Definition
 	parallelToolCalls bool
+	clock             func() time.Time
+	nowFormat         string
+	todayFormat       string
+	allowedHandoffs   []string
+	modelParams       provider.ModelParams
+	funcs             template.FuncMap
 }
 
 // Name returns the agent's name.
@@ -48,16 +64,81 @@ func (a *defaultAgent) ParallelToolCalls() bool {
 	return a.parallelToolCalls
 }
 
+// AllowedHandoffs returns the names of the agents the tools can hand off to, nil when any handoff is allowed.
+func (a *defaultAgent) AllowedHandoffs() []string {
+	return a.allowedHandoffs
+}
+
+// ModelParams returns the generation parameters the agent uses for its model.
+func (a *defaultAgent) ModelParams() provider.ModelParams {
+	return a.modelParams
+}
+
+// Clock returns the source of the current time for the instructions, nil when it wasn't configured.
+func (a *defaultAgent) Clock() func() time.Time {
+	return a.clock
+}
+
+// NowFormat returns the time layout of the {{.now}} instruction variable.
+func (a *defaultAgent) NowFormat() string {
+	return a.nowFormat
+}
+
+// TodayFormat returns the time layout of the {{.today}} instruction variable.
+func (a *defaultAgent) TodayFormat() string {
+	return a.todayFormat
+}
+
 // RenderInstructions renders the agent's instructions with the provided context variables.
+// The current date and time are available as {{.now}} and {{.today}}, unless the context
+// variables already define them.
 func (a *defaultAgent) RenderInstructions(cv types.ContextVars) (string, error) {
 	if !strings.Contains(a.instructions, "{{") {
 		return a.instructions, nil
 	}
-	return renderTemplate("instructions", a.instructions, cv)
+	clock := a.clock
+	if clock == nil {
+		clock = time.Now
+	}
+	return RenderTemplate("instructions", a.instructions, a.funcs, cv.WithTime(clock(), a.nowFormat, a.todayFormat))
+}
+
+// TemplateFuncs returns the functions that were added to the agent with WithTemplateFuncs.
+func (a *defaultAgent) TemplateFuncs() template.FuncMap {
+	return maps.Clone(a.funcs)
 }
 
-func renderTemplate(name, templateStr string, cv types.ContextVars) (string, error) {
-	tmpl, err := template.New(name).Option("missingkey=error").Parse(templateStr)
+var (
+	templateFuncsMu sync.RWMutex
+	templateFuncs   = template.FuncMap{}
+)
+
+// RegisterTemplateFuncs makes the functions available to the instructions of every agent,
+// the functions of an agent take precedence over them.
+//
+// Example:
+//
+//	agent.RegisterTemplateFuncs(template.FuncMap{"upper": strings.ToUpper})
+func RegisterTemplateFuncs(funcs template.FuncMap) {
+	templateFuncsMu.Lock()
+	defer templateFuncsMu.Unlock()
+	maps.Copy(templateFuncs, funcs)
+}
+
+// TemplateFuncs returns a copy of the functions that were registered with RegisterTemplateFuncs.
+func TemplateFuncs() template.FuncMap {
+	templateFuncsMu.RLock()
+	defer templateFuncsMu.RUnlock()
+	return maps.Clone(templateFuncs)
+}
+
+// RenderTemplate renders an instructions template with the context variables. The template can call
+// the functions that were registered with RegisterTemplateFuncs and funcs, funcs take precedence.
+// A missing variable is an error.
+func RenderTemplate(name, templateStr string, funcs template.FuncMap, cv types.ContextVars) (string, error) {
+	all := TemplateFuncs()
+	maps.Copy(all, funcs)
+	tmpl, err := template.New(name).Option("missingkey=error").Funcs(all).Parse(templateStr)
 	if err != nil {
 		return "", err
 	}
@@ -75,6 +156,12 @@ var (
 	Model             = opts.ForName[defaultAgent, api.Model]("model")
 	Instructions      = opts.ForName[defaultAgent, string]("instructions")
 	ParallelToolCalls = opts.ForName[defaultAgent, bool]("parallelToolCalls")
+	// Clock sets the source of the current time for the {{.now}} and {{.today}} instruction variables.
+	Clock = opts.ForName[defaultAgent, func() time.Time]("clock")
+	// NowFormat sets the time layout of the {{.now}} instruction variable.
+	NowFormat = opts.ForName[defaultAgent, string]("nowFormat")
+	// TodayFormat sets the time layout of the {{.today}} instruction variable.
+	TodayFormat = opts.ForName[defaultAgent, string]("todayFormat")
 )
 
 func Tools(tool tool.Definition, extraTools ...tool.Definition) opts.Option[defaultAgent] {
@@ -85,6 +172,40 @@ func Tools(tool tool.Definition, extraTools ...tool.Definition) opts.Option[defa
 	})
 }
 
+// AllowedHandoffs restricts the agents the tools can hand off to, a handoff to any other agent
+// fails the tool call. Without names, the tools can't hand off at all.
+func AllowedHandoffs(names ...string) opts.Option[defaultAgent] {
+	return opts.Type[defaultAgent](func(o *defaultAgent) error {
+		o.allowedHandoffs = append(make([]string, 0, len(names)), names...)
+		return nil
+	})
+}
+
+// WithTemplateFuncs adds functions the instructions template can call, e.g. {{upper .name}}.
+func WithTemplateFuncs(funcs template.FuncMap) opts.Option[defaultAgent] {
+	return opts.Type[defaultAgent](func(o *defaultAgent) error {
+		if o.funcs == nil {
+			o.funcs = make(template.FuncMap, len(funcs))
+		}
+		maps.Copy(o.funcs, funcs)
+		return nil
+	})
+}
+
+// WithModelParams sets the generation parameters the agent uses for its model,
+// the parameters that aren't set are left to the provider. The parameters of a run take precedence.
+//
+// Example:
+//
+//	temperature := 0.0
+//	agent.New(agent.Name("extractor"), agent.WithModelParams(provider.ModelParams{Temperature: &temperature}))
+func WithModelParams(params provider.ModelParams) opts.Option[defaultAgent] {
+	return opts.Type[defaultAgent](func(o *defaultAgent) error {
+		o.modelParams = params
+		return nil
+	})
+}
+
 // New creates a new DefaultAgent with the provided parameters.
 func New(options ...opts.Option[defaultAgent]) api.Agent {
 	agent := &defaultAgent{
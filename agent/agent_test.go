@@ -1,8 +1,12 @@
 package agent
 
 import (
+	"strings"
 	"testing"
+	"text/template"
+	"time"
 
+	"github.com/casualjim/bubo/api"
 	"github.com/casualjim/bubo/provider"
 	"github.com/casualjim/bubo/types"
 	"github.com/stretchr/testify/assert"
@@ -43,6 +47,23 @@ func TestNewAgent(t *testing.T) {
 	assert.Empty(t, agent.Tools())
 }
 
+func TestWithModelParams(t *testing.T) {
+	t.Run("unset parameters are left to the provider", func(t *testing.T) {
+		agent := New(Name("test"), Model(&testModel{}), Instructions("instructions"))
+		assert.Equal(t, provider.ModelParams{}, api.ModelParamsOf(agent))
+	})
+
+	t.Run("a zero temperature is kept", func(t *testing.T) {
+		temperature := 0.0
+		agent := New(Name("test"), Model(&testModel{}), Instructions("instructions"), WithModelParams(provider.ModelParams{Temperature: &temperature}))
+		params := api.ModelParamsOf(agent)
+		require.NotNil(t, params.Temperature)
+		assert.Zero(t, *params.Temperature)
+		assert.Nil(t, params.TopP)
+		assert.Nil(t, params.MaxTokens)
+	})
+}
+
 func TestRenderInstructions(t *testing.T) {
 	t.Run("no template variables", func(t *testing.T) {
 		agent := New(Name("test"), Model(&testModel{}), Instructions("simple instructions"))
@@ -69,4 +90,68 @@ func TestRenderInstructions(t *testing.T) {
 		_, err := agent.RenderInstructions(types.ContextVars{})
 		require.Error(t, err)
 	})
+
+	t.Run("with current date", func(t *testing.T) {
+		now := time.Date(2024, time.March, 14, 15, 9, 26, 0, time.UTC)
+		agent := New(
+			Name("test"),
+			Model(&testModel{}),
+			Instructions("Today is {{.today}}, it is {{.now}}"),
+			Clock(func() time.Time { return now }),
+		)
+		result, err := agent.RenderInstructions(types.ContextVars{})
+		require.NoError(t, err)
+		assert.Equal(t, "Today is 2024-03-14, it is 2024-03-14T15:09:26Z", result)
+	})
+
+	t.Run("with custom date formats", func(t *testing.T) {
+		now := time.Date(2024, time.March, 14, 15, 9, 26, 0, time.UTC)
+		agent := New(
+			Name("test"),
+			Model(&testModel{}),
+			Instructions("{{.today}} {{.now}}"),
+			Clock(func() time.Time { return now }),
+			TodayFormat("Jan 2, 2006"),
+			NowFormat(time.Kitchen),
+		)
+		result, err := agent.RenderInstructions(types.ContextVars{})
+		require.NoError(t, err)
+		assert.Equal(t, "Mar 14, 2024 3:09PM", result)
+	})
+
+	t.Run("with template functions", func(t *testing.T) {
+		agent := New(
+			Name("test"),
+			Model(&testModel{}),
+			Instructions("Hello {{upper .name}}"),
+			WithTemplateFuncs(template.FuncMap{"upper": strings.ToUpper}),
+		)
+		result, err := agent.RenderInstructions(types.ContextVars{"name": "world"})
+		require.NoError(t, err)
+		assert.Equal(t, "Hello WORLD", result)
+	})
+
+	t.Run("with global template functions", func(t *testing.T) {
+		RegisterTemplateFuncs(template.FuncMap{
+			"shout": func(s string) string { return strings.ToUpper(s) + "!" },
+			"greet": func(s string) string { return "hi " + s },
+		})
+		agent := New(
+			Name("test"),
+			Model(&testModel{}),
+			Instructions("{{greet .name}} {{shout .name}}"),
+			WithTemplateFuncs(template.FuncMap{"greet": func(s string) string { return "hello " + s }}),
+		)
+		result, err := agent.RenderInstructions(types.ContextVars{"name": "world"})
+		require.NoError(t, err)
+		assert.Equal(t, "hello world WORLD!", result)
+		assert.Contains(t, TemplateFuncs(), "shout")
+	})
+
+	t.Run("context vars override the date", func(t *testing.T) {
+		agent := New(Name("test"), Model(&testModel{}), Instructions("Today is {{.today}}"))
+		result, err := agent.RenderInstructions(types.ContextVars{"today": "someday"})
+		require.NoError(t, err)
+		assert.Equal(t, "Today is someday", result)
+	})
 }
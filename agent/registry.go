@@ -11,6 +11,12 @@ func Add(agent api.Agent) {
 	Global.Add(agent.Name(), agent)
 }
 
+// AddEphemeral registers an agent that can be evicted when the number of agents is bounded,
+// agents registered with Add are never evicted.
+func AddEphemeral(agent api.Agent) {
+	Global.AddEphemeral(agent.Name(), agent)
+}
+
 func Get(name string) (api.Agent, bool) {
 	return Global.Get(name)
 }
@@ -18,3 +24,19 @@ func Get(name string) (api.Agent, bool) {
 func Del(name string) {
 	Global.Del(name)
 }
+
+// List returns the names of all the registered agents
+func List() []string {
+	return Global.List()
+}
+
+// Clear removes all the registered agents
+func Clear() {
+	Global.Clear()
+}
+
+// SetMaxSize bounds the number of registered agents, evicting the least recently used ephemeral ones.
+// A value <= 0 removes the bound.
+func SetMaxSize(n int) {
+	Global.SetMaxSize(n)
+}
@@ -0,0 +1,72 @@
+package agent
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/casualjim/bubo/api"
+	"github.com/casualjim/bubo/pkg/reflectx"
+)
+
+// Validate checks the configuration of an agent before it is run.
+// It reports all the problems it finds as a single joined error:
+//
+//   - the agent has no name
+//   - the agent has no model
+//   - the agent has no instructions
+//   - a tool has no function, or the function is not a func
+//   - two tools share the same name
+//
+// Tool functions are only inspected, they are never called.
+func Validate(a api.Agent) error {
+	if a == nil {
+		return errors.New("agent is nil")
+	}
+
+	var errs error
+	if a.Name() == "" {
+		errs = errors.Join(errs, errors.New("agent has no name"))
+	}
+	if isNil(a.Model()) {
+		errs = errors.Join(errs, fmt.Errorf("agent %s has no model", a.Name()))
+	}
+	if a.Instructions() == "" {
+		errs = errors.Join(errs, fmt.Errorf("agent %s has no instructions", a.Name()))
+	}
+
+	seen := make(map[string]struct{}, len(a.Tools()))
+	for i, def := range a.Tools() {
+		if def.Builtin {
+			if _, ok := seen[def.Name]; ok {
+				errs = errors.Join(errs, fmt.Errorf("agent %s: duplicate tool name %s", a.Name(), def.Name))
+			}
+			seen[def.Name] = struct{}{}
+			continue
+		}
+		if !reflectx.IsFunction(def.Function) {
+			errs = errors.Join(errs, fmt.Errorf("agent %s: tool %d (%s) has no function", a.Name(), i, def.Name))
+			continue
+		}
+
+		name, _ := def.ToNameAndSchema()
+		if _, ok := seen[name]; ok {
+			errs = errors.Join(errs, fmt.Errorf("agent %s: duplicate tool name %s", a.Name(), name))
+		}
+		seen[name] = struct{}{}
+	}
+	return errs
+}
+
+func isNil(v any) bool {
+	if v == nil {
+		return true
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice, reflect.Func, reflect.Chan:
+		return rv.IsNil()
+	default:
+		return false
+	}
+}
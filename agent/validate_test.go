@@ -0,0 +1,88 @@
+package agent
+
+import (
+	"testing"
+
+	"github.com/casualjim/bubo/api"
+	"github.com/casualjim/bubo/tool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidate(t *testing.T) {
+	t.Run("valid agent", func(t *testing.T) {
+		a := New(Name("test"), Model(&testModel{}), Instructions("instructions"))
+		require.NoError(t, Validate(a))
+	})
+
+	t.Run("nil agent", func(t *testing.T) {
+		require.Error(t, Validate(nil))
+	})
+
+	t.Run("nil model", func(t *testing.T) {
+		a := New(Name("test"), Model(nil), Instructions("instructions"))
+		err := Validate(a)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "agent test has no model")
+	})
+
+	t.Run("empty instructions", func(t *testing.T) {
+		a := New(Name("test"), Model(&testModel{}))
+		err := Validate(a)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "agent test has no instructions")
+	})
+
+	t.Run("duplicate tool names", func(t *testing.T) {
+		a := New(
+			Name("test"),
+			Model(&testModel{}),
+			Instructions("instructions"),
+			Tools(
+				tool.Must(func() string { return "a" }, tool.Name("lookup")),
+				tool.Must(func() string { return "b" }, tool.Name("lookup")),
+			),
+		)
+		err := Validate(a)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "duplicate tool name lookup")
+	})
+
+	t.Run("tool without function", func(t *testing.T) {
+		a := New(
+			Name("test"),
+			Model(&testModel{}),
+			Instructions("instructions"),
+			Tools(tool.Definition{Name: "broken"}),
+		)
+		err := Validate(a)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "tool 0 (broken) has no function")
+	})
+
+	t.Run("transfer tools are not called", func(t *testing.T) {
+		a := New(
+			Name("test"),
+			Model(&testModel{}),
+			Instructions("instructions"),
+			Tools(tool.Must(func() api.Agent { panic("transfer tool was called") }, tool.Name("transferToTarget"))),
+		)
+		require.NotPanics(t, func() { require.NoError(t, Validate(a)) })
+	})
+
+	t.Run("reports all problems", func(t *testing.T) {
+		a := New(
+			Model(nil),
+			Tools(
+				tool.Must(func() string { return "a" }, tool.Name("lookup")),
+				tool.Must(func() string { return "b" }, tool.Name("lookup")),
+			),
+		)
+		err := Validate(a)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "agent has no name")
+		assert.Contains(t, err.Error(), "has no model")
+		assert.Contains(t, err.Error(), "has no instructions")
+		assert.Contains(t, err.Error(), "duplicate tool name lookup")
+	})
+}
@@ -1,6 +1,10 @@
 package api
 
 import (
+	"text/template"
+	"time"
+
+	"github.com/casualjim/bubo/provider"
 	"github.com/casualjim/bubo/tool"
 	"github.com/casualjim/bubo/types"
 )
@@ -60,3 +64,38 @@ type Agent interface {
 
 	Instructions() string
 }
+
+// HandoffPolicy is implemented by agents that restrict which agents their tools can hand off to.
+// A handoff to an agent that isn't allowed fails the tool call with ErrHandoffNotAllowed.
+type HandoffPolicy interface {
+	// AllowedHandoffs returns the names of the agents the tools can hand off to,
+	// a nil slice allows handoffs to any agent.
+	AllowedHandoffs() []string
+}
+
+// ModelTuning is implemented by agents that set the generation parameters of their model.
+// The parameters of the run take precedence over the ones of the agent.
+type ModelTuning interface {
+	ModelParams() provider.ModelParams
+}
+
+// InstructionClock is implemented by agents that configure the {{.now}} and {{.today}} variables
+// of their instructions. A nil clock or an empty format leaves the choice to the executor.
+type InstructionClock interface {
+	Clock() func() time.Time
+	NowFormat() string
+	TodayFormat() string
+}
+
+// InstructionFuncs is implemented by agents that add functions to the template of their instructions.
+type InstructionFuncs interface {
+	TemplateFuncs() template.FuncMap
+}
+
+// ModelParamsOf returns the generation parameters of the agent, they're empty when the agent doesn't set any.
+func ModelParamsOf(agent Agent) provider.ModelParams {
+	if tuning, ok := agent.(ModelTuning); ok {
+		return tuning.ModelParams()
+	}
+	return provider.ModelParams{}
+}
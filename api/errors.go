@@ -0,0 +1,36 @@
+package api
+
+import "errors"
+
+// ErrHandoffNotAllowed is returned when a tool hands off to an agent that is not in the
+// allowed handoffs of the active agent.
+var ErrHandoffNotAllowed = errors.New("handoff not allowed")
+
+// ErrNoUserInput is returned when a run is started with a thread that has no user message
+// or instructions to respond to, for example a workflow step with an empty prompt.
+var ErrNoUserInput = errors.New("no user input: the thread has no user message or instructions to send to the model")
+
+// RunStoppedError is the error of a run with structured output that a tool ended with
+// tool.Stop. The final message is plain text, so it can't be the result of the run;
+// use errors.As to get it.
+type RunStoppedError struct {
+	FinalMessage string
+}
+
+func (e *RunStoppedError) Error() string {
+	return "the run was stopped by a tool: " + e.FinalMessage
+}
+
+// ToolCallErrors collects the failures of the tool calls of a turn that ran in parallel,
+// so callers see every tool that failed instead of only the first one.
+// Use errors.Is or errors.As to check for a specific failure.
+type ToolCallErrors []error
+
+func (e ToolCallErrors) Error() string {
+	return errors.Join(e...).Error()
+}
+
+// Unwrap returns the failures of the individual tool calls
+func (e ToolCallErrors) Unwrap() []error {
+	return e
+}
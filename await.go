@@ -0,0 +1,96 @@
+// Package bubo provides a framework for building conversational AI agents that can interact
+// in a structured manner. It supports multi-agent conversations, structured output,
+// and flexible execution contexts.
+package bubo
+
+import (
+	"context"
+
+	"github.com/fogfish/opts"
+)
+
+// Result is the outcome of a run, as delivered by the channel of an Awaitable.
+type Result[T any] struct {
+	Value T
+	Err   error
+}
+
+// Awaitable is the result of a run that was started with Start.
+// Await blocks until the run completes, C returns a channel that can be used in a select.
+type Awaitable[T any] struct {
+	ch     chan Result[T]
+	done   chan struct{}
+	result Result[T]
+}
+
+var _ Future[string] = (*Awaitable[string])(nil)
+
+func newAwaitable[T any]() *Awaitable[T] {
+	return &Awaitable[T]{
+		ch:   make(chan Result[T], 1),
+		done: make(chan struct{}),
+	}
+}
+
+func (a *Awaitable[T]) resolve(value T, err error) {
+	a.result = Result[T]{Value: value, Err: err}
+	a.ch <- a.result
+	close(a.done)
+}
+
+// C returns a channel that receives the result once the run completes.
+// The result is sent only once, so there should be a single receiver.
+func (a *Awaitable[T]) C() <-chan Result[T] {
+	return a.ch
+}
+
+// Await blocks until the run completes or the context is done, whichever happens first.
+// When the context is done first, the run keeps going and Await can be called again.
+func (a *Awaitable[T]) Await(ctx context.Context) (T, error) {
+	select {
+	case <-a.done:
+		return a.result.Value, a.result.Err
+	case <-ctx.Done():
+		var zero T
+		return zero, ctx.Err()
+	}
+}
+
+// Get blocks until the run completes and returns its result.
+func (a *Awaitable[T]) Get() (T, error) {
+	<-a.done
+	return a.result.Value, a.result.Err
+}
+
+// Start runs the knot in the background with a local execution context and returns its result as an Awaitable.
+// The hook receives the events of the run, it can be nil when only the result is needed.
+// Cancelling the context cancels the run.
+//
+// Example usage:
+//
+//	run := bubo.Start[string](ctx, knot, nil)
+//	select {
+//	case res := <-run.C():
+//	    // handle res.Value and res.Err
+//	case <-shutdown:
+//	    // stop waiting
+//	}
+func Start[T any](ctx context.Context, k *Knot, hook Hook[T], options ...opts.Option[ExecutionContext]) *Awaitable[T] {
+	if hook == nil {
+		hook = noopResultHook[T]{}
+	}
+	rc, fut := local(hook, options...)
+
+	run := newAwaitable[T]()
+	go func() {
+		if err := k.Run(ctx, rc); err != nil {
+			var zero T
+			run.resolve(zero, err)
+			return
+		}
+		// the future only takes the first outcome, this is a no-op when the run produced a result
+		fut.Error(errNoResult)
+		run.resolve(fut.Get())
+	}()
+	return run
+}
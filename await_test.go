@@ -0,0 +1,74 @@
+package bubo
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStart(t *testing.T) {
+	t.Run("select on the result", func(t *testing.T) {
+		knot := New(
+			Agents(delayedAgent(t, "fast", &delayedProvider{delay: 10 * time.Millisecond, content: "done"})),
+			Steps(Step("fast", "hurry up")),
+		)
+
+		run := Start[string](context.Background(), knot, nil)
+		select {
+		case res := <-run.C():
+			require.NoError(t, res.Err)
+			assert.Equal(t, "done", res.Value)
+		case <-time.After(time.Second):
+			t.Fatal("timed out waiting for the result")
+		}
+	})
+
+	t.Run("timeout wins", func(t *testing.T) {
+		knot := New(
+			Agents(delayedAgent(t, "slow", &delayedProvider{delay: 200 * time.Millisecond, content: "eventually"})),
+			Steps(Step("slow", "take your time")),
+		)
+
+		run := Start[string](context.Background(), knot, nil)
+		select {
+		case <-run.C():
+			t.Fatal("the run should not have completed yet")
+		case <-time.After(20 * time.Millisecond):
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		_, err := run.Await(ctx)
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+
+		// the run keeps going after a timed out await
+		result, err := run.Await(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, "eventually", result)
+	})
+	t.Run("run without a result", func(t *testing.T) {
+		knot := New(Agents(delayedAgent(t, "idle", &delayedProvider{content: "unused"})))
+
+		run := Start[string](context.Background(), knot, nil)
+		select {
+		case res := <-run.C():
+			require.EqualError(t, res.Err, "run finished without a result")
+		case <-time.After(time.Second):
+			t.Fatal("timed out waiting for the result")
+		}
+	})
+	t.Run("run without a result", func(t *testing.T) {
+		knot := New(Agents(delayedAgent(t, "idle", &delayedProvider{content: "unused"})))
+
+		run := Start[string](context.Background(), knot, nil)
+		select {
+		case res := <-run.C():
+			require.ErrorIs(t, res.Err, errNoResult)
+		case <-time.After(time.Second):
+			t.Fatal("timed out waiting for the result")
+		}
+	})
+}
@@ -24,7 +24,7 @@
 // Example usage:
 //
 //	// Create a broker and get a topic
-//	broker := NewLocalBroker()
+//	broker := broker.Local()
 //	topic := broker.Topic(ctx, "agent-events")
 //
 //	// Create a subscription with a hook
@@ -45,8 +45,7 @@
 //	    return err
 //	}
 //
-// The broker package is designed to be internal to avoid exposing implementation
-// details while providing a robust foundation for event distribution throughout
-// the system. It works closely with the events package to ensure type-safe
-// event handling and proper context management.
+// Brokers are passed to the execution context with bubo.WithBroker, so the events of the runs
+// reach consumers in other goroutines or processes. The package works closely with the events
+// package to ensure type-safe event handling and proper context management.
 package broker
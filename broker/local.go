@@ -3,12 +3,14 @@ package broker
 import (
 	"context"
 	"fmt"
+	"log/slog"
 	"sync"
 	"time"
 
 	"github.com/alphadose/haxmap"
 	"github.com/casualjim/bubo/events"
 	"github.com/casualjim/bubo/messages"
+	"github.com/casualjim/bubo/pkg/slogx"
 	"github.com/casualjim/bubo/pkg/uuidx"
 )
 
@@ -17,12 +19,15 @@ const defaultSlowSubscriberTimeout = 100 * time.Millisecond
 type localBroker struct {
 	topics                *haxmap.Map[string, *topic]
 	slowSubscriberTimeout time.Duration
+	transformers          []events.EventTransformer
 }
 
-func Local() Broker {
+func Local(options ...Option) Broker {
+	cfg := newConfig(options)
 	return &localBroker{
 		topics:                haxmap.New[string, *topic](),
 		slowSubscriberTimeout: defaultSlowSubscriberTimeout,
+		transformers:          cfg.transformers,
 	}
 }
 
@@ -38,6 +43,7 @@ func (b *localBroker) Topic(ctx context.Context, id string) Topic {
 			ID:                    id,
 			subscriptions:         haxmap.New[string, *subscription](),
 			slowSubscriberTimeout: b.slowSubscriberTimeout,
+			transformers:          b.transformers,
 		}
 	})
 	return topic
@@ -47,9 +53,11 @@ type topic struct {
 	ID                    string
 	subscriptions         *haxmap.Map[string, *subscription]
 	slowSubscriberTimeout time.Duration
+	transformers          []events.EventTransformer
 }
 
 func (t *topic) Publish(ctx context.Context, event events.Event) error {
+	event = transform(event, t.transformers)
 	t.subscriptions.ForEach(func(id string, sub *subscription) bool {
 		if sub == nil {
 			return true
@@ -126,6 +134,21 @@ func (s *subscription) Unsubscribe() {
 	})
 }
 
+// transform applies the transformers to the event in order, a failing transformer is logged and skipped
+func transform(event events.Event, transformers []events.EventTransformer) events.Event {
+	for i, transformer := range transformers {
+		next, err := transformer(event)
+		if err != nil {
+			slog.Error("failed to transform event", slogx.Error(err), slog.Int("transformer", i))
+			continue
+		}
+		if next != nil {
+			event = next
+		}
+	}
+	return event
+}
+
 func forwardToHook(ctx context.Context, from chan events.Event, to events.Hook) {
 	for {
 		select {
@@ -138,6 +161,9 @@ func forwardToHook(ctx context.Context, from chan events.Event, to events.Hook)
 				// Delim events are used for stream control and don't need to be forwarded to hooks
 			case events.Request[messages.UserMessage]:
 				to.OnUserPrompt(ctx, messages.Message[messages.UserMessage]{
+					MessageID: event.MessageID,
+					RunID:     event.RunID,
+					TurnID:    event.TurnID,
 					Payload:   event.Message,
 					Sender:    event.Sender,
 					Timestamp: event.Timestamp,
@@ -145,6 +171,9 @@ func forwardToHook(ctx context.Context, from chan events.Event, to events.Hook)
 				})
 			case events.Chunk[messages.AssistantMessage]:
 				to.OnAssistantChunk(ctx, messages.Message[messages.AssistantMessage]{
+					MessageID: event.MessageID,
+					RunID:     event.RunID,
+					TurnID:    event.TurnID,
 					Payload:   event.Chunk,
 					Sender:    event.Sender,
 					Timestamp: event.Timestamp,
@@ -152,6 +181,9 @@ func forwardToHook(ctx context.Context, from chan events.Event, to events.Hook)
 				})
 			case events.Chunk[messages.ToolCallMessage]:
 				to.OnToolCallChunk(ctx, messages.Message[messages.ToolCallMessage]{
+					MessageID: event.MessageID,
+					RunID:     event.RunID,
+					TurnID:    event.TurnID,
 					Payload:   event.Chunk,
 					Sender:    event.Sender,
 					Timestamp: event.Timestamp,
@@ -159,6 +191,9 @@ func forwardToHook(ctx context.Context, from chan events.Event, to events.Hook)
 				})
 			case events.Request[messages.ToolResponse]:
 				to.OnToolCallResponse(ctx, messages.Message[messages.ToolResponse]{
+					MessageID: event.MessageID,
+					RunID:     event.RunID,
+					TurnID:    event.TurnID,
 					Payload:   event.Message,
 					Sender:    event.Sender,
 					Timestamp: event.Timestamp,
@@ -166,6 +201,9 @@ func forwardToHook(ctx context.Context, from chan events.Event, to events.Hook)
 				})
 			case events.Response[messages.ToolCallMessage]:
 				to.OnToolCallMessage(ctx, messages.Message[messages.ToolCallMessage]{
+					MessageID: event.MessageID,
+					RunID:     event.RunID,
+					TurnID:    event.TurnID,
 					Payload:   event.Response,
 					Sender:    event.Sender,
 					Timestamp: event.Timestamp,
@@ -173,12 +211,66 @@ func forwardToHook(ctx context.Context, from chan events.Event, to events.Hook)
 				})
 			case events.Response[messages.AssistantMessage]:
 				to.OnAssistantMessage(ctx, messages.Message[messages.AssistantMessage]{
+					MessageID: event.MessageID,
+					RunID:     event.RunID,
+					TurnID:    event.TurnID,
 					Payload:   event.Response,
 					Sender:    event.Sender,
 					Timestamp: event.Timestamp,
 					Meta:      event.Meta,
 				})
-
+			case events.Request[messages.ApprovalRequest]:
+				if ah, ok := to.(events.ApprovalHook); ok {
+					ah.OnApprovalRequest(ctx, messages.Message[messages.ApprovalRequest]{
+						MessageID: event.MessageID,
+						RunID:     event.RunID,
+						TurnID:    event.TurnID,
+						Payload:   event.Message,
+						Sender:    event.Sender,
+						Timestamp: event.Timestamp,
+						Meta:      event.Meta,
+					})
+				}
+			case events.Request[messages.Approval]:
+				if ah, ok := to.(events.ApprovalHook); ok {
+					ah.OnApproval(ctx, messages.Message[messages.Approval]{
+						MessageID: event.MessageID,
+						RunID:     event.RunID,
+						TurnID:    event.TurnID,
+						Payload:   event.Message,
+						Sender:    event.Sender,
+						Timestamp: event.Timestamp,
+						Meta:      event.Meta,
+					})
+				}
+			case events.Request[messages.InstructionsMessage]:
+				if ih, ok := to.(events.InstructionsHook); ok {
+					ih.OnInstructions(ctx, messages.Message[messages.InstructionsMessage]{
+						MessageID: event.MessageID,
+						RunID:     event.RunID,
+						TurnID:    event.TurnID,
+						Payload:   event.Message,
+						Sender:    event.Sender,
+						Timestamp: event.Timestamp,
+						Meta:      event.Meta,
+					})
+				}
+			case events.ContentFilter:
+				if ch, ok := to.(events.ContentFilterHook); ok {
+					ch.OnContentFilter(ctx, event)
+				}
+			case events.Summary:
+				if sh, ok := to.(events.SummaryHook); ok {
+					sh.OnSummary(ctx, event)
+				}
+			case events.Status:
+				if sh, ok := to.(events.StatusHook); ok {
+					sh.OnStatus(ctx, event)
+				}
+			case events.CancelTool:
+				if ch, ok := to.(events.CancelToolHook); ok {
+					ch.OnCancelTool(ctx, event)
+				}
 			case events.Error:
 				to.OnError(ctx, event.Err)
 			default:
@@ -16,6 +16,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
 )
 
 type recordingHook struct {
@@ -450,6 +451,60 @@ func TestTopic(t *testing.T) {
 			recorder.mu.Unlock()
 		}
 	})
+
+	t.Run("applies transformers in order", func(t *testing.T) {
+		var order []string
+		withTenant := func(event events.Event) (events.Event, error) {
+			order = append(order, "tenant")
+			resp := event.(events.Response[messages.AssistantMessage])
+			meta, err := sjson.Set(resp.Meta.Raw, "tenant", "acme")
+			if err != nil {
+				return nil, err
+			}
+			resp.Meta = gjson.Parse(meta)
+			return resp, nil
+		}
+		failing := func(event events.Event) (events.Event, error) {
+			order = append(order, "failing")
+			return nil, errors.New("transformer failed")
+		}
+		withSequence := func(event events.Event) (events.Event, error) {
+			order = append(order, "sequence")
+			resp := event.(events.Response[messages.AssistantMessage])
+			// the tenant is already set by the previous transformer
+			meta, err := sjson.Set(resp.Meta.Raw, "sequence", 1)
+			if err != nil {
+				return nil, err
+			}
+			resp.Meta = gjson.Parse(meta)
+			return resp, nil
+		}
+
+		broker := Local(WithTransformers(withTenant, failing, withSequence))
+		topic := broker.Topic(context.Background(), "test")
+
+		var wg sync.WaitGroup
+		recorder := newRecordingHook()
+		recorder.wg = &wg
+		sub, err := topic.Subscribe(context.Background(), recorder)
+		require.NoError(t, err)
+		defer sub.Unsubscribe()
+
+		wg.Add(1)
+		require.NoError(t, topic.Publish(context.Background(), events.Response[messages.AssistantMessage]{
+			RunID:    uuid.New(),
+			TurnID:   uuid.New(),
+			Response: messages.New().AssistantMessage("hello").Payload,
+			Meta:     gjson.Parse("{}"),
+		}))
+		wg.Wait()
+
+		assert.Equal(t, []string{"tenant", "failing", "sequence"}, order)
+		recorder.mu.Lock()
+		defer recorder.mu.Unlock()
+		require.Len(t, recorder.assistantMessages, 1)
+		assert.JSONEq(t, `{"tenant":"acme","sequence":1}`, recorder.assistantMessages[0].Meta.Raw)
+	})
 }
 
 func TestFromStreamEvent(t *testing.T) {
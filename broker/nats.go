@@ -0,0 +1,175 @@
+package broker
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+
+	"github.com/alphadose/haxmap"
+	"github.com/casualjim/bubo/events"
+	"github.com/casualjim/bubo/internal/shorttermmemory"
+	"github.com/casualjim/bubo/messages"
+	"github.com/casualjim/bubo/pkg/slogx"
+	"github.com/casualjim/bubo/pkg/uuidx"
+	"github.com/nats-io/nats.go"
+)
+
+type Event struct {
+	CompletionChunk events.Chunk[messages.Response]
+	Response        events.Result[any]
+	Message         *shorttermmemory.Checkpoint
+}
+
+const (
+	// contentEncodingHeader is the header that flags a compressed event payload
+	contentEncodingHeader = "Content-Encoding"
+	gzipEncoding          = "gzip"
+)
+
+type natsBroker struct {
+	client       *nats.Conn
+	topics       *haxmap.Map[string, *natsTopic]
+	transformers []events.EventTransformer
+	// compressionThreshold is the payload size from which events are compressed, 0 disables compression
+	compressionThreshold int
+}
+
+func NATS(client *nats.Conn, options ...Option) *natsBroker {
+	cfg := newConfig(options)
+	return &natsBroker{
+		client:               client,
+		topics:               haxmap.New[string, *natsTopic](),
+		transformers:         cfg.transformers,
+		compressionThreshold: cfg.compressionThreshold,
+	}
+}
+
+func (b *natsBroker) Topic(ctx context.Context, id string) Topic {
+	top, _ := b.topics.GetOrCompute(id, func() *natsTopic {
+		return &natsTopic{
+			subject:              id,
+			client:               b.client,
+			transformers:         b.transformers,
+			compressionThreshold: b.compressionThreshold,
+		}
+	})
+	return top
+}
+
+type natsTopic struct {
+	client               *nats.Conn
+	subject              string
+	transformers         []events.EventTransformer
+	compressionThreshold int
+}
+
+func (t *natsTopic) Publish(ctx context.Context, event events.Event) error {
+	eb, err := events.ToJSON(transform(event, t.transformers))
+	if err != nil {
+		return err
+	}
+	msg, err := encodeMsg(t.subject, eb, t.compressionThreshold)
+	if err != nil {
+		return err
+	}
+	return t.client.PublishMsg(msg)
+}
+
+// encodeMsg builds the message for the payload, compressing it when it's at least threshold bytes,
+// a threshold of 0 leaves the payload alone
+func encodeMsg(subject string, payload []byte, threshold int) (*nats.Msg, error) {
+	msg := nats.NewMsg(subject)
+	if threshold == 0 || len(payload) < threshold {
+		msg.Data = payload
+		return msg, nil
+	}
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(payload); err != nil {
+		return nil, fmt.Errorf("failed to compress event: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to compress event: %w", err)
+	}
+	msg.Header.Set(contentEncodingHeader, gzipEncoding)
+	msg.Data = buf.Bytes()
+	return msg, nil
+}
+
+// decodeMsg returns the payload of the message, decompressing it when it's flagged as compressed
+func decodeMsg(msg *nats.Msg) ([]byte, error) {
+	if msg.Header.Get(contentEncodingHeader) != gzipEncoding {
+		return msg.Data, nil
+	}
+
+	zr, err := gzip.NewReader(bytes.NewReader(msg.Data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress event: %w", err)
+	}
+	defer zr.Close()
+
+	payload, err := io.ReadAll(zr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress event: %w", err)
+	}
+	return payload, nil
+}
+
+func (t *natsTopic) Subscribe(ctx context.Context, hook events.Hook) (Subscription, error) {
+	if hook == nil {
+		return nil, fmt.Errorf("hook is required")
+	}
+	sub := make(chan events.Event, 50)
+	nsub, err := t.client.Subscribe(t.subject, func(msg *nats.Msg) {
+		payload, err := decodeMsg(msg)
+		if err != nil {
+			slog.Error("failed to decode event", slogx.Error(err))
+			return
+		}
+
+		event, err := events.FromJSON(payload)
+		if err != nil {
+			slog.Error("failed to unmarshal event", slogx.Error(err))
+			return
+		}
+
+		sub <- event
+
+		if msg.Reply != "" {
+			if nerr := msg.Ack(); nerr != nil {
+				slog.Error("failed to ack message", slogx.Error(nerr))
+				return
+			}
+		}
+	})
+
+	nsub.SetClosedHandler(func(_ string) { close(sub) })
+	if err != nil {
+		return nil, err
+	}
+
+	go forwardToHook(ctx, sub, hook)
+	return &natsSubscription{
+		id:  uuidx.NewString(),
+		sub: nsub,
+	}, nil
+}
+
+type natsSubscription struct {
+	id  string
+	sub *nats.Subscription
+}
+
+func (n *natsSubscription) ID() string {
+	return n.id
+}
+
+func (n *natsSubscription) Unsubscribe() {
+	if err := n.sub.Unsubscribe(); err != nil {
+		slog.Error("failed to unsubscribe", slogx.Error(err), slog.String("subscription", n.id))
+	}
+}
@@ -3,6 +3,7 @@ package broker
 import (
 	"context"
 	"fmt"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -236,6 +237,56 @@ func TestNATSTopic(t *testing.T) {
 		recorder.mu.Unlock()
 	})
 
+	t.Run("round-trips compressed large events", func(t *testing.T) {
+		nc := setupNATS(t)
+		broker := NATS(nc, WithCompression(DefaultCompressionThreshold))
+		topic := broker.Topic(context.Background(), "test-compressed")
+		ctx := context.Background()
+
+		raw, err := nc.SubscribeSync("test-compressed")
+		require.NoError(t, err)
+		defer func() { _ = raw.Unsubscribe() }()
+
+		var wg sync.WaitGroup
+		wg.Add(1)
+		recorder := newRecordingHook()
+		recorder.wg = &wg
+		sub, err := topic.Subscribe(ctx, recorder)
+		require.NoError(t, err)
+		defer sub.Unsubscribe()
+		recorder.signalReady()
+
+		content := strings.Repeat("a large payload ", 1024)
+		msg := messages.New().AssistantMessage(content)
+		err = topic.Publish(ctx, events.Response[messages.AssistantMessage]{
+			RunID:    uuid.New(),
+			TurnID:   uuid.New(),
+			Response: msg.Payload,
+		})
+		require.NoError(t, err)
+
+		wire, err := raw.NextMsg(2 * time.Second)
+		require.NoError(t, err)
+		assert.Equal(t, "gzip", wire.Header.Get("Content-Encoding"))
+		assert.Less(t, len(wire.Data), len(content))
+
+		done := make(chan struct{})
+		go func() {
+			wg.Wait()
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(2 * time.Second):
+			t.Fatal("timeout waiting for the compressed event")
+		}
+
+		recorder.mu.Lock()
+		defer recorder.mu.Unlock()
+		require.Len(t, recorder.assistantMessages, 1)
+		assert.Equal(t, content, recorder.assistantMessages[0].Payload.Content.Content)
+	})
+
 	t.Run("handles concurrent operations", func(t *testing.T) {
 		nc := setupNATS(t)
 		broker := NATS(nc)
@@ -293,3 +344,48 @@ func TestNATSTopic(t *testing.T) {
 		}
 	})
 }
+
+func TestNATSMessageCompression(t *testing.T) {
+	payload := []byte(strings.Repeat(`{"content":"a large payload"}`, 100))
+
+	t.Run("compresses large payloads", func(t *testing.T) {
+		msg, err := encodeMsg("test", payload, DefaultCompressionThreshold)
+		require.NoError(t, err)
+		assert.Equal(t, gzipEncoding, msg.Header.Get(contentEncodingHeader))
+		assert.Less(t, len(msg.Data), len(payload))
+
+		decoded, err := decodeMsg(msg)
+		require.NoError(t, err)
+		assert.Equal(t, payload, decoded)
+	})
+
+	t.Run("leaves small payloads alone", func(t *testing.T) {
+		msg, err := encodeMsg("test", []byte(`{}`), DefaultCompressionThreshold)
+		require.NoError(t, err)
+		assert.Empty(t, msg.Header.Get(contentEncodingHeader))
+		assert.Equal(t, []byte(`{}`), msg.Data)
+	})
+
+	t.Run("leaves payloads alone when disabled", func(t *testing.T) {
+		msg, err := encodeMsg("test", payload, 0)
+		require.NoError(t, err)
+		assert.Empty(t, msg.Header.Get(contentEncodingHeader))
+		assert.Equal(t, payload, msg.Data)
+	})
+
+	t.Run("uses the configured threshold", func(t *testing.T) {
+		msg, err := encodeMsg("test", []byte(`{"content":"small"}`), 16)
+		require.NoError(t, err)
+		assert.Equal(t, gzipEncoding, msg.Header.Get(contentEncodingHeader))
+
+		msg, err = encodeMsg("test", payload, len(payload)+1)
+		require.NoError(t, err)
+		assert.Empty(t, msg.Header.Get(contentEncodingHeader))
+	})
+
+	t.Run("replaces a threshold that isn't positive", func(t *testing.T) {
+		var b *natsBroker
+		require.NotPanics(t, func() { b = NATS(nil, WithCompression(0)) })
+		assert.Equal(t, DefaultCompressionThreshold, b.compressionThreshold)
+	})
+}
@@ -0,0 +1,46 @@
+package broker
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/casualjim/bubo/events"
+	"github.com/casualjim/bubo/pkg/uuidx"
+)
+
+// NewNoop returns a broker that discards every event that is published to it, for runs whose
+// result is only read from the future. Subscriptions never receive events, unsubscribing is a no-op.
+//
+// Example:
+//
+//	result, err := bubo.RunOnce[string](ctx, agent, "hello", bubo.WithBroker(broker.NewNoop()))
+func NewNoop() Broker {
+	return noopBroker{}
+}
+
+type noopBroker struct{}
+
+func (noopBroker) Topic(context.Context, string) Topic {
+	return noopTopic{}
+}
+
+type noopTopic struct{}
+
+func (noopTopic) Publish(context.Context, events.Event) error {
+	return nil
+}
+
+func (noopTopic) Subscribe(_ context.Context, hook events.Hook) (Subscription, error) {
+	if hook == nil {
+		return nil, fmt.Errorf("hook is required")
+	}
+	return noopSubscription(uuidx.NewString()), nil
+}
+
+type noopSubscription string
+
+func (s noopSubscription) ID() string {
+	return string(s)
+}
+
+func (noopSubscription) Unsubscribe() {}
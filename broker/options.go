@@ -0,0 +1,65 @@
+package broker
+
+import (
+	"log/slog"
+
+	"github.com/casualjim/bubo/events"
+	"github.com/casualjim/bubo/pkg/slogx"
+	"github.com/fogfish/opts"
+)
+
+// config holds the settings that are shared by the broker implementations
+type config struct {
+	transformers         []events.EventTransformer
+	compressionThreshold int
+}
+
+// Option configures a broker when it's created.
+type Option = opts.Option[config]
+
+// WithTransformers configures the transformers that are applied, in order, to every published event.
+// A failing transformer is logged and skipped, the event is published without its changes.
+//
+// Example:
+//
+//	b := broker.Local(broker.WithTransformers(addTenant, redactSecrets))
+func WithTransformers(transformers ...events.EventTransformer) Option {
+	return opts.Type[config](func(c *config) error {
+		c.transformers = append(c.transformers, transformers...)
+		return nil
+	})
+}
+
+// DefaultCompressionThreshold is a compression threshold that leaves small events like stream chunks alone,
+// they don't benefit from compression.
+const DefaultCompressionThreshold = 1024
+
+// WithCompression gzips the JSON payload of the events that are at least threshold bytes before they're
+// published, subscribers decompress them transparently. A threshold that isn't positive is logged
+// and replaced by DefaultCompressionThreshold.
+// Only the NATS broker sends events over the wire, the local broker ignores this option.
+//
+// Example:
+//
+//	b := broker.NATS(conn, broker.WithCompression(broker.DefaultCompressionThreshold))
+func WithCompression(threshold int) Option {
+	return opts.Type[config](func(c *config) error {
+		if threshold <= 0 {
+			slog.Warn("compression threshold must be positive, using the default", slog.Int("threshold", threshold), slog.Int("default", DefaultCompressionThreshold))
+			threshold = DefaultCompressionThreshold
+		}
+		c.compressionThreshold = threshold
+		return nil
+	})
+}
+
+// newConfig applies the options, the ones that fail are logged and skipped so creating a broker never fails
+func newConfig(options []Option) config {
+	var cfg config
+	for _, option := range options {
+		if err := opts.Apply(&cfg, []Option{option}); err != nil {
+			slog.Error("failed to apply broker option", slogx.Error(err))
+		}
+	}
+	return cfg
+}
@@ -0,0 +1,211 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	"github.com/casualjim/bubo/events"
+	"github.com/casualjim/bubo/messages"
+	"github.com/casualjim/bubo/pkg/slogx"
+	"github.com/google/uuid"
+)
+
+// Publisher returns a hook that publishes every event it receives to the topic of its run on the broker,
+// the topic is named after the run ID. The events are passed on to next as well, including the approval,
+// instructions, content filter and summary events when next implements the hooks for them.
+// Publishing failures are logged, they don't interrupt the run.
+func Publisher(b Broker, next events.Hook) events.Hook {
+	return RoutedPublisher(b, ByRun, next)
+}
+
+// RoutedPublisher returns a hook like Publisher that publishes every event to the topic picked by the router.
+func RoutedPublisher(b Broker, router TopicRouter, next events.Hook) events.Hook {
+	if router == nil {
+		router = ByRun
+	}
+	return &publisher{broker: b, router: router, next: next}
+}
+
+type publisher struct {
+	broker Broker
+	router TopicRouter
+	next   events.Hook
+}
+
+var (
+	_ events.Hook              = (*publisher)(nil)
+	_ events.ApprovalHook      = (*publisher)(nil)
+	_ events.InstructionsHook  = (*publisher)(nil)
+	_ events.ContentFilterHook = (*publisher)(nil)
+	_ events.SummaryHook       = (*publisher)(nil)
+	_ events.CancelToolHook    = (*publisher)(nil)
+	_ events.CheckpointHook    = (*publisher)(nil)
+)
+
+func (p *publisher) publish(ctx context.Context, runID uuid.UUID, event events.Event) {
+	if err := p.broker.Topic(ctx, p.router(runID, event)).Publish(ctx, event); err != nil {
+		slog.ErrorContext(ctx, "failed to publish event", slogx.Error(err), slog.String("run_id", runID.String()))
+	}
+}
+
+func request[T interface {
+	messages.Request
+	messages.ModelMessage
+}](msg messages.Message[T]) events.Request[T] {
+	return events.Request[T]{
+		MessageID: msg.MessageID,
+		RunID:     msg.RunID,
+		TurnID:    msg.TurnID,
+		Message:   msg.Payload,
+		Sender:    msg.Sender,
+		Timestamp: msg.Timestamp,
+		Meta:      msg.Meta,
+	}
+}
+
+func response[T interface {
+	messages.Response
+	messages.ModelMessage
+}](msg messages.Message[T]) events.Response[T] {
+	return events.Response[T]{
+		MessageID: msg.MessageID,
+		RunID:     msg.RunID,
+		TurnID:    msg.TurnID,
+		Response:  msg.Payload,
+		Sender:    msg.Sender,
+		Timestamp: msg.Timestamp,
+		Meta:      msg.Meta,
+	}
+}
+
+func chunk[T interface {
+	messages.Response
+	messages.ModelMessage
+}](msg messages.Message[T]) events.Chunk[T] {
+	return events.Chunk[T]{
+		MessageID: msg.MessageID,
+		RunID:     msg.RunID,
+		TurnID:    msg.TurnID,
+		Chunk:     msg.Payload,
+		Sender:    msg.Sender,
+		Timestamp: msg.Timestamp,
+		Meta:      msg.Meta,
+	}
+}
+
+func (p *publisher) OnUserPrompt(ctx context.Context, msg messages.Message[messages.UserMessage]) {
+	p.publish(ctx, msg.RunID, request(msg))
+	p.next.OnUserPrompt(ctx, msg)
+}
+
+func (p *publisher) OnAssistantChunk(ctx context.Context, msg messages.Message[messages.AssistantMessage]) {
+	p.publish(ctx, msg.RunID, chunk(msg))
+	p.next.OnAssistantChunk(ctx, msg)
+}
+
+func (p *publisher) OnToolCallChunk(ctx context.Context, msg messages.Message[messages.ToolCallMessage]) {
+	p.publish(ctx, msg.RunID, chunk(msg))
+	p.next.OnToolCallChunk(ctx, msg)
+}
+
+func (p *publisher) OnAssistantMessage(ctx context.Context, msg messages.Message[messages.AssistantMessage]) {
+	p.publish(ctx, msg.RunID, response(msg))
+	p.next.OnAssistantMessage(ctx, msg)
+}
+
+func (p *publisher) OnToolCallMessage(ctx context.Context, msg messages.Message[messages.ToolCallMessage]) {
+	p.publish(ctx, msg.RunID, response(msg))
+	p.next.OnToolCallMessage(ctx, msg)
+}
+
+func (p *publisher) OnToolCallResponse(ctx context.Context, msg messages.Message[messages.ToolResponse]) {
+	p.publish(ctx, msg.RunID, request(msg))
+	p.next.OnToolCallResponse(ctx, msg)
+}
+
+func (p *publisher) OnApprovalRequest(ctx context.Context, msg messages.Message[messages.ApprovalRequest]) {
+	p.publish(ctx, msg.RunID, request(msg))
+	if ah, ok := p.next.(events.ApprovalHook); ok {
+		ah.OnApprovalRequest(ctx, msg)
+	}
+}
+
+func (p *publisher) OnApproval(ctx context.Context, msg messages.Message[messages.Approval]) {
+	p.publish(ctx, msg.RunID, request(msg))
+	if ah, ok := p.next.(events.ApprovalHook); ok {
+		ah.OnApproval(ctx, msg)
+	}
+}
+
+func (p *publisher) OnInstructions(ctx context.Context, msg messages.Message[messages.InstructionsMessage]) {
+	p.publish(ctx, msg.RunID, request(msg))
+	if ih, ok := p.next.(events.InstructionsHook); ok {
+		ih.OnInstructions(ctx, msg)
+	}
+}
+
+func (p *publisher) OnContentFilter(ctx context.Context, event events.ContentFilter) {
+	p.publish(ctx, event.RunID, event)
+	if ch, ok := p.next.(events.ContentFilterHook); ok {
+		ch.OnContentFilter(ctx, event)
+	}
+}
+
+func (p *publisher) OnSummary(ctx context.Context, event events.Summary) {
+	p.publish(ctx, event.RunID, event)
+	if sh, ok := p.next.(events.SummaryHook); ok {
+		sh.OnSummary(ctx, event)
+	}
+}
+
+func (p *publisher) OnStatus(ctx context.Context, event events.Status) {
+	p.publish(ctx, event.RunID, event)
+	if sh, ok := p.next.(events.StatusHook); ok {
+		sh.OnStatus(ctx, event)
+	}
+}
+
+func (p *publisher) OnCancelTool(ctx context.Context, event events.CancelTool) {
+	p.publish(ctx, event.RunID, event)
+	if ch, ok := p.next.(events.CancelToolHook); ok {
+		ch.OnCancelTool(ctx, event)
+	}
+}
+
+// OnRequest isn't published, the request holds the tools of the agent which can't be serialized
+func (p *publisher) OnRequest(ctx context.Context, runID, turnID uuid.UUID, request events.CompletionRequest) {
+	if rh, ok := p.next.(events.RequestHook); ok {
+		rh.OnRequest(ctx, runID, turnID, request)
+	}
+}
+
+// OnToolAudit isn't published, the subscribers of the topic see the tool calls and their responses
+func (p *publisher) OnToolAudit(ctx context.Context, record events.ToolAuditRecord) {
+	if ah, ok := p.next.(events.ToolAuditHook); ok {
+		ah.OnToolAudit(ctx, record)
+	}
+}
+
+// OnCancel isn't published, the subscribers of the topic only see the error of the run
+// OnCheckpoint isn't published, the checkpoint is passed on in the encoding of its codec
+func (p *publisher) OnCheckpoint(ctx context.Context, runID, turnID uuid.UUID, checkpoint []byte) {
+	if ch, ok := p.next.(events.CheckpointHook); ok {
+		ch.OnCheckpoint(ctx, runID, turnID, checkpoint)
+	}
+}
+
+func (p *publisher) OnCancel(ctx context.Context, runID uuid.UUID, reason string) {
+	if ch, ok := p.next.(events.CancelHook); ok {
+		ch.OnCancel(ctx, runID, reason)
+	}
+}
+
+func (p *publisher) OnError(ctx context.Context, err error) {
+	// only errors of a run can be routed to its topic
+	var event events.Error
+	if errors.As(err, &event) {
+		p.publish(ctx, event.RunID, event)
+	}
+	p.next.OnError(ctx, err)
+}
@@ -0,0 +1,112 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/casualjim/bubo/events"
+	"github.com/casualjim/bubo/messages"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type topicRecorder struct {
+	mu     sync.Mutex
+	topics map[string][]events.Event
+}
+
+func (r *topicRecorder) Topic(_ context.Context, name string) Topic {
+	return &recordedTopic{recorder: r, name: name}
+}
+
+type recordedTopic struct {
+	Topic
+	recorder *topicRecorder
+	name     string
+}
+
+func (t *recordedTopic) Publish(_ context.Context, event events.Event) error {
+	t.recorder.mu.Lock()
+	defer t.recorder.mu.Unlock()
+	if t.recorder.topics == nil {
+		t.recorder.topics = make(map[string][]events.Event)
+	}
+	t.recorder.topics[t.name] = append(t.recorder.topics[t.name], event)
+	return nil
+}
+
+type discardHook struct{ events.Hook }
+
+func (discardHook) OnAssistantMessage(context.Context, messages.Message[messages.AssistantMessage]) {}
+func (discardHook) OnError(context.Context, error)                                                  {}
+
+func TestRoutedPublisher(t *testing.T) {
+	runID := uuid.New()
+	result := messages.New().WithRunID(runID).AssistantMessage("done")
+	failure := events.Error{RunID: runID, Err: errors.New("boom")}
+
+	t.Run("routes the events to their topics", func(t *testing.T) {
+		rec := &topicRecorder{}
+		hook := RoutedPublisher(rec, func(runID uuid.UUID, event events.Event) string {
+			if _, ok := event.(events.Error); ok {
+				return runID.String() + ".errors"
+			}
+			return runID.String() + ".results"
+		}, discardHook{})
+
+		hook.OnAssistantMessage(context.Background(), result)
+		hook.OnError(context.Background(), failure)
+
+		require.Len(t, rec.topics, 2)
+		require.Len(t, rec.topics[runID.String()+".results"], 1)
+		assert.IsType(t, events.Response[messages.AssistantMessage]{}, rec.topics[runID.String()+".results"][0])
+		require.Len(t, rec.topics[runID.String()+".errors"], 1)
+		assert.Equal(t, failure, rec.topics[runID.String()+".errors"][0])
+	})
+
+	t.Run("publishes to the topic of the run by default", func(t *testing.T) {
+		rec := &topicRecorder{}
+		hook := Publisher(rec, discardHook{})
+
+		hook.OnAssistantMessage(context.Background(), result)
+		hook.OnError(context.Background(), failure)
+
+		require.Len(t, rec.topics, 1)
+		assert.Len(t, rec.topics[runID.String()], 2)
+	})
+}
+
+func TestPublisherKeepsMessageIDs(t *testing.T) {
+	runID := uuid.New()
+	prompt := messages.New().WithRunID(runID).UserPrompt("hello")
+	chunk := messages.New().WithRunID(runID).AssistantMessage("do")
+	result := messages.New().WithRunID(runID).AssistantMessage("done")
+
+	b := Local()
+	var wg sync.WaitGroup
+	recorder := newRecordingHook()
+	recorder.wg = &wg
+	sub, err := b.Topic(context.Background(), runID.String()).Subscribe(context.Background(), recorder)
+	require.NoError(t, err)
+	defer sub.Unsubscribe()
+
+	wg.Add(3)
+	hook := Publisher(b, newRecordingHook())
+	hook.OnUserPrompt(context.Background(), prompt)
+	hook.OnAssistantChunk(context.Background(), chunk)
+	hook.OnAssistantMessage(context.Background(), result)
+	wg.Wait()
+
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	require.Len(t, recorder.userPrompts, 1)
+	assert.Equal(t, prompt.MessageID, recorder.userPrompts[0].MessageID)
+	require.Len(t, recorder.assistantChunks, 1)
+	assert.Equal(t, chunk.MessageID, recorder.assistantChunks[0].MessageID)
+	require.Len(t, recorder.assistantMessages, 1)
+	assert.Equal(t, result.MessageID, recorder.assistantMessages[0].MessageID)
+	assert.Equal(t, runID, recorder.assistantMessages[0].RunID)
+}
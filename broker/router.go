@@ -0,0 +1,25 @@
+package broker
+
+import (
+	"github.com/casualjim/bubo/events"
+	"github.com/google/uuid"
+)
+
+// TopicRouter picks the name of the topic an event of a run is published to.
+// It lets consumers subscribe to the kinds of events they care about, for example
+// errors on one topic and chunks on another.
+//
+// Example:
+//
+//	func(runID uuid.UUID, event events.Event) string {
+//	    if _, ok := event.(events.Error); ok {
+//	        return "errors"
+//	    }
+//	    return runID.String()
+//	}
+type TopicRouter func(runID uuid.UUID, event events.Event) string
+
+// ByRun publishes all the events of a run to the topic named after the run ID, it's the default router.
+func ByRun(runID uuid.UUID, _ events.Event) string {
+	return runID.String()
+}
@@ -0,0 +1,108 @@
+package events
+
+import (
+	"fmt"
+
+	"github.com/casualjim/bubo/messages"
+	"github.com/go-openapi/strfmt"
+	"github.com/google/uuid"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+var cancelToolJSON = []byte(`{"type":"cancel_tool"}`)
+
+// CancelTool asks the executor of a run to abort a tool call that is still running.
+// The tool's context is cancelled and the model is told the call was cancelled,
+// the run itself carries on.
+type CancelTool struct {
+	RunID      uuid.UUID `json:"run_id"`
+	ToolCallID string    `json:"tool_call_id"`
+	// Reason is passed on to the model in the tool response, when set.
+	Reason    string          `json:"reason,omitempty"`
+	Sender    string          `json:"sender,omitempty"`
+	Timestamp strfmt.DateTime `json:"timestamp,omitempty"`
+}
+
+func (CancelTool) pubsubEvent() {}
+
+// MarshalJSON implements custom JSON marshaling for CancelTool
+func (c CancelTool) MarshalJSON() ([]byte, error) {
+	result := cancelToolJSON
+
+	var err error
+	result, err = sjson.SetBytes(result, "run_id", c.RunID.String())
+	if err != nil {
+		return nil, err
+	}
+
+	result, err = sjson.SetBytes(result, "tool_call_id", c.ToolCallID)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.Reason != "" {
+		result, err = sjson.SetBytes(result, "reason", c.Reason)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if c.Sender != "" {
+		result, err = sjson.SetBytes(result, "sender", c.Sender)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if !c.Timestamp.IsZero() {
+		result, err = sjson.SetBytes(result, "timestamp", messages.MarshalTimestamp(c.Timestamp))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+// UnmarshalJSON implements custom JSON unmarshaling for CancelTool
+func (c *CancelTool) UnmarshalJSON(data []byte) error {
+	if !gjson.ValidBytes(data) {
+		return fmt.Errorf("invalid json: %s", data)
+	}
+
+	msgType := gjson.GetBytes(data, "type")
+	if !msgType.Exists() || msgType.String() != "cancel_tool" {
+		return fmt.Errorf("missing or invalid type, expected 'cancel_tool'")
+	}
+
+	runID := gjson.GetBytes(data, "run_id")
+	if !runID.Exists() {
+		return fmt.Errorf("missing required field 'run_id'")
+	}
+	if err := c.RunID.UnmarshalText([]byte(runID.String())); err != nil {
+		return fmt.Errorf("invalid run_id: %w", err)
+	}
+
+	toolCallID := gjson.GetBytes(data, "tool_call_id")
+	if !toolCallID.Exists() {
+		return fmt.Errorf("missing required field 'tool_call_id'")
+	}
+	c.ToolCallID = toolCallID.String()
+
+	if reason := gjson.GetBytes(data, "reason"); reason.Exists() {
+		c.Reason = reason.String()
+	}
+
+	if sender := gjson.GetBytes(data, "sender"); sender.Exists() {
+		c.Sender = sender.String()
+	}
+
+	if timestamp := gjson.GetBytes(data, "timestamp"); timestamp.Exists() {
+		if err := messages.UnmarshalTimestamp(timestamp, &c.Timestamp); err != nil {
+			return fmt.Errorf("invalid timestamp: %w", err)
+		}
+	}
+
+	return nil
+}
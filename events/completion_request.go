@@ -0,0 +1,15 @@
+package events
+
+import (
+	"github.com/casualjim/bubo/messages"
+	"github.com/casualjim/bubo/tool"
+)
+
+// CompletionRequest is what the executor sends to the provider for a turn: the rendered
+// instructions of the agent, the messages of the thread and the tools the model can call.
+type CompletionRequest struct {
+	Model        string
+	Instructions string
+	Messages     []messages.Message[messages.ModelMessage]
+	Tools        []tool.Definition
+}
@@ -0,0 +1,258 @@
+// Package eventstest provides helpers to assert on the events of a run in tests.
+package eventstest
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/casualjim/bubo/events"
+	"github.com/casualjim/bubo/messages"
+	"github.com/go-openapi/strfmt"
+)
+
+// Collector is a hook that records every event of a run.
+// It implements bubo.Hook[T], so it can be passed to an execution context directly:
+//
+//	collector := eventstest.NewCollector[string]()
+//	err := knot.Run(ctx, bubo.Local[string](collector))
+//	evts, err := collector.Events(ctx)
+type Collector[T any] struct {
+	mu     sync.Mutex
+	events []collected
+	audits []events.ToolAuditRecord
+	reason string
+	done   chan struct{}
+	once   sync.Once
+}
+
+type collected struct {
+	at    time.Time
+	event events.Event
+}
+
+// NewCollector creates a collector for a run that produces a result of type T.
+func NewCollector[T any]() *Collector[T] {
+	return &Collector[T]{done: make(chan struct{})}
+}
+
+// Events waits for the run to complete and returns all the events it produced, sorted by timestamp.
+// Events that happened at the same time keep the order in which they were received.
+// A run is complete when it produced a result or was closed, an execution context closes the hook
+// when the run ends, also when it failed. The errors that are reported during the run don't complete it.
+func (c *Collector[T]) Events(ctx context.Context) ([]events.Event, error) {
+	select {
+	case <-c.done:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	c.mu.Lock()
+	sorted := slices.Clone(c.events)
+	c.mu.Unlock()
+
+	slices.SortStableFunc(sorted, func(a, b collected) int {
+		return a.at.Compare(b.at)
+	})
+
+	result := make([]events.Event, len(sorted))
+	for i, e := range sorted {
+		result[i] = e.event
+	}
+	return result, nil
+}
+
+// ToolAudits returns the audit records of the tool calls that were received so far.
+func (c *Collector[T]) ToolAudits() []events.ToolAuditRecord {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return slices.Clone(c.audits)
+}
+
+func (c *Collector[T]) record(ts strfmt.DateTime, event events.Event) {
+	at := time.Time(ts)
+	if at.IsZero() {
+		at = time.Now()
+	}
+	c.mu.Lock()
+	c.events = append(c.events, collected{at: at, event: event})
+	c.mu.Unlock()
+}
+
+func (c *Collector[T]) complete() {
+	c.once.Do(func() { close(c.done) })
+}
+
+func (c *Collector[T]) OnUserPrompt(_ context.Context, msg messages.Message[messages.UserMessage]) {
+	c.record(msg.Timestamp, events.Request[messages.UserMessage]{
+		MessageID: msg.MessageID,
+		RunID:     msg.RunID,
+		TurnID:    msg.TurnID,
+		Message:   msg.Payload,
+		Sender:    msg.Sender,
+		Timestamp: msg.Timestamp,
+		Meta:      msg.Meta,
+	})
+}
+
+func (c *Collector[T]) OnAssistantChunk(_ context.Context, msg messages.Message[messages.AssistantMessage]) {
+	c.record(msg.Timestamp, events.Chunk[messages.AssistantMessage]{
+		MessageID: msg.MessageID,
+		RunID:     msg.RunID,
+		TurnID:    msg.TurnID,
+		Chunk:     msg.Payload,
+		Sender:    msg.Sender,
+		Timestamp: msg.Timestamp,
+		Meta:      msg.Meta,
+	})
+}
+
+func (c *Collector[T]) OnToolCallChunk(_ context.Context, msg messages.Message[messages.ToolCallMessage]) {
+	c.record(msg.Timestamp, events.Chunk[messages.ToolCallMessage]{
+		MessageID: msg.MessageID,
+		RunID:     msg.RunID,
+		TurnID:    msg.TurnID,
+		Chunk:     msg.Payload,
+		Sender:    msg.Sender,
+		Timestamp: msg.Timestamp,
+		Meta:      msg.Meta,
+	})
+}
+
+func (c *Collector[T]) OnAssistantMessage(_ context.Context, msg messages.Message[messages.AssistantMessage]) {
+	c.record(msg.Timestamp, events.Response[messages.AssistantMessage]{
+		MessageID: msg.MessageID,
+		RunID:     msg.RunID,
+		TurnID:    msg.TurnID,
+		Response:  msg.Payload,
+		Sender:    msg.Sender,
+		Timestamp: msg.Timestamp,
+		Meta:      msg.Meta,
+	})
+}
+
+func (c *Collector[T]) OnToolCallMessage(_ context.Context, msg messages.Message[messages.ToolCallMessage]) {
+	c.record(msg.Timestamp, events.Response[messages.ToolCallMessage]{
+		MessageID: msg.MessageID,
+		RunID:     msg.RunID,
+		TurnID:    msg.TurnID,
+		Response:  msg.Payload,
+		Sender:    msg.Sender,
+		Timestamp: msg.Timestamp,
+		Meta:      msg.Meta,
+	})
+}
+
+func (c *Collector[T]) OnToolCallResponse(_ context.Context, msg messages.Message[messages.ToolResponse]) {
+	c.record(msg.Timestamp, events.Request[messages.ToolResponse]{
+		MessageID: msg.MessageID,
+		RunID:     msg.RunID,
+		TurnID:    msg.TurnID,
+		Message:   msg.Payload,
+		Sender:    msg.Sender,
+		Timestamp: msg.Timestamp,
+		Meta:      msg.Meta,
+	})
+}
+
+func (c *Collector[T]) OnApprovalRequest(_ context.Context, msg messages.Message[messages.ApprovalRequest]) {
+	c.record(msg.Timestamp, events.Request[messages.ApprovalRequest]{
+		MessageID: msg.MessageID,
+		RunID:     msg.RunID,
+		TurnID:    msg.TurnID,
+		Message:   msg.Payload,
+		Sender:    msg.Sender,
+		Timestamp: msg.Timestamp,
+		Meta:      msg.Meta,
+	})
+}
+
+func (c *Collector[T]) OnApproval(_ context.Context, msg messages.Message[messages.Approval]) {
+	c.record(msg.Timestamp, events.Request[messages.Approval]{
+		MessageID: msg.MessageID,
+		RunID:     msg.RunID,
+		TurnID:    msg.TurnID,
+		Message:   msg.Payload,
+		Sender:    msg.Sender,
+		Timestamp: msg.Timestamp,
+		Meta:      msg.Meta,
+	})
+}
+
+func (c *Collector[T]) OnInstructions(_ context.Context, msg messages.Message[messages.InstructionsMessage]) {
+	c.record(msg.Timestamp, events.Request[messages.InstructionsMessage]{
+		MessageID: msg.MessageID,
+		RunID:     msg.RunID,
+		TurnID:    msg.TurnID,
+		Message:   msg.Payload,
+		Sender:    msg.Sender,
+		Timestamp: msg.Timestamp,
+		Meta:      msg.Meta,
+	})
+}
+
+func (c *Collector[T]) OnContentFilter(_ context.Context, filter events.ContentFilter) {
+	c.record(filter.Timestamp, filter)
+}
+
+func (c *Collector[T]) OnSummary(_ context.Context, summary events.Summary) {
+	c.record(summary.Timestamp, summary)
+}
+
+func (c *Collector[T]) OnStatus(_ context.Context, status events.Status) {
+	c.record(status.Timestamp, status)
+}
+
+func (c *Collector[T]) OnCancelTool(_ context.Context, cancel events.CancelTool) {
+	c.record(cancel.Timestamp, cancel)
+}
+
+// OnToolAudit keeps the audit record, they aren't events so they're returned by ToolAudits.
+func (c *Collector[T]) OnToolAudit(_ context.Context, record events.ToolAuditRecord) {
+	c.mu.Lock()
+	c.audits = append(c.audits, record)
+	c.mu.Unlock()
+}
+
+func (c *Collector[T]) OnError(_ context.Context, err error) {
+	var event events.Error
+	if !errors.As(err, &event) {
+		event = events.Error{Err: err, Timestamp: strfmt.DateTime(time.Now())}
+	}
+	c.record(event.Timestamp, event)
+}
+
+// OnFinishReason keeps the finish reason for the result of the run.
+func (c *Collector[T]) OnFinishReason(_ context.Context, reason string) {
+	c.mu.Lock()
+	c.reason = reason
+	c.mu.Unlock()
+}
+
+func (c *Collector[T]) OnResult(_ context.Context, result T) {
+	ts := strfmt.DateTime(time.Now())
+	c.mu.Lock()
+	reason := c.reason
+	c.mu.Unlock()
+	c.record(ts, events.Result[T]{Result: result, FinishReason: reason, Timestamp: ts})
+	c.complete()
+}
+
+// OnClose marks the run as complete, even when it didn't produce a result.
+func (c *Collector[T]) OnClose(context.Context) {
+	c.complete()
+}
+
+var (
+	_ events.Hook              = (*Collector[string])(nil)
+	_ events.ApprovalHook      = (*Collector[string])(nil)
+	_ events.InstructionsHook  = (*Collector[string])(nil)
+	_ events.ContentFilterHook = (*Collector[string])(nil)
+	_ events.SummaryHook       = (*Collector[string])(nil)
+	_ events.StatusHook        = (*Collector[string])(nil)
+	_ events.CancelToolHook    = (*Collector[string])(nil)
+	_ events.ToolAuditHook     = (*Collector[string])(nil)
+	_ events.FinishReasonHook  = (*Collector[string])(nil)
+)
@@ -0,0 +1,134 @@
+package eventstest_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/casualjim/bubo"
+	"github.com/casualjim/bubo/agent"
+	"github.com/casualjim/bubo/events"
+	"github.com/casualjim/bubo/events/eventstest"
+	"github.com/casualjim/bubo/internal/mocks"
+	"github.com/casualjim/bubo/messages"
+	"github.com/casualjim/bubo/provider"
+	"github.com/go-openapi/strfmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCollector(t *testing.T) {
+	prov := mocks.NewProvider(t)
+	prov.EXPECT().ChatCompletion(mock.Anything, mock.Anything).RunAndReturn(
+		func(_ context.Context, params provider.CompletionParams) (<-chan provider.StreamEvent, error) {
+			ch := make(chan provider.StreamEvent, 2)
+			ch <- provider.Chunk[messages.AssistantMessage]{
+				RunID:     params.RunID,
+				TurnID:    params.Thread.ID(),
+				Chunk:     messages.AssistantMessage{Content: messages.AssistantContentOrParts{Content: "Hello"}},
+				Timestamp: strfmt.DateTime(time.Now()),
+			}
+			ch <- provider.Response[messages.AssistantMessage]{
+				RunID:     params.RunID,
+				TurnID:    params.Thread.ID(),
+				Response:  messages.AssistantMessage{Content: messages.AssistantContentOrParts{Content: "Hello there"}},
+				Timestamp: strfmt.DateTime(time.Now()),
+			}
+			close(ch)
+			return ch, nil
+		})
+	model := mocks.NewModel(t)
+	model.EXPECT().Name().Return("test-model").Maybe()
+	model.EXPECT().Provider().Return(prov)
+
+	greeter := agent.New(agent.Name("greeter"), agent.Model(model), agent.Instructions("You greet people"))
+	knot := bubo.New(bubo.Agents(greeter), bubo.Steps(bubo.Step("greeter", "Say hello")))
+
+	collector := eventstest.NewCollector[string]()
+	require.NoError(t, knot.Run(context.Background(), bubo.Local[string](collector)))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	evts, err := collector.Events(ctx)
+	require.NoError(t, err)
+
+	require.Len(t, evts, 6)
+	prompt, ok := evts[0].(events.Request[messages.UserMessage])
+	require.True(t, ok, "expected a user prompt, got %T", evts[0])
+	assert.Equal(t, "Say hello", prompt.Message.Content.Content)
+
+	instructions, ok := evts[1].(events.Request[messages.InstructionsMessage])
+	require.True(t, ok, "expected the instructions, got %T", evts[1])
+	assert.Equal(t, "You greet people", instructions.Message.Content)
+
+	chunk, ok := evts[2].(events.Chunk[messages.AssistantMessage])
+	require.True(t, ok, "expected an assistant chunk, got %T", evts[2])
+	assert.Equal(t, "Hello", chunk.Chunk.Content.Content)
+
+	response, ok := evts[3].(events.Response[messages.AssistantMessage])
+	require.True(t, ok, "expected an assistant message, got %T", evts[3])
+	assert.Equal(t, "Hello there", response.Response.Content.Content)
+	assert.Equal(t, "greeter", response.Sender)
+
+	summary, ok := evts[4].(events.Summary)
+	require.True(t, ok, "expected a summary, got %T", evts[4])
+	assert.Equal(t, 1, summary.Turns)
+
+	result, ok := evts[5].(events.Result[string])
+	require.True(t, ok, "expected a result, got %T", evts[5])
+	assert.Equal(t, "Hello there", result.Result)
+}
+
+func TestCollectorCompletesOnResult(t *testing.T) {
+	collector := eventstest.NewCollector[string]()
+	ctx := context.Background()
+	now := time.Now()
+
+	collector.OnError(ctx, events.Error{Err: errors.New("tool failed"), Timestamp: strfmt.DateTime(now)})
+	collector.OnStatus(ctx, events.Status{ToolName: "lookup", State: events.ToolStarted, Timestamp: strfmt.DateTime(now.Add(time.Millisecond))})
+	collector.OnCancelTool(ctx, events.CancelTool{ToolCallID: "call_1", Timestamp: strfmt.DateTime(now.Add(2 * time.Millisecond))})
+	collector.OnToolAudit(ctx, events.ToolAuditRecord{ToolName: "lookup", Timestamp: strfmt.DateTime(now)})
+
+	waitCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	_, err := collector.Events(waitCtx)
+	require.ErrorIs(t, err, context.DeadlineExceeded, "an error during the run doesn't complete it")
+
+	collector.OnResult(ctx, "done")
+
+	evts, err := collector.Events(ctx)
+	require.NoError(t, err)
+	require.Len(t, evts, 4)
+	assert.IsType(t, events.Error{}, evts[0])
+	assert.IsType(t, events.Status{}, evts[1])
+	assert.IsType(t, events.CancelTool{}, evts[2])
+	assert.Equal(t, events.Result[string]{Result: "done", Timestamp: evts[3].(events.Result[string]).Timestamp}, evts[3])
+
+	audits := collector.ToolAudits()
+	require.Len(t, audits, 1)
+	assert.Equal(t, "lookup", audits[0].ToolName)
+}
+
+func TestCollectorCompletesOnClose(t *testing.T) {
+	collector := eventstest.NewCollector[string]()
+	ctx := context.Background()
+
+	collector.OnError(ctx, errors.New("run failed"))
+	collector.OnClose(ctx)
+
+	evts, err := collector.Events(ctx)
+	require.NoError(t, err)
+	require.Len(t, evts, 1)
+	assert.IsType(t, events.Error{}, evts[0])
+}
+
+func TestCollectorWaitsForCompletion(t *testing.T) {
+	collector := eventstest.NewCollector[string]()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := collector.Events(ctx)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+}
@@ -6,6 +6,7 @@ import (
 	"slices"
 
 	"github.com/casualjim/bubo/messages"
+	"github.com/google/uuid"
 )
 
 // Hook defines the interface for handling all possible event types in the execution flow.
@@ -25,6 +26,8 @@ import (
 //   - Implement all methods explicitly, even if some events don't require handling
 //   - Consider logging or monitoring for events that aren't actively handled
 //   - Be prepared for new methods to be added as the system evolves
+//   - Hooks don't need to be safe for concurrent use with the local executor, it calls them
+//     one at a time, even for tool calls that run in parallel
 //
 // Example implementation:
 //
@@ -54,6 +57,89 @@ type Hook interface {
 	OnError(context.Context, error)
 }
 
+// ApprovalHook is an optional extension of Hook for the human-in-the-loop approval flow.
+// Subscribers that implement it receive the approval requests for tools that require approval
+// and the approvals or denials that answer them. Hooks that don't implement it never see
+// these events.
+type ApprovalHook interface {
+	OnApprovalRequest(context.Context, messages.Message[messages.ApprovalRequest])
+
+	OnApproval(context.Context, messages.Message[messages.Approval])
+}
+
+// InstructionsHook is an optional extension of Hook for auditing what the model is told.
+// Subscribers that implement it receive the rendered instructions of the agent at the start
+// of every turn, after the template of the instructions was expanded with the context variables.
+type InstructionsHook interface {
+	OnInstructions(context.Context, messages.Message[messages.InstructionsMessage])
+}
+
+// ContentFilterHook is an optional extension of Hook for content filter outcomes.
+// Subscribers that implement it are told when the provider's content filter flagged
+// the output of a turn, so they can show a policy message instead of an error.
+type ContentFilterHook interface {
+	OnContentFilter(context.Context, ContentFilter)
+}
+
+// SummaryHook is an optional extension of Hook for run statistics.
+// Subscribers that implement it receive a single Summary when a run completes,
+// with the turns taken, the tools called, the tokens used and the elapsed time.
+type SummaryHook interface {
+	OnSummary(context.Context, Summary)
+}
+
+// CancelToolHook is an optional extension of Hook for cancelling running tool calls.
+// Executors subscribe to the run's topic with it to abort the tool calls named by the
+// CancelTool events that are published there.
+type CancelToolHook interface {
+	OnCancelTool(context.Context, CancelTool)
+}
+
+// StatusHook is an optional extension of Hook for the progress of tool calls.
+// Subscribers that implement it are told when a tool call starts and when it finishes,
+// so they can show that the tool is working.
+type StatusHook interface {
+	OnStatus(context.Context, Status)
+}
+
+// ToolAuditHook is an optional extension of Hook for auditing tool calls.
+// Subscribers that implement it receive a ToolAuditRecord every time a tool returns,
+// whether it succeeded or not. Tool calls that were denied or never ran aren't audited.
+type ToolAuditHook interface {
+	OnToolAudit(context.Context, ToolAuditRecord)
+}
+
+// FinishReasonHook is an optional extension of Hook for the reason a run finished.
+// Subscribers that implement it receive the finish reason of the final provider response,
+// like "stop" or "length", right before the result of the run.
+type FinishReasonHook interface {
+	OnFinishReason(ctx context.Context, reason string)
+}
+
+// RequestHook is an optional extension of Hook for debugging prompt construction.
+// Subscribers that implement it receive the complete request of every turn, right before
+// the provider is called. The request isn't published to the broker, with the temporal executor
+// it's only delivered to the hook of the worker that runs the completion activity.
+type RequestHook interface {
+	OnRequest(ctx context.Context, runID, turnID uuid.UUID, request CompletionRequest)
+}
+
+// CheckpointHook is an optional extension of Hook for persisting conversations.
+// Subscribers that implement it receive the checkpoint of the conversation when a run completes,
+// encoded with the checkpoint codec of the run, so they can store it and resume from it later.
+// The checkpoint isn't published to the broker, the encoded bytes are passed on as they are.
+type CheckpointHook interface {
+	OnCheckpoint(ctx context.Context, runID, turnID uuid.UUID, checkpoint []byte)
+}
+
+// CancelHook is an optional extension of Hook for runs that are cancelled.
+// Subscribers that implement it are told once when the context of a run is cancelled,
+// before the executor cleans up, so they can flush or close their own resources.
+// The reason is the cause of the cancellation.
+type CancelHook interface {
+	OnCancel(ctx context.Context, runID uuid.UUID, reason string)
+}
+
 // func LoggingHook() Hook {
 // 	return &loggingHook{}
 // }
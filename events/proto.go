@@ -0,0 +1,1071 @@
+package events
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/casualjim/bubo/messages"
+	"github.com/go-openapi/strfmt"
+	"github.com/google/uuid"
+	"github.com/tidwall/gjson"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// The field numbers of the Event envelope in events.proto
+const (
+	protoDelim protowire.Number = iota + 1
+	protoChunk
+	protoRequest
+	protoResponse
+	protoError
+	protoContentFilter
+	protoSummary
+	protoCancelTool
+	protoStatus
+)
+
+// ToProto encodes the event as an Event message of events.proto.
+// It's the binary counterpart of ToJSON for transports that move a lot of events.
+func ToProto(event Event) ([]byte, error) {
+	var (
+		num protowire.Number
+		msg []byte
+		err error
+	)
+	switch e := event.(type) {
+	case Delim:
+		num, msg = protoDelim, delimToProto(e)
+	case Chunk[messages.AssistantMessage]:
+		num = protoChunk
+		msg, err = chunkToProto(e)
+	case Chunk[messages.ToolCallMessage]:
+		num = protoChunk
+		msg, err = chunkToProto(e)
+	case Request[messages.UserMessage]:
+		num = protoRequest
+		msg, err = requestToProto(e)
+	case Request[messages.ToolResponse]:
+		num = protoRequest
+		msg, err = requestToProto(e)
+	case Request[messages.ApprovalRequest]:
+		num = protoRequest
+		msg, err = requestToProto(e)
+	case Request[messages.Approval]:
+		num = protoRequest
+		msg, err = requestToProto(e)
+	case Request[messages.InstructionsMessage]:
+		num = protoRequest
+		msg, err = requestToProto(e)
+	case Response[messages.AssistantMessage]:
+		num = protoResponse
+		msg, err = responseToProto(e)
+	case Response[messages.ToolCallMessage]:
+		num = protoResponse
+		msg, err = responseToProto(e)
+	case Error:
+		num, msg = protoError, errorToProto(e)
+	case ContentFilter:
+		num, msg = protoContentFilter, contentFilterToProto(e)
+	case Summary:
+		num, msg = protoSummary, summaryToProto(e)
+	case CancelTool:
+		num, msg = protoCancelTool, cancelToolToProto(e)
+	case Status:
+		num, msg = protoStatus, statusToProto(e)
+	default:
+		return nil, fmt.Errorf("unknown event type: %T", event)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return appendMessage(nil, num, msg), nil
+}
+
+// FromProto decodes an Event message of events.proto, it's the counterpart of ToProto.
+func FromProto(data []byte) (Event, error) {
+	var (
+		num protowire.Number
+		msg []byte
+	)
+	err := consumeFields(data, func(f protoField) error {
+		if f.num >= protoDelim && f.num <= protoStatus {
+			num, msg = f.num, f.bytes
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid protobuf event: %w", err)
+	}
+
+	switch num {
+	case protoDelim:
+		return delimFromProto(msg)
+	case protoChunk:
+		return chunkFromProto(msg)
+	case protoRequest:
+		return requestFromProto(msg)
+	case protoResponse:
+		return responseFromProto(msg)
+	case protoError:
+		return errorFromProto(msg)
+	case protoContentFilter:
+		return contentFilterFromProto(msg)
+	case protoSummary:
+		return summaryFromProto(msg)
+	case protoCancelTool:
+		return cancelToolFromProto(msg)
+	case protoStatus:
+		return statusFromProto(msg)
+	default:
+		return nil, errors.New("failed to parse event: missing event payload")
+	}
+}
+
+func delimToProto(d Delim) []byte {
+	b := appendUUID(nil, 1, d.RunID)
+	b = appendUUID(b, 2, d.TurnID)
+	return appendString(b, 3, d.Delim)
+}
+
+func delimFromProto(data []byte) (Event, error) {
+	var d Delim
+	err := consumeFields(data, func(f protoField) (err error) {
+		switch f.num {
+		case 1:
+			d.RunID, err = f.uuid()
+		case 2:
+			d.TurnID, err = f.uuid()
+		case 3:
+			d.Delim = f.string()
+		}
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid delim: %w", err)
+	}
+	return d, nil
+}
+
+// protoHeader holds the fields that chunks, requests and responses have in common,
+// along with the field number and the encoding of their message.
+type protoHeader struct {
+	MessageID    uuid.UUID
+	RunID        uuid.UUID
+	TurnID       uuid.UUID
+	Sender       string
+	FinishReason string
+	Timestamp    strfmt.DateTime
+	Meta         gjson.Result
+
+	kind    protowire.Number
+	payload []byte
+}
+
+// protoLayout describes the field numbers of a Chunk, Request or Response message.
+// The message is one of the fields between first and last.
+type protoLayout struct {
+	first, last  protowire.Number
+	sender       protowire.Number
+	finishReason protowire.Number
+	timestamp    protowire.Number
+	meta         protowire.Number
+	messageID    protowire.Number
+}
+
+var (
+	chunkLayout    = protoLayout{first: 3, last: 4, sender: 5, timestamp: 6, meta: 7, messageID: 8}
+	requestLayout  = protoLayout{first: 3, last: 7, sender: 8, timestamp: 9, meta: 10, messageID: 11}
+	responseLayout = protoLayout{first: 3, last: 4, sender: 5, finishReason: 6, timestamp: 7, meta: 8, messageID: 9}
+)
+
+func (l protoLayout) append(b []byte, h protoHeader) []byte {
+	b = appendUUID(b, 1, h.RunID)
+	b = appendUUID(b, 2, h.TurnID)
+	b = appendMessage(b, h.kind, h.payload)
+	b = appendString(b, l.sender, h.Sender)
+	if l.finishReason != 0 {
+		b = appendString(b, l.finishReason, h.FinishReason)
+	}
+	b = appendTimestamp(b, l.timestamp, h.Timestamp)
+	b = appendMeta(b, l.meta, h.Meta)
+	return appendUUID(b, l.messageID, h.MessageID)
+}
+
+func (l protoLayout) consume(data []byte) (protoHeader, error) {
+	var h protoHeader
+	err := consumeFields(data, func(f protoField) (err error) {
+		switch {
+		case f.num == 1:
+			h.RunID, err = f.uuid()
+		case f.num == 2:
+			h.TurnID, err = f.uuid()
+		case f.num >= l.first && f.num <= l.last:
+			h.kind, h.payload = f.num, f.bytes
+		case f.num == l.sender:
+			h.Sender = f.string()
+		case l.finishReason != 0 && f.num == l.finishReason:
+			h.FinishReason = f.string()
+		case f.num == l.timestamp:
+			h.Timestamp, err = f.timestamp()
+		case f.num == l.meta:
+			h.Meta, err = f.meta()
+		case f.num == l.messageID:
+			h.MessageID, err = f.uuid()
+		}
+		return err
+	})
+	return h, err
+}
+
+func chunkToProto[T messages.Response](c Chunk[T]) ([]byte, error) {
+	kind, payload, err := responseMessageToProto(c.Chunk)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode chunk: %w", err)
+	}
+	return chunkLayout.append(nil, protoHeader{
+		MessageID: c.MessageID,
+		RunID:     c.RunID,
+		TurnID:    c.TurnID,
+		Sender:    c.Sender,
+		Timestamp: c.Timestamp,
+		Meta:      c.Meta,
+		kind:      kind,
+		payload:   payload,
+	}), nil
+}
+
+func newChunk[T messages.Response](h protoHeader, chunk T) Chunk[T] {
+	return Chunk[T]{
+		MessageID: h.MessageID,
+		RunID:     h.RunID,
+		TurnID:    h.TurnID,
+		Chunk:     chunk,
+		Sender:    h.Sender,
+		Timestamp: h.Timestamp,
+		Meta:      h.Meta,
+	}
+}
+
+func chunkFromProto(data []byte) (Event, error) {
+	h, err := chunkLayout.consume(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid chunk: %w", err)
+	}
+	switch h.kind {
+	case 3:
+		msg, err := assistantMessageFromProto(h.payload)
+		if err != nil {
+			return nil, fmt.Errorf("invalid chunk: %w", err)
+		}
+		return newChunk(h, msg), nil
+	case 4:
+		msg, err := toolCallMessageFromProto(h.payload)
+		if err != nil {
+			return nil, fmt.Errorf("invalid chunk: %w", err)
+		}
+		return newChunk(h, msg), nil
+	default:
+		return nil, errors.New("failed to parse event chunk: missing chunk")
+	}
+}
+
+func requestToProto[T messages.Request](r Request[T]) ([]byte, error) {
+	var (
+		kind    protowire.Number
+		payload []byte
+		err     error
+	)
+	switch m := any(r.Message).(type) {
+	case messages.UserMessage:
+		kind = 3
+		payload, err = userMessageToProto(m)
+	case messages.ToolResponse:
+		kind, payload = 4, toolResponseToProto(m)
+	case messages.ApprovalRequest:
+		kind, payload = 5, approvalRequestToProto(m)
+	case messages.Approval:
+		kind, payload = 6, approvalToProto(m)
+	case messages.InstructionsMessage:
+		kind, payload = 7, appendString(nil, 1, m.Content)
+	default:
+		err = fmt.Errorf("unknown request message type: %T", m)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode request: %w", err)
+	}
+	return requestLayout.append(nil, protoHeader{
+		MessageID: r.MessageID,
+		RunID:     r.RunID,
+		TurnID:    r.TurnID,
+		Sender:    r.Sender,
+		Timestamp: r.Timestamp,
+		Meta:      r.Meta,
+		kind:      kind,
+		payload:   payload,
+	}), nil
+}
+
+func newRequest[T messages.Request](h protoHeader, msg T) Request[T] {
+	return Request[T]{
+		MessageID: h.MessageID,
+		RunID:     h.RunID,
+		TurnID:    h.TurnID,
+		Message:   msg,
+		Sender:    h.Sender,
+		Timestamp: h.Timestamp,
+		Meta:      h.Meta,
+	}
+}
+
+func requestFromProto(data []byte) (Event, error) {
+	h, err := requestLayout.consume(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid request: %w", err)
+	}
+	switch h.kind {
+	case 3:
+		msg, err := userMessageFromProto(h.payload)
+		if err != nil {
+			return nil, fmt.Errorf("invalid request: %w", err)
+		}
+		return newRequest(h, msg), nil
+	case 4:
+		msg, err := toolResponseFromProto(h.payload)
+		if err != nil {
+			return nil, fmt.Errorf("invalid request: %w", err)
+		}
+		return newRequest(h, msg), nil
+	case 5:
+		msg, err := approvalRequestFromProto(h.payload)
+		if err != nil {
+			return nil, fmt.Errorf("invalid request: %w", err)
+		}
+		return newRequest(h, msg), nil
+	case 6:
+		msg, err := approvalFromProto(h.payload)
+		if err != nil {
+			return nil, fmt.Errorf("invalid request: %w", err)
+		}
+		return newRequest(h, msg), nil
+	case 7:
+		var msg messages.InstructionsMessage
+		err := consumeFields(h.payload, func(f protoField) error {
+			if f.num == 1 {
+				msg.Content = f.string()
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("invalid request: %w", err)
+		}
+		return newRequest(h, msg), nil
+	default:
+		return nil, errors.New("failed to parse event request: missing message")
+	}
+}
+
+func responseToProto[T messages.Response](r Response[T]) ([]byte, error) {
+	kind, payload, err := responseMessageToProto(r.Response)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode response: %w", err)
+	}
+	return responseLayout.append(nil, protoHeader{
+		MessageID:    r.MessageID,
+		RunID:        r.RunID,
+		TurnID:       r.TurnID,
+		Sender:       r.Sender,
+		FinishReason: r.FinishReason,
+		Timestamp:    r.Timestamp,
+		Meta:         r.Meta,
+		kind:         kind,
+		payload:      payload,
+	}), nil
+}
+
+func newResponse[T messages.Response](h protoHeader, msg T) Response[T] {
+	return Response[T]{
+		MessageID:    h.MessageID,
+		RunID:        h.RunID,
+		TurnID:       h.TurnID,
+		Response:     msg,
+		Sender:       h.Sender,
+		FinishReason: h.FinishReason,
+		Timestamp:    h.Timestamp,
+		Meta:         h.Meta,
+	}
+}
+
+func responseFromProto(data []byte) (Event, error) {
+	h, err := responseLayout.consume(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid response: %w", err)
+	}
+	switch h.kind {
+	case 3:
+		msg, err := assistantMessageFromProto(h.payload)
+		if err != nil {
+			return nil, fmt.Errorf("invalid response: %w", err)
+		}
+		return newResponse(h, msg), nil
+	case 4:
+		msg, err := toolCallMessageFromProto(h.payload)
+		if err != nil {
+			return nil, fmt.Errorf("invalid response: %w", err)
+		}
+		return newResponse(h, msg), nil
+	default:
+		return nil, errors.New("failed to parse event response: missing response")
+	}
+}
+
+func errorToProto(e Error) []byte {
+	b := appendUUID(nil, 1, e.RunID)
+	b = appendUUID(b, 2, e.TurnID)
+	if e.Err != nil {
+		b = appendString(b, 3, e.Err.Error())
+	}
+	b = appendString(b, 4, e.Sender)
+	b = appendTimestamp(b, 5, e.Timestamp)
+	b = appendMeta(b, 6, e.Meta)
+	if e.Context != nil {
+		var c []byte
+		c = appendString(c, 1, e.Context.Model)
+		c = appendString(c, 2, e.Context.Agent)
+		c = appendInt(c, 3, int64(e.Context.TurnIndex))
+		c = appendString(c, 4, e.Context.Tool)
+		b = appendMessage(b, 7, c)
+	}
+	return b
+}
+
+func errorFromProto(data []byte) (Event, error) {
+	var e Error
+	err := consumeFields(data, func(f protoField) (err error) {
+		switch f.num {
+		case 1:
+			e.RunID, err = f.uuid()
+		case 2:
+			e.TurnID, err = f.uuid()
+		case 3:
+			e.Err = errors.New(f.string())
+		case 4:
+			e.Sender = f.string()
+		case 5:
+			e.Timestamp, err = f.timestamp()
+		case 6:
+			e.Meta, err = f.meta()
+		case 7:
+			e.Context = &RequestContext{}
+			err = consumeFields(f.bytes, func(f protoField) error {
+				switch f.num {
+				case 1:
+					e.Context.Model = f.string()
+				case 2:
+					e.Context.Agent = f.string()
+				case 3:
+					e.Context.TurnIndex = int(f.int())
+				case 4:
+					e.Context.Tool = f.string()
+				}
+				return nil
+			})
+		}
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid error: %w", err)
+	}
+	return e, nil
+}
+
+func contentFilterToProto(c ContentFilter) []byte {
+	b := appendUUID(nil, 1, c.RunID)
+	b = appendUUID(b, 2, c.TurnID)
+	for _, category := range c.Categories {
+		b = protowire.AppendTag(b, 3, protowire.BytesType)
+		b = protowire.AppendString(b, category)
+	}
+	b = appendString(b, 4, c.FinishReason)
+	b = appendString(b, 5, c.Sender)
+	b = appendTimestamp(b, 6, c.Timestamp)
+	return appendMeta(b, 7, c.Meta)
+}
+
+func contentFilterFromProto(data []byte) (Event, error) {
+	var c ContentFilter
+	err := consumeFields(data, func(f protoField) (err error) {
+		switch f.num {
+		case 1:
+			c.RunID, err = f.uuid()
+		case 2:
+			c.TurnID, err = f.uuid()
+		case 3:
+			c.Categories = append(c.Categories, f.string())
+		case 4:
+			c.FinishReason = f.string()
+		case 5:
+			c.Sender = f.string()
+		case 6:
+			c.Timestamp, err = f.timestamp()
+		case 7:
+			c.Meta, err = f.meta()
+		}
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid content filter: %w", err)
+	}
+	return c, nil
+}
+
+func summaryToProto(s Summary) []byte {
+	b := appendUUID(nil, 1, s.RunID)
+	b = appendUUID(b, 2, s.TurnID)
+	b = appendInt(b, 3, int64(s.Turns))
+	b = appendInt(b, 4, int64(s.ToolCalls))
+	b = appendInt(b, 5, s.TotalTokens)
+	b = appendInt(b, 6, s.ReasoningTokens)
+	if len(s.TurnReasoningTokens) > 0 {
+		var packed []byte
+		for _, tokens := range s.TurnReasoningTokens {
+			packed = protowire.AppendVarint(packed, uint64(tokens))
+		}
+		b = appendMessage(b, 7, packed)
+	}
+	b = appendInt(b, 8, s.Elapsed.Milliseconds())
+	b = appendString(b, 9, s.Model)
+	b = appendString(b, 10, s.Sender)
+	b = appendTimestamp(b, 11, s.Timestamp)
+	return appendMeta(b, 12, s.Meta)
+}
+
+func summaryFromProto(data []byte) (Event, error) {
+	var s Summary
+	err := consumeFields(data, func(f protoField) (err error) {
+		switch f.num {
+		case 1:
+			s.RunID, err = f.uuid()
+		case 2:
+			s.TurnID, err = f.uuid()
+		case 3:
+			s.Turns = int(f.int())
+		case 4:
+			s.ToolCalls = int(f.int())
+		case 5:
+			s.TotalTokens = f.int()
+		case 6:
+			s.ReasoningTokens = f.int()
+		case 7:
+			s.TurnReasoningTokens, err = f.appendInts(s.TurnReasoningTokens)
+		case 8:
+			s.Elapsed = time.Duration(f.int()) * time.Millisecond
+		case 9:
+			s.Model = f.string()
+		case 10:
+			s.Sender = f.string()
+		case 11:
+			s.Timestamp, err = f.timestamp()
+		case 12:
+			s.Meta, err = f.meta()
+		}
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid summary: %w", err)
+	}
+	return s, nil
+}
+
+func cancelToolToProto(c CancelTool) []byte {
+	b := appendUUID(nil, 1, c.RunID)
+	b = appendString(b, 2, c.ToolCallID)
+	b = appendString(b, 3, c.Reason)
+	b = appendString(b, 4, c.Sender)
+	return appendTimestamp(b, 5, c.Timestamp)
+}
+
+func cancelToolFromProto(data []byte) (Event, error) {
+	var c CancelTool
+	err := consumeFields(data, func(f protoField) (err error) {
+		switch f.num {
+		case 1:
+			c.RunID, err = f.uuid()
+		case 2:
+			c.ToolCallID = f.string()
+		case 3:
+			c.Reason = f.string()
+		case 4:
+			c.Sender = f.string()
+		case 5:
+			c.Timestamp, err = f.timestamp()
+		}
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid cancel tool: %w", err)
+	}
+	return c, nil
+}
+
+func statusToProto(s Status) []byte {
+	b := appendUUID(nil, 1, s.RunID)
+	b = appendUUID(b, 2, s.TurnID)
+	b = appendString(b, 3, s.ToolCallID)
+	b = appendString(b, 4, s.ToolName)
+	b = appendString(b, 5, string(s.State))
+	b = appendString(b, 6, s.Sender)
+	return appendTimestamp(b, 7, s.Timestamp)
+}
+
+func statusFromProto(data []byte) (Event, error) {
+	var s Status
+	err := consumeFields(data, func(f protoField) (err error) {
+		switch f.num {
+		case 1:
+			s.RunID, err = f.uuid()
+		case 2:
+			s.TurnID, err = f.uuid()
+		case 3:
+			s.ToolCallID = f.string()
+		case 4:
+			s.ToolName = f.string()
+		case 5:
+			s.State = ToolState(f.string())
+		case 6:
+			s.Sender = f.string()
+		case 7:
+			s.Timestamp, err = f.timestamp()
+		}
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid status: %w", err)
+	}
+	return s, nil
+}
+
+func responseMessageToProto(msg any) (protowire.Number, []byte, error) {
+	switch m := msg.(type) {
+	case messages.AssistantMessage:
+		b, err := assistantMessageToProto(m)
+		return 3, b, err
+	case messages.ToolCallMessage:
+		return 4, toolCallMessageToProto(m), nil
+	default:
+		return 0, nil, fmt.Errorf("unknown response message type: %T", msg)
+	}
+}
+
+func userMessageToProto(m messages.UserMessage) ([]byte, error) {
+	b := appendString(nil, 1, m.Content.Content)
+	for _, part := range m.Content.Parts {
+		p, err := contentPartToProto(part)
+		if err != nil {
+			return nil, err
+		}
+		b = appendMessage(b, 2, p)
+	}
+	return b, nil
+}
+
+func userMessageFromProto(data []byte) (messages.UserMessage, error) {
+	var content messages.ContentOrParts
+	err := consumeFields(data, func(f protoField) error {
+		switch f.num {
+		case 1:
+			content.Content = f.string()
+		case 2:
+			part, err := contentPartFromProto(f.bytes)
+			if err != nil {
+				return err
+			}
+			p, ok := part.(messages.ContentPart)
+			if !ok {
+				return fmt.Errorf("a user message can't have a %T", part)
+			}
+			content.Parts = append(content.Parts, p)
+		}
+		return nil
+	})
+	return messages.UserMessage{Content: content}, err
+}
+
+func assistantMessageToProto(m messages.AssistantMessage) ([]byte, error) {
+	b := appendString(nil, 1, m.Content.Content)
+	for _, part := range m.Content.Parts {
+		p, err := contentPartToProto(part)
+		if err != nil {
+			return nil, err
+		}
+		b = appendMessage(b, 2, p)
+	}
+	b = appendString(b, 3, m.Content.Refusal)
+	return appendString(b, 4, m.Refusal), nil
+}
+
+func assistantMessageFromProto(data []byte) (messages.AssistantMessage, error) {
+	var (
+		content messages.AssistantContentOrParts
+		refusal string
+	)
+	err := consumeFields(data, func(f protoField) error {
+		switch f.num {
+		case 1:
+			content.Content = f.string()
+		case 2:
+			part, err := contentPartFromProto(f.bytes)
+			if err != nil {
+				return err
+			}
+			p, ok := part.(messages.AssistantContentPart)
+			if !ok {
+				return fmt.Errorf("an assistant message can't have a %T", part)
+			}
+			content.Parts = append(content.Parts, p)
+		case 3:
+			content.Refusal = f.string()
+		case 4:
+			refusal = f.string()
+		}
+		return nil
+	})
+	return messages.AssistantMessage{Content: content, Refusal: refusal}, err
+}
+
+func contentPartToProto(part any) ([]byte, error) {
+	switch p := part.(type) {
+	case messages.TextContentPart:
+		return appendMessage(nil, 1, appendString(nil, 1, p.Text)), nil
+	case messages.ImageContentPart:
+		b := appendString(nil, 1, p.URL)
+		b = appendString(b, 2, p.Detail)
+		return appendMessage(nil, 2, appendString(b, 3, p.AltText)), nil
+	case messages.AudioContentPart:
+		b := appendBytes(nil, 1, p.InputAudio.Data)
+		return appendMessage(nil, 3, appendString(b, 2, p.InputAudio.Format)), nil
+	case messages.RefusalContentPart:
+		return appendMessage(nil, 4, appendString(nil, 1, p.Refusal)), nil
+	default:
+		return nil, fmt.Errorf("unknown content part type: %T", part)
+	}
+}
+
+func contentPartFromProto(data []byte) (any, error) {
+	var part any
+	err := consumeFields(data, func(f protoField) error {
+		var (
+			first, second, third protoField
+			err                  error
+		)
+		if f.num >= 1 && f.num <= 4 {
+			err = consumeFields(f.bytes, func(field protoField) error {
+				switch field.num {
+				case 1:
+					first = field
+				case 2:
+					second = field
+				case 3:
+					third = field
+				}
+				return nil
+			})
+		}
+		switch f.num {
+		case 1:
+			part = messages.TextContentPart{Text: first.string()}
+		case 2:
+			part = messages.ImageContentPart{URL: first.string(), Detail: second.string(), AltText: third.string()}
+		case 3:
+			part = messages.AudioContentPart{InputAudio: messages.InputAudio{Data: first.clone(), Format: second.string()}}
+		case 4:
+			part = messages.RefusalContentPart{Refusal: first.string()}
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if part == nil {
+		return nil, errors.New("missing content part")
+	}
+	return part, nil
+}
+
+func toolCallMessageToProto(m messages.ToolCallMessage) []byte {
+	var b []byte
+	for _, call := range m.ToolCalls {
+		c := appendString(nil, 1, call.ID)
+		c = appendString(c, 2, call.Name)
+		c = appendString(c, 3, call.Arguments)
+		b = appendMessage(b, 1, c)
+	}
+	return b
+}
+
+func toolCallMessageFromProto(data []byte) (messages.ToolCallMessage, error) {
+	var calls []messages.ToolCallData
+	err := consumeFields(data, func(f protoField) error {
+		if f.num != 1 {
+			return nil
+		}
+		var call messages.ToolCallData
+		err := consumeFields(f.bytes, func(f protoField) error {
+			switch f.num {
+			case 1:
+				call.ID = f.string()
+			case 2:
+				call.Name = f.string()
+			case 3:
+				call.Arguments = f.string()
+			}
+			return nil
+		})
+		calls = append(calls, call)
+		return err
+	})
+	return messages.ToolCallMessage{ToolCalls: calls}, err
+}
+
+func toolResponseToProto(m messages.ToolResponse) []byte {
+	b := appendString(nil, 1, m.ToolName)
+	b = appendString(b, 2, m.ToolCallID)
+	b = appendString(b, 3, m.Content)
+	b = appendBool(b, 4, m.RawJSON)
+	b = appendBytes(b, 5, m.Data)
+	return appendString(b, 6, m.MIMEType)
+}
+
+func toolResponseFromProto(data []byte) (messages.ToolResponse, error) {
+	var m messages.ToolResponse
+	err := consumeFields(data, func(f protoField) error {
+		switch f.num {
+		case 1:
+			m.ToolName = f.string()
+		case 2:
+			m.ToolCallID = f.string()
+		case 3:
+			m.Content = f.string()
+		case 4:
+			m.RawJSON = f.varint != 0
+		case 5:
+			m.Data = f.clone()
+		case 6:
+			m.MIMEType = f.string()
+		}
+		return nil
+	})
+	return m, err
+}
+
+func approvalRequestToProto(m messages.ApprovalRequest) []byte {
+	b := appendString(nil, 1, m.ToolName)
+	b = appendString(b, 2, m.ToolCallID)
+	return appendString(b, 3, m.Arguments)
+}
+
+func approvalRequestFromProto(data []byte) (messages.ApprovalRequest, error) {
+	var m messages.ApprovalRequest
+	err := consumeFields(data, func(f protoField) error {
+		switch f.num {
+		case 1:
+			m.ToolName = f.string()
+		case 2:
+			m.ToolCallID = f.string()
+		case 3:
+			m.Arguments = f.string()
+		}
+		return nil
+	})
+	return m, err
+}
+
+func approvalToProto(m messages.Approval) []byte {
+	b := appendString(nil, 1, m.ToolCallID)
+	b = appendBool(b, 2, m.Approved)
+	return appendString(b, 3, m.Reason)
+}
+
+func approvalFromProto(data []byte) (messages.Approval, error) {
+	var m messages.Approval
+	err := consumeFields(data, func(f protoField) error {
+		switch f.num {
+		case 1:
+			m.ToolCallID = f.string()
+		case 2:
+			m.Approved = f.varint != 0
+		case 3:
+			m.Reason = f.string()
+		}
+		return nil
+	})
+	return m, err
+}
+
+// The append helpers leave out fields that hold their zero value, like proto3 does.
+
+func appendUUID(b []byte, num protowire.Number, id uuid.UUID) []byte {
+	if id == uuid.Nil {
+		return b
+	}
+	return appendBytes(b, num, id[:])
+}
+
+func appendString(b []byte, num protowire.Number, s string) []byte {
+	if s == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, s)
+}
+
+func appendBytes(b []byte, num protowire.Number, v []byte) []byte {
+	if len(v) == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, v)
+}
+
+func appendInt(b []byte, num protowire.Number, v int64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, uint64(v))
+}
+
+func appendBool(b []byte, num protowire.Number, v bool) []byte {
+	if !v {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, 1)
+}
+
+// appendMessage always appends the message, so an empty member of a oneof is still set.
+func appendMessage(b []byte, num protowire.Number, msg []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, msg)
+}
+
+// appendTimestamp encodes the timestamp as a google.protobuf.Timestamp
+func appendTimestamp(b []byte, num protowire.Number, ts strfmt.DateTime) []byte {
+	if ts.IsZero() {
+		return b
+	}
+	t := time.Time(ts)
+	msg := appendInt(nil, 1, t.Unix())
+	msg = appendInt(msg, 2, int64(t.Nanosecond()))
+	return appendMessage(b, num, msg)
+}
+
+func appendMeta(b []byte, num protowire.Number, meta gjson.Result) []byte {
+	if !meta.Exists() {
+		return b
+	}
+	return appendBytes(b, num, []byte(meta.Raw))
+}
+
+// protoField is a decoded field of a message, fields with the fixed size wire types aren't used by events.proto
+type protoField struct {
+	num    protowire.Number
+	typ    protowire.Type
+	varint uint64
+	bytes  []byte
+}
+
+// consumeFields calls fn for every varint and length delimited field of the message.
+func consumeFields(data []byte, fn func(protoField) error) error {
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+
+		f := protoField{num: num, typ: typ}
+		switch typ {
+		case protowire.VarintType:
+			f.varint, n = protowire.ConsumeVarint(data)
+		case protowire.BytesType:
+			f.bytes, n = protowire.ConsumeBytes(data)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, data)
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+
+		if typ != protowire.VarintType && typ != protowire.BytesType {
+			continue
+		}
+		if err := fn(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f protoField) string() string {
+	return string(f.bytes)
+}
+
+func (f protoField) clone() []byte {
+	return bytes.Clone(f.bytes)
+}
+
+func (f protoField) int() int64 {
+	return int64(f.varint)
+}
+
+// appendInts decodes a repeated int64 field, which is packed unless the encoder chose otherwise
+func (f protoField) appendInts(values []int64) ([]int64, error) {
+	if f.typ == protowire.VarintType {
+		return append(values, f.int()), nil
+	}
+	data := f.bytes
+	for len(data) > 0 {
+		v, n := protowire.ConsumeVarint(data)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		values = append(values, int64(v))
+		data = data[n:]
+	}
+	return values, nil
+}
+
+func (f protoField) uuid() (uuid.UUID, error) {
+	id, err := uuid.FromBytes(f.bytes)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("invalid uuid in field %d: %w", f.num, err)
+	}
+	return id, nil
+}
+
+func (f protoField) timestamp() (strfmt.DateTime, error) {
+	var seconds, nanos int64
+	err := consumeFields(f.bytes, func(f protoField) error {
+		switch f.num {
+		case 1:
+			seconds = f.int()
+		case 2:
+			nanos = f.int()
+		}
+		return nil
+	})
+	if err != nil {
+		return strfmt.DateTime{}, fmt.Errorf("invalid timestamp: %w", err)
+	}
+	return strfmt.DateTime(time.Unix(seconds, nanos).UTC()), nil
+}
+
+func (f protoField) meta() (gjson.Result, error) {
+	if !gjson.ValidBytes(f.bytes) {
+		return gjson.Result{}, fmt.Errorf("invalid meta: %s", f.bytes)
+	}
+	return gjson.ParseBytes(f.bytes), nil
+}
@@ -0,0 +1,322 @@
+package events
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/casualjim/bubo/messages"
+	"github.com/go-openapi/strfmt"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func TestEventProto(t *testing.T) {
+	runID := uuid.New()
+	turnID := uuid.New()
+	messageID := uuid.New()
+	timestamp := strfmt.DateTime(time.Now().UTC())
+	meta := gjson.Parse(`{"key":"value"}`)
+
+	t.Run("round trip", func(t *testing.T) {
+		tests := []struct {
+			name  string
+			event Event
+		}{
+			{
+				name:  "Delim",
+				event: Delim{RunID: runID, TurnID: turnID, Delim: "start"},
+			},
+			{
+				name: "Chunk AssistantMessage",
+				event: Chunk[messages.AssistantMessage]{
+					MessageID: messageID,
+					RunID:     runID,
+					TurnID:    turnID,
+					Chunk:     messages.New().AssistantMessage("test").Payload,
+					Sender:    "test",
+					Timestamp: timestamp,
+					Meta:      meta,
+				},
+			},
+			{
+				name: "Chunk AssistantMessage with parts",
+				event: Chunk[messages.AssistantMessage]{
+					RunID:  runID,
+					TurnID: turnID,
+					Chunk: messages.AssistantMessage{
+						Content: messages.AssistantContentOrParts{
+							Parts: []messages.AssistantContentPart{messages.Text("hello"), messages.Refusal("no")},
+						},
+						Refusal: "no",
+					},
+				},
+			},
+			{
+				name: "Chunk ToolCallMessage",
+				event: Chunk[messages.ToolCallMessage]{
+					RunID:     runID,
+					TurnID:    turnID,
+					Chunk:     messages.New().ToolCall([]messages.ToolCallData{{ID: "call-1", Name: "test", Arguments: "{}"}}).Payload,
+					Sender:    "test",
+					Timestamp: timestamp,
+					Meta:      meta,
+				},
+			},
+			{
+				name: "Request UserMessage",
+				event: Request[messages.UserMessage]{
+					MessageID: messageID,
+					RunID:     runID,
+					TurnID:    turnID,
+					Message:   messages.New().UserPrompt("test").Payload,
+					Sender:    "test",
+					Timestamp: timestamp,
+					Meta:      meta,
+				},
+			},
+			{
+				name: "Request UserMessage with parts",
+				event: Request[messages.UserMessage]{
+					RunID:  runID,
+					TurnID: turnID,
+					Message: messages.UserMessage{
+						Content: messages.ContentOrParts{
+							Parts: []messages.ContentPart{
+								messages.Text("describe this"),
+								messages.ImageContentPart{URL: "https://example.com/cat.png", Detail: "low", AltText: "a cat"},
+								messages.Audio([]byte{1, 2, 3}, "wav"),
+							},
+						},
+					},
+				},
+			},
+			{
+				name: "Request ToolResponse",
+				event: Request[messages.ToolResponse]{
+					RunID:  runID,
+					TurnID: turnID,
+					Message: messages.ToolResponse{
+						ToolName:   "chart",
+						ToolCallID: "call-1",
+						Content:    `{"ok":true}`,
+						RawJSON:    true,
+						Data:       []byte{0x89, 0x50},
+						MIMEType:   "image/png",
+					},
+					Sender:    "test",
+					Timestamp: timestamp,
+					Meta:      meta,
+				},
+			},
+			{
+				name: "Request ApprovalRequest",
+				event: Request[messages.ApprovalRequest]{
+					RunID:     runID,
+					TurnID:    turnID,
+					Message:   messages.ApprovalRequest{ToolName: "test", ToolCallID: "test12", Arguments: "{}"},
+					Sender:    "test",
+					Timestamp: timestamp,
+					Meta:      meta,
+				},
+			},
+			{
+				name: "Request Approval",
+				event: Request[messages.Approval]{
+					RunID:     runID,
+					TurnID:    turnID,
+					Message:   messages.Approval{ToolCallID: "test12", Approved: true, Reason: "looks fine"},
+					Sender:    "test",
+					Timestamp: timestamp,
+					Meta:      meta,
+				},
+			},
+			{
+				name: "Request InstructionsMessage",
+				event: Request[messages.InstructionsMessage]{
+					RunID:     runID,
+					TurnID:    turnID,
+					Message:   messages.InstructionsMessage{Content: "You are a helpful assistant"},
+					Sender:    "test",
+					Timestamp: timestamp,
+					Meta:      meta,
+				},
+			},
+			{
+				name: "Response AssistantMessage",
+				event: Response[messages.AssistantMessage]{
+					MessageID:    messageID,
+					RunID:        runID,
+					TurnID:       turnID,
+					Response:     messages.New().AssistantMessage("test").Payload,
+					Sender:       "test",
+					FinishReason: "stop",
+					Timestamp:    timestamp,
+					Meta:         meta,
+				},
+			},
+			{
+				name: "Response ToolCallMessage",
+				event: Response[messages.ToolCallMessage]{
+					RunID:        runID,
+					TurnID:       turnID,
+					Response:     messages.New().ToolCall([]messages.ToolCallData{{ID: "call-1", Name: "a"}, {ID: "call-2", Name: "b", Arguments: `{"x":1}`}}).Payload,
+					Sender:       "test",
+					FinishReason: "tool_calls",
+					Timestamp:    timestamp,
+					Meta:         meta,
+				},
+			},
+			{
+				name: "Error",
+				event: Error{
+					RunID:     runID,
+					TurnID:    turnID,
+					Err:       errors.New("test error"),
+					Sender:    "test",
+					Timestamp: timestamp,
+					Meta:      meta,
+					Context:   &RequestContext{Model: "gpt-4o", Agent: "test", TurnIndex: 2, Tool: "lookup"},
+				},
+			},
+			{
+				name: "ContentFilter",
+				event: ContentFilter{
+					RunID:        runID,
+					TurnID:       turnID,
+					Categories:   []string{"violence", "hate"},
+					FinishReason: "content_filter",
+					Sender:       "test",
+					Timestamp:    timestamp,
+					Meta:         meta,
+				},
+			},
+			{
+				name: "Summary",
+				event: Summary{
+					RunID:               runID,
+					TurnID:              turnID,
+					Turns:               2,
+					ToolCalls:           1,
+					TotalTokens:         120,
+					ReasoningTokens:     30,
+					TurnReasoningTokens: []int64{0, 30},
+					Elapsed:             1500 * time.Millisecond,
+					Model:               "gpt-4o",
+					Sender:              "test",
+					Timestamp:           timestamp,
+					Meta:                meta,
+				},
+			},
+			{
+				name: "CancelTool",
+				event: CancelTool{
+					RunID:      runID,
+					ToolCallID: "call-1",
+					Reason:     "taking too long",
+					Sender:     "operator",
+					Timestamp:  timestamp,
+				},
+			},
+			{
+				name: "Status",
+				event: Status{
+					RunID:      runID,
+					TurnID:     turnID,
+					ToolCallID: "call-1",
+					ToolName:   "lookup",
+					State:      ToolFinished,
+					Sender:     "test",
+					Timestamp:  timestamp,
+				},
+			},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				data, err := ToProto(tt.event)
+				require.NoError(t, err)
+
+				event, err := FromProto(data)
+				require.NoError(t, err)
+				assert.Equal(t, tt.event, event)
+			})
+		}
+	})
+
+	t.Run("smaller than JSON", func(t *testing.T) {
+		event := Chunk[messages.AssistantMessage]{
+			RunID:     runID,
+			TurnID:    turnID,
+			Chunk:     messages.New().AssistantMessage("test").Payload,
+			Sender:    "test",
+			Timestamp: timestamp,
+			Meta:      meta,
+		}
+		pb, err := ToProto(event)
+		require.NoError(t, err)
+		js, err := ToJSON(event)
+		require.NoError(t, err)
+		assert.Less(t, len(pb), len(js))
+	})
+
+	t.Run("unknown event type", func(t *testing.T) {
+		_, err := ToProto(nil)
+		assert.Error(t, err)
+	})
+
+	t.Run("FromProto errors", func(t *testing.T) {
+		tests := []struct {
+			name  string
+			input []byte
+		}{
+			{
+				name:  "truncated",
+				input: []byte{0x0a, 0x10, 0x01},
+			},
+			{
+				name:  "empty",
+				input: nil,
+			},
+			{
+				name:  "chunk without a message",
+				input: appendMessage(nil, protoChunk, appendUUID(nil, 1, runID)),
+			},
+			{
+				name:  "invalid run id",
+				input: appendMessage(nil, protoDelim, appendBytes(nil, 1, []byte{1, 2, 3})),
+			},
+			{
+				name: "refusal in a user message",
+				input: appendMessage(nil, protoRequest,
+					appendMessage(nil, 3,
+						appendMessage(nil, 2, appendMessage(nil, 4, appendString(nil, 1, "no"))))),
+			},
+			{
+				name:  "invalid meta",
+				input: appendMessage(nil, protoChunk, appendBytes(nil, 7, []byte("{"))),
+			},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				_, err := FromProto(tt.input)
+				assert.Error(t, err)
+			})
+		}
+	})
+
+	t.Run("skips unknown fields", func(t *testing.T) {
+		data, err := ToProto(Delim{RunID: runID, TurnID: turnID, Delim: "end"})
+		require.NoError(t, err)
+		data = protowire.AppendTag(data, 99, protowire.Fixed64Type)
+		data = protowire.AppendFixed64(data, 42)
+
+		event, err := FromProto(data)
+		require.NoError(t, err)
+		assert.Equal(t, Delim{RunID: runID, TurnID: turnID, Delim: "end"}, event)
+	})
+}
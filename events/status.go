@@ -0,0 +1,137 @@
+package events
+
+import (
+	"fmt"
+
+	"github.com/casualjim/bubo/messages"
+	"github.com/go-openapi/strfmt"
+	"github.com/google/uuid"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+var statusJSON = []byte(`{"type":"status"}`)
+
+// ToolState is the state of a tool call that is reported with a Status event
+type ToolState string
+
+const (
+	// ToolStarted is reported right before the executor calls the tool
+	ToolStarted ToolState = "started"
+	// ToolFinished is reported when the tool returned, whether it failed or not
+	ToolFinished ToolState = "finished"
+)
+
+// Status reports the progress of a tool call, so a UI can show that the tool is working.
+// Every call of a tool is bracketed by a started and a finished status, the tool response
+// is published separately.
+type Status struct {
+	RunID      uuid.UUID       `json:"run_id"`
+	TurnID     uuid.UUID       `json:"turn_id"`
+	ToolCallID string          `json:"tool_call_id"`
+	ToolName   string          `json:"tool_name"`
+	State      ToolState       `json:"state"`
+	Sender     string          `json:"sender,omitempty"`
+	Timestamp  strfmt.DateTime `json:"timestamp,omitempty"`
+}
+
+func (Status) pubsubEvent() {}
+
+// MarshalJSON implements custom JSON marshaling for Status
+func (s Status) MarshalJSON() ([]byte, error) {
+	result := statusJSON
+
+	var err error
+	result, err = sjson.SetBytes(result, "run_id", s.RunID.String())
+	if err != nil {
+		return nil, err
+	}
+
+	result, err = sjson.SetBytes(result, "turn_id", s.TurnID.String())
+	if err != nil {
+		return nil, err
+	}
+
+	result, err = sjson.SetBytes(result, "tool_call_id", s.ToolCallID)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err = sjson.SetBytes(result, "tool_name", s.ToolName)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err = sjson.SetBytes(result, "state", string(s.State))
+	if err != nil {
+		return nil, err
+	}
+
+	if s.Sender != "" {
+		result, err = sjson.SetBytes(result, "sender", s.Sender)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if !s.Timestamp.IsZero() {
+		result, err = sjson.SetBytes(result, "timestamp", messages.MarshalTimestamp(s.Timestamp))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+// UnmarshalJSON implements custom JSON unmarshaling for Status
+func (s *Status) UnmarshalJSON(data []byte) error {
+	if !gjson.ValidBytes(data) {
+		return fmt.Errorf("invalid json: %s", data)
+	}
+
+	msgType := gjson.GetBytes(data, "type")
+	if !msgType.Exists() || msgType.String() != "status" {
+		return fmt.Errorf("missing or invalid type, expected 'status'")
+	}
+
+	runID := gjson.GetBytes(data, "run_id")
+	if !runID.Exists() {
+		return fmt.Errorf("missing required field 'run_id'")
+	}
+	if err := s.RunID.UnmarshalText([]byte(runID.String())); err != nil {
+		return fmt.Errorf("invalid run_id: %w", err)
+	}
+
+	if turnID := gjson.GetBytes(data, "turn_id"); turnID.Exists() {
+		if err := s.TurnID.UnmarshalText([]byte(turnID.String())); err != nil {
+			return fmt.Errorf("invalid turn_id: %w", err)
+		}
+	}
+
+	toolCallID := gjson.GetBytes(data, "tool_call_id")
+	if !toolCallID.Exists() {
+		return fmt.Errorf("missing required field 'tool_call_id'")
+	}
+	s.ToolCallID = toolCallID.String()
+
+	s.ToolName = gjson.GetBytes(data, "tool_name").String()
+
+	state := gjson.GetBytes(data, "state")
+	if !state.Exists() {
+		return fmt.Errorf("missing required field 'state'")
+	}
+	s.State = ToolState(state.String())
+
+	if sender := gjson.GetBytes(data, "sender"); sender.Exists() {
+		s.Sender = sender.String()
+	}
+
+	if timestamp := gjson.GetBytes(data, "timestamp"); timestamp.Exists() {
+		if err := messages.UnmarshalTimestamp(timestamp, &s.Timestamp); err != nil {
+			return fmt.Errorf("invalid timestamp: %w", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,180 @@
+package events
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/casualjim/bubo/messages"
+	"github.com/go-openapi/strfmt"
+	"github.com/google/uuid"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+var summaryJSON = []byte(`{"type":"summary"}`)
+
+// Summary is published once when a run completes and holds the statistics of the run.
+// It's delivered to SummaryHook subscribers.
+type Summary struct {
+	RunID  uuid.UUID `json:"run_id"`
+	TurnID uuid.UUID `json:"turn_id"`
+	// Turns is the number of completions that were requested from the models.
+	Turns int `json:"turns"`
+	// ToolCalls is the number of tools that were called.
+	ToolCalls int `json:"tool_calls"`
+	// TotalTokens is the number of tokens the providers reported, it's only known when they report usage.
+	TotalTokens int64 `json:"total_tokens,omitempty"`
+	// ReasoningTokens is the number of tokens the reasoning models used to think, they're part of the total.
+	ReasoningTokens int64 `json:"reasoning_tokens,omitempty"`
+	// TurnReasoningTokens are the reasoning tokens of every response, in the order of the turns.
+	// It's only set when the providers reported reasoning tokens.
+	TurnReasoningTokens []int64 `json:"turn_reasoning_tokens,omitempty"`
+	// Elapsed is the wall clock time of the run, it's serialized in milliseconds.
+	Elapsed time.Duration `json:"elapsed_ms"`
+	// Model is the name of the model that produced the final response.
+	Model     string          `json:"model,omitempty"`
+	Sender    string          `json:"sender,omitempty"`
+	Timestamp strfmt.DateTime `json:"timestamp,omitempty"`
+	Meta      gjson.Result    `json:"meta,omitempty"`
+}
+
+func (Summary) pubsubEvent() {}
+
+// MarshalJSON implements custom JSON marshaling for Summary
+func (s Summary) MarshalJSON() ([]byte, error) {
+	result := summaryJSON
+
+	var err error
+	result, err = sjson.SetBytes(result, "run_id", s.RunID.String())
+	if err != nil {
+		return nil, err
+	}
+
+	result, err = sjson.SetBytes(result, "turn_id", s.TurnID.String())
+	if err != nil {
+		return nil, err
+	}
+
+	result, err = sjson.SetBytes(result, "turns", s.Turns)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err = sjson.SetBytes(result, "tool_calls", s.ToolCalls)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.TotalTokens > 0 {
+		result, err = sjson.SetBytes(result, "total_tokens", s.TotalTokens)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if s.ReasoningTokens > 0 {
+		result, err = sjson.SetBytes(result, "reasoning_tokens", s.ReasoningTokens)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(s.TurnReasoningTokens) > 0 {
+		result, err = sjson.SetBytes(result, "turn_reasoning_tokens", s.TurnReasoningTokens)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	result, err = sjson.SetBytes(result, "elapsed_ms", s.Elapsed.Milliseconds())
+	if err != nil {
+		return nil, err
+	}
+
+	if s.Model != "" {
+		result, err = sjson.SetBytes(result, "model", s.Model)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if s.Sender != "" {
+		result, err = sjson.SetBytes(result, "sender", s.Sender)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if !s.Timestamp.IsZero() {
+		result, err = sjson.SetBytes(result, "timestamp", messages.MarshalTimestamp(s.Timestamp))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if s.Meta.Exists() {
+		result, err = sjson.SetRawBytes(result, "meta", []byte(s.Meta.Raw))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+// UnmarshalJSON implements custom JSON unmarshaling for Summary
+func (s *Summary) UnmarshalJSON(data []byte) error {
+	if !gjson.ValidBytes(data) {
+		return fmt.Errorf("invalid json: %s", data)
+	}
+
+	msgType := gjson.GetBytes(data, "type")
+	if !msgType.Exists() || msgType.String() != "summary" {
+		return fmt.Errorf("missing or invalid type, expected 'summary'")
+	}
+
+	runID := gjson.GetBytes(data, "run_id")
+	if !runID.Exists() {
+		return fmt.Errorf("missing required field 'run_id'")
+	}
+	if err := s.RunID.UnmarshalText([]byte(runID.String())); err != nil {
+		return fmt.Errorf("invalid run_id: %w", err)
+	}
+
+	turnID := gjson.GetBytes(data, "turn_id")
+	if !turnID.Exists() {
+		return fmt.Errorf("missing required field 'turn_id'")
+	}
+	if err := s.TurnID.UnmarshalText([]byte(turnID.String())); err != nil {
+		return fmt.Errorf("invalid turn_id: %w", err)
+	}
+
+	s.Turns = int(gjson.GetBytes(data, "turns").Int())
+	s.ToolCalls = int(gjson.GetBytes(data, "tool_calls").Int())
+	s.TotalTokens = gjson.GetBytes(data, "total_tokens").Int()
+	s.ReasoningTokens = gjson.GetBytes(data, "reasoning_tokens").Int()
+	for _, tokens := range gjson.GetBytes(data, "turn_reasoning_tokens").Array() {
+		s.TurnReasoningTokens = append(s.TurnReasoningTokens, tokens.Int())
+	}
+	s.Elapsed = time.Duration(gjson.GetBytes(data, "elapsed_ms").Int()) * time.Millisecond
+
+	if model := gjson.GetBytes(data, "model"); model.Exists() {
+		s.Model = model.String()
+	}
+
+	if sender := gjson.GetBytes(data, "sender"); sender.Exists() {
+		s.Sender = sender.String()
+	}
+
+	if timestamp := gjson.GetBytes(data, "timestamp"); timestamp.Exists() {
+		if err := messages.UnmarshalTimestamp(timestamp, &s.Timestamp); err != nil {
+			return fmt.Errorf("invalid timestamp: %w", err)
+		}
+	}
+
+	if meta := gjson.GetBytes(data, "meta"); meta.Exists() {
+		s.Meta = meta
+	}
+
+	return nil
+}
@@ -0,0 +1,37 @@
+package events
+
+import (
+	"time"
+
+	"github.com/go-openapi/strfmt"
+	"github.com/google/uuid"
+)
+
+// ToolOutcome is how a tool call ended, it's reported with a ToolAuditRecord
+type ToolOutcome string
+
+const (
+	// ToolSucceeded is reported when the tool returned a result
+	ToolSucceeded ToolOutcome = "succeeded"
+	// ToolFailed is reported when the tool returned an error
+	ToolFailed ToolOutcome = "failed"
+	// ToolCancelled is reported when the tool call was cancelled with a CancelTool event
+	ToolCancelled ToolOutcome = "cancelled"
+)
+
+// ToolAuditRecord pairs a tool call with its outcome, for audit logs that need to know
+// what a tool was called with and what it produced.
+// Result holds the content of the tool response for the model, Error the error the tool returned.
+type ToolAuditRecord struct {
+	RunID      uuid.UUID       `json:"run_id"`
+	TurnID     uuid.UUID       `json:"turn_id"`
+	ToolCallID string          `json:"tool_call_id"`
+	ToolName   string          `json:"tool_name"`
+	Arguments  string          `json:"arguments"`
+	Result     string          `json:"result,omitempty"`
+	Error      string          `json:"error,omitempty"`
+	Outcome    ToolOutcome     `json:"outcome"`
+	Duration   time.Duration   `json:"duration"`
+	Sender     string          `json:"sender,omitempty"`
+	Timestamp  strfmt.DateTime `json:"timestamp,omitempty"`
+}
@@ -25,6 +25,11 @@ type Event interface {
 	pubsubEvent()
 }
 
+// EventTransformer rewrites an event before it is published to subscribers,
+// for example to attach tenant metadata, add sequence numbers or redact content.
+// When a transformer fails, the event is published as it was before that transformer ran.
+type EventTransformer func(Event) (Event, error)
+
 func FromStreamEvent(e provider.StreamEvent, sender string) Event {
 	switch event := e.(type) {
 	case provider.Delim:
@@ -49,21 +54,23 @@ func FromStreamEvent(e provider.StreamEvent, sender string) Event {
 		}
 	case provider.Response[messages.ToolCallMessage]:
 		return Response[messages.ToolCallMessage]{
-			RunID:     event.RunID,
-			TurnID:    event.TurnID,
-			Response:  event.Response,
-			Timestamp: event.Timestamp,
-			Meta:      event.Meta,
-			Sender:    sender,
+			RunID:        event.RunID,
+			TurnID:       event.TurnID,
+			Response:     event.Response,
+			Timestamp:    event.Timestamp,
+			Meta:         event.Meta,
+			Sender:       sender,
+			FinishReason: event.FinishReason,
 		}
 	case provider.Response[messages.AssistantMessage]:
 		return Response[messages.AssistantMessage]{
-			RunID:     event.RunID,
-			TurnID:    event.TurnID,
-			Response:  event.Response,
-			Timestamp: event.Timestamp,
-			Meta:      event.Meta,
-			Sender:    sender,
+			RunID:        event.RunID,
+			TurnID:       event.TurnID,
+			Response:     event.Response,
+			Timestamp:    event.Timestamp,
+			Meta:         event.Meta,
+			Sender:       sender,
+			FinishReason: event.FinishReason,
 		}
 	case provider.Error:
 		return Error{
@@ -74,6 +81,16 @@ func FromStreamEvent(e provider.StreamEvent, sender string) Event {
 			Timestamp: event.Timestamp,
 			Meta:      event.Meta,
 		}
+	case provider.ContentFilter:
+		return ContentFilter{
+			RunID:        event.RunID,
+			TurnID:       event.TurnID,
+			Categories:   event.Categories,
+			FinishReason: event.FinishReason,
+			Sender:       sender,
+			Timestamp:    event.Timestamp,
+			Meta:         event.Meta,
+		}
 	default:
 		panic(fmt.Sprintf("unknown event type: %T", event))
 	}
@@ -91,12 +108,26 @@ func ToJSON(event Event) ([]byte, error) {
 		return json.Marshal(e)
 	case Request[messages.ToolResponse]:
 		return json.Marshal(e)
+	case Request[messages.ApprovalRequest]:
+		return json.Marshal(e)
+	case Request[messages.Approval]:
+		return json.Marshal(e)
+	case Request[messages.InstructionsMessage]:
+		return json.Marshal(e)
 	case Response[messages.AssistantMessage]:
 		return json.Marshal(e)
 	case Response[messages.ToolCallMessage]:
 		return json.Marshal(e)
 	case Error:
 		return json.Marshal(e)
+	case ContentFilter:
+		return json.Marshal(e)
+	case Summary:
+		return json.Marshal(e)
+	case CancelTool:
+		return json.Marshal(e)
+	case Status:
+		return json.Marshal(e)
 	default:
 		return nil, fmt.Errorf("unknown event type: %T", event)
 	}
@@ -148,6 +179,24 @@ func FromJSON(jsonData []byte) (Event, error) {
 				return nil, err
 			}
 			return d, nil
+		case "approval_request":
+			var d Request[messages.ApprovalRequest]
+			if err := json.Unmarshal(jsonData, &d); err != nil {
+				return nil, err
+			}
+			return d, nil
+		case "approval":
+			var d Request[messages.Approval]
+			if err := json.Unmarshal(jsonData, &d); err != nil {
+				return nil, err
+			}
+			return d, nil
+		case "instructions":
+			var d Request[messages.InstructionsMessage]
+			if err := json.Unmarshal(jsonData, &d); err != nil {
+				return nil, err
+			}
+			return d, nil
 		default:
 			return nil, fmt.Errorf("failed to parse event request type: %s", ct)
 		}
@@ -175,6 +224,30 @@ func FromJSON(jsonData []byte) (Event, error) {
 			return nil, err
 		}
 		return e, nil
+	case "content_filter":
+		var c ContentFilter
+		if err := json.Unmarshal(jsonData, &c); err != nil {
+			return nil, err
+		}
+		return c, nil
+	case "summary":
+		var s Summary
+		if err := json.Unmarshal(jsonData, &s); err != nil {
+			return nil, err
+		}
+		return s, nil
+	case "cancel_tool":
+		var c CancelTool
+		if err := json.Unmarshal(jsonData, &c); err != nil {
+			return nil, err
+		}
+		return c, nil
+	case "status":
+		var s Status
+		if err := json.Unmarshal(jsonData, &s); err != nil {
+			return nil, err
+		}
+		return s, nil
 	default:
 		return nil, fmt.Errorf("failed to parse event type: %s", et)
 	}
@@ -244,6 +317,7 @@ func (d *Delim) UnmarshalJSON(data []byte) error {
 }
 
 type Chunk[T messages.Response] struct {
+	MessageID uuid.UUID       `json:"message_id,omitempty"`
 	RunID     uuid.UUID       `json:"run_id"`
 	TurnID    uuid.UUID       `json:"turn_id"`
 	Chunk     T               `json:"chunk"`
@@ -269,6 +343,13 @@ func (c Chunk[T]) MarshalJSON() ([]byte, error) {
 		return nil, err
 	}
 
+	if c.MessageID != uuid.Nil {
+		result, err = sjson.SetBytes(result, "message_id", c.MessageID.String())
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	chunkBytes, err := json.Marshal(c.Chunk)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal chunk: %w", err)
@@ -286,7 +367,7 @@ func (c Chunk[T]) MarshalJSON() ([]byte, error) {
 	}
 
 	if !c.Timestamp.IsZero() {
-		result, err = sjson.SetBytes(result, "timestamp", c.Timestamp.String())
+		result, err = sjson.SetBytes(result, "timestamp", messages.MarshalTimestamp(c.Timestamp))
 		if err != nil {
 			return nil, err
 		}
@@ -329,6 +410,12 @@ func (c *Chunk[T]) UnmarshalJSON(data []byte) error {
 		return fmt.Errorf("invalid turn_id: %w", err)
 	}
 
+	if messageID := gjson.GetBytes(data, "message_id"); messageID.Exists() {
+		if err := c.MessageID.UnmarshalText([]byte(messageID.String())); err != nil {
+			return fmt.Errorf("invalid message_id: %w", err)
+		}
+	}
+
 	chunk := gjson.GetBytes(data, "chunk")
 	if !chunk.Exists() {
 		return fmt.Errorf("missing required field 'chunk'")
@@ -342,7 +429,7 @@ func (c *Chunk[T]) UnmarshalJSON(data []byte) error {
 	}
 
 	if timestamp := gjson.GetBytes(data, "timestamp"); timestamp.Exists() {
-		if err := c.Timestamp.UnmarshalText([]byte(timestamp.String())); err != nil {
+		if err := messages.UnmarshalTimestamp(timestamp, &c.Timestamp); err != nil {
 			return fmt.Errorf("invalid timestamp: %w", err)
 		}
 	}
@@ -355,6 +442,7 @@ func (c *Chunk[T]) UnmarshalJSON(data []byte) error {
 }
 
 type Request[T messages.Request] struct {
+	MessageID uuid.UUID       `json:"message_id,omitempty"`
 	RunID     uuid.UUID       `json:"run_id"`
 	TurnID    uuid.UUID       `json:"turn_id"`
 	Message   T               `json:"message"`
@@ -380,6 +468,13 @@ func (r Request[T]) MarshalJSON() ([]byte, error) {
 		return nil, err
 	}
 
+	if r.MessageID != uuid.Nil {
+		result, err = sjson.SetBytes(result, "message_id", r.MessageID.String())
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	messageBytes, err := json.Marshal(r.Message)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal message: %w", err)
@@ -397,7 +492,7 @@ func (r Request[T]) MarshalJSON() ([]byte, error) {
 	}
 
 	if !r.Timestamp.IsZero() {
-		result, err = sjson.SetBytes(result, "timestamp", r.Timestamp.String())
+		result, err = sjson.SetBytes(result, "timestamp", messages.MarshalTimestamp(r.Timestamp))
 		if err != nil {
 			return nil, err
 		}
@@ -440,6 +535,12 @@ func (r *Request[T]) UnmarshalJSON(data []byte) error {
 		return fmt.Errorf("invalid turn_id: %w", err)
 	}
 
+	if messageID := gjson.GetBytes(data, "message_id"); messageID.Exists() {
+		if err := r.MessageID.UnmarshalText([]byte(messageID.String())); err != nil {
+			return fmt.Errorf("invalid message_id: %w", err)
+		}
+	}
+
 	message := gjson.GetBytes(data, "message")
 	if !message.Exists() {
 		return fmt.Errorf("missing required field 'message'")
@@ -453,7 +554,7 @@ func (r *Request[T]) UnmarshalJSON(data []byte) error {
 	}
 
 	if timestamp := gjson.GetBytes(data, "timestamp"); timestamp.Exists() {
-		if err := r.Timestamp.UnmarshalText([]byte(timestamp.String())); err != nil {
+		if err := messages.UnmarshalTimestamp(timestamp, &r.Timestamp); err != nil {
 			return fmt.Errorf("invalid timestamp: %w", err)
 		}
 	}
@@ -466,12 +567,14 @@ func (r *Request[T]) UnmarshalJSON(data []byte) error {
 }
 
 type Response[T messages.Response] struct {
-	RunID     uuid.UUID       `json:"run_id"`
-	TurnID    uuid.UUID       `json:"turn_id"`
-	Response  T               `json:"response"`
-	Sender    string          `json:"sender,omitempty"`
-	Timestamp strfmt.DateTime `json:"timestamp,omitempty"`
-	Meta      gjson.Result    `json:"meta,omitempty"`
+	MessageID    uuid.UUID       `json:"message_id,omitempty"`
+	RunID        uuid.UUID       `json:"run_id"`
+	TurnID       uuid.UUID       `json:"turn_id"`
+	Response     T               `json:"response"`
+	Sender       string          `json:"sender,omitempty"`
+	FinishReason string          `json:"finish_reason,omitempty"`
+	Timestamp    strfmt.DateTime `json:"timestamp,omitempty"`
+	Meta         gjson.Result    `json:"meta,omitempty"`
 }
 
 func (Response[T]) pubsubEvent() {}
@@ -491,6 +594,13 @@ func (r Response[T]) MarshalJSON() ([]byte, error) {
 		return nil, err
 	}
 
+	if r.MessageID != uuid.Nil {
+		result, err = sjson.SetBytes(result, "message_id", r.MessageID.String())
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	responseBytes, err := json.Marshal(r.Response)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal response: %w", err)
@@ -507,8 +617,15 @@ func (r Response[T]) MarshalJSON() ([]byte, error) {
 		}
 	}
 
+	if r.FinishReason != "" {
+		result, err = sjson.SetBytes(result, "finish_reason", r.FinishReason)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	if !r.Timestamp.IsZero() {
-		result, err = sjson.SetBytes(result, "timestamp", r.Timestamp.String())
+		result, err = sjson.SetBytes(result, "timestamp", messages.MarshalTimestamp(r.Timestamp))
 		if err != nil {
 			return nil, err
 		}
@@ -551,6 +668,12 @@ func (r *Response[T]) UnmarshalJSON(data []byte) error {
 		return fmt.Errorf("invalid turn_id: %w", err)
 	}
 
+	if messageID := gjson.GetBytes(data, "message_id"); messageID.Exists() {
+		if err := r.MessageID.UnmarshalText([]byte(messageID.String())); err != nil {
+			return fmt.Errorf("invalid message_id: %w", err)
+		}
+	}
+
 	response := gjson.GetBytes(data, "response")
 	if !response.Exists() {
 		return fmt.Errorf("missing required field 'response'")
@@ -563,8 +686,12 @@ func (r *Response[T]) UnmarshalJSON(data []byte) error {
 		r.Sender = sender.String()
 	}
 
+	if finishReason := gjson.GetBytes(data, "finish_reason"); finishReason.Exists() {
+		r.FinishReason = finishReason.String()
+	}
+
 	if timestamp := gjson.GetBytes(data, "timestamp"); timestamp.Exists() {
-		if err := r.Timestamp.UnmarshalText([]byte(timestamp.String())); err != nil {
+		if err := messages.UnmarshalTimestamp(timestamp, &r.Timestamp); err != nil {
 			return fmt.Errorf("invalid timestamp: %w", err)
 		}
 	}
@@ -577,12 +704,13 @@ func (r *Response[T]) UnmarshalJSON(data []byte) error {
 }
 
 type Result[T any] struct {
-	RunID     uuid.UUID       `json:"run_id"`
-	TurnID    uuid.UUID       `json:"turn_id"`
-	Result    T               `json:"result"`
-	Sender    string          `json:"sender,omitempty"`
-	Timestamp strfmt.DateTime `json:"timestamp,omitempty"`
-	Meta      gjson.Result    `json:"meta,omitempty"`
+	RunID        uuid.UUID       `json:"run_id"`
+	TurnID       uuid.UUID       `json:"turn_id"`
+	Result       T               `json:"result"`
+	Sender       string          `json:"sender,omitempty"`
+	FinishReason string          `json:"finish_reason,omitempty"`
+	Timestamp    strfmt.DateTime `json:"timestamp,omitempty"`
+	Meta         gjson.Result    `json:"meta,omitempty"`
 }
 
 func (Result[T]) pubsubEvent() {}
@@ -618,8 +746,15 @@ func (r Result[T]) MarshalJSON() ([]byte, error) {
 		}
 	}
 
+	if r.FinishReason != "" {
+		result, err = sjson.SetBytes(result, "finish_reason", r.FinishReason)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	if !r.Timestamp.IsZero() {
-		result, err = sjson.SetBytes(result, "timestamp", r.Timestamp.String())
+		result, err = sjson.SetBytes(result, "timestamp", messages.MarshalTimestamp(r.Timestamp))
 		if err != nil {
 			return nil, err
 		}
@@ -674,8 +809,12 @@ func (r *Result[T]) UnmarshalJSON(data []byte) error {
 		r.Sender = sender.String()
 	}
 
+	if finishReason := gjson.GetBytes(data, "finish_reason"); finishReason.Exists() {
+		r.FinishReason = finishReason.String()
+	}
+
 	if timestamp := gjson.GetBytes(data, "timestamp"); timestamp.Exists() {
-		if err := r.Timestamp.UnmarshalText([]byte(timestamp.String())); err != nil {
+		if err := messages.UnmarshalTimestamp(timestamp, &r.Timestamp); err != nil {
 			return fmt.Errorf("invalid timestamp: %w", err)
 		}
 	}
@@ -687,6 +826,18 @@ func (r *Result[T]) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
+// RequestContext describes the request that was being processed when an error occurred.
+type RequestContext struct {
+	// Model is the name of the model the request was sent to
+	Model string `json:"model,omitempty"`
+	// Agent is the name of the agent that made the request
+	Agent string `json:"agent,omitempty"`
+	// TurnIndex is the number of turns completed before the error occurred
+	TurnIndex int `json:"turn_index"`
+	// Tool is the name of the tool that was being called, if any
+	Tool string `json:"tool,omitempty"`
+}
+
 type Error struct {
 	RunID     uuid.UUID       `json:"run_id"`
 	TurnID    uuid.UUID       `json:"turn_id"`
@@ -694,6 +845,7 @@ type Error struct {
 	Sender    string          `json:"sender,omitempty"`
 	Timestamp strfmt.DateTime `json:"timestamp,omitempty"`
 	Meta      gjson.Result    `json:"meta,omitempty"`
+	Context   *RequestContext `json:"context,omitempty"`
 }
 
 func (Error) pubsubEvent() {}
@@ -728,7 +880,7 @@ func (e Error) MarshalJSON() ([]byte, error) {
 	}
 
 	if !e.Timestamp.IsZero() {
-		result, err = sjson.SetBytes(result, "timestamp", e.Timestamp.String())
+		result, err = sjson.SetBytes(result, "timestamp", messages.MarshalTimestamp(e.Timestamp))
 		if err != nil {
 			return nil, err
 		}
@@ -741,6 +893,13 @@ func (e Error) MarshalJSON() ([]byte, error) {
 		}
 	}
 
+	if e.Context != nil {
+		result, err = sjson.SetBytes(result, "context", e.Context)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	return result, nil
 }
 
@@ -782,7 +941,7 @@ func (e *Error) UnmarshalJSON(data []byte) error {
 	}
 
 	if timestamp := gjson.GetBytes(data, "timestamp"); timestamp.Exists() {
-		if err := e.Timestamp.UnmarshalText([]byte(timestamp.String())); err != nil {
+		if err := messages.UnmarshalTimestamp(timestamp, &e.Timestamp); err != nil {
 			return fmt.Errorf("invalid timestamp: %w", err)
 		}
 	}
@@ -791,9 +950,23 @@ func (e *Error) UnmarshalJSON(data []byte) error {
 		e.Meta = meta
 	}
 
+	if reqCtx := gjson.GetBytes(data, "context"); reqCtx.IsObject() {
+		e.Context = &RequestContext{
+			Model:     reqCtx.Get("model").String(),
+			Agent:     reqCtx.Get("agent").String(),
+			TurnIndex: int(reqCtx.Get("turn_index").Int()),
+			Tool:      reqCtx.Get("tool").String(),
+		}
+	}
+
 	return nil
 }
 
+// Unwrap returns the underlying error.
+func (e Error) Unwrap() error {
+	return e.Err
+}
+
 func (e Error) Error() string {
 	errStr := "<nil>"
 	if e.Err != nil {
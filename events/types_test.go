@@ -102,8 +102,10 @@ func TestChunkJSON(t *testing.T) {
 	timestamp := strfmt.DateTime(time.Now().UTC().Truncate(time.Millisecond))
 	meta := gjson.Parse(`{"key":"value"}`)
 
+	messageID := uuid.New()
 	msg := messages.New().AssistantMessage("test")
 	chunk := Chunk[messages.AssistantMessage]{
+		MessageID: messageID,
 		RunID:     runID,
 		TurnID:    turnID,
 		Chunk:     msg.Payload,
@@ -120,6 +122,7 @@ func TestChunkJSON(t *testing.T) {
 		assert.Equal(t, "chunk", result.Get("type").String())
 		assert.Equal(t, runID.String(), result.Get("run_id").String())
 		assert.Equal(t, turnID.String(), result.Get("turn_id").String())
+		assert.Equal(t, messageID.String(), result.Get("message_id").String())
 		assert.True(t, result.Get("chunk").Exists())
 		assert.Equal(t, "test", result.Get("sender").String())
 		assert.Equal(t, timestamp.String(), result.Get("timestamp").String())
@@ -131,6 +134,7 @@ func TestChunkJSON(t *testing.T) {
 			"type": "chunk",
 			"run_id": "` + runID.String() + `",
 			"turn_id": "` + turnID.String() + `",
+			"message_id": "` + messageID.String() + `",
 			"chunk": {"type": "assistant", "content": "test"},
 			"sender": "test",
 			"timestamp": "` + timestamp.String() + `",
@@ -142,6 +146,7 @@ func TestChunkJSON(t *testing.T) {
 		require.NoError(t, err)
 		assert.Equal(t, chunk.RunID, c.RunID)
 		assert.Equal(t, chunk.TurnID, c.TurnID)
+		assert.Equal(t, chunk.MessageID, c.MessageID)
 		assert.Equal(t, chunk.Sender, c.Sender)
 		assert.Equal(t, chunk.Timestamp, c.Timestamp)
 		assert.Equal(t, chunk.Meta.Raw, c.Meta.Raw)
@@ -210,8 +215,10 @@ func TestRequestJSON(t *testing.T) {
 	timestamp := strfmt.DateTime(time.Now().UTC().Truncate(time.Millisecond))
 	meta := gjson.Parse(`{"key":"value"}`)
 
+	messageID := uuid.New()
 	msg := messages.New().UserPrompt("test")
 	request := Request[messages.UserMessage]{
+		MessageID: messageID,
 		RunID:     runID,
 		TurnID:    turnID,
 		Message:   msg.Payload,
@@ -228,6 +235,7 @@ func TestRequestJSON(t *testing.T) {
 		assert.Equal(t, "request", result.Get("type").String())
 		assert.Equal(t, runID.String(), result.Get("run_id").String())
 		assert.Equal(t, turnID.String(), result.Get("turn_id").String())
+		assert.Equal(t, messageID.String(), result.Get("message_id").String())
 		assert.True(t, result.Get("message").Exists())
 		assert.Equal(t, "test", result.Get("sender").String())
 		assert.Equal(t, timestamp.String(), result.Get("timestamp").String())
@@ -239,6 +247,7 @@ func TestRequestJSON(t *testing.T) {
 			"type": "request",
 			"run_id": "` + runID.String() + `",
 			"turn_id": "` + turnID.String() + `",
+			"message_id": "` + messageID.String() + `",
 			"message": {"type": "user", "content": "test"},
 			"sender": "test",
 			"timestamp": "` + timestamp.String() + `",
@@ -250,6 +259,7 @@ func TestRequestJSON(t *testing.T) {
 		require.NoError(t, err)
 		assert.Equal(t, request.RunID, r.RunID)
 		assert.Equal(t, request.TurnID, r.TurnID)
+		assert.Equal(t, request.MessageID, r.MessageID)
 		assert.Equal(t, request.Sender, r.Sender)
 		assert.Equal(t, request.Timestamp, r.Timestamp)
 		assert.Equal(t, request.Meta.Raw, r.Meta.Raw)
@@ -318,8 +328,10 @@ func TestResponseJSON(t *testing.T) {
 	timestamp := strfmt.DateTime(time.Now().UTC().Truncate(time.Millisecond))
 	meta := gjson.Parse(`{"key":"value"}`)
 
+	messageID := uuid.New()
 	msg := messages.New().AssistantMessage("test")
 	response := Response[messages.AssistantMessage]{
+		MessageID: messageID,
 		RunID:     runID,
 		TurnID:    turnID,
 		Response:  msg.Payload,
@@ -336,6 +348,7 @@ func TestResponseJSON(t *testing.T) {
 		assert.Equal(t, "response", result.Get("type").String())
 		assert.Equal(t, runID.String(), result.Get("run_id").String())
 		assert.Equal(t, turnID.String(), result.Get("turn_id").String())
+		assert.Equal(t, messageID.String(), result.Get("message_id").String())
 		assert.True(t, result.Get("response").Exists())
 		assert.Equal(t, "test", result.Get("sender").String())
 		assert.Equal(t, timestamp.String(), result.Get("timestamp").String())
@@ -347,6 +360,7 @@ func TestResponseJSON(t *testing.T) {
 			"type": "response",
 			"run_id": "` + runID.String() + `",
 			"turn_id": "` + turnID.String() + `",
+			"message_id": "` + messageID.String() + `",
 			"response": {"type": "assistant", "content": "test"},
 			"sender": "test",
 			"timestamp": "` + timestamp.String() + `",
@@ -358,6 +372,7 @@ func TestResponseJSON(t *testing.T) {
 		require.NoError(t, err)
 		assert.Equal(t, response.RunID, r.RunID)
 		assert.Equal(t, response.TurnID, r.TurnID)
+		assert.Equal(t, response.MessageID, r.MessageID)
 		assert.Equal(t, response.Sender, r.Sender)
 		assert.Equal(t, response.Timestamp, r.Timestamp)
 		assert.Equal(t, response.Meta.Raw, r.Meta.Raw)
@@ -484,6 +499,39 @@ func TestEventSerialization(t *testing.T) {
 					Meta:      meta,
 				},
 			},
+			{
+				name: "Request ApprovalRequest",
+				event: Request[messages.ApprovalRequest]{
+					RunID:     runID,
+					TurnID:    turnID,
+					Message:   messages.ApprovalRequest{ToolName: "test", ToolCallID: "test12", Arguments: "{}"},
+					Sender:    "test",
+					Timestamp: timestamp,
+					Meta:      meta,
+				},
+			},
+			{
+				name: "Request Approval",
+				event: Request[messages.Approval]{
+					RunID:     runID,
+					TurnID:    turnID,
+					Message:   messages.Approval{ToolCallID: "test12", Approved: true},
+					Sender:    "test",
+					Timestamp: timestamp,
+					Meta:      meta,
+				},
+			},
+			{
+				name: "Request InstructionsMessage",
+				event: Request[messages.InstructionsMessage]{
+					RunID:     runID,
+					TurnID:    turnID,
+					Message:   messages.InstructionsMessage{Content: "You are a helpful assistant"},
+					Sender:    "test",
+					Timestamp: timestamp,
+					Meta:      meta,
+				},
+			},
 			{
 				name: "Response AssistantMessage",
 				event: Response[messages.AssistantMessage]{
@@ -517,6 +565,55 @@ func TestEventSerialization(t *testing.T) {
 					Meta:      meta,
 				},
 			},
+			{
+				name: "ContentFilter",
+				event: ContentFilter{
+					RunID:        runID,
+					TurnID:       turnID,
+					Categories:   []string{"violence"},
+					FinishReason: "content_filter",
+					Sender:       "test",
+					Timestamp:    timestamp,
+					Meta:         meta,
+				},
+			},
+			{
+				name: "Summary",
+				event: Summary{
+					RunID:       runID,
+					TurnID:      turnID,
+					Turns:       2,
+					ToolCalls:   1,
+					TotalTokens: 120,
+					Elapsed:     1500 * time.Millisecond,
+					Model:       "gpt-4o",
+					Sender:      "test",
+					Timestamp:   timestamp,
+					Meta:        meta,
+				},
+			},
+			{
+				name: "CancelTool",
+				event: CancelTool{
+					RunID:      runID,
+					ToolCallID: "call-1",
+					Reason:     "taking too long",
+					Sender:     "operator",
+					Timestamp:  timestamp,
+				},
+			},
+			{
+				name: "Status",
+				event: Status{
+					RunID:      runID,
+					TurnID:     turnID,
+					ToolCallID: "call-1",
+					ToolName:   "lookup",
+					State:      ToolStarted,
+					Sender:     "test",
+					Timestamp:  timestamp,
+				},
+			},
 		}
 
 		for _, tt := range tests {
@@ -629,6 +726,19 @@ func TestErrorJSON(t *testing.T) {
 		assert.Equal(t, `{"key": "value"}`, e.Meta.Raw)
 	})
 
+	t.Run("request context", func(t *testing.T) {
+		withCtx := errEvent
+		withCtx.Context = &RequestContext{Model: "gpt-4o", Agent: "agent", TurnIndex: 2, Tool: "lookup"}
+
+		data, err := withCtx.MarshalJSON()
+		require.NoError(t, err)
+		assert.Equal(t, "lookup", gjson.GetBytes(data, "context.tool").String())
+
+		var e Error
+		require.NoError(t, e.UnmarshalJSON(data))
+		assert.Equal(t, withCtx.Context, e.Context)
+	})
+
 	t.Run("Error() method", func(t *testing.T) {
 		errStr := errEvent.Error()
 		assert.Contains(t, errStr, testErr.Error())
@@ -693,3 +803,28 @@ func TestErrorJSON(t *testing.T) {
 		}
 	})
 }
+
+func TestSummaryJSON(t *testing.T) {
+	summary := Summary{
+		RunID:               uuid.New(),
+		TurnID:              uuid.New(),
+		Turns:               3,
+		ToolCalls:           2,
+		TotalTokens:         345,
+		ReasoningTokens:     128,
+		TurnReasoningTokens: []int64{128, 0, 0},
+		Elapsed:             2500 * time.Millisecond,
+		Model:               "o1",
+		Sender:              "agent",
+		Timestamp:           strfmt.DateTime(time.Now().UTC().Truncate(time.Millisecond)),
+	}
+
+	data, err := ToJSON(summary)
+	require.NoError(t, err)
+	assert.Equal(t, "summary", gjson.GetBytes(data, "type").String())
+	assert.Equal(t, int64(2500), gjson.GetBytes(data, "elapsed_ms").Int())
+
+	event, err := FromJSON(data)
+	require.NoError(t, err)
+	assert.Equal(t, summary, event)
+}
@@ -174,6 +174,7 @@ type consoleHook[T any] struct {
 func (c *consoleHook[T]) OnUserPrompt(ctx context.Context, msg messages.Message[messages.UserMessage]) {
 	slog.InfoContext(ctx, "user prompt", slog.Any("msg", msg))
 	c.ch <- buboevents.Request[messages.UserMessage]{
+		MessageID: msg.MessageID,
 		RunID:     msg.RunID,
 		TurnID:    msg.TurnID,
 		Message:   msg.Payload,
@@ -186,6 +187,7 @@ func (c *consoleHook[T]) OnUserPrompt(ctx context.Context, msg messages.Message[
 func (c *consoleHook[T]) OnAssistantChunk(ctx context.Context, msg messages.Message[messages.AssistantMessage]) {
 	slog.InfoContext(ctx, "assistant chunk", slog.Any("msg", msg))
 	c.ch <- buboevents.Chunk[messages.AssistantMessage]{
+		MessageID: msg.MessageID,
 		RunID:     msg.RunID,
 		TurnID:    msg.TurnID,
 		Chunk:     msg.Payload,
@@ -198,6 +200,7 @@ func (c *consoleHook[T]) OnAssistantChunk(ctx context.Context, msg messages.Mess
 func (c *consoleHook[T]) OnToolCallChunk(ctx context.Context, msg messages.Message[messages.ToolCallMessage]) {
 	slog.InfoContext(ctx, "tool call chunk", slog.Any("msg", msg))
 	c.ch <- buboevents.Chunk[messages.ToolCallMessage]{
+		MessageID: msg.MessageID,
 		RunID:     msg.RunID,
 		TurnID:    msg.TurnID,
 		Chunk:     msg.Payload,
@@ -210,6 +213,7 @@ func (c *consoleHook[T]) OnToolCallChunk(ctx context.Context, msg messages.Messa
 func (c *consoleHook[T]) OnAssistantMessage(ctx context.Context, msg messages.Message[messages.AssistantMessage]) {
 	slog.Info("assistant message", slog.Any("msg", msg))
 	c.ch <- buboevents.Response[messages.AssistantMessage]{
+		MessageID: msg.MessageID,
 		RunID:     msg.RunID,
 		TurnID:    msg.TurnID,
 		Response:  msg.Payload,
@@ -222,6 +226,7 @@ func (c *consoleHook[T]) OnAssistantMessage(ctx context.Context, msg messages.Me
 func (c *consoleHook[T]) OnToolCallMessage(ctx context.Context, msg messages.Message[messages.ToolCallMessage]) {
 	slog.InfoContext(ctx, "tool call message", slog.Any("msg", msg))
 	c.ch <- buboevents.Response[messages.ToolCallMessage]{
+		MessageID: msg.MessageID,
 		RunID:     msg.RunID,
 		TurnID:    msg.TurnID,
 		Response:  msg.Payload,
@@ -234,6 +239,7 @@ func (c *consoleHook[T]) OnToolCallMessage(ctx context.Context, msg messages.Mes
 func (c *consoleHook[T]) OnToolCallResponse(ctx context.Context, msg messages.Message[messages.ToolResponse]) {
 	slog.InfoContext(ctx, "tool call response", slog.Any("msg", msg))
 	c.ch <- buboevents.Request[messages.ToolResponse]{
+		MessageID: msg.MessageID,
 		RunID:     msg.RunID,
 		TurnID:    msg.TurnID,
 		Message:   msg.Payload,
@@ -0,0 +1,79 @@
+package msgfmt
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"sync"
+
+	"github.com/casualjim/bubo"
+	"github.com/casualjim/bubo/messages"
+	"github.com/casualjim/bubo/pkg/slogx"
+)
+
+// WriterSink returns a hook that writes the text of the assistant to w, nothing else is written.
+// Streamed chunks are written as they arrive and w is flushed after every chunk when it has
+// a Flush method, like a *bufio.Writer or an http.ResponseWriter. The complete assistant message
+// is only written when it wasn't streamed.
+func WriterSink[T any](w io.Writer) bubo.Hook[T] {
+	return &writerSink[T]{w: w}
+}
+
+type writerSink[T any] struct {
+	mu       sync.Mutex
+	w        io.Writer
+	streamed bool
+}
+
+func (s *writerSink[T]) write(ctx context.Context, text string) {
+	if text == "" {
+		return
+	}
+	if _, err := io.WriteString(s.w, text); err != nil {
+		slog.ErrorContext(ctx, "failed to write assistant text", slogx.Error(err))
+		return
+	}
+	switch f := s.w.(type) {
+	case interface{ Flush() error }:
+		if err := f.Flush(); err != nil {
+			slog.ErrorContext(ctx, "failed to flush assistant text", slogx.Error(err))
+		}
+	case interface{ Flush() }:
+		f.Flush()
+	}
+}
+
+func (s *writerSink[T]) OnAssistantChunk(ctx context.Context, msg messages.Message[messages.AssistantMessage]) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.streamed = true
+	s.write(ctx, msg.Payload.Content.Content)
+}
+
+func (s *writerSink[T]) OnAssistantMessage(ctx context.Context, msg messages.Message[messages.AssistantMessage]) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.streamed {
+		// the chunks of the message were written already
+		s.streamed = false
+		return
+	}
+	s.write(ctx, msg.Payload.Content.Content)
+}
+
+func (s *writerSink[T]) OnUserPrompt(context.Context, messages.Message[messages.UserMessage]) {}
+
+func (s *writerSink[T]) OnToolCallChunk(context.Context, messages.Message[messages.ToolCallMessage]) {
+}
+
+func (s *writerSink[T]) OnToolCallMessage(context.Context, messages.Message[messages.ToolCallMessage]) {
+}
+
+func (s *writerSink[T]) OnToolCallResponse(context.Context, messages.Message[messages.ToolResponse]) {
+}
+
+func (s *writerSink[T]) OnError(context.Context, error) {}
+
+func (s *writerSink[T]) OnResult(context.Context, T) {}
+
+func (s *writerSink[T]) OnClose(context.Context) {}
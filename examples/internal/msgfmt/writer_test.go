@@ -0,0 +1,41 @@
+package msgfmt
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/casualjim/bubo/messages"
+	"github.com/stretchr/testify/assert"
+)
+
+// flushRecorder records the content that was flushed
+type flushRecorder struct {
+	strings.Builder
+	flushed []string
+}
+
+func (f *flushRecorder) Flush() error {
+	f.flushed = append(f.flushed, f.String())
+	return nil
+}
+
+func TestWriterSink(t *testing.T) {
+	ctx := context.Background()
+	w := &flushRecorder{}
+	hook := WriterSink[string](w)
+
+	hook.OnUserPrompt(ctx, messages.New().UserPrompt("tell me a story"))
+	for _, chunk := range []string{"Once ", "upon ", "a time."} {
+		hook.OnAssistantChunk(ctx, messages.New().AssistantMessage(chunk))
+	}
+	// the complete message repeats the chunks
+	hook.OnAssistantMessage(ctx, messages.New().AssistantMessage("Once upon a time."))
+	hook.OnToolCallMessage(ctx, messages.New().ToolCall([]messages.ToolCallData{{ID: "call-1", Name: "lookup", Arguments: "{}"}}))
+	hook.OnToolCallResponse(ctx, messages.New().ToolResponse("call-1", "lookup", "a dragon"))
+	// a message that wasn't streamed
+	hook.OnAssistantMessage(ctx, messages.New().AssistantMessage(" The end."))
+
+	assert.Equal(t, "Once upon a time. The end.", w.String())
+	assert.Equal(t, []string{"Once ", "Once upon ", "Once upon a time.", "Once upon a time. The end."}, w.flushed)
+}
@@ -180,6 +180,7 @@ type consoleHook[T any] struct {
 
 func (c *consoleHook[T]) OnUserPrompt(ctx context.Context, msg messages.Message[messages.UserMessage]) {
 	c.ch <- events.Request[messages.UserMessage]{
+		MessageID: msg.MessageID,
 		RunID:     msg.RunID,
 		TurnID:    msg.TurnID,
 		Message:   msg.Payload,
@@ -191,6 +192,7 @@ func (c *consoleHook[T]) OnUserPrompt(ctx context.Context, msg messages.Message[
 
 func (c *consoleHook[T]) OnAssistantChunk(ctx context.Context, msg messages.Message[messages.AssistantMessage]) {
 	c.ch <- events.Chunk[messages.AssistantMessage]{
+		MessageID: msg.MessageID,
 		RunID:     msg.RunID,
 		TurnID:    msg.TurnID,
 		Chunk:     msg.Payload,
@@ -202,6 +204,7 @@ func (c *consoleHook[T]) OnAssistantChunk(ctx context.Context, msg messages.Mess
 
 func (c *consoleHook[T]) OnToolCallChunk(ctx context.Context, msg messages.Message[messages.ToolCallMessage]) {
 	c.ch <- events.Chunk[messages.ToolCallMessage]{
+		MessageID: msg.MessageID,
 		RunID:     msg.RunID,
 		TurnID:    msg.TurnID,
 		Chunk:     msg.Payload,
@@ -213,6 +216,7 @@ func (c *consoleHook[T]) OnToolCallChunk(ctx context.Context, msg messages.Messa
 
 func (c *consoleHook[T]) OnAssistantMessage(ctx context.Context, msg messages.Message[messages.AssistantMessage]) {
 	c.ch <- events.Response[messages.AssistantMessage]{
+		MessageID: msg.MessageID,
 		RunID:     msg.RunID,
 		TurnID:    msg.TurnID,
 		Response:  msg.Payload,
@@ -224,6 +228,7 @@ func (c *consoleHook[T]) OnAssistantMessage(ctx context.Context, msg messages.Me
 
 func (c *consoleHook[T]) OnToolCallMessage(ctx context.Context, msg messages.Message[messages.ToolCallMessage]) {
 	c.ch <- events.Response[messages.ToolCallMessage]{
+		MessageID: msg.MessageID,
 		RunID:     msg.RunID,
 		TurnID:    msg.TurnID,
 		Response:  msg.Payload,
@@ -235,6 +240,7 @@ func (c *consoleHook[T]) OnToolCallMessage(ctx context.Context, msg messages.Mes
 
 func (c *consoleHook[T]) OnToolCallResponse(ctx context.Context, msg messages.Message[messages.ToolResponse]) {
 	c.ch <- events.Request[messages.ToolResponse]{
+		MessageID: msg.MessageID,
 		RunID:     msg.RunID,
 		TurnID:    msg.TurnID,
 		Message:   msg.Payload,
@@ -19,8 +19,10 @@ package bubo
 import (
 	"context"
 	"reflect"
+	"time"
 
 	"github.com/casualjim/bubo/api"
+	"github.com/casualjim/bubo/broker"
 	"github.com/casualjim/bubo/events"
 	"github.com/casualjim/bubo/internal/executor"
 	"github.com/casualjim/bubo/internal/shorttermmemory"
@@ -58,7 +60,38 @@ import (
 //   - Event hook integration
 //   - Automatic cleanup on completion
 func Local[T any](hook Hook[T], options ...opts.Option[ExecutionContext]) ExecutionContext {
-	fut := executor.NewFuture(executor.DefaultUnmarshal[T]())
+	execCtx, _ := local(hook, options...)
+	return execCtx
+}
+
+// LocalWithUnmarshal creates a local execution context like Local, the result is decoded with unmarshal
+// instead of the default decoding. Use it for result types that need their own decoding, like a union
+// of types picked by a discriminator field.
+//
+// Example usage:
+//
+//	ctx := LocalWithUnmarshal[Shape](hook, func(data []byte) (Shape, error) {
+//	    switch gjson.GetBytes(data, "kind").String() {
+//	    case "circle":
+//	        var c Circle
+//	        return c, json.Unmarshal(data, &c)
+//	    default:
+//	        return nil, fmt.Errorf("unknown shape: %s", data)
+//	    }
+//	})
+func LocalWithUnmarshal[T any](hook Hook[T], unmarshal func([]byte) (T, error), options ...opts.Option[ExecutionContext]) ExecutionContext {
+	execCtx, _ := localWithUnmarshal(hook, unmarshal, options...)
+	return execCtx
+}
+
+// local creates a local execution context and returns the future that receives its result
+func local[T any](hook Hook[T], options ...opts.Option[ExecutionContext]) (ExecutionContext, executor.CompletableFuture[T]) {
+	return localWithUnmarshal(hook, executor.DefaultUnmarshal[T](), options...)
+}
+
+// localWithUnmarshal creates a local execution context and returns the future that receives its result decoded with unmarshal
+func localWithUnmarshal[T any](hook Hook[T], unmarshal func([]byte) (T, error), options ...opts.Option[ExecutionContext]) (ExecutionContext, executor.CompletableFuture[T]) {
+	fut := executor.NewFuture(unmarshal)
 	dp := &deferredPromise[T]{
 		promise: fut,
 		hook:    hook,
@@ -78,7 +111,7 @@ func Local[T any](hook Hook[T], options ...opts.Option[ExecutionContext]) Execut
 		panic(err)
 	}
 
-	return execCtx
+	return execCtx, fut
 }
 
 // ExecutionContext holds the configuration and state for executing conversation steps.
@@ -103,9 +136,28 @@ type ExecutionContext struct {
 	promise        executor.Promise           // Promise for handling command results
 	responseSchema *provider.StructuredOutput // Schema for structured output responses
 	contextVars    types.ContextVars          // Variables available in the execution context
+	runState       *types.RunState            // State shared by the tools, hidden from the model
+	toolsFunc      executor.ToolsFunc         // Tools of every turn, instead of the tools of the agent
+	modelSelector  executor.ModelSelector     // Model of every turn, instead of the model of the agent
 	onClose        func(context.Context)      // Cleanup function called when execution completes
 	stream         bool                       // Whether to stream responses
 	maxTurns       int                        // Maximum number of conversation turns
+	userIDVar      string                     // Context variable holding the end-user identifier
+	hashUserID     bool                       // Whether to hash the end-user identifier before sending it
+	maxToolCalls   int                        // Maximum number of tool calls executed per turn
+	concurrent     bool                       // Whether the tool calls of a turn run at the same time
+	prefill        string                     // Seed for the start of the assistant's response
+	stopSequences  []string                   // Sequences where the model stops generating
+	streamUsage    bool                       // Whether to report token usage for streamed responses
+	suppressChunks bool                       // Whether to keep the chunks of streamed responses from the hook
+	suppressFinal  bool                       // Whether to skip final responses that repeat the streamed chunks
+	modelParams    provider.ModelParams       // Generation parameters that override the ones of the agents
+	broker         broker.Broker              // Broker the runs listen on for tool approvals and cancellations
+	approvalWait   time.Duration              // How long a tool call waits for an approval
+	senderNames    map[string]string          // Names the events of the agents are published with
+	failFast       bool                       // Whether ParallelSteps cancels the other steps when one fails
+	autoContinue   int                        // Maximum number of times a response cut off by the length limit is continued
+	checkpoints    provider.CheckpointCodec   // Codec of the checkpoints that are passed to the hook
 }
 
 // createCommand builds a RunCommand for the given agent using the current execution context.
@@ -134,6 +186,15 @@ func (e *ExecutionContext) createCommand(agent api.Agent, mem *shorttermmemory.A
 	if len(e.contextVars) > 0 {
 		cmd = cmd.WithContextVariables(e.contextVars)
 	}
+	if e.runState != nil {
+		cmd = cmd.WithRunState(e.runState)
+	}
+	if e.toolsFunc != nil {
+		cmd = cmd.WithToolsFunc(e.toolsFunc)
+	}
+	if e.modelSelector != nil {
+		cmd = cmd.WithModelSelector(e.modelSelector)
+	}
 	if e.responseSchema != nil {
 		cmd = cmd.WithStructuredOutput(e.responseSchema)
 	}
@@ -143,6 +204,51 @@ func (e *ExecutionContext) createCommand(agent api.Agent, mem *shorttermmemory.A
 	if e.maxTurns > 0 {
 		cmd = cmd.WithMaxTurns(e.maxTurns)
 	}
+	if e.maxToolCalls > 0 {
+		cmd = cmd.WithMaxToolCallsPerTurn(e.maxToolCalls)
+	}
+	if e.concurrent {
+		cmd = cmd.WithConcurrentToolCalls(e.concurrent)
+	}
+	if e.prefill != "" {
+		cmd = cmd.WithAssistantPrefill(e.prefill)
+	}
+	if len(e.stopSequences) > 0 {
+		cmd = cmd.WithStopSequences(e.stopSequences)
+	}
+	if e.streamUsage {
+		cmd = cmd.WithStreamUsage(e.streamUsage)
+	}
+	if e.suppressChunks {
+		cmd = cmd.WithSuppressChunks(e.suppressChunks)
+	}
+	if e.suppressFinal {
+		cmd = cmd.WithSuppressRedundantFinal(e.suppressFinal)
+	}
+	if e.modelParams != (provider.ModelParams{}) {
+		cmd = cmd.WithModelParams(e.modelParams)
+	}
+	if e.autoContinue > 0 {
+		cmd = cmd.WithAutoContinue(e.autoContinue)
+	}
+	if e.checkpoints != nil {
+		cmd = cmd.WithCheckpointCodec(e.checkpoints)
+	}
+	for agentName, displayName := range e.senderNames {
+		cmd = cmd.WithSenderName(agentName, displayName)
+	}
+	if e.broker != nil {
+		topic := e.broker.Topic(context.Background(), cmd.ID().String())
+		cmd = cmd.WithApprovals(topic, e.approvalWait).WithCancellations(topic)
+	}
+	var userID string
+	if e.userIDVar != "" {
+		userID, _ = e.contextVars[e.userIDVar].(string)
+	}
+	if userID != "" || e.hashUserID {
+		// without a user ID the provider falls back to the message sender, which is hashed as well
+		cmd = cmd.WithUserID(userID, e.hashUserID)
+	}
 	return cmd, nil
 }
 
@@ -185,6 +291,14 @@ var (
 	//  }))
 	WithContextVars = opts.ForName[ExecutionContext, types.ContextVars]("contextVars")
 
+	// WithRunState is an option to share a run state between the tools of the execution.
+	// Unlike context variables, the run state is never rendered into the instructions.
+	// Only the local executor supports it, the tools of a temporal run each execute in their own activity.
+	//
+	// Example:
+	//  Local(hook, WithRunState(types.NewRunState()))
+	WithRunState = opts.ForName[ExecutionContext, *types.RunState]("runState")
+
 	// Streaming is an option to enable/disable response streaming.
 	// When enabled, responses are sent incrementally as they become available.
 	// When disabled, responses are sent only after completion.
@@ -200,8 +314,195 @@ var (
 	// Example:
 	//  Local(hook, WithMaxTurns(5))
 	WithMaxTurns = opts.ForName[ExecutionContext, int]("maxTurns")
+
+	// WithMaxToolCallsPerTurn is an option to limit the number of tool calls executed in a single turn.
+	// Tool calls beyond the limit are not executed, the model is told they were skipped instead.
+	//
+	// Example:
+	//  Local(hook, WithMaxToolCallsPerTurn(3))
+	WithMaxToolCallsPerTurn = opts.ForName[ExecutionContext, int]("maxToolCalls")
+
+	// WithConcurrentToolCalls is an option to run the tool calls of a turn at the same time,
+	// for agents that allow parallel tool calls. The tools must be safe to run concurrently.
+	// Without it the tools are called one after another, even when the model requested them in parallel.
+	// Only the local executor runs them concurrently.
+	//
+	// Example:
+	//  Local(hook, WithConcurrentToolCalls(true))
+	WithConcurrentToolCalls = opts.ForName[ExecutionContext, bool]("concurrent")
+
+	// WithAssistantPrefill is an option to seed the start of the assistant's response,
+	// for providers that support it. Other providers ignore it.
+	//
+	// Example:
+	//  Local(hook, WithAssistantPrefill("{"))
+	WithAssistantPrefill = opts.ForName[ExecutionContext, string]("prefill")
+
+	// WithStopSequences is an option to set the sequences where the model stops generating.
+	// The stop sequences are removed from the final response.
+	//
+	// Example:
+	//  Local(hook, WithStopSequences([]string{"END"}))
+	WithStopSequences = opts.ForName[ExecutionContext, []string]("stopSequences")
+
+	// IncludeStreamUsage is an option to have the provider report the token usage of streamed
+	// responses. The usage is added to the metadata of the assistant message under "usage".
+	//
+	// Example:
+	//  Local(hook, Streaming(true), IncludeStreamUsage(true))
+	IncludeStreamUsage = opts.ForName[ExecutionContext, bool]("streamUsage")
+
+	// WithToolsFunc is an option to decide the available tools every turn, instead of using the tools
+	// of the agent. The function is called before every completion with the context variables of the run.
+	// Only the local executor supports it.
+	//
+	// Example:
+	//  Local(hook, WithToolsFunc(func(ctx context.Context, cv types.ContextVars) []tool.Definition {
+	//      if cv["admin"] == true {
+	//          return append(tools, adminTools...)
+	//      }
+	//      return tools
+	//  }))
+	WithToolsFunc = opts.ForName[ExecutionContext, executor.ToolsFunc]("toolsFunc")
+
+	// WithModelSelector is an option to pick the model every turn from the messages of the thread,
+	// instead of using the model of the agent. The model of the agent is used when it returns nil.
+	//
+	// Example:
+	//  Local(hook, WithModelSelector(func(ctx context.Context, msgs []messages.Message[messages.ModelMessage]) api.Model {
+	//      if len(msgs) > 0 && len(fmt.Sprint(msgs[len(msgs)-1].Payload)) < 200 {
+	//          return openai.GPT4oMini()
+	//      }
+	//      return openai.GPT4o()
+	//  }))
+	WithModelSelector = opts.ForName[ExecutionContext, executor.ModelSelector]("modelSelector")
+
+	// SuppressChunks is an option to only publish the complete messages and the final result,
+	// without the chunks. The provider still streams the response when streaming is enabled,
+	// which is convenient when only the final structured output matters.
+	//
+	// Example:
+	//  Local(hook, Streaming(true), SuppressChunks(true))
+	SuppressChunks = opts.ForName[ExecutionContext, bool]("suppressChunks")
+
+	// SuppressRedundantFinal is an option to skip publishing a final assistant message that is
+	// identical to the chunks that were streamed before it, for UIs that render the chunks.
+	// A final message that differs from the chunks is still published.
+	//
+	// Example:
+	//  Local(hook, Streaming(true), SuppressRedundantFinal(true))
+	SuppressRedundantFinal = opts.ForName[ExecutionContext, bool]("suppressFinal")
+
+	// FailFast is an option to have ParallelSteps cancel the remaining steps as soon as one of them fails,
+	// ParallelRun.Outcomes then reports the error of that step. By default every step runs to completion.
+	//
+	// Example:
+	//  ParallelSteps[string](ctx, knot, Local[string](hook, FailFast(true)), steps...)
+	FailFast = opts.ForName[ExecutionContext, bool]("failFast")
+
+	// WithAutoContinue is an option to ask the model to continue a response that was cut off by the
+	// length limit, at most the given number of times. The result of the run is the assembled response.
+	//
+	// Example:
+	//  Local(hook, WithAutoContinue(2))
+	WithAutoContinue = opts.ForName[ExecutionContext, int]("autoContinue")
+
+	// WithModelParams is an option to set the generation parameters of the run,
+	// the parameters that are set take precedence over the ones of the agents.
+	//
+	// Example:
+	//  temperature := 0.2
+	//  Local(hook, WithModelParams(provider.ModelParams{Temperature: &temperature}))
+	WithModelParams = opts.ForName[ExecutionContext, provider.ModelParams]("modelParams")
+
+	// WithUserIDFrom is an option to derive the end-user identifier sent to the
+	// provider from the named context variable, instead of the message sender.
+	//
+	// Example:
+	//  Local(hook, WithContextVars(types.ContextVars{"user_id": "123"}), WithUserIDFrom("user_id"))
+	WithUserIDFrom = opts.ForName[ExecutionContext, string]("userIDVar")
+
+	// HashUserID is an option to hash the end-user identifier before it is sent
+	// to the provider, so the raw value never leaves the process. It applies to the
+	// identifier from WithUserIDFrom as well as the message sender it replaces.
+	//
+	// Example:
+	//  Local(hook, WithUserIDFrom("user_id"), HashUserID(true))
+	HashUserID = opts.ForName[ExecutionContext, bool]("hashUserID")
+
+	// WithApprovalTimeout is an option to limit how long a call of a tool that requires approval waits
+	// for the approval on the broker before it's denied, DefaultApprovalTimeout by default.
+	//
+	// Example:
+	//  Local(hook, WithBroker(broker.NATS(conn)), WithApprovalTimeout(time.Minute))
+	WithApprovalTimeout = opts.ForName[ExecutionContext, time.Duration]("approvalWait")
+
+	// WithCheckpointCodec is an option to encode the checkpoint of the conversation that's passed
+	// to a hook implementing events.CheckpointHook when a run completes, JSON by default.
+	//
+	// Example:
+	//  Local(hook, WithCheckpointCodec(gobCodec{}))
+	WithCheckpointCodec = opts.ForName[ExecutionContext, provider.CheckpointCodec]("checkpoints")
 )
 
+// DefaultApprovalTimeout is how long a call of a tool that requires approval waits for the approval
+// when WithApprovalTimeout isn't used.
+const DefaultApprovalTimeout = executor.DefaultApprovalTimeout
+
+// WithBroker is an option to publish the events of the runs to a broker, like NATS, so consumers
+// in other processes can follow them. The events are published to the topic named after the run ID,
+// the hook of the execution context still receives them as well.
+// The runs listen on their topic for events.CancelTool events, to abort the tool calls they name.
+// Calls of tools that require approval publish an approval request on the topic and wait for the
+// matching messages.Approval, see WithApprovalTimeout. Without a broker those calls are denied.
+//
+// Example:
+//
+//	Local(hook, WithBroker(broker.NATS(conn)))
+func WithBroker(b broker.Broker) opts.Option[ExecutionContext] {
+	return opts.Type[ExecutionContext](func(e *ExecutionContext) error {
+		e.hook = broker.Publisher(b, e.hook)
+		e.broker = b
+		return nil
+	})
+}
+
+// WithRoutedBroker is an option like WithBroker that publishes every event to the topic picked by the router,
+// so consumers can subscribe to only the kinds of events they need. The runs still listen on the topic
+// named after their run ID for events.CancelTool events and approvals.
+//
+// Example:
+//
+//	Local(hook, WithRoutedBroker(broker.NATS(conn), func(runID uuid.UUID, event events.Event) string {
+//	    if _, ok := event.(events.Error); ok {
+//	        return "errors"
+//	    }
+//	    return runID.String()
+//	}))
+func WithRoutedBroker(b broker.Broker, router broker.TopicRouter) opts.Option[ExecutionContext] {
+	return opts.Type[ExecutionContext](func(e *ExecutionContext) error {
+		e.hook = broker.RoutedPublisher(b, router, e.hook)
+		e.broker = b
+		return nil
+	})
+}
+
+// WithSenderName is an option to publish the events of an agent with a display name instead of the
+// agent name, e.g. to show a name per tenant. Handoffs and the agent registry keep using the agent name.
+//
+// Example:
+//
+//	Local(hook, WithSenderName("support", "Acme Support"))
+func WithSenderName(agentName, displayName string) opts.Option[ExecutionContext] {
+	return opts.Type[ExecutionContext](func(e *ExecutionContext) error {
+		if e.senderNames == nil {
+			e.senderNames = make(map[string]string)
+		}
+		e.senderNames[agentName] = displayName
+		return nil
+	})
+}
+
 // StructuredOutput creates an option to configure structured output for responses.
 // It generates a JSON schema for type T and associates it with the given name and description.
 // The schema is used to validate and structure the conversation output.
@@ -0,0 +1,140 @@
+package bubo_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/casualjim/bubo"
+	"github.com/casualjim/bubo/agent"
+	"github.com/casualjim/bubo/broker"
+	"github.com/casualjim/bubo/events"
+	"github.com/casualjim/bubo/events/eventstest"
+	"github.com/casualjim/bubo/messages"
+	"github.com/casualjim/bubo/provider"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// The tests in this file only use the public API, like an application that depends on bubo.
+
+// answerProvider answers every completion with its content
+type answerProvider struct {
+	content      string
+	finishReason string
+}
+
+func (p answerProvider) ChatCompletion(_ context.Context, params provider.CompletionParams) (<-chan provider.StreamEvent, error) {
+	ch := make(chan provider.StreamEvent, 1)
+	ch <- provider.Response[messages.AssistantMessage]{
+		RunID:        params.RunID,
+		TurnID:       params.Thread.ID(),
+		Response:     messages.AssistantMessage{Content: messages.AssistantContentOrParts{Content: p.content}},
+		FinishReason: p.finishReason,
+	}
+	close(ch)
+	return ch, nil
+}
+
+type answerModel struct {
+	provider answerProvider
+}
+
+func (answerModel) Name() string { return "answer-model" }
+
+func (m answerModel) Provider() provider.Provider { return m.provider }
+
+// assistantSubscriber passes the assistant messages it receives from a topic to a channel
+type assistantSubscriber struct {
+	messages chan messages.Message[messages.AssistantMessage]
+}
+
+func (s assistantSubscriber) OnUserPrompt(context.Context, messages.Message[messages.UserMessage]) {}
+
+func (s assistantSubscriber) OnAssistantChunk(context.Context, messages.Message[messages.AssistantMessage]) {
+}
+
+func (s assistantSubscriber) OnToolCallChunk(context.Context, messages.Message[messages.ToolCallMessage]) {
+}
+
+func (s assistantSubscriber) OnAssistantMessage(_ context.Context, msg messages.Message[messages.AssistantMessage]) {
+	s.messages <- msg
+}
+
+func (s assistantSubscriber) OnToolCallMessage(context.Context, messages.Message[messages.ToolCallMessage]) {
+}
+
+func (s assistantSubscriber) OnToolCallResponse(context.Context, messages.Message[messages.ToolResponse]) {
+}
+
+func (s assistantSubscriber) OnError(context.Context, error) {}
+
+func TestWithBrokerFromAnotherPackage(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	b := broker.Local()
+	sub := assistantSubscriber{messages: make(chan messages.Message[messages.AssistantMessage], 1)}
+	subscription, err := b.Topic(ctx, "runs").Subscribe(ctx, sub)
+	require.NoError(t, err)
+	defer subscription.Unsubscribe()
+
+	worker := agent.New(
+		agent.Name("worker"),
+		agent.Model(answerModel{provider: answerProvider{content: "done"}}),
+		agent.Instructions("You are a test agent"),
+	)
+	knot := bubo.New(bubo.Agents(worker), bubo.Steps(bubo.Step("worker", "hello")))
+
+	collector := eventstest.NewCollector[string]()
+	toRuns := func(uuid.UUID, events.Event) string { return "runs" }
+	require.NoError(t, knot.Run(ctx, bubo.Local[string](collector, bubo.WithRoutedBroker(b, toRuns))))
+
+	select {
+	case msg := <-sub.messages:
+		assert.Equal(t, "done", msg.Payload.Content.Content)
+	case <-ctx.Done():
+		t.Fatal("the subscriber didn't receive the assistant message")
+	}
+}
+
+func TestWithNoopBrokerFromAnotherPackage(t *testing.T) {
+	worker := agent.New(
+		agent.Name("worker"),
+		agent.Model(answerModel{provider: answerProvider{content: "done"}}),
+		agent.Instructions("You are a test agent"),
+	)
+
+	result, err := bubo.RunOnce[string](context.Background(), worker, "hello", bubo.WithBroker(broker.NewNoop()))
+	require.NoError(t, err)
+	assert.Equal(t, "done", result)
+}
+
+func TestResultHasFinishReason(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	worker := agent.New(
+		agent.Name("worker"),
+		agent.Model(answerModel{provider: answerProvider{content: "trunc", finishReason: "length"}}),
+		agent.Instructions("You are a test agent"),
+	)
+	knot := bubo.New(bubo.Agents(worker), bubo.Steps(bubo.Step("worker", "hello")))
+
+	collector := eventstest.NewCollector[string]()
+	require.NoError(t, knot.Run(ctx, bubo.Local[string](collector)))
+
+	evts, err := collector.Events(ctx)
+	require.NoError(t, err)
+
+	var result *events.Result[string]
+	for _, evt := range evts {
+		if r, ok := evt.(events.Result[string]); ok {
+			result = &r
+		}
+	}
+	require.NotNil(t, result)
+	assert.Equal(t, "trunc", result.Result)
+	assert.Equal(t, "length", result.FinishReason)
+}
@@ -0,0 +1,625 @@
+package bubo
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/casualjim/bubo/agent"
+	"github.com/casualjim/bubo/api"
+	"github.com/casualjim/bubo/broker"
+	"github.com/casualjim/bubo/events"
+	"github.com/casualjim/bubo/internal/executor"
+	"github.com/casualjim/bubo/internal/mocks"
+	"github.com/casualjim/bubo/messages"
+	"github.com/casualjim/bubo/provider"
+	"github.com/casualjim/bubo/tool"
+	"github.com/casualjim/bubo/types"
+	"github.com/fogfish/opts"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+)
+
+// recordingBroker keeps the events that are published to its topics
+type recordingBroker struct {
+	mu     sync.Mutex
+	topics map[string][]events.Event
+}
+
+func (b *recordingBroker) Topic(ctx context.Context, id string) broker.Topic {
+	// subscriptions go nowhere, the runs subscribe to their topic for tool cancellations
+	return &recordingTopic{Topic: broker.NewNoop().Topic(ctx, id), broker: b, id: id}
+}
+
+type recordingTopic struct {
+	broker.Topic
+	broker *recordingBroker
+	id     string
+}
+
+func (t *recordingTopic) Publish(_ context.Context, event events.Event) error {
+	t.broker.mu.Lock()
+	defer t.broker.mu.Unlock()
+	if t.broker.topics == nil {
+		t.broker.topics = make(map[string][]events.Event)
+	}
+	t.broker.topics[t.id] = append(t.broker.topics[t.id], event)
+	return nil
+}
+
+func TestWithBroker(t *testing.T) {
+	rec := &recordingBroker{}
+	knot := New(
+		Agents(delayedAgent(t, "worker", &delayedProvider{content: "done"})),
+		Steps(Step("worker", "work")),
+	)
+
+	execCtx, fut := local[string](noopResultHook[string]{}, WithBroker(rec))
+	require.NoError(t, knot.Run(context.Background(), execCtx))
+	result, err := fut.Get()
+	require.NoError(t, err)
+	assert.Equal(t, "done", result)
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	require.Len(t, rec.topics, 1, "the events of a run go to the topic of the run")
+	for _, published := range rec.topics {
+		require.Len(t, published, 4)
+		prompt, ok := published[0].(events.Request[messages.UserMessage])
+		require.True(t, ok, "expected the user prompt, got %T", published[0])
+		assert.Equal(t, "work", prompt.Message.Content.Content)
+		instructions, ok := published[1].(events.Request[messages.InstructionsMessage])
+		require.True(t, ok, "expected the instructions, got %T", published[1])
+		assert.Equal(t, "You are a test agent", instructions.Message.Content)
+		response, ok := published[2].(events.Response[messages.AssistantMessage])
+		require.True(t, ok, "expected the assistant response, got %T", published[2])
+		assert.Equal(t, "done", response.Response.Content.Content)
+		summary, ok := published[3].(events.Summary)
+		require.True(t, ok, "expected the summary, got %T", published[3])
+		assert.Equal(t, 1, summary.Turns)
+	}
+}
+
+func TestWithNoopBroker(t *testing.T) {
+	knot := New(
+		Agents(delayedAgent(t, "worker", &delayedProvider{content: "done"})),
+		Steps(Step("worker", "work")),
+	)
+
+	execCtx, fut := local[string](noopResultHook[string]{}, WithBroker(broker.NewNoop()))
+	require.NoError(t, knot.Run(context.Background(), execCtx))
+	result, err := fut.Get()
+	require.NoError(t, err)
+	assert.Equal(t, "done", result)
+}
+
+type shape interface{ area() float64 }
+
+type circle struct {
+	Radius float64 `json:"radius"`
+}
+
+func (c circle) area() float64 { return 3 * c.Radius * c.Radius }
+
+type square struct {
+	Side float64 `json:"side"`
+}
+
+func (s square) area() float64 { return s.Side * s.Side }
+
+func unmarshalShape(data []byte) (shape, error) {
+	switch kind := gjson.GetBytes(data, "kind").String(); kind {
+	case "circle":
+		var c circle
+		return c, json.Unmarshal(data, &c)
+	case "square":
+		var s square
+		return s, json.Unmarshal(data, &s)
+	default:
+		return nil, fmt.Errorf("unknown shape kind %q", kind)
+	}
+}
+
+func TestLocalWithUnmarshal(t *testing.T) {
+	run := func(t *testing.T, content string) (shape, error) {
+		knot := New(
+			Agents(delayedAgent(t, "geometer", &delayedProvider{content: content})),
+			Steps(Step("geometer", "draw a shape")),
+		)
+		execCtx, fut := localWithUnmarshal[shape](noopResultHook[shape]{}, unmarshalShape)
+		require.NoError(t, knot.Run(context.Background(), execCtx))
+		return fut.Get()
+	}
+
+	result, err := run(t, `{"kind":"square","side":2}`)
+	require.NoError(t, err)
+	assert.Equal(t, square{Side: 2}, result)
+
+	result, err = run(t, `{"kind":"circle","radius":1.5}`)
+	require.NoError(t, err)
+	assert.Equal(t, circle{Radius: 1.5}, result)
+
+	_, err = run(t, `{"kind":"hexagon"}`)
+	assert.ErrorContains(t, err, `unknown shape kind "hexagon"`)
+}
+
+func TestRunRejectsEmptyStep(t *testing.T) {
+	knot := New(
+		Agents(delayedAgent(t, "worker", &delayedProvider{err: errors.New("the provider should not be called")})),
+		Steps(Step("worker", "  ")),
+	)
+
+	execCtx, fut := local[string](noopResultHook[string]{})
+	err := knot.Run(context.Background(), execCtx)
+	require.ErrorIs(t, err, api.ErrNoUserInput)
+	assert.NotContains(t, err.Error(), "the provider should not be called")
+
+	_, err = fut.Get()
+	require.ErrorIs(t, err, api.ErrNoUserInput)
+}
+
+// scriptedProvider answers every completion with the next turn of the script, the last turn is repeated.
+// It keeps the parameters of the completions.
+type scriptedProvider struct {
+	mu     sync.Mutex
+	turns  [][]provider.StreamEvent
+	params []provider.CompletionParams
+}
+
+func (p *scriptedProvider) ChatCompletion(_ context.Context, params provider.CompletionParams) (<-chan provider.StreamEvent, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.params = append(p.params, params)
+
+	turn := p.turns[min(len(p.params), len(p.turns))-1]
+	ch := make(chan provider.StreamEvent, len(turn))
+	for _, event := range turn {
+		// like a real provider, the tool calls belong to the run that requested them
+		if resp, ok := event.(provider.Response[messages.ToolCallMessage]); ok {
+			resp.RunID = params.RunID
+			event = resp
+		}
+		ch <- event
+	}
+	close(ch)
+	return ch, nil
+}
+
+func answer(content string) []provider.StreamEvent {
+	return []provider.StreamEvent{provider.Response[messages.AssistantMessage]{
+		Response: messages.AssistantMessage{Content: messages.AssistantContentOrParts{Content: content}},
+	}}
+}
+
+func callTools(names ...string) []provider.StreamEvent {
+	calls := make([]messages.ToolCallData, len(names))
+	for i, name := range names {
+		calls[i] = messages.ToolCallData{ID: fmt.Sprintf("call-%d", i+1), Name: name, Arguments: "{}"}
+	}
+	return []provider.StreamEvent{provider.Response[messages.ToolCallMessage]{
+		Response: messages.ToolCallMessage{ToolCalls: calls},
+	}}
+}
+
+func scriptedAgent(t *testing.T, p provider.Provider, tools ...tool.Definition) api.Agent {
+	model := mocks.NewModel(t)
+	model.EXPECT().Name().Return("test-model").Maybe()
+	model.EXPECT().Provider().Return(p).Maybe()
+	if len(tools) == 0 {
+		return agent.New(agent.Name("worker"), agent.Model(model), agent.Instructions("You are a test agent"))
+	}
+	return agent.New(agent.Name("worker"), agent.Model(model), agent.Instructions("You are a test agent"), agent.Tools(tools[0], tools[1:]...))
+}
+
+// runSteps runs the prompts as the steps of a knot with the worker agent and returns the result of the last step
+func runSteps(t *testing.T, worker api.Agent, hook Hook[string], options []opts.Option[ExecutionContext], prompts ...string) (string, error) {
+	t.Helper()
+	steps := make([]ConversationStep, len(prompts))
+	for i, prompt := range prompts {
+		steps[i] = Step(worker.Name(), prompt)
+	}
+	knot := New(Agents(worker), Steps(steps[0], steps[1:]...))
+
+	execCtx, fut := local(hook, options...)
+	if err := knot.Run(context.Background(), execCtx); err != nil {
+		return "", err
+	}
+	return fut.Get()
+}
+
+func TestKnotRunAppliesOptions(t *testing.T) {
+	temperature := 0.2
+
+	tests := []struct {
+		name    string
+		options []opts.Option[ExecutionContext]
+		check   func(t *testing.T, params provider.CompletionParams)
+	}{
+		{
+			name:    "Streaming",
+			options: []opts.Option[ExecutionContext]{Streaming(true)},
+			check: func(t *testing.T, params provider.CompletionParams) {
+				assert.True(t, params.Stream)
+			},
+		},
+		{
+			name: "WithUserIDFrom and HashUserID",
+			options: []opts.Option[ExecutionContext]{
+				WithContextVars(types.ContextVars{"uid": "alice"}),
+				WithUserIDFrom("uid"),
+				HashUserID(true),
+			},
+			check: func(t *testing.T, params provider.CompletionParams) {
+				assert.Equal(t, "alice", params.UserID)
+				assert.True(t, params.HashUserID)
+			},
+		},
+		{
+			name:    "HashUserID without WithUserIDFrom",
+			options: []opts.Option[ExecutionContext]{HashUserID(true)},
+			check: func(t *testing.T, params provider.CompletionParams) {
+				assert.Empty(t, params.UserID, "the provider falls back to the sender")
+				assert.True(t, params.HashUserID)
+			},
+		},
+		{
+			name:    "WithAssistantPrefill",
+			options: []opts.Option[ExecutionContext]{WithAssistantPrefill("{")},
+			check: func(t *testing.T, params provider.CompletionParams) {
+				assert.Equal(t, "{", params.AssistantPrefill)
+			},
+		},
+		{
+			name:    "WithStopSequences",
+			options: []opts.Option[ExecutionContext]{WithStopSequences([]string{"END"})},
+			check: func(t *testing.T, params provider.CompletionParams) {
+				assert.Equal(t, []string{"END"}, params.StopSequences)
+			},
+		},
+		{
+			name:    "IncludeStreamUsage",
+			options: []opts.Option[ExecutionContext]{Streaming(true), IncludeStreamUsage(true)},
+			check: func(t *testing.T, params provider.CompletionParams) {
+				assert.True(t, params.IncludeStreamUsage)
+			},
+		},
+		{
+			name:    "WithModelParams",
+			options: []opts.Option[ExecutionContext]{WithModelParams(provider.ModelParams{Temperature: &temperature})},
+			check: func(t *testing.T, params provider.CompletionParams) {
+				require.NotNil(t, params.ModelParams.Temperature)
+				assert.InDelta(t, temperature, *params.ModelParams.Temperature, 0.0001)
+			},
+		},
+		{
+			name: "WithToolsFunc",
+			options: []opts.Option[ExecutionContext]{WithToolsFunc(func(context.Context, types.ContextVars) []tool.Definition {
+				return []tool.Definition{{Name: "lookup", Function: func() string { return "found" }}}
+			})},
+			check: func(t *testing.T, params provider.CompletionParams) {
+				require.Len(t, params.Tools, 1)
+				assert.Equal(t, "lookup", params.Tools[0].Name)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prov := &scriptedProvider{turns: [][]provider.StreamEvent{answer("done")}}
+
+			result, err := runSteps(t, scriptedAgent(t, prov), noopResultHook[string]{}, tt.options, "first", "second")
+			require.NoError(t, err)
+			assert.Equal(t, "done", result)
+
+			require.Len(t, prov.params, 2, "one completion per step")
+			for _, params := range prov.params {
+				tt.check(t, params)
+			}
+		})
+	}
+}
+
+func TestKnotRunWithModelSelector(t *testing.T) {
+	prov := &scriptedProvider{turns: [][]provider.StreamEvent{answer("done")}}
+	selected := mocks.NewModel(t)
+	selected.EXPECT().Name().Return("selected-model").Maybe()
+	selected.EXPECT().Provider().Return(prov).Maybe()
+
+	options := []opts.Option[ExecutionContext]{WithModelSelector(func(context.Context, []messages.Message[messages.ModelMessage]) api.Model {
+		return selected
+	})}
+	_, err := runSteps(t, scriptedAgent(t, prov), noopResultHook[string]{}, options, "first", "second")
+	require.NoError(t, err)
+
+	require.Len(t, prov.params, 2)
+	for _, params := range prov.params {
+		assert.Equal(t, "selected-model", params.Model.Name())
+	}
+}
+
+// recordingHook keeps the assistant chunks, assistant messages and tool responses of a run
+// approvingHook approves the tool calls of every run it sees on the broker
+type approvingHook struct {
+	recordingHook
+	broker broker.Broker
+}
+
+func (h *approvingHook) OnToolCallMessage(ctx context.Context, msg messages.Message[messages.ToolCallMessage]) {
+	topic := h.broker.Topic(ctx, msg.RunID.String())
+	_, _ = topic.Subscribe(ctx, approver{topic: topic})
+}
+
+type approver struct {
+	noopHook
+	topic broker.Topic
+}
+
+func (a approver) OnApprovalRequest(ctx context.Context, msg messages.Message[messages.ApprovalRequest]) {
+	_ = a.topic.Publish(ctx, events.Request[messages.Approval]{
+		RunID:   msg.RunID,
+		TurnID:  msg.TurnID,
+		Message: messages.Approval{ToolCallID: msg.Payload.ToolCallID, Approved: true},
+	})
+}
+
+func (approver) OnApproval(context.Context, messages.Message[messages.Approval]) {}
+
+func TestWithBrokerApprovesToolCalls(t *testing.T) {
+	t.Run("runs the tool once it's approved", func(t *testing.T) {
+		b := broker.Local()
+		prov := &scriptedProvider{turns: [][]provider.StreamEvent{callTools("deploy")}}
+		worker := scriptedAgent(t, prov, tool.Definition{Name: "deploy", RequiresApproval: true, Function: func() tool.StopRun {
+			return tool.Stop("deployed")
+		}})
+
+		hook := &approvingHook{broker: b}
+		result, err := runSteps(t, worker, hook, []opts.Option[ExecutionContext]{WithBroker(b), WithApprovalTimeout(2 * time.Second)}, "deploy it")
+		require.NoError(t, err)
+		assert.Equal(t, "deployed", result)
+	})
+
+	t.Run("denies the tool when the approval times out", func(t *testing.T) {
+		b := broker.Local()
+		prov := &scriptedProvider{turns: [][]provider.StreamEvent{callTools("deploy")}}
+		var calls int
+		worker := scriptedAgent(t, prov, tool.Definition{Name: "deploy", RequiresApproval: true, Function: func() string {
+			calls++
+			return "deploy started"
+		}})
+
+		hook := &recordingHook{}
+		_, _ = runSteps(t, worker, hook, []opts.Option[ExecutionContext]{WithBroker(b), WithApprovalTimeout(10 * time.Millisecond)}, "deploy it")
+		assert.Zero(t, calls)
+
+		hook.mu.Lock()
+		defer hook.mu.Unlock()
+		require.Len(t, hook.responses, 1)
+		assert.Contains(t, hook.responses[0].Payload.Content, "was denied")
+	})
+}
+
+type recordingHook struct {
+	noopResultHook[string]
+	mu        sync.Mutex
+	chunks    []messages.Message[messages.AssistantMessage]
+	messages  []messages.Message[messages.AssistantMessage]
+	responses []messages.Message[messages.ToolResponse]
+	// checkpoints are the encoded checkpoints of the runs
+	checkpoints [][]byte
+}
+
+func (h *recordingHook) OnCheckpoint(_ context.Context, _, _ uuid.UUID, checkpoint []byte) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.checkpoints = append(h.checkpoints, checkpoint)
+}
+
+// prefixCodec marks the JSON encoding of the checkpoints, so tests can tell it was used
+type prefixCodec struct{}
+
+func (prefixCodec) Encode(checkpoint provider.Checkpoint) ([]byte, error) {
+	data, err := provider.JSONCheckpointCodec{}.Encode(checkpoint)
+	return append([]byte("prefix:"), data...), err
+}
+
+func (prefixCodec) Decode(data []byte) (provider.Checkpoint, error) {
+	return provider.JSONCheckpointCodec{}.Decode(bytes.TrimPrefix(data, []byte("prefix:")))
+}
+
+func (h *recordingHook) OnAssistantChunk(_ context.Context, msg messages.Message[messages.AssistantMessage]) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.chunks = append(h.chunks, msg)
+}
+
+func (h *recordingHook) OnAssistantMessage(_ context.Context, msg messages.Message[messages.AssistantMessage]) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.messages = append(h.messages, msg)
+}
+
+func (h *recordingHook) OnToolCallResponse(_ context.Context, msg messages.Message[messages.ToolResponse]) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.responses = append(h.responses, msg)
+}
+
+func TestKnotRunAppliesRunOptions(t *testing.T) {
+	streamed := []provider.StreamEvent{
+		provider.Chunk[messages.AssistantMessage]{
+			Chunk: messages.AssistantMessage{Content: messages.AssistantContentOrParts{Content: "done"}},
+		},
+		answer("done")[0],
+	}
+
+	t.Run("WithMaxTurns", func(t *testing.T) {
+		// the continuation of a truncated response is a new turn
+		prov := &scriptedProvider{turns: [][]provider.StreamEvent{
+			{provider.Response[messages.AssistantMessage]{
+				Response:     messages.AssistantMessage{Content: messages.AssistantContentOrParts{Content: "The quick "}},
+				FinishReason: "length",
+			}},
+			answer("brown fox."),
+		}}
+
+		options := []opts.Option[ExecutionContext]{WithAutoContinue(1), WithMaxTurns(1)}
+		_, err := runSteps(t, scriptedAgent(t, prov), noopResultHook[string]{}, options, "hello")
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "max turns exceeded")
+		assert.Len(t, prov.params, 1)
+	})
+
+	t.Run("WithMaxToolCallsPerTurn", func(t *testing.T) {
+		prov := &scriptedProvider{turns: [][]provider.StreamEvent{callTools("count", "count")}}
+		var calls int
+		worker := scriptedAgent(t, prov, tool.Definition{Name: "count", Function: func() string { calls++; return "counted" }})
+
+		hook := &recordingHook{}
+		_, _ = runSteps(t, worker, hook, []opts.Option[ExecutionContext]{WithMaxToolCallsPerTurn(1)}, "hello")
+		assert.Equal(t, 1, calls, "the second call is skipped")
+		require.Len(t, hook.responses, 2)
+		assert.Contains(t, hook.responses[0].Payload.Content, "was not executed")
+		assert.Equal(t, "counted", hook.responses[1].Payload.Content)
+	})
+
+	t.Run("WithCheckpointCodec", func(t *testing.T) {
+		prov := &scriptedProvider{turns: [][]provider.StreamEvent{answer("Hi Ada")}}
+		worker := scriptedAgent(t, prov)
+
+		hook := &recordingHook{}
+		_, err := runSteps(t, worker, hook, nil, "my name is Ada")
+		require.NoError(t, err)
+		require.Len(t, hook.checkpoints, 1)
+		assert.True(t, json.Valid(hook.checkpoints[0]), "checkpoints are JSON by default")
+
+		prov = &scriptedProvider{turns: [][]provider.StreamEvent{answer("Hi Ada")}}
+		hook = &recordingHook{}
+		_, err = runSteps(t, scriptedAgent(t, prov), hook, []opts.Option[ExecutionContext]{WithCheckpointCodec(prefixCodec{})}, "my name is Ada")
+		require.NoError(t, err)
+		require.Len(t, hook.checkpoints, 1)
+		checkpoint, err := prefixCodec{}.Decode(hook.checkpoints[0])
+		require.NoError(t, err)
+		assert.Len(t, checkpoint.Messages(), 2)
+	})
+
+	t.Run("WithConcurrentToolCalls", func(t *testing.T) {
+		// each tool waits for the other one to start, that only works when they run at the same time
+		started := map[string]chan struct{}{"left": make(chan struct{}), "right": make(chan struct{})}
+		meet := func(name, other string) tool.Definition {
+			return tool.Definition{Name: name, Function: func() (string, error) {
+				close(started[name])
+				select {
+				case <-started[other]:
+					return "met", nil
+				case <-time.After(time.Second):
+					return "", fmt.Errorf("%s didn't start", other)
+				}
+			}}
+		}
+		prov := &scriptedProvider{turns: [][]provider.StreamEvent{callTools("left", "right")}}
+		worker := scriptedAgent(t, prov, meet("left", "right"), meet("right", "left"))
+
+		hook := &recordingHook{}
+		_, _ = runSteps(t, worker, hook, []opts.Option[ExecutionContext]{WithConcurrentToolCalls(true)}, "hello")
+		hook.mu.Lock()
+		defer hook.mu.Unlock()
+		require.Len(t, hook.responses, 2)
+		assert.Equal(t, "met", hook.responses[0].Payload.Content)
+		assert.Equal(t, "met", hook.responses[1].Payload.Content)
+	})
+
+	t.Run("WithRunState", func(t *testing.T) {
+		prov := &scriptedProvider{turns: [][]provider.StreamEvent{callTools("remember")}}
+		worker := scriptedAgent(t, prov, tool.Definition{Name: "remember", Function: func(state *types.RunState) tool.StopRun {
+			state.Set("remembered", true)
+			return tool.Stop("done")
+		}})
+
+		state := types.NewRunState()
+		result, err := runSteps(t, worker, noopResultHook[string]{}, []opts.Option[ExecutionContext]{WithRunState(state)}, "hello")
+		require.NoError(t, err)
+		assert.Equal(t, "done", result)
+		remembered, ok := state.Get("remembered")
+		require.True(t, ok, "the tool sees the run state of the execution context")
+		assert.Equal(t, true, remembered)
+	})
+
+	t.Run("SuppressChunks", func(t *testing.T) {
+		prov := &scriptedProvider{turns: [][]provider.StreamEvent{streamed}}
+		hook := &recordingHook{}
+		_, err := runSteps(t, scriptedAgent(t, prov), hook, []opts.Option[ExecutionContext]{Streaming(true), SuppressChunks(true)}, "hello")
+		require.NoError(t, err)
+		assert.Empty(t, hook.chunks)
+		assert.Len(t, hook.messages, 1)
+	})
+
+	t.Run("SuppressRedundantFinal", func(t *testing.T) {
+		prov := &scriptedProvider{turns: [][]provider.StreamEvent{streamed}}
+		hook := &recordingHook{}
+		_, err := runSteps(t, scriptedAgent(t, prov), hook, []opts.Option[ExecutionContext]{Streaming(true), SuppressRedundantFinal(true)}, "hello")
+		require.NoError(t, err)
+		assert.Len(t, hook.chunks, 1)
+		assert.Empty(t, hook.messages, "the final repeats the chunks")
+	})
+
+	t.Run("WithSenderName", func(t *testing.T) {
+		prov := &scriptedProvider{turns: [][]provider.StreamEvent{answer("done")}}
+		hook := &recordingHook{}
+		_, err := runSteps(t, scriptedAgent(t, prov), hook, []opts.Option[ExecutionContext]{WithSenderName("worker", "Worker Bee")}, "hello")
+		require.NoError(t, err)
+		require.Len(t, hook.messages, 1)
+		assert.Equal(t, "Worker Bee", hook.messages[0].Sender)
+	})
+
+	t.Run("WithAutoContinue", func(t *testing.T) {
+		prov := &scriptedProvider{turns: [][]provider.StreamEvent{
+			{provider.Response[messages.AssistantMessage]{
+				Response:     messages.AssistantMessage{Content: messages.AssistantContentOrParts{Content: "The quick "}},
+				FinishReason: "length",
+			}},
+			answer("brown fox."),
+		}}
+		result, err := runSteps(t, scriptedAgent(t, prov), noopResultHook[string]{}, []opts.Option[ExecutionContext]{WithAutoContinue(1)}, "hello")
+		require.NoError(t, err)
+		assert.Equal(t, "The quick brown fox.", result)
+	})
+
+	brokerOptions := map[string]func(broker.Broker) opts.Option[ExecutionContext]{
+		"WithBroker": WithBroker,
+		"WithRoutedBroker": func(b broker.Broker) opts.Option[ExecutionContext] {
+			return WithRoutedBroker(b, func(uuid.UUID, events.Event) string { return "all-runs" })
+		},
+	}
+	for name, option := range brokerOptions {
+		t.Run(name+" cancels tool calls", func(t *testing.T) {
+			b := broker.Local()
+			prov := &scriptedProvider{turns: [][]provider.StreamEvent{callTools("slow")}}
+			cancelled := make(chan struct{})
+			worker := scriptedAgent(t, prov, tool.Definition{Name: "slow", Function: func(ctx context.Context) string {
+				runID, _ := executor.RunIDFromContext(ctx)
+				_ = b.Topic(ctx, runID.String()).Publish(ctx, events.CancelTool{RunID: runID, ToolCallID: "call-1", Reason: "too slow"})
+				select {
+				case <-ctx.Done():
+					close(cancelled)
+				case <-time.After(2 * time.Second):
+				}
+				return "finished"
+			}})
+
+			hook := &recordingHook{}
+			_, _ = runSteps(t, worker, hook, []opts.Option[ExecutionContext]{option(b)}, "hello")
+			select {
+			case <-cancelled:
+			default:
+				t.Fatal("the tool call wasn't cancelled")
+			}
+		})
+	}
+}
@@ -24,6 +24,7 @@ require (
 	github.com/wk8/go-ordered-map/v2 v2.1.8
 	go.temporal.io/api v1.43.2
 	go.temporal.io/sdk v1.32.1
+	google.golang.org/protobuf v1.34.2
 	mvdan.cc/gofumpt v0.7.0
 )
 
@@ -86,6 +87,5 @@ require (
 	google.golang.org/genproto/googleapis/api v0.0.0-20240827150818-7e3bb234dfed // indirect
 	google.golang.org/genproto/googleapis/rpc v0.0.0-20240827150818-7e3bb234dfed // indirect
 	google.golang.org/grpc v1.66.0 // indirect
-	google.golang.org/protobuf v1.34.2 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
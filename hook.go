@@ -7,6 +7,7 @@ import (
 	"context"
 
 	"github.com/casualjim/bubo/events"
+	"github.com/casualjim/bubo/messages"
 )
 
 // Hook extends the events.Hook interface to provide type-safe result handling
@@ -87,3 +88,24 @@ type Hook[T any] interface {
 	// is cancelled.
 	OnClose(context.Context)
 }
+
+// noopHook ignores all the events, it's used when the caller only needs the result
+type noopHook struct{}
+
+func (noopHook) OnUserPrompt(context.Context, messages.Message[messages.UserMessage])            {}
+func (noopHook) OnAssistantChunk(context.Context, messages.Message[messages.AssistantMessage])   {}
+func (noopHook) OnToolCallChunk(context.Context, messages.Message[messages.ToolCallMessage])     {}
+func (noopHook) OnAssistantMessage(context.Context, messages.Message[messages.AssistantMessage]) {}
+func (noopHook) OnToolCallMessage(context.Context, messages.Message[messages.ToolCallMessage])   {}
+func (noopHook) OnToolCallResponse(context.Context, messages.Message[messages.ToolResponse])     {}
+func (noopHook) OnError(context.Context, error)                                                  {}
+
+var _ events.Hook = noopHook{}
+
+// noopResultHook ignores all the events and the result, the result is delivered some other way
+type noopResultHook[T any] struct {
+	noopHook
+}
+
+func (noopResultHook[T]) OnResult(context.Context, T) {}
+func (noopResultHook[T]) OnClose(context.Context)     {}
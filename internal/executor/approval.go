@@ -0,0 +1,150 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/casualjim/bubo/broker"
+	"github.com/casualjim/bubo/events"
+	"github.com/casualjim/bubo/messages"
+	"github.com/go-openapi/strfmt"
+	"github.com/google/uuid"
+)
+
+// DefaultApprovalTimeout is how long a tool call waits for an approval when no timeout is configured.
+const DefaultApprovalTimeout = 5 * time.Minute
+
+const approvalHeartbeatInterval = 5 * time.Second
+
+type approvalParams struct {
+	topic   broker.Topic
+	timeout time.Duration
+	runID   uuid.UUID
+	turnID  uuid.UUID
+	sender  string
+	// heartbeat is called periodically while waiting, so long waits don't look like a stuck activity
+	heartbeat func()
+}
+
+// awaitApproval publishes an approval request for the tool call on the topic and blocks
+// until an approval for the call is published, or the timeout expires.
+// A missing topic or an expired timeout are reported as a denial, an error is only
+// returned when the request can't be published or the context is cancelled.
+func awaitApproval(ctx context.Context, params approvalParams, call messages.ToolCallData) (messages.Approval, error) {
+	if params.topic == nil {
+		return messages.Approval{
+			ToolCallID: call.ID,
+			Reason:     "no approval channel is configured for this run",
+		}, nil
+	}
+
+	timeout := effectiveApprovalTimeout(params.timeout)
+
+	waitCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	waiter := &approvalWaiter{toolCallID: call.ID, approvals: make(chan messages.Approval, 1)}
+	sub, err := params.topic.Subscribe(waitCtx, waiter)
+	if err != nil {
+		return messages.Approval{}, fmt.Errorf("failed to subscribe to approvals: %w", err)
+	}
+	defer sub.Unsubscribe()
+
+	if err := params.topic.Publish(ctx, events.Request[messages.ApprovalRequest]{
+		RunID:  params.runID,
+		TurnID: params.turnID,
+		Message: messages.ApprovalRequest{
+			ToolName:   call.Name,
+			ToolCallID: call.ID,
+			Arguments:  call.Arguments,
+		},
+		Sender:    params.sender,
+		Timestamp: strfmt.DateTime(time.Now()),
+	}); err != nil {
+		return messages.Approval{}, fmt.Errorf("failed to publish approval request: %w", err)
+	}
+
+	ticker := time.NewTicker(approvalHeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case approval := <-waiter.approvals:
+			return approval, nil
+		case <-ticker.C:
+			if params.heartbeat != nil {
+				params.heartbeat()
+			}
+		case <-waitCtx.Done():
+			if errors.Is(waitCtx.Err(), context.DeadlineExceeded) && ctx.Err() == nil {
+				return messages.Approval{
+					ToolCallID: call.ID,
+					Reason:     fmt.Sprintf("no approval was received within %s", timeout),
+				}, nil
+			}
+			return messages.Approval{}, ctx.Err()
+		}
+	}
+}
+
+func effectiveApprovalTimeout(timeout time.Duration) time.Duration {
+	if timeout <= 0 {
+		return DefaultApprovalTimeout
+	}
+	return timeout
+}
+
+// deniedToolCallResponse builds the tool response that informs the model a tool call
+// was not executed because it was not approved.
+func deniedToolCallResponse(call messages.ToolCallData, approval messages.Approval) messages.Message[messages.ToolResponse] {
+	content := fmt.Sprintf("tool call %s was denied and not executed", call.Name)
+	if approval.Reason != "" {
+		content += ": " + approval.Reason
+	}
+	return messages.New().ToolResponse(call.ID, call.Name, content)
+}
+
+// approvalWaiter is the subscriber that waits for the approval of a single tool call.
+type approvalWaiter struct {
+	toolCallID string
+	approvals  chan messages.Approval
+}
+
+var (
+	_ events.Hook         = (*approvalWaiter)(nil)
+	_ events.ApprovalHook = (*approvalWaiter)(nil)
+)
+
+func (w *approvalWaiter) OnApproval(_ context.Context, msg messages.Message[messages.Approval]) {
+	if msg.Payload.ToolCallID != w.toolCallID {
+		return
+	}
+	select {
+	case w.approvals <- msg.Payload:
+	default:
+	}
+}
+
+func (w *approvalWaiter) OnApprovalRequest(context.Context, messages.Message[messages.ApprovalRequest]) {
+}
+
+func (w *approvalWaiter) OnUserPrompt(context.Context, messages.Message[messages.UserMessage]) {}
+
+func (w *approvalWaiter) OnAssistantChunk(context.Context, messages.Message[messages.AssistantMessage]) {
+}
+
+func (w *approvalWaiter) OnToolCallChunk(context.Context, messages.Message[messages.ToolCallMessage]) {
+}
+
+func (w *approvalWaiter) OnAssistantMessage(context.Context, messages.Message[messages.AssistantMessage]) {
+}
+
+func (w *approvalWaiter) OnToolCallMessage(context.Context, messages.Message[messages.ToolCallMessage]) {
+}
+
+func (w *approvalWaiter) OnToolCallResponse(context.Context, messages.Message[messages.ToolResponse]) {
+}
+
+func (w *approvalWaiter) OnError(context.Context, error) {}
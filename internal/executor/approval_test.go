@@ -0,0 +1,141 @@
+package executor
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/casualjim/bubo/broker"
+	"github.com/casualjim/bubo/events"
+	"github.com/casualjim/bubo/internal/mocks"
+	"github.com/casualjim/bubo/internal/shorttermmemory"
+	"github.com/casualjim/bubo/messages"
+	"github.com/casualjim/bubo/pkg/uuidx"
+	"github.com/casualjim/bubo/tool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// approver answers every approval request it sees on the topic
+type approver struct {
+	approvalWaiter
+	topic    broker.Topic
+	approved bool
+	reason   string
+	requests chan messages.ApprovalRequest
+}
+
+func (a *approver) OnApprovalRequest(ctx context.Context, msg messages.Message[messages.ApprovalRequest]) {
+	a.requests <- msg.Payload
+	_ = a.topic.Publish(ctx, events.Request[messages.Approval]{
+		RunID:  msg.RunID,
+		TurnID: msg.TurnID,
+		Message: messages.Approval{
+			ToolCallID: msg.Payload.ToolCallID,
+			Approved:   a.approved,
+			Reason:     a.reason,
+		},
+	})
+}
+
+func TestHandleToolCallsWithApproval(t *testing.T) {
+	setup := func(t *testing.T) (*mockAgent, *bool, *[]messages.Message[messages.ToolResponse], *mocks.Hook) {
+		executed := new(bool)
+		agent := newTestAgent()
+		agent.testTools = []tool.Definition{
+			tool.Must(func() string {
+				*executed = true
+				return "deleted"
+			}, tool.Name("deleteAccount"), tool.RequireApproval()),
+		}
+
+		responses := new([]messages.Message[messages.ToolResponse])
+		hook := mocks.NewHook(t)
+		hook.EXPECT().OnToolCallResponse(mock.Anything, mock.MatchedBy(func(msg messages.Message[messages.ToolResponse]) bool {
+			*responses = append(*responses, msg)
+			return true
+		}))
+		return agent, executed, responses, hook
+	}
+
+	call := messages.ToolCallData{ID: "call-1", Name: "deleteAccount", Arguments: "{}"}
+
+	run := func(ctx context.Context, agent *mockAgent, hook *mocks.Hook, approvals approvalParams) error {
+		_, err := NewLocal().handleToolCalls(ctx, toolCallParams{
+			runID:     approvals.runID,
+			agent:     agent,
+			mem:       shorttermmemory.New(),
+			hook:      hook,
+			toolCalls: messages.ToolCallMessage{ToolCalls: []messages.ToolCallData{call}},
+			approvals: approvals,
+		})
+		return err
+	}
+
+	t.Run("approved", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		agent, executed, responses, hook := setup(t)
+		topic := broker.Local().Topic(ctx, "run")
+		human := &approver{topic: topic, approved: true, requests: make(chan messages.ApprovalRequest, 1)}
+		_, err := topic.Subscribe(ctx, human)
+		require.NoError(t, err)
+
+		err = run(ctx, agent, hook, approvalParams{topic: topic, timeout: 5 * time.Second, runID: uuidx.New()})
+		require.NoError(t, err)
+
+		request := <-human.requests
+		assert.Equal(t, "call-1", request.ToolCallID)
+		assert.Equal(t, "deleteAccount", request.ToolName)
+
+		assert.True(t, *executed)
+		require.Len(t, *responses, 1)
+		assert.Equal(t, "deleted", (*responses)[0].Payload.Content)
+	})
+
+	t.Run("denied", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		agent, executed, responses, hook := setup(t)
+		topic := broker.Local().Topic(ctx, "run")
+		human := &approver{topic: topic, reason: "not today", requests: make(chan messages.ApprovalRequest, 1)}
+		_, err := topic.Subscribe(ctx, human)
+		require.NoError(t, err)
+
+		err = run(ctx, agent, hook, approvalParams{topic: topic, timeout: 5 * time.Second, runID: uuidx.New()})
+		require.NoError(t, err)
+
+		assert.False(t, *executed)
+		require.Len(t, *responses, 1)
+		assert.Equal(t, "tool call deleteAccount was denied and not executed: not today", (*responses)[0].Payload.Content)
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		agent, executed, responses, hook := setup(t)
+		topic := broker.Local().Topic(ctx, "run")
+
+		err := run(ctx, agent, hook, approvalParams{topic: topic, timeout: 50 * time.Millisecond, runID: uuidx.New()})
+		require.NoError(t, err)
+
+		assert.False(t, *executed)
+		require.Len(t, *responses, 1)
+		assert.Contains(t, (*responses)[0].Payload.Content, "no approval was received within 50ms")
+	})
+
+	t.Run("no approval channel", func(t *testing.T) {
+		agent, executed, responses, hook := setup(t)
+
+		err := run(context.Background(), agent, hook, approvalParams{runID: uuidx.New()})
+		require.NoError(t, err)
+
+		assert.False(t, *executed)
+		require.Len(t, *responses, 1)
+		assert.Contains(t, (*responses)[0].Payload.Content, "no approval channel is configured")
+	})
+}
@@ -0,0 +1,121 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/casualjim/bubo/broker"
+	"github.com/casualjim/bubo/events"
+	"github.com/casualjim/bubo/messages"
+)
+
+// errToolCancelled is the cause of the context of a tool call that was cancelled with a CancelTool event
+var errToolCancelled = errors.New("tool call was cancelled")
+
+// toolCancellations tracks the running tool calls of a run, so the CancelTool events
+// published on the run's topic can abort them.
+// A nil *toolCancellations tracks nothing, the tool calls can't be cancelled.
+type toolCancellations struct {
+	mu      sync.Mutex
+	running map[string]context.CancelCauseFunc
+	// cancelled holds the reasons of the cancellations, including the ones that arrived before the call started
+	cancelled map[string]string
+}
+
+// watchToolCancellations subscribes to the topic for CancelTool events, the subscription
+// is closed when the returned function is called.
+func watchToolCancellations(ctx context.Context, topic broker.Topic) (*toolCancellations, func(), error) {
+	if topic == nil {
+		return nil, func() {}, nil
+	}
+
+	c := &toolCancellations{
+		running:   make(map[string]context.CancelCauseFunc),
+		cancelled: make(map[string]string),
+	}
+	sub, err := topic.Subscribe(ctx, c)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to subscribe to tool cancellations: %w", err)
+	}
+	return c, sub.Unsubscribe, nil
+}
+
+// track returns the context to run the tool call with, it's cancelled when a CancelTool event
+// for the call arrives. The returned function stops tracking the call.
+func (c *toolCancellations) track(ctx context.Context, toolCallID string) (context.Context, func()) {
+	if c == nil {
+		return ctx, func() {}
+	}
+
+	callCtx, cancel := context.WithCancelCause(ctx)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, cancelled := c.cancelled[toolCallID]; cancelled {
+		cancel(errToolCancelled)
+	}
+	c.running[toolCallID] = cancel
+
+	return callCtx, func() {
+		c.mu.Lock()
+		delete(c.running, toolCallID)
+		c.mu.Unlock()
+		cancel(nil)
+	}
+}
+
+// reason returns the reason the tool call was cancelled for, and whether it was cancelled
+func (c *toolCancellations) reason(toolCallID string) (string, bool) {
+	if c == nil {
+		return "", false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	reason, ok := c.cancelled[toolCallID]
+	return reason, ok
+}
+
+func (c *toolCancellations) OnCancelTool(_ context.Context, event events.CancelTool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cancelled[event.ToolCallID] = event.Reason
+	if cancel, ok := c.running[event.ToolCallID]; ok {
+		cancel(errToolCancelled)
+	}
+}
+
+// cancelledToolCallResponse builds the tool response that informs the model a tool call
+// was aborted before it completed.
+func cancelledToolCallResponse(call messages.ToolCallData, reason string) messages.Message[messages.ToolResponse] {
+	content := fmt.Sprintf("tool call %s was cancelled", call.Name)
+	if reason != "" {
+		content += ": " + reason
+	}
+	return messages.New().ToolResponse(call.ID, call.Name, content)
+}
+
+var (
+	_ events.Hook           = (*toolCancellations)(nil)
+	_ events.CancelToolHook = (*toolCancellations)(nil)
+)
+
+func (c *toolCancellations) OnUserPrompt(context.Context, messages.Message[messages.UserMessage]) {}
+
+func (c *toolCancellations) OnAssistantChunk(context.Context, messages.Message[messages.AssistantMessage]) {
+}
+
+func (c *toolCancellations) OnToolCallChunk(context.Context, messages.Message[messages.ToolCallMessage]) {
+}
+
+func (c *toolCancellations) OnAssistantMessage(context.Context, messages.Message[messages.AssistantMessage]) {
+}
+
+func (c *toolCancellations) OnToolCallMessage(context.Context, messages.Message[messages.ToolCallMessage]) {
+}
+
+func (c *toolCancellations) OnToolCallResponse(context.Context, messages.Message[messages.ToolResponse]) {
+}
+
+func (c *toolCancellations) OnError(context.Context, error) {}
@@ -0,0 +1,78 @@
+package executor
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/casualjim/bubo/broker"
+	"github.com/casualjim/bubo/events"
+	"github.com/casualjim/bubo/internal/mocks"
+	"github.com/casualjim/bubo/internal/shorttermmemory"
+	"github.com/casualjim/bubo/messages"
+	"github.com/casualjim/bubo/pkg/uuidx"
+	"github.com/casualjim/bubo/tool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleToolCallsCancelTool(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	runID := uuidx.New()
+	topic := broker.Local().Topic(ctx, runID.String())
+
+	started := make(chan struct{})
+	aborted := make(chan error, 1)
+	agent := newTestAgent()
+	agent.testTools = []tool.Definition{
+		tool.Must(func(ctx context.Context) (string, error) {
+			close(started)
+			select {
+			case <-ctx.Done():
+				aborted <- ctx.Err()
+				return "", ctx.Err()
+			case <-time.After(5 * time.Second):
+				return "report ready", nil
+			}
+		}, tool.Name("buildReport")),
+	}
+
+	var responses []messages.Message[messages.ToolResponse]
+	hook := mocks.NewHook(t)
+	hook.EXPECT().OnToolCallResponse(mock.Anything, mock.MatchedBy(func(msg messages.Message[messages.ToolResponse]) bool {
+		responses = append(responses, msg)
+		return true
+	}))
+
+	cancellations, unsubscribe, err := watchToolCancellations(ctx, topic)
+	require.NoError(t, err)
+	defer unsubscribe()
+
+	go func() {
+		<-started
+		_ = topic.Publish(ctx, events.CancelTool{RunID: runID, ToolCallID: "call-1", Reason: "taking too long"})
+	}()
+
+	_, err = NewLocal().handleToolCalls(ctx, toolCallParams{
+		runID:         runID,
+		agent:         agent,
+		mem:           shorttermmemory.New(),
+		hook:          hook,
+		toolCalls:     messages.ToolCallMessage{ToolCalls: []messages.ToolCallData{{ID: "call-1", Name: "buildReport", Arguments: "{}"}}},
+		cancellations: cancellations,
+	})
+	require.NoError(t, err)
+
+	select {
+	case err := <-aborted:
+		assert.ErrorIs(t, err, context.Canceled)
+	default:
+		t.Fatal("the tool was not aborted")
+	}
+	require.Len(t, responses, 1)
+	assert.Equal(t, "call-1", responses[0].Payload.ToolCallID)
+	assert.Equal(t, "tool call buildReport was cancelled: taking too long", responses[0].Payload.Content)
+}
@@ -0,0 +1,282 @@
+package executor
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/casualjim/bubo/types"
+	json "github.com/goccy/go-json"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// ContextVarsCodec serializes context variables when they cross a workflow or activity boundary.
+// The payloads are encoded with TypedContextVarsCodec and name it next to the context variables,
+// payloads without a codec name, like the ones in histories recorded before, are decoded as plain JSON.
+type ContextVarsCodec interface {
+	Encode(types.ContextVars) ([]byte, error)
+	Decode([]byte) (types.ContextVars, error)
+}
+
+// typedCodecName is stored next to the context variables that were encoded with TypedContextVarsCodec
+const typedCodecName = "typed"
+
+// codecSuffix is appended to the path of the context variables to get the path of the codec name
+const codecSuffix = "_codec"
+
+// JSONContextVarsCodec encodes context variables as plain JSON, it decodes payloads that don't name a codec.
+// Numbers are decoded as float64, so Go types don't survive a round trip.
+func JSONContextVarsCodec() ContextVarsCodec {
+	return jsonContextVarsCodec{}
+}
+
+type jsonContextVarsCodec struct{}
+
+func (jsonContextVarsCodec) Encode(cv types.ContextVars) ([]byte, error) {
+	return json.Marshal(cv)
+}
+
+func (jsonContextVarsCodec) Decode(data []byte) (types.ContextVars, error) {
+	var cv types.ContextVars
+	if err := json.Unmarshal(data, &cv); err != nil {
+		return nil, err
+	}
+	return cv, nil
+}
+
+// TypedContextVarsCodec encodes every context variable together with its Go type,
+// so integers, unsigned integers and floats decode to the type they were encoded from.
+// Nested maps and slices are tagged recursively, other values are encoded as plain JSON.
+// It encodes the context variables of every payload that crosses a workflow or activity boundary.
+func TypedContextVarsCodec() ContextVarsCodec {
+	return typedContextVarsCodec{}
+}
+
+type typedContextVarsCodec struct{}
+
+func (typedContextVarsCodec) Encode(cv types.ContextVars) ([]byte, error) {
+	if cv == nil {
+		return jsonNull, nil
+	}
+	return encodeTypedMap(cv)
+}
+
+func (typedContextVarsCodec) Decode(data []byte) (types.ContextVars, error) {
+	if !gjson.ValidBytes(data) {
+		return nil, fmt.Errorf("invalid json: %s", data)
+	}
+	parsed := gjson.ParseBytes(data)
+	if parsed.Type == gjson.Null {
+		return nil, nil
+	}
+	m, err := decodeTypedMap(parsed)
+	if err != nil {
+		return nil, err
+	}
+	return types.ContextVars(m), nil
+}
+
+var jsonNull = []byte("null")
+
+type typedValue struct {
+	Type  string          `json:"type"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+func encodeTypedMap(m map[string]any) ([]byte, error) {
+	result := make(map[string]json.RawMessage, len(m))
+	for key, value := range m {
+		encoded, err := encodeTypedValue(value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode context variable %q: %w", key, err)
+		}
+		result[key] = encoded
+	}
+	return json.Marshal(result)
+}
+
+func encodeTypedValue(value any) ([]byte, error) {
+	var tv typedValue
+	var err error
+
+	switch v := value.(type) {
+	case nil:
+		tv.Type = "null"
+	case types.ContextVars:
+		tv.Type = "map"
+		tv.Value, err = encodeTypedMap(v)
+	case map[string]any:
+		tv.Type = "map"
+		tv.Value, err = encodeTypedMap(v)
+	case []any:
+		tv.Type = "slice"
+		elems := make([]json.RawMessage, len(v))
+		for i, elem := range v {
+			if elems[i], err = encodeTypedValue(elem); err != nil {
+				return nil, err
+			}
+		}
+		tv.Value, err = json.Marshal(elems)
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64, bool, string:
+		tv.Type = fmt.Sprintf("%T", v)
+		tv.Value, err = json.Marshal(v)
+	default:
+		tv.Type = "json"
+		tv.Value, err = json.Marshal(v)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(tv)
+}
+
+func decodeTypedMap(data gjson.Result) (map[string]any, error) {
+	if !data.IsObject() {
+		return nil, fmt.Errorf("expected an object, got %s", data.Raw)
+	}
+
+	result := make(map[string]any)
+	var err error
+	data.ForEach(func(key, value gjson.Result) bool {
+		var decoded any
+		decoded, err = decodeTypedValue(value)
+		if err != nil {
+			err = fmt.Errorf("failed to decode context variable %q: %w", key.String(), err)
+			return false
+		}
+		result[key.String()] = decoded
+		return true
+	})
+	return result, err
+}
+
+func decodeTypedValue(data gjson.Result) (any, error) {
+	value := data.Get("value")
+	switch tpe := data.Get("type").String(); tpe {
+	case "null":
+		return nil, nil
+	case "map":
+		return decodeTypedMap(value)
+	case "slice":
+		if !value.IsArray() {
+			return nil, fmt.Errorf("expected an array, got %s", value.Raw)
+		}
+		elems := value.Array()
+		result := make([]any, len(elems))
+		for i, elem := range elems {
+			decoded, err := decodeTypedValue(elem)
+			if err != nil {
+				return nil, err
+			}
+			result[i] = decoded
+		}
+		return result, nil
+	case "int", "int8", "int16", "int32", "int64":
+		n, err := strconv.ParseInt(value.Raw, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		switch tpe {
+		case "int8":
+			return int8(n), nil
+		case "int16":
+			return int16(n), nil
+		case "int32":
+			return int32(n), nil
+		case "int64":
+			return n, nil
+		default:
+			return int(n), nil
+		}
+	case "uint", "uint8", "uint16", "uint32", "uint64":
+		n, err := strconv.ParseUint(value.Raw, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		switch tpe {
+		case "uint8":
+			return uint8(n), nil
+		case "uint16":
+			return uint16(n), nil
+		case "uint32":
+			return uint32(n), nil
+		case "uint64":
+			return n, nil
+		default:
+			return uint(n), nil
+		}
+	case "float32":
+		return float32(value.Float()), nil
+	case "float64":
+		return value.Float(), nil
+	case "bool":
+		return value.Bool(), nil
+	case "string":
+		return value.String(), nil
+	case "json":
+		var v any
+		if err := json.Unmarshal([]byte(value.Raw), &v); err != nil {
+			return nil, err
+		}
+		return v, nil
+	default:
+		return nil, fmt.Errorf("unknown context variable type %q", tpe)
+	}
+}
+
+// marshalContextVars encodes the context variables with the typed codec at the given path of the JSON document,
+// and names the codec next to them.
+func marshalContextVars(data []byte, path string, cv types.ContextVars) ([]byte, error) {
+	if cv == nil {
+		return sjson.DeleteBytes(data, path)
+	}
+	encoded, err := TypedContextVarsCodec().Encode(cv)
+	if err != nil {
+		return nil, err
+	}
+	data, err = sjson.SetRawBytes(data, path, encoded)
+	if err != nil {
+		return nil, err
+	}
+	return sjson.SetBytes(data, path+codecSuffix, typedCodecName)
+}
+
+// unmarshalContextVars decodes the context variables at the given path of the JSON document
+// with the codec that's named next to them.
+func unmarshalContextVars(data []byte, path string) (types.ContextVars, error) {
+	raw := gjson.GetBytes(data, path)
+	if !raw.Exists() || raw.Type == gjson.Null {
+		return nil, nil
+	}
+	codec := JSONContextVarsCodec()
+	if gjson.GetBytes(data, path+codecSuffix).String() == typedCodecName {
+		codec = TypedContextVarsCodec()
+	}
+	return codec.Decode([]byte(raw.Raw))
+}
+
+// marshalWithContextVars marshals v and stores the context variables at the given path,
+// encoded with the typed codec.
+func marshalWithContextVars(v any, path string, cv types.ContextVars) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return marshalContextVars(data, path, cv)
+}
+
+// unmarshalWithContextVars unmarshals the data into v, leaving out the context variables at the given path.
+// It returns the context variables decoded with the codec that's named next to them.
+func unmarshalWithContextVars(data []byte, path string, v any) (types.ContextVars, error) {
+	stripped, err := sjson.DeleteBytes(data, path)
+	if err != nil {
+		return nil, err
+	}
+	if stripped, err = sjson.DeleteBytes(stripped, path+codecSuffix); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(stripped, v); err != nil {
+		return nil, err
+	}
+	return unmarshalContextVars(data, path)
+}
@@ -0,0 +1,87 @@
+package executor
+
+import (
+	"testing"
+
+	"github.com/casualjim/bubo/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+)
+
+func TestTypedContextVarsCodec(t *testing.T) {
+	codec := TypedContextVarsCodec()
+
+	cv := types.ContextVars{
+		"int":     42,
+		"int64":   int64(1 << 60),
+		"uint8":   uint8(7),
+		"float32": float32(1.5),
+		"float64": 2.25,
+		"bool":    true,
+		"string":  "value",
+		"null":    nil,
+		"nested": map[string]any{
+			"count": 3,
+			"tags":  []any{"a", 1},
+		},
+		"struct": struct {
+			Name string `json:"name"`
+		}{Name: "test"},
+	}
+
+	data, err := codec.Encode(cv)
+	require.NoError(t, err)
+
+	decoded, err := codec.Decode(data)
+	require.NoError(t, err)
+
+	assert.Equal(t, 42, decoded["int"])
+	assert.Equal(t, int64(1<<60), decoded["int64"])
+	assert.Equal(t, uint8(7), decoded["uint8"])
+	assert.Equal(t, float32(1.5), decoded["float32"])
+	assert.Equal(t, 2.25, decoded["float64"])
+	assert.Equal(t, true, decoded["bool"])
+	assert.Equal(t, "value", decoded["string"])
+	assert.Nil(t, decoded["null"])
+	assert.Contains(t, decoded, "null")
+	assert.Equal(t, map[string]any{"count": 3, "tags": []any{"a", 1}}, decoded["nested"])
+	assert.Equal(t, map[string]any{"name": "test"}, decoded["struct"])
+
+	t.Run("nil", func(t *testing.T) {
+		data, err := codec.Encode(nil)
+		require.NoError(t, err)
+		decoded, err := codec.Decode(data)
+		require.NoError(t, err)
+		assert.Nil(t, decoded)
+	})
+
+	t.Run("unknown type", func(t *testing.T) {
+		_, err := codec.Decode([]byte(`{"key":{"type":"complex128","value":1}}`))
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), `unknown context variable type "complex128"`)
+	})
+}
+
+func TestRemoteRunCommandContextVars(t *testing.T) {
+	cmd := RemoteRunCommand{
+		MaxTurns:         3,
+		ContextVariables: types.ContextVars{"counter": 1},
+	}
+
+	data, err := cmd.MarshalJSON()
+	require.NoError(t, err)
+
+	var decoded RemoteRunCommand
+	require.NoError(t, decoded.UnmarshalJSON(data))
+	assert.Equal(t, 3, decoded.MaxTurns)
+	assert.Equal(t, types.ContextVars{"counter": 1}, decoded.ContextVariables)
+	assert.Equal(t, "typed", gjson.GetBytes(data, "context_variables_codec").String())
+
+	t.Run("plain JSON from before the typed codec", func(t *testing.T) {
+		var decoded RemoteRunCommand
+		require.NoError(t, decoded.UnmarshalJSON([]byte(`{"max_turns":3,"context_variables":{"counter":1}}`)))
+		assert.Equal(t, 3, decoded.MaxTurns)
+		assert.Equal(t, types.ContextVars{"counter": float64(1)}, decoded.ContextVariables)
+	})
+}
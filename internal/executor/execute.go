@@ -7,15 +7,20 @@ import (
 	"maps"
 	"math"
 	"reflect"
+	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/casualjim/bubo/api"
+	"github.com/casualjim/bubo/broker"
 	"github.com/casualjim/bubo/events"
 	"github.com/casualjim/bubo/internal/shorttermmemory"
+	"github.com/casualjim/bubo/messages"
 	"github.com/casualjim/bubo/pkg/stdx"
 	"github.com/casualjim/bubo/pkg/uuidx"
 	"github.com/casualjim/bubo/provider"
+	"github.com/casualjim/bubo/tool"
 	"github.com/casualjim/bubo/types"
 	"github.com/goccy/go-json"
 	"github.com/google/uuid"
@@ -61,15 +66,43 @@ func NewRunCommand(agent api.Agent, thread *shorttermmemory.Aggregator, hook eve
 	}, nil
 }
 
+// ToolsFunc returns the tools that are available in a turn, it's called before every completion
+// with the context variables of the run.
+type ToolsFunc func(ctx context.Context, cv types.ContextVars) []tool.Definition
+
+// ModelSelector picks the model of a turn from the messages of the thread, it's called before every completion.
+// The model of the agent is used when it returns nil.
+type ModelSelector func(ctx context.Context, msgs []messages.Message[messages.ModelMessage]) api.Model
+
 type RunCommand struct {
-	id               uuid.UUID
-	Agent            api.Agent
-	Thread           *shorttermmemory.Aggregator
-	StructuredOutput *provider.StructuredOutput
-	Stream           bool
-	MaxTurns         int
-	ContextVariables types.ContextVars
-	Hook             events.Hook
+	id                     uuid.UUID
+	ParentRunID            uuid.UUID
+	Agent                  api.Agent
+	Thread                 *shorttermmemory.Aggregator
+	StructuredOutput       *provider.StructuredOutput
+	Stream                 bool
+	MaxTurns               int
+	ContextVariables       types.ContextVars
+	RunState               *types.RunState
+	ToolsFunc              ToolsFunc
+	ModelSelector          ModelSelector
+	Hook                   events.Hook
+	UserID                 string
+	HashUserID             bool
+	MaxToolCallsPerTurn    int
+	ConcurrentToolCalls    bool
+	AssistantPrefill       string
+	StopSequences          []string
+	IncludeStreamUsage     bool
+	SuppressChunks         bool
+	SuppressRedundantFinal bool
+	ModelParams            provider.ModelParams
+	Approvals              broker.Topic
+	ApprovalTimeout        time.Duration
+	Cancellations          broker.Topic
+	SenderNames            map[string]string
+	AutoContinue           int
+	CheckpointCodec        provider.CheckpointCodec
 }
 
 func (r *RunCommand) Validate() error {
@@ -85,6 +118,23 @@ func (r *RunCommand) Validate() error {
 	return nil
 }
 
+// hasInput reports whether the thread has a user message or instructions message with content.
+func hasInput(thread *shorttermmemory.Aggregator) bool {
+	for msg := range thread.MessagesIter() {
+		switch payload := msg.Payload.(type) {
+		case messages.UserMessage:
+			if strings.TrimSpace(payload.Content.Content) != "" || len(payload.Content.Parts) > 0 {
+				return true
+			}
+		case messages.InstructionsMessage:
+			if strings.TrimSpace(payload.Content) != "" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 func (r *RunCommand) initializeContextVars() types.ContextVars {
 	if r.ContextVariables != nil {
 		return maps.Clone(r.ContextVariables)
@@ -96,6 +146,19 @@ func (r *RunCommand) ID() uuid.UUID {
 	return r.id
 }
 
+type runIDKey struct{}
+
+// withRunID returns a context that carries the ID of the run
+func withRunID(ctx context.Context, runID uuid.UUID) context.Context {
+	return context.WithValue(ctx, runIDKey{}, runID)
+}
+
+// RunIDFromContext returns the ID of the run the context belongs to, the tools of a run receive it with their context
+func RunIDFromContext(ctx context.Context) (uuid.UUID, bool) {
+	id, ok := ctx.Value(runIDKey{}).(uuid.UUID)
+	return id, ok
+}
+
 func (r RunCommand) WithStream(stream bool) RunCommand {
 	r.Stream = stream
 	return r
@@ -111,11 +174,136 @@ func (r RunCommand) WithContextVariables(contextVariables types.ContextVars) Run
 	return r
 }
 
+// WithRunState sets the run-scoped state that is shared by the tools of the run,
+// a new state is created for the run when it is nil. Only the local executor supports it,
+// the temporal executor rejects runs with a run state.
+func (r RunCommand) WithRunState(state *types.RunState) RunCommand {
+	r.RunState = state
+	return r
+}
+
+func (r RunCommand) WithMaxToolCallsPerTurn(maxToolCalls int) RunCommand {
+	r.MaxToolCallsPerTurn = maxToolCalls
+	return r
+}
+
+// WithConcurrentToolCalls runs the tool calls of a turn at the same time for agents that allow
+// parallel tool calls. Without it the tools are called one after another, in the order of the calls.
+// Only the local executor supports it, the temporal executor calls the tools one after another.
+func (r RunCommand) WithConcurrentToolCalls(concurrent bool) RunCommand {
+	r.ConcurrentToolCalls = concurrent
+	return r
+}
+
+func (r RunCommand) WithAssistantPrefill(prefill string) RunCommand {
+	r.AssistantPrefill = prefill
+	return r
+}
+
+func (r RunCommand) WithStopSequences(stop []string) RunCommand {
+	r.StopSequences = stop
+	return r
+}
+
+func (r RunCommand) WithStreamUsage(include bool) RunCommand {
+	r.IncludeStreamUsage = include
+	return r
+}
+
+// WithToolsFunc makes every turn use the tools returned by fn instead of the tools of the agent.
+// Functions can't be sent to a remote worker, so only the local executor supports it.
+func (r RunCommand) WithToolsFunc(fn ToolsFunc) RunCommand {
+	r.ToolsFunc = fn
+	return r
+}
+
+// WithModelSelector makes every turn use the model picked by fn instead of the model of the agent,
+// e.g. to send simple prompts to a cheaper model. Like WithToolsFunc only the local executor supports it.
+func (r RunCommand) WithModelSelector(fn ModelSelector) RunCommand {
+	r.ModelSelector = fn
+	return r
+}
+
+// WithSuppressChunks stops the chunk events from being published, the hook only receives the complete messages.
+func (r RunCommand) WithSuppressChunks(suppress bool) RunCommand {
+	r.SuppressChunks = suppress
+	return r
+}
+
+// WithSuppressRedundantFinal stops the final assistant message from being published when it's identical
+// to the content of the chunks that were published before it. It's still added to the thread.
+func (r RunCommand) WithSuppressRedundantFinal(suppress bool) RunCommand {
+	r.SuppressRedundantFinal = suppress
+	return r
+}
+
+// WithCheckpointCodec sets the codec of the checkpoint that's passed to hooks that implement
+// events.CheckpointHook when the run completes, JSON by default. Only the local executor delivers checkpoints.
+func (r RunCommand) WithCheckpointCodec(codec provider.CheckpointCodec) RunCommand {
+	r.CheckpointCodec = codec
+	return r
+}
+
+// WithParentRunID marks the run as a sub-run of the run with the given ID, the ID is added to the
+// metadata of its events as parent_run_id. Runs that are started from a tool of another run get
+// the ID of that run when it's not set.
+func (r RunCommand) WithParentRunID(id uuid.UUID) RunCommand {
+	r.ParentRunID = id
+	return r
+}
+
+// WithModelParams sets the generation parameters of the run, they take precedence over the ones of the agent.
+func (r RunCommand) WithModelParams(params provider.ModelParams) RunCommand {
+	r.ModelParams = params
+	return r
+}
+
+// WithApprovals sets the topic used to request and receive approvals for tools that require them.
+// Tool calls that are not approved within the timeout are denied.
+func (r RunCommand) WithApprovals(topic broker.Topic, timeout time.Duration) RunCommand {
+	r.Approvals = topic
+	r.ApprovalTimeout = timeout
+	return r
+}
+
+// WithCancellations sets the topic the run listens on for events.CancelTool events,
+// they abort the matching tool calls while they're running.
+func (r RunCommand) WithCancellations(topic broker.Topic) RunCommand {
+	r.Cancellations = topic
+	return r
+}
+
+// WithSenderName sets the name the events of the agent are published with, e.g. a display name
+// for the tenant. The thread keeps the agent name, so handoffs and lookups use the real name.
+func (r RunCommand) WithSenderName(agentName, displayName string) RunCommand {
+	names := make(map[string]string, len(r.SenderNames)+1)
+	maps.Copy(names, r.SenderNames)
+	names[agentName] = displayName
+	r.SenderNames = names
+	return r
+}
+
+// WithAutoContinue makes the run ask the model to continue a response that was cut off by the
+// length limit, at most maxContinuations times. The result of the run is the assembled response.
+func (r RunCommand) WithAutoContinue(maxContinuations int) RunCommand {
+	r.AutoContinue = maxContinuations
+	return r
+}
+
+func (r RunCommand) WithUserID(userID string, hash bool) RunCommand {
+	r.UserID = userID
+	r.HashUserID = hash
+	return r
+}
+
 func (r RunCommand) WithStructuredOutput(output *provider.StructuredOutput) RunCommand {
 	r.StructuredOutput = output
 	return r
 }
 
+// DefaultUnmarshal returns the unmarshaler NewFuture uses for common result types:
+// strings get the raw result, gjson.Result parses it and every other type is decoded
+// with encoding/json.
 func DefaultUnmarshal[T any]() func([]byte) (T, error) {
 	var responseUnmarshaler func([]byte) (T, error)
 
@@ -159,6 +347,18 @@ type Promise interface {
 	Error(error)
 }
 
+// FinishReasonRecorder is implemented by the promises that keep why a run finished.
+// The executors record the finish reason of the final provider response before they complete the promise.
+type FinishReasonRecorder interface {
+	RecordFinishReason(reason string)
+}
+
+func recordFinishReason(promise Promise, reason string) {
+	if recorder, ok := promise.(FinishReasonRecorder); ok && reason != "" {
+		recorder.RecordFinishReason(reason)
+	}
+}
+
 type Future[T any] interface {
 	Get() (T, error)
 }
@@ -182,6 +382,9 @@ type future[T any] struct {
 	mu        sync.Mutex
 }
 
+// NewFuture creates a future that decodes the raw result of a run with unmarshal.
+// Use DefaultUnmarshal for common result types, or a custom function for types that
+// need their own decoding, like a union of types picked by a discriminator field.
 func NewFuture[T any](unmarshal func([]byte) (T, error)) CompletableFuture[T] {
 	f := &future[T]{
 		unmarshal: unmarshal,
@@ -46,7 +46,7 @@ func TestNewRunCommand(t *testing.T) {
 		agent := &mockAgent{
 			testModel: testModel{provider: prov},
 		}
-		thread := shorttermmemory.New()
+		thread := promptedThread()
 		hook := &mockHook{}
 
 		cmd, err := NewRunCommand(agent, thread, hook)
@@ -131,7 +131,7 @@ func TestNewRunCommand(t *testing.T) {
 		agent := &mockAgent{
 			testModel: testModel{provider: prov},
 		}
-		thread := shorttermmemory.New()
+		thread := promptedThread()
 		hook := &mockHook{}
 
 		cmd, err := NewRunCommand(agent, thread, hook)
@@ -184,7 +184,7 @@ func TestNewRunCommand(t *testing.T) {
 		agent := &mockAgent{
 			testModel: testModel{provider: prov},
 		}
-		thread := shorttermmemory.New()
+		thread := promptedThread()
 		hook := &mockHook{}
 
 		cmd, err := NewRunCommand(agent, thread, hook)
@@ -11,6 +11,7 @@ import (
 	"slices"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/casualjim/bubo/api"
@@ -19,6 +20,7 @@ import (
 	"github.com/casualjim/bubo/messages"
 	"github.com/casualjim/bubo/pkg/reflectx"
 	"github.com/casualjim/bubo/pkg/slogx"
+	"github.com/casualjim/bubo/pkg/uuidx"
 	"github.com/casualjim/bubo/provider"
 	"github.com/casualjim/bubo/tool"
 	"github.com/casualjim/bubo/types"
@@ -42,17 +44,59 @@ func (e *continueError) Error() string {
 	return "continue"
 }
 
+// stopError is returned when a tool stopped the run with a final message
+type stopError struct {
+	message string
+}
+
+// completeStopped settles the promise of a run a tool stopped, the final message is only
+// the result of runs without structured output.
+func completeStopped(promise Promise, structured bool, finalMessage string) {
+	if structured {
+		promise.Error(&api.RunStoppedError{FinalMessage: finalMessage})
+		return
+	}
+	promise.Complete(finalMessage)
+}
+
+func (e *stopError) Error() string {
+	return "stop"
+}
+
 type Local struct{}
 
 func NewLocal() *Local {
 	return &Local{}
 }
 
-func wrapErr(runID, turnID uuid.UUID, sender string, err error) (events.Error, bool) {
+// toolCallError records the tool that was being called when an error occurred
+type toolCallError struct {
+	tool string
+	err  error
+}
+
+func (e *toolCallError) Error() string {
+	return e.err.Error()
+}
+
+func (e *toolCallError) Unwrap() error {
+	return e.err
+}
+
+func wrapErr(runID, turnID uuid.UUID, sender string, reqCtx *events.RequestContext, err error) (events.Error, bool) {
 	if err == nil {
 		return events.Error{}, false
 	}
+	var tcErr *toolCallError
+	if reqCtx != nil && errors.As(err, &tcErr) {
+		withTool := *reqCtx
+		withTool.Tool = tcErr.tool
+		reqCtx = &withTool
+	}
 	if pErr, ok := err.(events.Error); ok { //nolint: errorlint
+		if pErr.Context == nil {
+			pErr.Context = reqCtx
+		}
 		return pErr, true
 	}
 	return events.Error{
@@ -61,54 +105,201 @@ func wrapErr(runID, turnID uuid.UUID, sender string, err error) (events.Error, b
 		Sender:    sender,
 		Err:       err,
 		Timestamp: strfmt.DateTime(time.Now()),
+		Context:   reqCtx,
 	}, true
 }
 
 type toolCallParams struct {
-	runID       uuid.UUID
-	agent       api.Agent
-	contextVars types.ContextVars
-	mem         *shorttermmemory.Aggregator
-	hook        events.Hook
-	toolCalls   messages.ToolCallMessage
+	runID        uuid.UUID
+	parentRunID  uuid.UUID
+	agent        api.Agent
+	contextVars  types.ContextVars
+	runState     *types.RunState
+	tools        []tool.Definition
+	mem          *shorttermmemory.Aggregator
+	hook         events.Hook
+	toolCalls    messages.ToolCallMessage
+	maxToolCalls int
+	// concurrent runs the tool calls of agents that allow parallel tool calls at the same time
+	concurrent bool
+	approvals  approvalParams
+	// cancellations abort the tool calls named by the CancelTool events of the run
+	cancellations *toolCancellations
+	// hookMu serializes the hook calls of the tool calls that run in parallel,
+	// hooks don't have to be safe for concurrent use
+	hookMu *sync.Mutex
+}
+
+// lockHook locks the hook for the tool calls that run in parallel, it returns the function that unlocks it
+func (p toolCallParams) lockHook() func() {
+	if p.hookMu == nil {
+		return func() {}
+	}
+	p.hookMu.Lock()
+	return p.hookMu.Unlock
 }
 
 func (l *Local) Run(ctx context.Context, command RunCommand, promise Promise) error {
 	if err := command.Validate(); err != nil {
 		return err
 	}
+	if !hasInput(command.Thread) {
+		promise.Error(api.ErrNoUserInput)
+		return api.ErrNoUserInput
+	}
 
+	if command.ParentRunID == uuid.Nil {
+		command.ParentRunID, _ = RunIDFromContext(ctx)
+	}
+	// runs that are started by the tools of this run are delegated by it
+	ctx = withRunID(ctx, command.ID())
+	command.Hook = displayNames(command.Hook, command.SenderNames)
 	contextVars := command.initializeContextVars()
+	if command.RunState == nil {
+		command.RunState = types.NewRunState()
+	}
 	thread := command.Thread.Fork()
 	activeAgent := command.Agent
+	stats := &runStats{started: time.Now()}
 
-	err := l.runReactorLoop(ctx, reactorParams{
-		command:     command,
-		thread:      thread,
-		activeAgent: activeAgent,
-		contextVars: contextVars,
-		promise:     promise,
+	cancellations, unsubscribe, err := watchToolCancellations(ctx, command.Cancellations)
+	if err != nil {
+		return err
+	}
+	defer unsubscribe()
+
+	err = l.runReactorLoop(ctx, reactorParams{
+		command:       command,
+		thread:        thread,
+		activeAgent:   activeAgent,
+		contextVars:   contextVars,
+		promise:       promise,
+		stats:         stats,
+		cancellations: cancellations,
 	})
 	var breakErr *breakError
 	if err != nil && !errors.As(err, &breakErr) {
+		if ctx.Err() != nil {
+			notifyCancel(ctx, command.Hook, command.ID())
+		}
 		return err
 	}
 
 	// Always join the thread back to the command's thread
 	command.Thread.Join(thread)
+
+	if hook, ok := command.Hook.(events.SummaryHook); ok {
+		hook.OnSummary(ctx, stats.summary(command.ID(), thread.ID()))
+	}
+	if hook, ok := command.Hook.(events.CheckpointHook); ok {
+		codec := command.CheckpointCodec
+		if codec == nil {
+			codec = provider.JSONCheckpointCodec{}
+		}
+		checkpoint, err := codec.Encode(command.Thread.Checkpoint())
+		if err != nil {
+			return fmt.Errorf("failed to encode the checkpoint: %w", err)
+		}
+		hook.OnCheckpoint(ctx, command.ID(), command.Thread.ID(), checkpoint)
+	}
 	return nil
 }
 
+// notifyCancel tells the hook that the run was cancelled, the hook gets a context that isn't
+// cancelled so it can still flush what it buffered
+func notifyCancel(ctx context.Context, hook events.Hook, runID uuid.UUID) {
+	ch, ok := hook.(events.CancelHook)
+	if !ok {
+		return
+	}
+	ch.OnCancel(context.WithoutCancel(ctx), runID, context.Cause(ctx).Error())
+}
+
 type reactorParams struct {
 	command     RunCommand
 	thread      *shorttermmemory.Aggregator
 	activeAgent api.Agent
 	contextVars types.ContextVars
 	promise     Promise
+	stats       *runStats
+	// cancellations abort the tool calls named by the CancelTool events of the run
+	cancellations *toolCancellations
+	// tools are the tools of the current turn
+	tools []tool.Definition
+	// model is the model of the current turn
+	model api.Model
+	// streamed is the content of the assistant chunks that were published in the current turn
+	streamed strings.Builder
+	// continuations is the number of times a truncated response was continued
+	continuations int
+	// truncated is the content of the truncated responses that the final response continues
+	truncated strings.Builder
+	// continued is the thread of the run while a truncated response is continued in a fork of it,
+	// so the continuation prompts never reach the thread of the run
+	continued *shorttermmemory.Aggregator
+	// requested is when the completion of the current turn was requested
+	requested time.Time
+	// ttft is the time to the first chunk or response of the current turn, zero until it arrives
+	ttft time.Duration
+}
+
+// turnLen is the number of messages the run added, including the ones of a continuation
+func (p *reactorParams) turnLen() int {
+	if p.continued != nil {
+		return p.continued.TurnLen() + p.thread.TurnLen()
+	}
+	return p.thread.TurnLen()
+}
+
+// runStats collects the statistics of a run for the summary that is published when it completes
+type runStats struct {
+	started     time.Time
+	turns       int
+	toolCalls   int
+	totalTokens int64
+	// reasoningTokens are the reasoning tokens of every response
+	reasoningTokens []int64
+	model           string
+	sender          string
+}
+
+// recordResponse keeps track of the model that responded and the tokens it reported
+func (s *runStats) recordResponse(meta gjson.Result, sender string) {
+	if model := meta.Get("model"); model.Exists() {
+		s.model = model.String()
+	}
+	s.sender = sender
+	s.totalTokens += meta.Get("usage.total_tokens").Int()
+	s.reasoningTokens = append(s.reasoningTokens, meta.Get("usage.completion_tokens_details.reasoning_tokens").Int())
+}
+
+func (s *runStats) summary(runID, turnID uuid.UUID) events.Summary {
+	var reasoningTokens int64
+	for _, tokens := range s.reasoningTokens {
+		reasoningTokens += tokens
+	}
+	var turnReasoningTokens []int64
+	if reasoningTokens > 0 {
+		turnReasoningTokens = s.reasoningTokens
+	}
+
+	return events.Summary{
+		RunID:               runID,
+		TurnID:              turnID,
+		Turns:               s.turns,
+		ToolCalls:           s.toolCalls,
+		TotalTokens:         s.totalTokens,
+		ReasoningTokens:     reasoningTokens,
+		TurnReasoningTokens: turnReasoningTokens,
+		Elapsed:             time.Since(s.started),
+		Model:               s.model,
+		Sender:              s.sender,
+		Timestamp:           strfmt.DateTime(time.Now()),
+	}
 }
 
 func (l *Local) runReactorLoop(ctx context.Context, params reactorParams) error {
-	for params.thread.TurnLen() < params.command.MaxTurns {
+	for params.turnLen() < params.command.MaxTurns {
 		// Validate current agent and provider
 		if err := l.validateAgentAndProvider(ctx, &params); err != nil {
 			return err
@@ -119,6 +310,8 @@ func (l *Local) runReactorLoop(ctx context.Context, params reactorParams) error
 		if err != nil {
 			return err
 		}
+		params.stats.turns++
+		params.streamed.Reset()
 
 		// Process stream events
 		if err := l.handleStreamEvents(ctx, stream, &params); err != nil {
@@ -137,6 +330,12 @@ func (l *Local) runReactorLoop(ctx context.Context, params reactorParams) error
 
 func (l *Local) validateAgentAndProvider(ctx context.Context, params *reactorParams) error {
 	model := params.activeAgent.Model()
+	if params.command.ModelSelector != nil {
+		if selected := params.command.ModelSelector(ctx, params.thread.Messages()); selected != nil {
+			model = selected
+		}
+	}
+	params.model = model
 	if model == nil {
 		err := fmt.Errorf("agent model cannot be nil")
 		l.publishError(ctx, params, err)
@@ -159,15 +358,44 @@ func (l *Local) initiateChatCompletion(ctx context.Context, params *reactorParam
 		l.publishError(ctx, params, fmt.Errorf("failed to render instructions: %w", err))
 		return nil, fmt.Errorf("failed to render instructions: %w", err)
 	}
+	params.tools = params.activeAgent.Tools()
+	if params.command.ToolsFunc != nil {
+		params.tools = params.command.ToolsFunc(ctx, params.contextVars)
+	}
+	instructions = withToolExamples(instructions, params.tools)
+	if hook, ok := params.command.Hook.(events.InstructionsHook); ok {
+		msg := messages.New().Instructions(instructions)
+		msg.RunID = params.command.ID()
+		msg.TurnID = params.thread.ID()
+		msg.Sender = params.activeAgent.Name()
+		msg.Meta = withParentRunID(msg.Meta, params.command.ParentRunID)
+		hook.OnInstructions(ctx, msg)
+	}
 
-	stream, err := params.activeAgent.Model().Provider().ChatCompletion(ctx, provider.CompletionParams{
-		RunID:          params.command.ID(),
-		Instructions:   instructions,
-		Thread:         params.thread,
-		Stream:         params.command.Stream,
-		Model:          params.activeAgent.Model(),
-		ResponseSchema: params.command.StructuredOutput,
-		Tools:          params.activeAgent.Tools(),
+	if hook, ok := params.command.Hook.(events.RequestHook); ok {
+		hook.OnRequest(ctx, params.command.ID(), params.thread.ID(), events.CompletionRequest{
+			Model:        params.model.Name(),
+			Instructions: instructions,
+			Messages:     params.thread.Messages(),
+			Tools:        params.tools,
+		})
+	}
+
+	params.requested, params.ttft = time.Now(), 0
+	stream, err := params.model.Provider().ChatCompletion(ctx, provider.CompletionParams{
+		RunID:              params.command.ID(),
+		Instructions:       instructions,
+		Thread:             params.thread,
+		Stream:             params.command.Stream,
+		Model:              params.model,
+		ResponseSchema:     params.command.StructuredOutput,
+		Tools:              params.tools,
+		UserID:             params.command.UserID,
+		HashUserID:         params.command.HashUserID,
+		AssistantPrefill:   params.command.AssistantPrefill,
+		StopSequences:      params.command.StopSequences,
+		IncludeStreamUsage: params.command.IncludeStreamUsage,
+		ModelParams:        api.ModelParamsOf(params.activeAgent).Merge(params.command.ModelParams),
 	})
 	if err != nil {
 		l.publishError(ctx, params, fmt.Errorf("failed to get chat completion: %w", err))
@@ -216,7 +444,12 @@ func (l *Local) handleStreamCompletion(params *reactorParams) error {
 	// We know it's safe because handleToolCallResponse would have returned continueError
 	// if there was an agent transfer
 	if assistantMsg, ok := lastMsg.Payload.(messages.AssistantMessage); ok {
-		params.promise.Complete(assistantMsg.Content.Content)
+		content := params.truncated.String() + assistantMsg.Content.Content
+		if params.continued != nil {
+			assembleContinued(params, lastMsg, content)
+		}
+		recordFinishReason(params.promise, lastMsg.Meta.Get("finish_reason").String())
+		params.promise.Complete(content)
 		return &breakError{}
 	}
 
@@ -225,6 +458,11 @@ func (l *Local) handleStreamCompletion(params *reactorParams) error {
 }
 
 func (l *Local) processStreamEvent(ctx context.Context, event provider.StreamEvent, params *reactorParams) error {
+	event = provider.WithMeta(event, "model", params.model.Name())
+	if params.command.ParentRunID != uuid.Nil {
+		event = provider.WithMeta(event, "parent_run_id", params.command.ParentRunID.String())
+	}
+	event = withTTFT(event, params)
 	switch event := event.(type) {
 	case provider.Delim:
 		return nil
@@ -233,7 +471,12 @@ func (l *Local) processStreamEvent(ctx context.Context, event provider.StreamEve
 		params.promise.Error(event.Err)
 		return event.Err
 	case provider.Chunk[messages.AssistantMessage]:
+		if params.command.SuppressChunks {
+			return nil
+		}
+		params.streamed.WriteString(event.Chunk.Content.Content)
 		params.command.Hook.OnAssistantChunk(ctx, messages.Message[messages.AssistantMessage]{
+			MessageID: uuidx.New(),
 			RunID:     event.RunID,
 			TurnID:    event.TurnID,
 			Payload:   event.Chunk,
@@ -243,7 +486,11 @@ func (l *Local) processStreamEvent(ctx context.Context, event provider.StreamEve
 		})
 		return nil
 	case provider.Chunk[messages.ToolCallMessage]:
+		if params.command.SuppressChunks {
+			return nil
+		}
 		params.command.Hook.OnToolCallChunk(ctx, messages.Message[messages.ToolCallMessage]{
+			MessageID: uuidx.New(),
 			RunID:     event.RunID,
 			TurnID:    event.TurnID,
 			Payload:   event.Chunk,
@@ -252,9 +499,17 @@ func (l *Local) processStreamEvent(ctx context.Context, event provider.StreamEve
 			Meta:      event.Meta,
 		})
 		return nil
+	case provider.ContentFilter:
+		if hook, ok := params.command.Hook.(events.ContentFilterHook); ok {
+			hook.OnContentFilter(ctx, events.FromStreamEvent(event, params.activeAgent.Name()).(events.ContentFilter))
+		}
+		return nil
 	case provider.Response[messages.ToolCallMessage]:
+		params.stats.recordResponse(event.Meta, params.activeAgent.Name())
+		params.stats.toolCalls += len(event.Response.ToolCalls)
 		return l.handleToolCallResponse(ctx, event, params)
 	case provider.Response[messages.AssistantMessage]:
+		params.stats.recordResponse(event.Meta, params.activeAgent.Name())
 		if err := l.handleAssistantResponse(ctx, event, params); err != nil {
 			return err
 		}
@@ -265,7 +520,14 @@ func (l *Local) processStreamEvent(ctx context.Context, event provider.StreamEve
 }
 
 func (l *Local) publishError(ctx context.Context, params *reactorParams, err error) {
-	if ee, hasErr := wrapErr(params.command.ID(), params.thread.ID(), params.activeAgent.Name(), err); hasErr {
+	reqCtx := &events.RequestContext{
+		Agent:     params.activeAgent.Name(),
+		TurnIndex: params.turnLen(),
+	}
+	if params.model != nil {
+		reqCtx.Model = params.model.Name()
+	}
+	if ee, hasErr := wrapErr(params.command.ID(), params.thread.ID(), params.activeAgent.Name(), reqCtx, err); hasErr {
 		params.command.Hook.OnError(ctx, ee)
 	}
 }
@@ -274,19 +536,75 @@ func (l *Local) handleAssistantResponse(ctx context.Context, event provider.Resp
 	// The provider guarantees that tool calls and responses are processed before
 	// any assistant messages. If we get here, it means all tool calls have been
 	// handled and there were no agent transfers.
+	if err := event.Response.Validate(); err != nil {
+		err = fmt.Errorf("agent %s produced an invalid response: %w", params.activeAgent.Name(), err)
+		l.publishError(ctx, params, err)
+		params.promise.Error(err)
+		return err
+	}
 	event.Checkpoint.MergeInto(params.thread)
 
 	msg := messages.Message[messages.AssistantMessage]{
+		MessageID: uuidx.New(),
 		RunID:     event.RunID,
 		TurnID:    event.TurnID,
 		Payload:   event.Response,
 		Sender:    params.activeAgent.Name(),
 		Timestamp: event.Timestamp,
-		Meta:      event.Meta,
+		Meta:      withFinishReason(event.Meta, event.FinishReason),
 	}
 	params.thread.AddAssistantMessage(msg)
+	if params.command.SuppressRedundantFinal && params.streamed.Len() > 0 && params.streamed.String() == event.Response.Content.Content {
+		// the subscribers already have the whole response from the chunks
+		return l.continueTruncated(event, params)
+	}
 	params.command.Hook.OnAssistantMessage(ctx, msg)
-	return nil
+	return l.continueTruncated(event, params)
+}
+
+// continuationPrompt asks the model to continue a response that was cut off by the length limit
+const continuationPrompt = "Continue exactly where you left off, without repeating anything."
+
+// continueTruncated asks the model for the rest of a response that was cut off by the length limit,
+// when the run is configured to continue those.
+func (l *Local) continueTruncated(event provider.Response[messages.AssistantMessage], params *reactorParams) error {
+	if event.FinishReason != "length" || params.continuations >= params.command.AutoContinue {
+		return nil
+	}
+	params.continuations++
+	params.truncated.WriteString(event.Response.Content.Content)
+	if params.continued == nil {
+		params.continued = params.thread
+		params.thread = params.thread.Fork()
+	}
+
+	msg := messages.New().UserPrompt(continuationPrompt)
+	msg.RunID = event.RunID
+	msg.TurnID = params.thread.ID()
+	msg.Sender = "user"
+	msg.Meta = withParentRunID(msg.Meta, params.command.ParentRunID)
+	params.thread.AddUserPrompt(msg)
+	return &continueError{}
+}
+
+// assembleContinued replaces the truncated response in the thread of the run with the assembled one,
+// the continuation prompts and the parts of the response stay behind in the fork they were added to.
+func assembleContinued(params *reactorParams, last messages.Message[messages.ModelMessage], content string) {
+	thread := params.continued
+	thread.Rewind(1)
+	thread.AddAssistantMessage(messages.Message[messages.AssistantMessage]{
+		MessageID: last.MessageID,
+		RunID:     last.RunID,
+		TurnID:    last.TurnID,
+		Payload:   messages.AssistantMessage{Content: messages.AssistantContentOrParts{Content: content}},
+		Sender:    last.Sender,
+		Timestamp: last.Timestamp,
+		Meta:      last.Meta,
+	})
+	usage := params.thread.Usage()
+	thread.AddUsage(&usage)
+	params.thread = thread
+	params.continued = nil
 }
 
 func (l *Local) handleToolCallResponse(ctx context.Context, event provider.Response[messages.ToolCallMessage], params *reactorParams) error {
@@ -294,29 +612,57 @@ func (l *Local) handleToolCallResponse(ctx context.Context, event provider.Respo
 	event.Checkpoint.MergeInto(forked)
 
 	toolCallMsg := messages.Message[messages.ToolCallMessage]{
+		MessageID: uuidx.New(),
 		RunID:     event.RunID,
 		TurnID:    event.TurnID,
 		Payload:   event.Response,
 		Sender:    params.activeAgent.Name(),
 		Timestamp: event.Timestamp,
-		Meta:      event.Meta,
+		Meta:      withFinishReason(event.Meta, event.FinishReason),
 	}
 	forked.AddToolCall(toolCallMsg)
 	params.command.Hook.OnToolCallMessage(ctx, toolCallMsg)
 
 	toolParams := toolCallParams{
-		mem:         forked,
-		agent:       params.activeAgent,
-		runID:       event.RunID,
-		hook:        params.command.Hook,
-		toolCalls:   event.Response,
-		contextVars: make(types.ContextVars),
+		mem:          forked,
+		agent:        params.activeAgent,
+		runID:        event.RunID,
+		parentRunID:  params.command.ParentRunID,
+		hook:         params.command.Hook,
+		toolCalls:    event.Response,
+		contextVars:  make(types.ContextVars),
+		runState:     params.command.RunState,
+		tools:        params.tools,
+		maxToolCalls: params.command.MaxToolCallsPerTurn,
+		concurrent:   params.command.ConcurrentToolCalls,
+		approvals: approvalParams{
+			topic:   params.command.Approvals,
+			timeout: params.command.ApprovalTimeout,
+			runID:   event.RunID,
+			turnID:  forked.ID(),
+			sender:  params.activeAgent.Name(),
+		},
+		cancellations: params.cancellations,
 	}
 	if params.contextVars != nil {
 		maps.Copy(toolParams.contextVars, params.contextVars)
 	}
 
 	nextAgent, err := l.handleToolCalls(ctx, toolParams)
+	var stopErr *stopError
+	if errors.As(err, &stopErr) {
+		// keep the tool call and its response in the thread, followed by the final message
+		params.thread.Join(forked)
+		msg := messages.New().AssistantMessage(stopErr.message)
+		msg.RunID = event.RunID
+		msg.TurnID = params.thread.ID()
+		msg.Sender = params.activeAgent.Name()
+		msg.Meta = withParentRunID(msg.Meta, params.command.ParentRunID)
+		params.thread.AddAssistantMessage(msg)
+		params.command.Hook.OnAssistantMessage(ctx, msg)
+		completeStopped(params.promise, params.command.StructuredOutput != nil, stopErr.message)
+		return &breakError{}
+	}
 	if err != nil {
 		l.publishError(ctx, params, err)
 		return err
@@ -332,26 +678,45 @@ func (l *Local) handleToolCallResponse(ctx context.Context, event provider.Respo
 }
 
 func (l *Local) handleToolCalls(ctx context.Context, params toolCallParams) (api.Agent, error) {
-	agentTools := make(map[string]tool.Definition, len(params.agent.Tools()))
-	for tool := range slices.Values(params.agent.Tools()) {
+	tools := params.tools
+	if tools == nil {
+		tools = params.agent.Tools()
+	}
+	agentTools := make(map[string]tool.Definition, len(tools))
+	for tool := range slices.Values(tools) {
 		agentTools[tool.Name] = tool
 	}
 
 	var agentTransfers []messages.ToolCallData
 	var otherTools []messages.ToolCallData
 
-	for _, call := range params.toolCalls.ToolCalls {
+	// the skipped calls get their response first, a transfer or a stop ends the turn before the other calls complete
+	toolCalls, skipped := limitToolCalls(params.toolCalls.ToolCalls, params.maxToolCalls)
+	for _, call := range skipped {
+		msg := skippedToolCallResponse(call, params.maxToolCalls)
+		msg.RunID = params.runID
+		msg.TurnID = params.mem.ID()
+		msg.Sender = params.agent.Name()
+		params.mem.AddToolResponse(msg)
+		params.hook.OnToolCallResponse(ctx, msg)
+	}
+
+	for _, call := range toolCalls {
 		tool, exists := agentTools[call.Name]
 		if !exists {
 			return nil, events.Error{
 				RunID:     params.runID,
 				TurnID:    params.mem.ID(),
 				Sender:    params.agent.Name(),
-				Err:       fmt.Errorf("unknown tool %s", call.Name),
+				Err:       &toolCallError{tool: call.Name, err: fmt.Errorf("unknown tool %s", call.Name)},
 				Timestamp: strfmt.DateTime(time.Now()),
 			}
 		}
 
+		if tool.Builtin {
+			// the provider already executed the tool, its result is part of the response
+			continue
+		}
 		if reflectx.ResultImplements[api.Agent](tool.Function) {
 			agentTransfers = append(agentTransfers, call)
 		} else {
@@ -359,38 +724,444 @@ func (l *Local) handleToolCalls(ctx context.Context, params toolCallParams) (api
 		}
 	}
 
-	for _, call := range append(agentTransfers, otherTools...) {
-		tool := agentTools[call.Name]
-		args := buildArgList(call.Arguments, tool.Parameters)
-		result, err := callFunction(tool.Function, args, params.contextVars)
+	for _, call := range agentTransfers {
+		result, msg, err := l.runToolCall(ctx, params, call, agentTools[call.Name])
 		if err != nil {
 			return nil, err
 		}
-
 		// Check for agent transfer before adding response
 		if result.Agent != nil {
 			return result.Agent, nil
 		}
+		l.addToolResponse(ctx, params, result, msg)
+	}
+
+	if params.concurrent && params.agent.ParallelToolCalls() && len(otherTools) > 1 {
+		if err := l.runParallelToolCalls(ctx, params, otherTools, agentTools); err != nil {
+			return nil, err
+		}
+	} else {
+		var errs api.ToolCallErrors
+		for _, call := range otherTools {
+			result, msg, err := l.runToolCall(ctx, params, call, agentTools[call.Name])
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			if result.Agent != nil {
+				return result.Agent, nil
+			}
+			l.addToolResponse(ctx, params, result, msg)
 
-		msg := messages.New().ToolResponse(call.ID, call.Name, fmt.Sprintf("%v", result.Value))
-		msg.RunID = params.runID
-		msg.TurnID = params.mem.ID()
-		msg.Sender = params.agent.Name()
+			if result.Stop != nil {
+				if len(errs) > 0 {
+					return nil, errs
+				}
+				return nil, &stopError{message: *result.Stop}
+			}
+
+			if result.ContextVariables != nil {
+				if params.contextVars == nil {
+					params.contextVars = make(types.ContextVars)
+				}
+				maps.Copy(params.contextVars, result.ContextVariables)
+			}
+		}
+		if len(errs) > 0 {
+			return nil, errs
+		}
+	}
+
+	return nil, nil
+}
+
+// runToolCall validates, approves and calls a single tool, it returns the response for the model
+// without adding it to the thread.
+func (l *Local) runToolCall(ctx context.Context, params toolCallParams, call messages.ToolCallData, def tool.Definition) (toolResult, messages.Message[messages.ToolResponse], error) {
+	if msg, rejected, err := l.checkToolCall(ctx, params, call, def); rejected || err != nil {
+		return toolResult{}, msg, err
+	}
+	return l.executeToolCall(ctx, params, call, def)
+}
+
+// checkToolCall validates the arguments of the tool call and asks for its approval when the tool requires it.
+// It returns the response for the model when the call is rejected and must not run.
+func (l *Local) checkToolCall(ctx context.Context, params toolCallParams, call messages.ToolCallData, def tool.Definition) (messages.Message[messages.ToolResponse], bool, error) {
+	if retry, invalid := validateToolArgs(call, def); invalid {
+		msg, err := toolRetryResponse(retry)
+		if err != nil {
+			return msg, true, err
+		}
+		return l.toolResponse(params, msg), true, nil
+	}
+
+	if def.RequiresApproval {
+		approval, err := awaitApproval(ctx, params.approvals, call)
+		if err != nil {
+			return messages.Message[messages.ToolResponse]{}, true, err
+		}
+		if !approval.Approved {
+			return l.toolResponse(params, deniedToolCallResponse(call, approval)), true, nil
+		}
+	}
+	return messages.Message[messages.ToolResponse]{}, false, nil
+}
+
+// executeToolCall calls a tool that passed checkToolCall and returns the response for the model
+func (l *Local) executeToolCall(ctx context.Context, params toolCallParams, call messages.ToolCallData, def tool.Definition) (toolResult, messages.Message[messages.ToolResponse], error) {
+	args := buildArgList(call.Arguments, def.Parameters, def.Defaults)
+	callCtx, untrack := params.cancellations.track(ctx, call.ID)
+	l.publishStatus(ctx, params, call, events.ToolStarted)
+	started := time.Now()
+	result, err := callFunction(callCtx, def.Function, args, params.contextVars, params.runState)
+	duration := time.Since(started)
+	untrack()
+	l.publishStatus(ctx, params, call, events.ToolFinished)
+	if errors.Is(context.Cause(callCtx), errToolCancelled) {
+		reason, _ := params.cancellations.reason(call.ID)
+		msg := cancelledToolCallResponse(call, reason)
+		msg.Meta = withDuration(msg.Meta, duration)
+		l.publishToolAudit(ctx, params, call, events.ToolCancelled, msg.Payload.Content, err, duration)
+		return toolResult{}, l.toolResponse(params, msg), nil
+	}
+	if err != nil {
+		l.publishToolAudit(ctx, params, call, events.ToolFailed, "", err, duration)
+		return toolResult{}, messages.Message[messages.ToolResponse]{}, &toolCallError{tool: call.Name, err: err}
+	}
+	if result.Agent != nil {
+		if err := checkHandoff(params.agent, result.Agent); err != nil {
+			l.publishToolAudit(ctx, params, call, events.ToolFailed, "", err, duration)
+			return toolResult{}, messages.Message[messages.ToolResponse]{}, &toolCallError{tool: call.Name, err: err}
+		}
+		l.publishToolAudit(ctx, params, call, events.ToolSucceeded, "", nil, duration)
+		return result, messages.Message[messages.ToolResponse]{}, nil
+	}
+
+	msg := messages.New().ToolResponse(call.ID, call.Name, fmt.Sprintf("%v", result.Value))
+	if def.RawJSONResult {
+		msg.Payload.Content = result.JSON
+		msg.Payload.RawJSON = true
+	}
+	if result.File != nil {
+		msg.Payload.Data = result.File.Data
+		msg.Payload.MIMEType = result.File.MIMEType
+	}
+	msg.Meta = withDuration(msg.Meta, duration)
+	result.SideEffectOnly = def.SideEffectOnly
+	l.publishToolAudit(ctx, params, call, events.ToolSucceeded, msg.Payload.Content, nil, duration)
+	return result, l.toolResponse(params, msg), nil
+}
+
+// publishStatus tells the hook about the progress of the tool call
+func (l *Local) publishStatus(ctx context.Context, params toolCallParams, call messages.ToolCallData, state events.ToolState) {
+	sh, ok := params.hook.(events.StatusHook)
+	if !ok {
+		return
+	}
+	defer params.lockHook()()
+	sh.OnStatus(ctx, events.Status{
+		RunID:      params.runID,
+		TurnID:     params.mem.ID(),
+		ToolCallID: call.ID,
+		ToolName:   call.Name,
+		State:      state,
+		Sender:     params.agent.Name(),
+		Timestamp:  strfmt.DateTime(time.Now()),
+	})
+}
+
+// publishToolAudit tells the hook how a tool call that ran ended
+func (l *Local) publishToolAudit(ctx context.Context, params toolCallParams, call messages.ToolCallData, outcome events.ToolOutcome, result string, err error, duration time.Duration) {
+	ah, ok := params.hook.(events.ToolAuditHook)
+	if !ok {
+		return
+	}
+	record := events.ToolAuditRecord{
+		RunID:      params.runID,
+		TurnID:     params.mem.ID(),
+		ToolCallID: call.ID,
+		ToolName:   call.Name,
+		Arguments:  call.Arguments,
+		Result:     result,
+		Outcome:    outcome,
+		Duration:   duration,
+		Sender:     params.agent.Name(),
+		Timestamp:  strfmt.DateTime(time.Now()),
+	}
+	if err != nil {
+		record.Error = err.Error()
+	}
+	defer params.lockHook()()
+	ah.OnToolAudit(ctx, record)
+}
+
+// addToolResponse adds the response of a tool call to the thread and publishes it,
+// for tools that are side effect only the thread gets an acknowledgment instead of the result.
+func (l *Local) addToolResponse(ctx context.Context, params toolCallParams, result toolResult, msg messages.Message[messages.ToolResponse]) {
+	if result.SideEffectOnly {
+		params.mem.AddToolResponse(sideEffectAck(msg))
+	} else {
 		params.mem.AddToolResponse(msg)
-		params.hook.OnToolCallResponse(ctx, msg)
+	}
+	params.hook.OnToolCallResponse(ctx, msg)
+}
+
+// sideEffectAck replaces the result in the tool response with the acknowledgment the model sees
+// for tools that are side effect only.
+func sideEffectAck(msg messages.Message[messages.ToolResponse]) messages.Message[messages.ToolResponse] {
+	msg.Payload.Content = fmt.Sprintf("tool call %s completed", msg.Payload.ToolName)
+	msg.Payload.RawJSON = false
+	msg.Payload.Data = nil
+	msg.Payload.MIMEType = ""
+	return msg
+}
+
+// checkHandoff returns an error when the agent restricts its handoffs and the next agent isn't one of them
+func checkHandoff(from, to api.Agent) error {
+	policy, ok := from.(api.HandoffPolicy)
+	if !ok {
+		return nil
+	}
+	allowed := policy.AllowedHandoffs()
+	if allowed == nil || slices.Contains(allowed, to.Name()) {
+		return nil
+	}
+	return fmt.Errorf("%w: agent %s can't hand off to %s", api.ErrHandoffNotAllowed, from.Name(), to.Name())
+}
 
-		if result.ContextVariables != nil {
+func (l *Local) toolResponse(params toolCallParams, msg messages.Message[messages.ToolResponse]) messages.Message[messages.ToolResponse] {
+	msg.RunID = params.runID
+	msg.TurnID = params.mem.ID()
+	msg.Sender = params.agent.Name()
+	msg.Meta = withParentRunID(msg.Meta, params.parentRunID)
+	return msg
+}
+
+// runParallelToolCalls runs the tool calls concurrently for agents that allow parallel tool calls,
+// when the run opted in with WithConcurrentToolCalls.
+// The arguments are validated and the approvals are requested one call at a time, in the order of the calls,
+// before the approved tools run. The hook is never called concurrently.
+// The responses are added to the thread in the order of the calls, the failures of all the calls
+// are returned together as api.ToolCallErrors. Every call changes its own copy of the context variables,
+// the copies are merged in the order of the calls.
+func (l *Local) runParallelToolCalls(ctx context.Context, params toolCallParams, calls []messages.ToolCallData, agentTools map[string]tool.Definition) error {
+	type outcome struct {
+		result  toolResult
+		msg     messages.Message[messages.ToolResponse]
+		ctxVars types.ContextVars
+		err     error
+	}
+
+	outcomes := make([]outcome, len(calls))
+	approved := make([]bool, len(calls))
+	for i, call := range calls {
+		msg, rejected, err := l.checkToolCall(ctx, params, call, agentTools[call.Name])
+		outcomes[i] = outcome{msg: msg, err: err}
+		approved[i] = !rejected && err == nil
+	}
+
+	params.hookMu = new(sync.Mutex)
+	base := maps.Clone(params.contextVars)
+	var wg sync.WaitGroup
+	for i, call := range calls {
+		if !approved[i] {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// every call gets its own copy of the context variables, they're merged when all the calls are done
+			callParams := params
+			callParams.contextVars = maps.Clone(params.contextVars)
+			result, msg, err := l.executeToolCall(ctx, callParams, call, agentTools[call.Name])
+			outcomes[i] = outcome{result: result, msg: msg, ctxVars: callParams.contextVars, err: err}
+		}()
+	}
+	wg.Wait()
+
+	var errs api.ToolCallErrors
+	var stop *string
+	for _, o := range outcomes {
+		if o.err != nil {
+			errs = append(errs, o.err)
+			continue
+		}
+		l.addToolResponse(ctx, params, o.result, o.msg)
+
+		if o.result.Stop != nil && stop == nil {
+			stop = o.result.Stop
+		}
+		if changed := changedContextVars(base, o.ctxVars); len(changed) > 0 {
 			if params.contextVars == nil {
 				params.contextVars = make(types.ContextVars)
 			}
-			maps.Copy(params.contextVars, result.ContextVariables)
+			maps.Copy(params.contextVars, changed)
+		}
+		if o.result.ContextVariables != nil {
+			if params.contextVars == nil {
+				params.contextVars = make(types.ContextVars)
+			}
+			maps.Copy(params.contextVars, o.result.ContextVariables)
 		}
 	}
 
-	return nil, nil
+	if len(errs) > 0 {
+		return errs
+	}
+	if stop != nil {
+		return &stopError{message: *stop}
+	}
+	return nil
+}
+
+// changedContextVars returns the context variables a tool added or changed in its copy of base
+func changedContextVars(base, vars types.ContextVars) types.ContextVars {
+	var changed types.ContextVars
+	for key, value := range vars {
+		if old, ok := base[key]; ok && reflect.DeepEqual(old, value) {
+			continue
+		}
+		if changed == nil {
+			changed = make(types.ContextVars)
+		}
+		changed[key] = value
+	}
+	return changed
+}
+
+// withToolExamples appends the example invocations of the tools to the instructions
+func withToolExamples(instructions string, tools []tool.Definition) string {
+	var sb strings.Builder
+	for _, def := range tools {
+		if len(def.Examples) == 0 {
+			continue
+		}
+		if sb.Len() == 0 {
+			sb.WriteString(instructions)
+			sb.WriteString("\n\n# Tool examples\n")
+		}
+		fmt.Fprintf(&sb, "\n## %s\n", def.Name)
+		for _, example := range def.Examples {
+			fmt.Fprintf(&sb, "\nArguments: %s\nResult: %s\n", example.Arguments, example.Result)
+		}
+	}
+	if sb.Len() == 0 {
+		return instructions
+	}
+	return sb.String()
+}
+
+// limitToolCalls keeps the first maxToolCalls tool calls and returns the ones that exceed the limit.
+// A limit <= 0 keeps all the tool calls.
+func limitToolCalls(calls []messages.ToolCallData, maxToolCalls int) (kept, skipped []messages.ToolCallData) {
+	if maxToolCalls <= 0 || len(calls) <= maxToolCalls {
+		return calls, nil
+	}
+	return calls[:maxToolCalls], calls[maxToolCalls:]
+}
+
+// skippedToolCallResponse builds the tool response that informs the model a tool call
+// was not executed because the turn exceeded the maximum number of tool calls.
+func skippedToolCallResponse(call messages.ToolCallData, maxToolCalls int) messages.Message[messages.ToolResponse] {
+	content := fmt.Sprintf(
+		"tool call %s was not executed: exceeded the limit of %d tool calls per turn, retry this call in a later turn if it's still needed",
+		call.Name, maxToolCalls,
+	)
+	return messages.New().ToolResponse(call.ID, call.Name, content)
+}
+
+// withFinishReason records the provider's finish reason for a turn in the message metadata
+func withFinishReason(meta gjson.Result, reason string) gjson.Result {
+	if reason == "" {
+		return meta
+	}
+	return provider.SetMeta(meta, "finish_reason", reason)
+}
+
+// withParentRunID records the run that delegated to this run in the message metadata
+func withParentRunID(meta gjson.Result, parentRunID uuid.UUID) gjson.Result {
+	if parentRunID == uuid.Nil {
+		return meta
+	}
+	return provider.SetMeta(meta, "parent_run_id", parentRunID.String())
+}
+
+// withTTFT measures the time to the first token of the turn when the first chunk or response arrives,
+// and records it in the metadata of the response.
+func withTTFT(event provider.StreamEvent, params *reactorParams) provider.StreamEvent {
+	switch event.(type) {
+	case provider.Delim, provider.Error, provider.ContentFilter:
+		return event
+	}
+	if params.ttft == 0 && !params.requested.IsZero() {
+		params.ttft = max(time.Since(params.requested), time.Nanosecond)
+	}
+	switch event.(type) {
+	case provider.Response[messages.AssistantMessage], provider.Response[messages.ToolCallMessage]:
+		return provider.WithMeta(event, "ttft_ms", params.ttft.Milliseconds())
+	default:
+		return event
+	}
+}
+
+// withDuration records how long the tool took to produce the response in the message metadata
+func withDuration(meta gjson.Result, duration time.Duration) gjson.Result {
+	return provider.SetMeta(meta, "duration_ms", duration.Milliseconds())
+}
+
+// validateToolArgs checks that the arguments the model produced for a tool call can be used
+// to call the tool. When they can't, it returns a retry message with the offending arguments.
+func validateToolArgs(call messages.ToolCallData, def tool.Definition) (messages.Message[messages.Retry], bool) {
+	if def.Function == nil {
+		return messages.Message[messages.Retry]{}, false
+	}
+	_, schema := def.ToNameAndSchema()
+	if schema.Properties == nil || schema.Properties.Len() == 0 {
+		return messages.Message[messages.Retry]{}, false
+	}
+
+	if !gjson.Valid(call.Arguments) {
+		return messages.New().ToolArgumentsError(
+			call.ID,
+			call.Name,
+			call.Arguments,
+			"the arguments must be a valid JSON object matching the tool parameters",
+			fmt.Errorf("invalid arguments for tool %s: not valid JSON", call.Name),
+		), true
+	}
+
+	args := gjson.Parse(call.Arguments)
+	var missing []string
+	for _, name := range schema.Required {
+		if !args.Get(name).Exists() {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return messages.New().ToolArgumentsError(
+			call.ID,
+			call.Name,
+			call.Arguments,
+			fmt.Sprintf("provide a value for: %s", strings.Join(missing, ", ")),
+			fmt.Errorf("invalid arguments for tool %s: missing %s", call.Name, strings.Join(missing, ", ")),
+		), true
+	}
+
+	return messages.Message[messages.Retry]{}, false
+}
+
+// toolRetryResponse converts a retry message into the tool response sent back to the model
+func toolRetryResponse(retry messages.Message[messages.Retry]) (messages.Message[messages.ToolResponse], error) {
+	content, err := json.Marshal(retry.Payload)
+	if err != nil {
+		return messages.Message[messages.ToolResponse]{}, fmt.Errorf("failed to marshal tool retry: %w", err)
+	}
+	return messages.New().ToolResponse(retry.Payload.ToolCallID, retry.Payload.ToolName, string(content)), nil
 }
 
-func buildArgList(arguments string, parameters map[string]string) []reflect.Value {
+// buildArgList returns the arguments of the call in the order of the parameters, the default value
+// of a parameter is used when the argument is missing.
+func buildArgList(arguments string, parameters map[string]string, defaults map[string]any) []reflect.Value {
 	args := gjson.Parse(arguments)
 	targs := make([]string, len(parameters))
 	for k, v := range parameters {
@@ -410,6 +1181,9 @@ func buildArgList(arguments string, parameters map[string]string) []reflect.Valu
 
 		val := args.Get(arg)
 		if !val.Exists() {
+			if value, ok := defaults[arg]; ok {
+				toolArgs = append(toolArgs, reflect.ValueOf(value))
+			}
 			continue
 		}
 
@@ -422,24 +1196,55 @@ type toolResult struct {
 	Value            string
 	Agent            api.Agent
 	ContextVariables types.ContextVars
+	Stop             *string // The final message when the tool stopped the run
+	JSON             string  // The result as JSON, for tools that return raw JSON results
+	File             *tool.File
+	// SideEffectOnly keeps the result from the model, see tool.SideEffectOnly
+	SideEffectOnly bool
 }
 
-func callFunction(fn any, args []reflect.Value, contextVars types.ContextVars) (toolResult, error) {
+var (
+	contextType  = reflect.TypeFor[context.Context]()
+	runStateType = reflect.TypeFor[*types.RunState]()
+)
+
+// callFunction calls the function of a tool with the arguments provided by the model.
+// Parameters of type context.Context, types.ContextVars and *types.RunState are injected
+// instead of taken from the arguments.
+func callFunction(ctx context.Context, fn any, args []reflect.Value, contextVars types.ContextVars, runState *types.RunState) (toolResult, error) {
 	val := reflect.ValueOf(fn)
 	vtpe := val.Type()
 
 	numIn := vtpe.NumIn()
 	callArgs := make([]reflect.Value, numIn)
 
+	var argIdx int
 	for fi := 0; fi < numIn; fi++ {
 		paramType := vtpe.In(fi)
-		if reflectx.IsRefinedType[types.ContextVars](paramType) {
+		switch {
+		case paramType == contextType:
+			callArgs[fi] = reflect.ValueOf(&ctx).Elem()
+		case reflectx.IsRefinedType[types.ContextVars](paramType):
 			callArgs[fi] = reflect.ValueOf(contextVars)
-		} else if fi < len(args) {
-			vv := args[fi]
-			if vv.Type().ConvertibleTo(paramType) {
-				callArgs[fi] = vv.Convert(paramType)
+		case paramType == runStateType:
+			if runState == nil {
+				runState = types.NewRunState()
+			}
+			callArgs[fi] = reflect.ValueOf(runState)
+		default:
+			if argIdx < len(args) {
+				vv := args[argIdx]
+				decoded, err := decodeArg(vv, paramType)
+				if err != nil {
+					return toolResult{}, err
+				}
+				if decoded.IsValid() {
+					callArgs[fi] = decoded
+				} else if vv.Type().ConvertibleTo(paramType) {
+					callArgs[fi] = vv.Convert(paramType)
+				}
 			}
+			argIdx++
 		}
 	}
 
@@ -453,13 +1258,54 @@ func callFunction(fn any, args []reflect.Value, contextVars types.ContextVars) (
 		return toolResult{}, nil
 	}
 
-	switch vtpe := res.Interface().(type) {
+	result, err := resultOf(res.Interface())
+	if err != nil {
+		return toolResult{}, err
+	}
+	result.JSON = resultJSON(res.Interface(), result.Value)
+	return result, nil
+}
+
+// decodeArg decodes the argument with the decoder that is registered for the type of the parameter,
+// see tool.RegisterArgDecoder. The value is invalid when no decoder is registered.
+func decodeArg(arg reflect.Value, paramType reflect.Type) (reflect.Value, error) {
+	decode, ok := tool.ArgDecoderFor(paramType)
+	if !ok {
+		return reflect.Value{}, nil
+	}
+	data, err := json.Marshal(arg.Interface())
+	if err != nil {
+		return reflect.Value{}, err
+	}
+	value, err := decode(data)
+	if err != nil {
+		return reflect.Value{}, fmt.Errorf("failed to decode argument of type %s: %w", paramType, err)
+	}
+	rv := reflect.ValueOf(value)
+	if !rv.IsValid() || !rv.Type().ConvertibleTo(paramType) {
+		return reflect.Value{}, fmt.Errorf("decoder for %s returned a %T", paramType, value)
+	}
+	return rv.Convert(paramType), nil
+}
+
+// resultOf converts the value returned by a tool into its result, the value is stringified for the model
+func resultOf(value any) (toolResult, error) {
+	switch vtpe := value.(type) {
 	case api.Agent:
 		return toolResult{Value: fmt.Sprintf(`{"assistant":%q}`, vtpe.Name()), Agent: vtpe}, nil
 	case error:
 		return toolResult{}, vtpe
 	case types.ContextVars:
 		return toolResult{Value: "", ContextVariables: vtpe}, nil
+	case tool.StopRun:
+		return toolResult{Value: vtpe.FinalMessage, Stop: &vtpe.FinalMessage}, nil
+	case tool.File:
+		return toolResult{Value: vtpe.Description, File: &vtpe}, nil
+	case *tool.File:
+		if vtpe == nil {
+			return toolResult{}, nil
+		}
+		return toolResult{Value: vtpe.Description, File: vtpe}, nil
 	case string:
 		return toolResult{Value: vtpe}, nil
 	case time.Time:
@@ -490,3 +1336,20 @@ func callFunction(fn any, args []reflect.Value, contextVars types.ContextVars) (
 		return toolResult{Value: string(b)}, nil
 	}
 }
+
+// resultJSON returns the JSON-native representation of the value returned by a tool:
+// numbers and booleans stay unquoted, text is quoted and everything else is already JSON.
+func resultJSON(value any, text string) string {
+	switch value.(type) {
+	case bool, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return text
+	case string, time.Time, encoding.TextMarshaler, fmt.Stringer:
+		b, err := json.Marshal(text)
+		if err != nil {
+			return text
+		}
+		return string(b)
+	default:
+		return text
+	}
+}
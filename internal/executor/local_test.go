@@ -1,14 +1,19 @@
 package executor
 
 import (
+	"bytes"
 	"context"
 	"encoding"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"reflect"
 	"testing"
 	"time"
 
+	buboagent "github.com/casualjim/bubo/agent"
 	"github.com/casualjim/bubo/api"
+	"github.com/casualjim/bubo/events"
 	"github.com/casualjim/bubo/internal/mocks"
 	"github.com/casualjim/bubo/internal/shorttermmemory"
 	"github.com/casualjim/bubo/messages"
@@ -17,9 +22,11 @@ import (
 	"github.com/casualjim/bubo/tool"
 	"github.com/casualjim/bubo/types"
 	"github.com/go-openapi/strfmt"
+	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
 )
 
 type textMarshaler struct {
@@ -38,6 +45,7 @@ func TestBuildArgList(t *testing.T) {
 		name       string
 		arguments  string
 		parameters map[string]string
+		defaults   map[string]any
 		want       []string
 	}{
 		{
@@ -75,11 +83,21 @@ func TestBuildArgList(t *testing.T) {
 			},
 			want: []string{"42", "true", "text"},
 		},
+		{
+			name:      "missing argument with default",
+			arguments: `{"arg1": "value1"}`,
+			parameters: map[string]string{
+				"param0": "arg1",
+				"param1": "arg2",
+			},
+			defaults: map[string]any{"arg2": 10},
+			want:     []string{"value1", "10"},
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := buildArgList(tt.arguments, tt.parameters)
+			got := buildArgList(tt.arguments, tt.parameters, tt.defaults)
 
 			// For empty arguments, expect empty slice
 			if tt.name == "empty arguments" {
@@ -156,7 +174,7 @@ func TestCallFunction(t *testing.T) {
 					args[i] = reflect.ValueOf(arg)
 				}
 			}
-			result, err := callFunction(tt.fn, args, tt.contextVars)
+			result, err := callFunction(context.Background(), tt.fn, args, tt.contextVars, nil)
 
 			if tt.wantErr {
 				assert.Error(t, err)
@@ -201,6 +219,173 @@ func TestHandleToolCalls(t *testing.T) {
 		assert.Nil(t, nextAgent)
 	})
 
+	t.Run("builtin tools are not dispatched", func(t *testing.T) {
+		l := NewLocal()
+
+		var called []string
+		agent := &mockAgent{
+			testName:  "test_agent",
+			testModel: testModel{provider: &mockProvider{}},
+			testTools: []tool.Definition{
+				tool.Builtin("web_search"),
+				{
+					Name: "regular_tool",
+					Function: func() string {
+						called = append(called, "regular_tool")
+						return "regular result"
+					},
+				},
+			},
+		}
+
+		hook := mocks.NewHook(t)
+		hook.EXPECT().OnToolCallResponse(mock.Anything, mock.MatchedBy(func(msg messages.Message[messages.ToolResponse]) bool {
+			return msg.Payload.ToolName == "regular_tool"
+		})).Once()
+
+		mem := shorttermmemory.New()
+		nextAgent, err := l.handleToolCalls(context.Background(), toolCallParams{
+			runID:       uuidx.New(),
+			agent:       agent,
+			mem:         mem,
+			hook:        hook,
+			contextVars: make(types.ContextVars),
+			toolCalls: messages.ToolCallMessage{
+				ToolCalls: []messages.ToolCallData{
+					{ID: "call_1", Name: "web_search", Arguments: `{"query":"weather in Paris"}`},
+					{ID: "call_2", Name: "regular_tool", Arguments: "{}"},
+				},
+			},
+		})
+		require.NoError(t, err)
+		assert.Nil(t, nextAgent)
+		assert.Equal(t, []string{"regular_tool"}, called)
+		assert.Equal(t, 1, mem.Len())
+	})
+
+	failingTools := func() (*mockAgent, error, error) {
+		errTimeout := errors.New("weather service timed out")
+		errNotFound := errors.New("stock symbol not found")
+		return &mockAgent{
+			testName:  "test_agent",
+			testModel: testModel{provider: &mockProvider{}},
+			parallel:  true,
+			testTools: []tool.Definition{
+				tool.Must(func() (string, error) { return "", nil }, tool.Name("time")),
+				tool.Must(func() error { return errTimeout }, tool.Name("weather")),
+				tool.Must(func() error { return errNotFound }, tool.Name("stocks")),
+			},
+		}, errTimeout, errNotFound
+	}
+	failingCalls := messages.ToolCallMessage{
+		ToolCalls: []messages.ToolCallData{
+			{ID: "call_1", Name: "time", Arguments: "{}"},
+			{ID: "call_2", Name: "weather", Arguments: "{}"},
+			{ID: "call_3", Name: "stocks", Arguments: "{}"},
+		},
+	}
+
+	for _, concurrent := range []bool{false, true} {
+		t.Run(fmt.Sprintf("tool failures are collected, concurrent=%t", concurrent), func(t *testing.T) {
+			agent, errTimeout, errNotFound := failingTools()
+
+			hook := mocks.NewHook(t)
+			hook.EXPECT().OnToolCallResponse(mock.Anything, mock.MatchedBy(func(msg messages.Message[messages.ToolResponse]) bool {
+				return msg.Payload.ToolName == "time"
+			})).Once()
+
+			_, err := NewLocal().handleToolCalls(context.Background(), toolCallParams{
+				runID:       uuidx.New(),
+				agent:       agent,
+				mem:         shorttermmemory.New(),
+				hook:        hook,
+				contextVars: make(types.ContextVars),
+				concurrent:  concurrent,
+				toolCalls:   failingCalls,
+			})
+			require.Error(t, err)
+
+			var toolErrs api.ToolCallErrors
+			require.ErrorAs(t, err, &toolErrs)
+			assert.Len(t, toolErrs, 2)
+			assert.ErrorIs(t, err, errTimeout)
+			assert.ErrorIs(t, err, errNotFound)
+		})
+	}
+
+	t.Run("parallel tool calls run one after another by default", func(t *testing.T) {
+		var order []string
+		record := func(name string) func(types.ContextVars) string {
+			return func(cv types.ContextVars) string {
+				order = append(order, name)
+				// the change is seen by the calls that follow
+				cv["calls"] = len(order)
+				return name
+			}
+		}
+		agent := &mockAgent{
+			testName:  "test_agent",
+			testModel: testModel{provider: &mockProvider{}},
+			parallel:  true,
+			testTools: []tool.Definition{
+				tool.Must(record("first"), tool.Name("first")),
+				tool.Must(record("second"), tool.Name("second")),
+				tool.Must(record("third"), tool.Name("third")),
+			},
+		}
+
+		contextVars := make(types.ContextVars)
+		_, err := NewLocal().handleToolCalls(context.Background(), toolCallParams{
+			runID:       uuidx.New(),
+			agent:       agent,
+			mem:         shorttermmemory.New(),
+			hook:        &mockHook{},
+			contextVars: contextVars,
+			toolCalls: messages.ToolCallMessage{ToolCalls: []messages.ToolCallData{
+				{ID: "call_1", Name: "first", Arguments: "{}"},
+				{ID: "call_2", Name: "second", Arguments: "{}"},
+				{ID: "call_3", Name: "third", Arguments: "{}"},
+			}},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"first", "second", "third"}, order)
+		assert.Equal(t, 3, contextVars["calls"])
+	})
+
+	t.Run("concurrent tool calls keep the changes to the context variables", func(t *testing.T) {
+		set := func(key string) func(types.ContextVars) string {
+			return func(cv types.ContextVars) string {
+				cv[key] = true
+				return key
+			}
+		}
+		agent := &mockAgent{
+			testName:  "test_agent",
+			testModel: testModel{provider: &mockProvider{}},
+			parallel:  true,
+			testTools: []tool.Definition{
+				tool.Must(set("a"), tool.Name("a")),
+				tool.Must(set("b"), tool.Name("b")),
+			},
+		}
+
+		params := toolCallParams{
+			runID:       uuidx.New(),
+			agent:       agent,
+			mem:         shorttermmemory.New(),
+			hook:        &mockHook{},
+			contextVars: types.ContextVars{"kept": 1},
+			concurrent:  true,
+			toolCalls: messages.ToolCallMessage{ToolCalls: []messages.ToolCallData{
+				{ID: "call_1", Name: "a", Arguments: "{}"},
+				{ID: "call_2", Name: "b", Arguments: "{}"},
+			}},
+		}
+		_, err := NewLocal().handleToolCalls(context.Background(), params)
+		require.NoError(t, err)
+		assert.Equal(t, types.ContextVars{"kept": 1, "a": true, "b": true}, params.contextVars)
+	})
+
 	t.Run("agent transfer before regular tools", func(t *testing.T) {
 		l := NewLocal()
 
@@ -258,6 +443,46 @@ func TestHandleToolCalls(t *testing.T) {
 		assert.Equal(t, []string{"agent_tool"}, executionOrder, "tools should execute in order and return agent from agent tool")
 	})
 
+	t.Run("restricts handoffs to the allowed agents", func(t *testing.T) {
+		l := NewLocal()
+
+		allowed := newTestAgent()
+		allowed.testName = "allowed_agent"
+		other := newTestAgent()
+		other.testName = "other_agent"
+
+		agent := buboagent.New(
+			buboagent.Name("test_agent"),
+			buboagent.Model(testModel{provider: &mockProvider{}}),
+			buboagent.AllowedHandoffs("allowed_agent"),
+			buboagent.Tools(
+				tool.Must(func() api.Agent { return allowed }, tool.Name("to_allowed")),
+				tool.Must(func() api.Agent { return other }, tool.Name("to_other")),
+			),
+		)
+
+		handoff := func(name string) (api.Agent, error) {
+			return l.handleToolCalls(context.Background(), toolCallParams{
+				runID:       uuidx.New(),
+				agent:       agent,
+				mem:         shorttermmemory.New(),
+				hook:        mocks.NewHook(t),
+				contextVars: make(types.ContextVars),
+				toolCalls: messages.ToolCallMessage{
+					ToolCalls: []messages.ToolCallData{{ID: "call_1", Name: name, Arguments: "{}"}},
+				},
+			})
+		}
+
+		nextAgent, err := handoff("to_other")
+		require.ErrorIs(t, err, api.ErrHandoffNotAllowed)
+		assert.Nil(t, nextAgent)
+
+		nextAgent, err = handoff("to_allowed")
+		require.NoError(t, err)
+		assert.Equal(t, allowed, nextAgent)
+	})
+
 	t.Run("context variable propagation", func(t *testing.T) {
 		l := NewLocal()
 
@@ -351,6 +576,177 @@ func TestHandleToolCallsErrors(t *testing.T) {
 	assert.Contains(t, err.Error(), "unknown tool")
 }
 
+func TestHandleToolCallsWithBadArguments(t *testing.T) {
+	l := NewLocal()
+
+	var called bool
+	agent := newTestAgent()
+	agent.testTools = []tool.Definition{
+		{
+			Name:       "weather",
+			Parameters: map[string]string{"param0": "location"},
+			Function: func(location string) string {
+				called = true
+				return location
+			},
+		},
+	}
+
+	tests := []struct {
+		name           string
+		arguments      string
+		wantSuggestion string
+	}{
+		{
+			name:           "missing argument",
+			arguments:      `{"unit":"celsius"}`,
+			wantSuggestion: "provide a value for: location",
+		},
+		{
+			name:           "invalid json",
+			arguments:      `{"location":`,
+			wantSuggestion: "the arguments must be a valid JSON object matching the tool parameters",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var response messages.Message[messages.ToolResponse]
+			hook := mocks.NewHook(t)
+			hook.EXPECT().OnToolCallResponse(mock.Anything, mock.MatchedBy(func(msg messages.Message[messages.ToolResponse]) bool {
+				response = msg
+				return true
+			}))
+
+			mem := shorttermmemory.New()
+			nextAgent, err := l.handleToolCalls(context.Background(), toolCallParams{
+				runID: uuidx.New(),
+				agent: agent,
+				mem:   mem,
+				hook:  hook,
+				toolCalls: messages.ToolCallMessage{
+					ToolCalls: []messages.ToolCallData{
+						{
+							ID:        "call-1",
+							Name:      "weather",
+							Arguments: tt.arguments,
+						},
+					},
+				},
+			})
+			require.NoError(t, err)
+			assert.Nil(t, nextAgent)
+			assert.False(t, called, "tool should not be called with invalid arguments")
+
+			assert.Equal(t, "call-1", response.Payload.ToolCallID)
+			assert.Equal(t, 1, mem.Len())
+
+			var retry messages.Retry
+			require.NoError(t, json.Unmarshal([]byte(response.Payload.Content), &retry))
+			assert.Equal(t, tt.arguments, retry.Arguments)
+			assert.Equal(t, tt.wantSuggestion, retry.Suggestion)
+			assert.Equal(t, "weather", retry.ToolName)
+			assert.Error(t, retry.Error)
+		})
+	}
+}
+
+func TestHandleToolCallsWithMaxToolCalls(t *testing.T) {
+	l := NewLocal()
+
+	var executed []string
+	agent := newTestAgent()
+	agent.testTools = []tool.Definition{
+		{
+			Name: "counter",
+			Function: func() string {
+				executed = append(executed, "counter")
+				return "counted"
+			},
+		},
+	}
+
+	var responses []messages.Message[messages.ToolResponse]
+	hook := mocks.NewHook(t)
+	hook.EXPECT().OnToolCallResponse(mock.Anything, mock.MatchedBy(func(msg messages.Message[messages.ToolResponse]) bool {
+		responses = append(responses, msg)
+		return true
+	}))
+
+	calls := make([]messages.ToolCallData, 5)
+	for i := range calls {
+		calls[i] = messages.ToolCallData{
+			ID:        fmt.Sprintf("call-%d", i),
+			Name:      "counter",
+			Arguments: "{}",
+		}
+	}
+
+	mem := shorttermmemory.New()
+	nextAgent, err := l.handleToolCalls(context.Background(), toolCallParams{
+		runID:        uuidx.New(),
+		agent:        agent,
+		mem:          mem,
+		hook:         hook,
+		toolCalls:    messages.ToolCallMessage{ToolCalls: calls},
+		maxToolCalls: 2,
+	})
+	require.NoError(t, err)
+	assert.Nil(t, nextAgent)
+
+	assert.Len(t, executed, 2, "only the first 2 tool calls should execute")
+	require.Len(t, responses, 5, "every tool call should get a response")
+	assert.Equal(t, 5, mem.Len())
+
+	// the skipped calls are answered before the executed ones
+	for i, resp := range responses[:3] {
+		assert.Equal(t, fmt.Sprintf("call-%d", i+2), resp.Payload.ToolCallID)
+		assert.Contains(t, resp.Payload.Content, "exceeded the limit of 2 tool calls per turn")
+	}
+	for i, resp := range responses[3:] {
+		assert.Equal(t, fmt.Sprintf("call-%d", i), resp.Payload.ToolCallID)
+		assert.Equal(t, "counted", resp.Payload.Content)
+	}
+}
+
+func TestHandleToolCallsAnswersSkippedCallsBeforeATransfer(t *testing.T) {
+	l := NewLocal()
+
+	next := newTestAgent()
+	next.testName = "next_agent"
+	agent := newTestAgent()
+	agent.testTools = []tool.Definition{
+		{Name: "transfer", Function: func() api.Agent { return next }},
+		{Name: "counter", Function: func() string { return "counted" }},
+	}
+
+	var responses []messages.Message[messages.ToolResponse]
+	hook := mocks.NewHook(t)
+	hook.EXPECT().OnToolCallResponse(mock.Anything, mock.MatchedBy(func(msg messages.Message[messages.ToolResponse]) bool {
+		responses = append(responses, msg)
+		return true
+	}))
+
+	mem := shorttermmemory.New()
+	nextAgent, err := l.handleToolCalls(context.Background(), toolCallParams{
+		runID: uuidx.New(),
+		agent: agent,
+		mem:   mem,
+		hook:  hook,
+		toolCalls: messages.ToolCallMessage{ToolCalls: []messages.ToolCallData{
+			{ID: "call-0", Name: "transfer", Arguments: "{}"},
+			{ID: "call-1", Name: "counter", Arguments: "{}"},
+		}},
+		maxToolCalls: 1,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, next, nextAgent)
+
+	require.Len(t, responses, 1, "the skipped call is answered even though the transfer ends the turn")
+	assert.Equal(t, "call-1", responses[0].Payload.ToolCallID)
+	assert.Contains(t, responses[0].Payload.Content, "was not executed")
+}
+
 func TestHandleToolCallsWithContextVars(t *testing.T) {
 	l := NewLocal()
 
@@ -1096,7 +1492,7 @@ func TestRunWithStreamingAgentHandoff(t *testing.T) {
 		},
 	}
 
-	thread := shorttermmemory.New()
+	thread := promptedThread()
 
 	var toolCallChunks []messages.ToolCallMessage
 	var toolCallResponses []messages.ToolCallMessage
@@ -1182,7 +1578,7 @@ func TestRunWithStreamingToolCalls(t *testing.T) {
 		},
 	}
 
-	thread := shorttermmemory.New()
+	thread := promptedThread()
 
 	var toolCallChunks []messages.ToolCallMessage
 	var toolCallResponses []messages.ToolCallMessage
@@ -1246,7 +1642,7 @@ func TestRunWithStreaming(t *testing.T) {
 		}},
 	}
 
-	thread := shorttermmemory.New()
+	thread := promptedThread()
 
 	var streamingResponses []string
 	hook := mocks.NewHook(t)
@@ -1276,6 +1672,99 @@ func TestRunWithStreaming(t *testing.T) {
 	assert.Equal(t, "streaming chunk", result)
 }
 
+// finishReasonFuture keeps the finish reason the executor records
+type finishReasonFuture struct {
+	CompletableFuture[string]
+	reason string
+}
+
+func (f *finishReasonFuture) RecordFinishReason(reason string) { f.reason = reason }
+
+func TestRunSurfacesFinishReason(t *testing.T) {
+	l := NewLocal()
+
+	agent := &mockAgent{
+		testName: "test_agent",
+		testModel: testModel{provider: &mockProvider{
+			responses: []provider.StreamEvent{
+				provider.Response[messages.AssistantMessage]{
+					Response: messages.AssistantMessage{
+						Content: messages.AssistantContentOrParts{
+							Content: "truncated respon",
+						},
+					},
+					FinishReason: "length",
+				},
+			},
+		}},
+	}
+
+	thread := promptedThread()
+
+	var finishReason string
+	hook := mocks.NewHook(t)
+	hook.EXPECT().OnAssistantMessage(mock.Anything, mock.MatchedBy(func(msg messages.Message[messages.AssistantMessage]) bool {
+		finishReason = msg.Meta.Get("finish_reason").String()
+		return true
+	}))
+
+	cmd, err := NewRunCommand(agent, thread, hook)
+	require.NoError(t, err)
+
+	fut := &finishReasonFuture{CompletableFuture: NewFuture(DefaultUnmarshal[string]())}
+	err = l.Run(context.Background(), cmd, fut)
+	require.NoError(t, err)
+
+	assert.Equal(t, "length", finishReason)
+	assert.Equal(t, "length", fut.reason)
+
+	msgs := thread.Messages()
+	require.NotEmpty(t, msgs)
+	assert.Equal(t, "length", msgs[len(msgs)-1].Meta.Get("finish_reason").String())
+}
+
+func TestRunAnnotatesModelName(t *testing.T) {
+	l := NewLocal()
+
+	agent := &mockAgent{
+		testName: "test_agent",
+		testModel: testModel{provider: &mockProvider{
+			responses: []provider.StreamEvent{
+				provider.Chunk[messages.AssistantMessage]{
+					Chunk: messages.AssistantMessage{
+						Content: messages.AssistantContentOrParts{Content: "hel"},
+					},
+				},
+				provider.Response[messages.AssistantMessage]{
+					Response: messages.AssistantMessage{
+						Content: messages.AssistantContentOrParts{Content: "hello"},
+					},
+				},
+			},
+		}},
+	}
+
+	var chunkModel, responseModel string
+	hook := mocks.NewHook(t)
+	hook.EXPECT().OnAssistantChunk(mock.Anything, mock.MatchedBy(func(msg messages.Message[messages.AssistantMessage]) bool {
+		chunkModel = msg.Meta.Get("model").String()
+		return true
+	}))
+	hook.EXPECT().OnAssistantMessage(mock.Anything, mock.MatchedBy(func(msg messages.Message[messages.AssistantMessage]) bool {
+		responseModel = msg.Meta.Get("model").String()
+		return true
+	}))
+
+	cmd, err := NewRunCommand(agent, promptedThread(), hook)
+	require.NoError(t, err)
+
+	fut := NewFuture(DefaultUnmarshal[string]())
+	require.NoError(t, l.Run(context.Background(), cmd, fut))
+
+	assert.Equal(t, "test_model", chunkModel)
+	assert.Equal(t, "test_model", responseModel)
+}
+
 func TestRunWithAgentChain(t *testing.T) {
 	l := NewLocal()
 
@@ -1397,7 +1886,7 @@ func TestRunWithAgentChain(t *testing.T) {
 		},
 	}
 
-	thread := shorttermmemory.New()
+	thread := promptedThread()
 
 	var toolResponses []messages.Message[messages.ToolResponse]
 	var toolCallMessages []messages.Message[messages.ToolCallMessage]
@@ -1424,7 +1913,7 @@ func TestRunWithAgentChain(t *testing.T) {
 	require.NoError(t, err)
 
 	msgs := thread.Messages()
-	assert.Equal(t, 1, len(msgs), "Should have final message in chain")
+	assert.Equal(t, 2, len(msgs), "Should have the prompt and the final message in chain")
 
 	assert.Len(t, toolResponses, 1, "Should have final tool response")
 	assert.Len(t, assistantMessages, 1, "Should have final assistant message")
@@ -1468,17 +1957,208 @@ func TestRunWithAgentChain(t *testing.T) {
 	assert.Equal(t, "Final response after all tools", result)
 }
 
-func TestCallFunctionWithComplexTypes(t *testing.T) {
+func TestCallFunctionRawJSON(t *testing.T) {
 	tests := []struct {
-		name      string
-		fn        interface{}
-		args      []interface{}
-		wantValue string
-		wantErr   bool
+		name     string
+		fn       any
+		wantJSON string
 	}{
-		{
-			name: "text marshaler success",
-			fn: func() encoding.TextMarshaler {
+		{name: "int return", fn: func() int { return 42 }, wantJSON: `42`},
+		{name: "float return", fn: func() float64 { return 3.14 }, wantJSON: `3.14`},
+		{name: "bool return", fn: func() bool { return true }, wantJSON: `true`},
+		{name: "string return", fn: func() string { return "test" }, wantJSON: `"test"`},
+		{name: "struct return", fn: func() struct{ N int } { return struct{ N int }{N: 1} }, wantJSON: `{"N":1}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := callFunction(context.Background(), tt.fn, nil, nil, nil)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantJSON, result.JSON)
+		})
+	}
+}
+
+func TestCallFunctionArgDecoder(t *testing.T) {
+	tool.RegisterArgDecoder(reflect.TypeFor[time.Duration](), func(data []byte) (any, error) {
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return nil, err
+		}
+		return time.ParseDuration(s)
+	})
+
+	fn := func(timeout time.Duration) string {
+		return fmt.Sprintf("%d minutes", int(timeout.Minutes()))
+	}
+	params := map[string]string{"param0": "timeout"}
+
+	t.Run("decodes registered types", func(t *testing.T) {
+		args := buildArgList(`{"timeout":"1h30m"}`, params, nil)
+		result, err := callFunction(context.Background(), fn, args, nil, nil)
+		require.NoError(t, err)
+		assert.Equal(t, "90 minutes", result.Value)
+	})
+
+	t.Run("fails on invalid values", func(t *testing.T) {
+		args := buildArgList(`{"timeout":"soon"}`, params, nil)
+		_, err := callFunction(context.Background(), fn, args, nil, nil)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "time.Duration")
+	})
+}
+
+func TestHandleToolCallsRawJSONResult(t *testing.T) {
+	var responses []messages.Message[messages.ToolResponse]
+	hook := &mockHook{onToolCallResponse: func(_ context.Context, msg messages.Message[messages.ToolResponse]) {
+		responses = append(responses, msg)
+	}}
+	agent := &mockAgent{
+		testName:  "test_agent",
+		testModel: testModel{provider: &mockProvider{}},
+		testTools: []tool.Definition{
+			tool.Must(func() int { return 42 }, tool.Name("raw"), tool.RawJSONResult()),
+			tool.Must(func() int { return 42 }, tool.Name("text")),
+		},
+	}
+
+	_, err := NewLocal().handleToolCalls(context.Background(), toolCallParams{
+		runID:       uuidx.New(),
+		agent:       agent,
+		mem:         shorttermmemory.New(),
+		hook:        hook,
+		contextVars: make(types.ContextVars),
+		toolCalls: messages.ToolCallMessage{
+			ToolCalls: []messages.ToolCallData{
+				{ID: "call_1", Name: "raw", Arguments: "{}"},
+				{ID: "call_2", Name: "text", Arguments: "{}"},
+			},
+		},
+	})
+	require.NoError(t, err)
+	require.Len(t, responses, 2)
+
+	raw, err := json.Marshal(responses[0].Payload)
+	require.NoError(t, err)
+	assert.Equal(t, `42`, gjson.GetBytes(raw, "content").Raw)
+
+	text, err := json.Marshal(responses[1].Payload)
+	require.NoError(t, err)
+	assert.Equal(t, `"42"`, gjson.GetBytes(text, "content").Raw)
+}
+
+func TestHandleToolCallsFileResult(t *testing.T) {
+	var responses []messages.Message[messages.ToolResponse]
+	hook := &mockHook{onToolCallResponse: func(_ context.Context, msg messages.Message[messages.ToolResponse]) {
+		responses = append(responses, msg)
+	}}
+	agent := &mockAgent{
+		testName:  "test_agent",
+		testModel: testModel{provider: &mockProvider{}},
+		testTools: []tool.Definition{
+			tool.Must(func() tool.File {
+				return tool.File{Data: []byte("%PDF-1.7"), MIMEType: "application/pdf", Description: "the invoice"}
+			}, tool.Name("invoice")),
+		},
+	}
+
+	_, err := NewLocal().handleToolCalls(context.Background(), toolCallParams{
+		runID:       uuidx.New(),
+		agent:       agent,
+		mem:         shorttermmemory.New(),
+		hook:        hook,
+		contextVars: make(types.ContextVars),
+		toolCalls: messages.ToolCallMessage{
+			ToolCalls: []messages.ToolCallData{{ID: "call_1", Name: "invoice", Arguments: "{}"}},
+		},
+	})
+	require.NoError(t, err)
+	require.Len(t, responses, 1)
+	assert.Equal(t, "the invoice", responses[0].Payload.Content)
+	assert.Equal(t, []byte("%PDF-1.7"), responses[0].Payload.Data)
+	assert.Equal(t, "application/pdf", responses[0].Payload.MIMEType)
+}
+
+func TestCallFunctionWithContext(t *testing.T) {
+	type ctxKey struct{}
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), ctxKey{}, "from-run"))
+	cancel()
+	contextVars := types.ContextVars{"key": "value"}
+
+	tests := []struct {
+		name      string
+		fn        any
+		args      []any
+		wantValue string
+		wantErr   error
+	}{
+		{
+			name: "ctx",
+			fn: func(ctx context.Context) string {
+				return ctx.Value(ctxKey{}).(string)
+			},
+			wantValue: "from-run",
+		},
+		{
+			name: "ctx and context vars",
+			fn: func(ctx context.Context, cv types.ContextVars) string {
+				return ctx.Value(ctxKey{}).(string) + ":" + cv["key"].(string)
+			},
+			wantValue: "from-run:value",
+		},
+		{
+			name: "context vars",
+			fn: func(cv types.ContextVars) string {
+				return cv["key"].(string)
+			},
+			wantValue: "value",
+		},
+		{
+			name: "ctx, context vars and arguments",
+			fn: func(ctx context.Context, cv types.ContextVars, name string) string {
+				return name + ":" + cv["key"].(string)
+			},
+			args:      []any{"arg"},
+			wantValue: "arg:value",
+		},
+		{
+			name: "honors cancellation",
+			fn: func(ctx context.Context) error {
+				return ctx.Err()
+			},
+			wantErr: context.Canceled,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var args []reflect.Value
+			for _, arg := range tt.args {
+				args = append(args, reflect.ValueOf(arg))
+			}
+			result, err := callFunction(ctx, tt.fn, args, contextVars, nil)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantValue, result.Value)
+		})
+	}
+}
+
+func TestCallFunctionWithComplexTypes(t *testing.T) {
+	tests := []struct {
+		name      string
+		fn        interface{}
+		args      []interface{}
+		wantValue string
+		wantErr   bool
+	}{
+		{
+			name: "text marshaler success",
+			fn: func() encoding.TextMarshaler {
 				return textMarshaler{shouldError: false}
 			},
 			wantValue: "marshaled text",
@@ -1520,7 +2200,7 @@ func TestCallFunctionWithComplexTypes(t *testing.T) {
 					args[i] = reflect.ValueOf(arg)
 				}
 			}
-			result, err := callFunction(tt.fn, args, nil)
+			result, err := callFunction(context.Background(), tt.fn, args, nil, nil)
 
 			if tt.wantErr {
 				assert.Error(t, err)
@@ -1532,3 +2212,1427 @@ func TestCallFunctionWithComplexTypes(t *testing.T) {
 		})
 	}
 }
+
+func TestRunRejectsInvalidAssistantMessage(t *testing.T) {
+	l := NewLocal()
+
+	agent := &mockAgent{
+		testName: "test_agent",
+		testModel: testModel{provider: &mockProvider{
+			responses: []provider.StreamEvent{
+				provider.Response[messages.AssistantMessage]{
+					Response: messages.AssistantMessage{
+						Content: messages.AssistantContentOrParts{Content: "hello"},
+						Refusal: "I can't help with that",
+					},
+				},
+			},
+		}},
+	}
+
+	var published error
+	hook := mocks.NewHook(t)
+	hook.EXPECT().OnError(mock.Anything, mock.MatchedBy(func(err error) bool {
+		published = err
+		return true
+	}))
+
+	thread := promptedThread()
+	cmd, err := NewRunCommand(agent, thread, hook)
+	require.NoError(t, err)
+
+	fut := NewFuture(DefaultUnmarshal[string]())
+	err = l.Run(context.Background(), cmd, fut)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "agent test_agent produced an invalid response")
+	assert.Contains(t, err.Error(), "both Content and Refusal cannot be set")
+
+	require.Error(t, published)
+	assert.Contains(t, published.Error(), "both Content and Refusal cannot be set")
+
+	_, err = fut.Get()
+	require.Error(t, err)
+
+	// the invalid message never reaches the thread
+	assert.Len(t, thread.Messages(), 1)
+}
+
+func TestRunErrorsCarryRequestContext(t *testing.T) {
+	captureError := func(t *testing.T) (*mocks.Hook, *events.Error) {
+		published := new(events.Error)
+		hook := mocks.NewHook(t)
+		hook.EXPECT().OnError(mock.Anything, mock.MatchedBy(func(err error) bool {
+			return errors.As(err, published)
+		}))
+		return hook, published
+	}
+
+	t.Run("provider failure", func(t *testing.T) {
+		agent := &mockAgent{
+			testName: "test_agent",
+			testModel: testModel{provider: &mockProvider{
+				responses: []provider.StreamEvent{
+					provider.Error{Err: errors.New("rate limited")},
+				},
+			}},
+		}
+		hook, published := captureError(t)
+
+		cmd, err := NewRunCommand(agent, promptedThread(), hook)
+		require.NoError(t, err)
+
+		err = NewLocal().Run(context.Background(), cmd, NewFuture(DefaultUnmarshal[string]()))
+		require.Error(t, err)
+
+		require.NotNil(t, published.Context)
+		assert.Equal(t, events.RequestContext{
+			Model:     "test_model",
+			Agent:     "test_agent",
+			TurnIndex: 0,
+		}, *published.Context)
+		assert.Contains(t, published.Error(), "rate limited")
+	})
+
+	t.Run("tool failure", func(t *testing.T) {
+		agent := &mockAgent{
+			testName: "test_agent",
+			testModel: testModel{provider: &mockProvider{
+				responses: []provider.StreamEvent{
+					provider.Response[messages.ToolCallMessage]{
+						Response: messages.ToolCallMessage{
+							ToolCalls: []messages.ToolCallData{{ID: "call-1", Name: "lookup", Arguments: "{}"}},
+						},
+					},
+				},
+			}},
+			testTools: []tool.Definition{
+				tool.Must(func() error {
+					return errors.New("lookup failed")
+				}, tool.Name("lookup")),
+			},
+		}
+		hook, published := captureError(t)
+		hook.EXPECT().OnToolCallMessage(mock.Anything, mock.Anything)
+
+		cmd, err := NewRunCommand(agent, promptedThread(), hook)
+		require.NoError(t, err)
+
+		err = NewLocal().Run(context.Background(), cmd, NewFuture(DefaultUnmarshal[string]()))
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "lookup failed")
+
+		require.NotNil(t, published.Context)
+		assert.Equal(t, "test_model", published.Context.Model)
+		assert.Equal(t, "test_agent", published.Context.Agent)
+		assert.Equal(t, "lookup", published.Context.Tool)
+	})
+}
+
+func TestRunForwardsContentFilter(t *testing.T) {
+	agent := &mockAgent{
+		testName: "test_agent",
+		testModel: testModel{provider: &mockProvider{
+			responses: []provider.StreamEvent{
+				provider.ContentFilter{Categories: []string{"violence"}, FinishReason: "content_filter"},
+				provider.Response[messages.AssistantMessage]{FinishReason: "content_filter"},
+			},
+		}},
+	}
+
+	hook := newRecordingHook()
+
+	cmd, err := NewRunCommand(agent, promptedThread(), hook)
+	require.NoError(t, err)
+
+	require.NoError(t, NewLocal().Run(context.Background(), cmd, NewFuture(DefaultUnmarshal[string]())))
+
+	require.Len(t, hook.contentFilters, 1)
+	assert.Equal(t, []string{"violence"}, hook.contentFilters[0].Categories)
+	assert.Equal(t, "test_agent", hook.contentFilters[0].Sender)
+	assert.Equal(t, "test_model", hook.contentFilters[0].Meta.Get("model").String())
+}
+
+func TestRunAssignsMessageIDs(t *testing.T) {
+	agent := &mockAgent{
+		testName: "test_agent",
+		testModel: testModel{provider: &mockProvider{
+			responses: []provider.StreamEvent{
+				provider.Chunk[messages.AssistantMessage]{
+					Chunk: messages.AssistantMessage{Content: messages.AssistantContentOrParts{Content: "hel"}},
+				},
+				provider.Response[messages.AssistantMessage]{
+					Response: messages.AssistantMessage{Content: messages.AssistantContentOrParts{Content: "hello"}},
+				},
+			},
+		}},
+	}
+
+	var chunk, final messages.Message[messages.AssistantMessage]
+	hook := mocks.NewHook(t)
+	hook.EXPECT().OnAssistantChunk(mock.Anything, mock.Anything).Run(func(_ context.Context, msg messages.Message[messages.AssistantMessage]) {
+		chunk = msg
+	})
+	hook.EXPECT().OnAssistantMessage(mock.Anything, mock.Anything).Run(func(_ context.Context, msg messages.Message[messages.AssistantMessage]) {
+		final = msg
+	})
+
+	thread := promptedThread()
+	cmd, err := NewRunCommand(agent, thread, hook)
+	require.NoError(t, err)
+	require.NoError(t, NewLocal().Run(context.Background(), cmd, NewFuture(DefaultUnmarshal[string]())))
+
+	assert.NotEqual(t, uuid.Nil, chunk.MessageID)
+	assert.NotEqual(t, uuid.Nil, final.MessageID)
+	assert.NotEqual(t, chunk.MessageID, final.MessageID)
+
+	msgs := thread.Messages()
+	require.NotEmpty(t, msgs)
+	assert.Equal(t, final.MessageID, msgs[len(msgs)-1].MessageID, "the thread keeps the ID the hook saw")
+}
+
+func TestRunStoppedByTool(t *testing.T) {
+	var calls int
+	var called []string
+	agent := &mockAgent{
+		testName: "test_agent",
+		testModel: testModel{provider: &mockProvider{
+			chatCompletionHook: func() { calls++ },
+			responses: []provider.StreamEvent{
+				provider.Response[messages.ToolCallMessage]{
+					Response: messages.ToolCallMessage{
+						ToolCalls: []messages.ToolCallData{
+							{ID: "call-1", Name: "escalate", Arguments: "{}"},
+							{ID: "call-2", Name: "lookup", Arguments: "{}"},
+						},
+					},
+				},
+				provider.Response[messages.AssistantMessage]{
+					Response: messages.AssistantMessage{Content: messages.AssistantContentOrParts{Content: "never seen"}},
+				},
+			},
+		}},
+		testTools: []tool.Definition{
+			tool.Must(func() tool.StopRun {
+				called = append(called, "escalate")
+				return tool.Stop("A human will take over from here")
+			}, tool.Name("escalate")),
+			tool.Must(func() string {
+				called = append(called, "lookup")
+				return "looked up"
+			}, tool.Name("lookup")),
+		},
+	}
+
+	hook := mocks.NewHook(t)
+	hook.EXPECT().OnToolCallMessage(mock.Anything, mock.Anything)
+	hook.EXPECT().OnToolCallResponse(mock.Anything, mock.MatchedBy(func(msg messages.Message[messages.ToolResponse]) bool {
+		return msg.Payload.ToolName == "escalate"
+	})).Once()
+	hook.EXPECT().OnAssistantMessage(mock.Anything, mock.MatchedBy(func(msg messages.Message[messages.AssistantMessage]) bool {
+		return msg.Payload.Content.Content == "A human will take over from here"
+	})).Once()
+
+	thread := promptedThread()
+	cmd, err := NewRunCommand(agent, thread, hook)
+	require.NoError(t, err)
+
+	fut := NewFuture(DefaultUnmarshal[string]())
+	require.NoError(t, NewLocal().Run(context.Background(), cmd, fut))
+
+	result, err := fut.Get()
+	require.NoError(t, err)
+	assert.Equal(t, "A human will take over from here", result)
+	assert.Equal(t, 1, calls, "the model should not be asked for another completion")
+	assert.Equal(t, []string{"escalate"}, called, "no tools should run after the run was stopped")
+
+	msgs := thread.Messages()
+	require.NotEmpty(t, msgs)
+	last, ok := msgs[len(msgs)-1].Payload.(messages.AssistantMessage)
+	require.True(t, ok)
+	assert.Equal(t, "A human will take over from here", last.Content.Content)
+}
+
+func TestRunStoppedByToolWithStructuredOutput(t *testing.T) {
+	agent := &mockAgent{
+		testName: "test_agent",
+		testModel: testModel{provider: &mockProvider{
+			responses: []provider.StreamEvent{
+				provider.Response[messages.ToolCallMessage]{
+					Response: messages.ToolCallMessage{
+						ToolCalls: []messages.ToolCallData{{ID: "call-1", Name: "escalate", Arguments: "{}"}},
+					},
+				},
+			},
+		}},
+		testTools: []tool.Definition{
+			tool.Must(func() tool.StopRun {
+				return tool.Stop("A human will take over from here")
+			}, tool.Name("escalate")),
+		},
+	}
+
+	hook := mocks.NewHook(t)
+	hook.EXPECT().OnToolCallMessage(mock.Anything, mock.Anything)
+	hook.EXPECT().OnToolCallResponse(mock.Anything, mock.Anything)
+	hook.EXPECT().OnAssistantMessage(mock.Anything, mock.Anything).Once()
+
+	cmd, err := NewRunCommand(agent, promptedThread(), hook)
+	require.NoError(t, err)
+	cmd = cmd.WithStructuredOutput(&provider.StructuredOutput{Name: "answer"})
+
+	fut := NewFuture(DefaultUnmarshal[map[string]any]())
+	require.NoError(t, NewLocal().Run(context.Background(), cmd, fut))
+
+	_, err = fut.Get()
+	var stopped *api.RunStoppedError
+	require.ErrorAs(t, err, &stopped)
+	assert.Equal(t, "A human will take over from here", stopped.FinalMessage)
+}
+
+func TestRunRendersToolExamples(t *testing.T) {
+	prov := &mockProvider{
+		responses: []provider.StreamEvent{
+			provider.Response[messages.AssistantMessage]{
+				Response: messages.AssistantMessage{Content: messages.AssistantContentOrParts{Content: "done"}},
+			},
+		},
+	}
+	agent := &mockAgent{
+		testName:  "test_agent",
+		testModel: testModel{provider: prov},
+		testTools: []tool.Definition{
+			tool.Must(func(city string) string { return "sunny" },
+				tool.Name("weather"),
+				tool.Parameters("city"),
+				tool.Example(`{"city":"Paris"}`, "sunny"),
+				tool.Example(`{"city":"London"}`, "rainy"),
+			),
+			tool.Must(func() string { return "12:00" }, tool.Name("time")),
+		},
+	}
+
+	cmd, err := NewRunCommand(agent, promptedThread(), &mockHook{})
+	require.NoError(t, err)
+	require.NoError(t, NewLocal().Run(context.Background(), cmd, NewFuture(DefaultUnmarshal[string]())))
+
+	instructions := prov.lastParams.Instructions
+	assert.Regexp(t, "^mock instructions", instructions)
+	assert.Contains(t, instructions, "## weather")
+	assert.Contains(t, instructions, "Arguments: {\"city\":\"Paris\"}\nResult: sunny")
+	assert.Contains(t, instructions, "Arguments: {\"city\":\"London\"}\nResult: rainy")
+	assert.NotContains(t, instructions, "## time")
+}
+
+func TestRunSharesRunStateBetweenTools(t *testing.T) {
+	prov := &mockProvider{
+		responses: []provider.StreamEvent{
+			provider.Response[messages.ToolCallMessage]{
+				Response: messages.ToolCallMessage{
+					ToolCalls: []messages.ToolCallData{
+						{ID: "call-1", Name: "increment", Arguments: "{}"},
+						{ID: "call-2", Name: "increment", Arguments: "{}"},
+						{ID: "call-3", Name: "read", Arguments: "{}"},
+					},
+				},
+			},
+			provider.Response[messages.AssistantMessage]{
+				Response: messages.AssistantMessage{Content: messages.AssistantContentOrParts{Content: "done"}},
+			},
+		},
+	}
+
+	var seen any
+	agent := buboagent.New(
+		buboagent.Name("test_agent"),
+		buboagent.Model(testModel{provider: prov}),
+		buboagent.Instructions("Context: {{ . }}"),
+		buboagent.ParallelToolCalls(false),
+		buboagent.Tools(
+			tool.Must(func(state *types.RunState) string {
+				count, _ := state.Get("counter")
+				n, _ := count.(int)
+				state.Set("counter", n+1)
+				return "incremented"
+			}, tool.Name("increment")),
+			tool.Must(func(state *types.RunState) string {
+				seen, _ = state.Get("counter")
+				return "read"
+			}, tool.Name("read")),
+		),
+	)
+
+	state := types.NewRunState()
+	state.Set("counter", 40)
+	cmd, err := NewRunCommand(agent, promptedThread(), &mockHook{})
+	require.NoError(t, err)
+	cmd = cmd.WithContextVariables(types.ContextVars{"visible": "yes"}).WithRunState(state)
+
+	fut := NewFuture(DefaultUnmarshal[string]())
+	require.NoError(t, NewLocal().Run(context.Background(), cmd, fut))
+	result, err := fut.Get()
+	require.NoError(t, err)
+	assert.Equal(t, "done", result)
+
+	assert.Equal(t, 42, seen, "the tools should share the run state")
+	value, ok := state.Get("counter")
+	require.True(t, ok)
+	assert.Equal(t, 42, value)
+
+	instructions := prov.lastParams.Instructions
+	assert.Contains(t, instructions, "visible")
+	assert.NotContains(t, instructions, "counter", "the run state should never be rendered into the instructions")
+}
+
+func TestRunMergesModelParams(t *testing.T) {
+	temperature, topP, maxTokens := 0.7, 0.9, int64(256)
+	prov := &mockProvider{
+		responses: []provider.StreamEvent{
+			provider.Response[messages.AssistantMessage]{
+				Response: messages.AssistantMessage{Content: messages.AssistantContentOrParts{Content: "done"}},
+			},
+		},
+	}
+	agent := buboagent.New(
+		buboagent.Name("test_agent"),
+		buboagent.Model(testModel{provider: prov}),
+		buboagent.Instructions("You are a test agent"),
+		buboagent.WithModelParams(provider.ModelParams{Temperature: &temperature, TopP: &topP, MaxTokens: &maxTokens}),
+	)
+
+	run := func(params provider.ModelParams) provider.ModelParams {
+		cmd, err := NewRunCommand(agent, promptedThread(), &mockHook{})
+		require.NoError(t, err)
+		require.NoError(t, NewLocal().Run(context.Background(), cmd.WithModelParams(params), NewFuture(DefaultUnmarshal[string]())))
+		return prov.lastParams.ModelParams
+	}
+
+	t.Run("uses the parameters of the agent", func(t *testing.T) {
+		params := run(provider.ModelParams{})
+		require.NotNil(t, params.Temperature)
+		assert.InDelta(t, 0.7, *params.Temperature, 1e-9)
+		require.NotNil(t, params.TopP)
+		assert.InDelta(t, 0.9, *params.TopP, 1e-9)
+		require.NotNil(t, params.MaxTokens)
+		assert.Equal(t, int64(256), *params.MaxTokens)
+	})
+
+	t.Run("the run overrides the agent", func(t *testing.T) {
+		temperature := 0.2
+		params := run(provider.ModelParams{Temperature: &temperature})
+		require.NotNil(t, params.Temperature)
+		assert.InDelta(t, 0.2, *params.Temperature, 1e-9)
+		require.NotNil(t, params.TopP)
+		assert.InDelta(t, 0.9, *params.TopP, 1e-9, "parameters the run doesn't set come from the agent")
+	})
+}
+
+func TestRunPublishesSummary(t *testing.T) {
+	agent2 := &mockAgent{
+		testName: "agent2",
+		testModel: testModel{provider: &mockProvider{
+			responses: []provider.StreamEvent{
+				provider.Response[messages.AssistantMessage]{
+					Response: messages.AssistantMessage{Content: messages.AssistantContentOrParts{Content: "done"}},
+					Meta:     gjson.Parse(`{"usage":{"total_tokens":20}}`),
+				},
+			},
+		}},
+	}
+	agent1 := &mockAgent{
+		testName: "agent1",
+		testModel: testModel{provider: &mockProvider{
+			responses: []provider.StreamEvent{
+				provider.Response[messages.ToolCallMessage]{
+					Response: messages.ToolCallMessage{
+						ToolCalls: []messages.ToolCallData{
+							{ID: "call-1", Name: "lookup", Arguments: "{}"},
+							{ID: "call-2", Name: "transfer_to_agent2", Arguments: "{}"},
+						},
+					},
+					Meta: gjson.Parse(`{"usage":{"total_tokens":30}}`),
+				},
+			},
+		}},
+		testTools: []tool.Definition{
+			{Name: "lookup", Function: func() string { return "found" }},
+			{Name: "transfer_to_agent2", Function: func() api.Agent { return agent2 }},
+		},
+	}
+
+	hook := newRecordingHook()
+	cmd, err := NewRunCommand(agent1, promptedThread(), hook)
+	require.NoError(t, err)
+
+	started := time.Now()
+	fut := NewFuture(DefaultUnmarshal[string]())
+	require.NoError(t, NewLocal().Run(context.Background(), cmd, fut))
+	result, err := fut.Get()
+	require.NoError(t, err)
+	assert.Equal(t, "done", result)
+
+	require.Len(t, hook.summaries, 1)
+	summary := hook.summaries[0]
+	assert.Equal(t, cmd.ID(), summary.RunID)
+	assert.Equal(t, 2, summary.Turns)
+	assert.Equal(t, 2, summary.ToolCalls)
+	assert.Equal(t, int64(50), summary.TotalTokens)
+	assert.Equal(t, "test_model", summary.Model)
+	assert.Equal(t, "agent2", summary.Sender)
+	assert.LessOrEqual(t, summary.Elapsed, time.Since(started))
+}
+
+func TestRunNotifiesCancel(t *testing.T) {
+	ctx, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
+
+	agent := &mockAgent{
+		testModel: testModel{provider: &mockProvider{
+			// the stream never produces a response, the run only ends when it's cancelled
+			streamCh:           make(chan provider.StreamEvent),
+			chatCompletionHook: func() { cancel(errors.New("user went away")) },
+		}},
+	}
+
+	hook := newRecordingHook()
+	cmd, err := NewRunCommand(agent, promptedThread(), hook)
+	require.NoError(t, err)
+
+	fut := NewFuture(DefaultUnmarshal[string]())
+	err = NewLocal().Run(ctx, cmd, fut)
+	require.ErrorIs(t, err, context.Canceled)
+
+	require.Len(t, hook.cancels, 1, "OnCancel fires exactly once")
+	assert.Equal(t, cmd.ID(), hook.cancels[0].runID)
+	assert.Equal(t, "user went away", hook.cancels[0].reason)
+	assert.NoError(t, hook.cancels[0].ctxErr, "the hook can still use its context")
+}
+
+func TestRunSuppressChunks(t *testing.T) {
+	prov := &mockProvider{
+		responses: []provider.StreamEvent{
+			provider.Chunk[messages.ToolCallMessage]{
+				Chunk: messages.ToolCallMessage{ToolCalls: []messages.ToolCallData{{ID: "call-1", Name: "lookup"}}},
+			},
+			provider.Chunk[messages.AssistantMessage]{
+				Chunk: messages.AssistantMessage{Content: messages.AssistantContentOrParts{Content: `{"answer":`}},
+			},
+			provider.Chunk[messages.AssistantMessage]{
+				Chunk: messages.AssistantMessage{Content: messages.AssistantContentOrParts{Content: `42}`}},
+			},
+			provider.Response[messages.AssistantMessage]{
+				Response: messages.AssistantMessage{Content: messages.AssistantContentOrParts{Content: `{"answer":42}`}},
+			},
+		},
+	}
+	agent := &mockAgent{testName: "test_agent", testModel: testModel{provider: prov}}
+
+	var chunks int
+	var final []string
+	hook := &mockHook{
+		onAssistantChunk: func(context.Context, messages.Message[messages.AssistantMessage]) { chunks++ },
+		onToolCallChunk:  func(context.Context, messages.Message[messages.ToolCallMessage]) { chunks++ },
+		onAssistantMessage: func(_ context.Context, msg messages.Message[messages.AssistantMessage]) {
+			final = append(final, msg.Payload.Content.Content)
+		},
+	}
+	cmd, err := NewRunCommand(agent, promptedThread(), hook)
+	require.NoError(t, err)
+	cmd = cmd.WithStream(true).WithSuppressChunks(true)
+
+	type answer struct {
+		Answer int `json:"answer"`
+	}
+	fut := NewFuture(DefaultUnmarshal[answer]())
+	require.NoError(t, NewLocal().Run(context.Background(), cmd, fut))
+	result, err := fut.Get()
+	require.NoError(t, err)
+	assert.Equal(t, 42, result.Answer)
+
+	assert.Zero(t, chunks, "no chunks should be published")
+	assert.Equal(t, []string{`{"answer":42}`}, final)
+}
+
+// turnsProvider returns the responses of a turn for every completion and records the tools of each request
+type turnsProvider struct {
+	provider.Provider
+	turns [][]provider.StreamEvent
+	tools [][]string
+}
+
+func (p *turnsProvider) ChatCompletion(_ context.Context, params provider.CompletionParams) (<-chan provider.StreamEvent, error) {
+	var names []string
+	for _, def := range params.Tools {
+		names = append(names, def.Name)
+	}
+	p.tools = append(p.tools, names)
+
+	responses := p.turns[len(p.tools)-1]
+	ch := make(chan provider.StreamEvent, len(responses))
+	for _, resp := range responses {
+		ch <- resp
+	}
+	close(ch)
+	return ch, nil
+}
+
+func TestRunToolsFunc(t *testing.T) {
+	prov := &turnsProvider{
+		turns: [][]provider.StreamEvent{
+			{
+				provider.Response[messages.ToolCallMessage]{
+					Response: messages.ToolCallMessage{
+						ToolCalls: []messages.ToolCallData{{ID: "call-1", Name: "unlock", Arguments: "{}"}},
+					},
+				},
+			},
+			{
+				provider.Response[messages.AssistantMessage]{
+					Response: messages.AssistantMessage{Content: messages.AssistantContentOrParts{Content: "done"}},
+				},
+			},
+		},
+	}
+	agent := &mockAgent{
+		testName:  "test_agent",
+		testModel: testModel{provider: prov},
+		testTools: []tool.Definition{{Name: "agent_tool", Function: func() string { return "agent" }}},
+	}
+
+	// unlocking hands the conversation back to the agent, which starts the next turn
+	var unlocked bool
+	tools := []tool.Definition{{Name: "unlock", Function: func() api.Agent { unlocked = true; return agent }}}
+	toolsFunc := func(_ context.Context, cv types.ContextVars) []tool.Definition {
+		if unlocked {
+			return append(tools, tool.Definition{Name: "secret", Function: func() string { return "secret" }})
+		}
+		return tools
+	}
+
+	cmd, err := NewRunCommand(agent, promptedThread(), &mockHook{})
+	require.NoError(t, err)
+	cmd = cmd.WithToolsFunc(toolsFunc)
+
+	fut := NewFuture(DefaultUnmarshal[string]())
+	require.NoError(t, NewLocal().Run(context.Background(), cmd, fut))
+	result, err := fut.Get()
+	require.NoError(t, err)
+	assert.Equal(t, "done", result)
+
+	assert.Equal(t, [][]string{{"unlock"}, {"unlock", "secret"}}, prov.tools)
+}
+
+func TestRunSuppressRedundantFinal(t *testing.T) {
+	run := func(final string) []string {
+		prov := &mockProvider{
+			responses: []provider.StreamEvent{
+				provider.Chunk[messages.AssistantMessage]{
+					Chunk: messages.AssistantMessage{Content: messages.AssistantContentOrParts{Content: "streaming "}},
+				},
+				provider.Chunk[messages.AssistantMessage]{
+					Chunk: messages.AssistantMessage{Content: messages.AssistantContentOrParts{Content: "chunk"}},
+				},
+				provider.Response[messages.AssistantMessage]{
+					Response: messages.AssistantMessage{Content: messages.AssistantContentOrParts{Content: final}},
+				},
+			},
+		}
+		agent := &mockAgent{testName: "test_agent", testModel: testModel{provider: prov}}
+
+		var published []string
+		hook := &mockHook{
+			onAssistantMessage: func(_ context.Context, msg messages.Message[messages.AssistantMessage]) {
+				published = append(published, msg.Payload.Content.Content)
+			},
+		}
+		thread := promptedThread()
+		cmd, err := NewRunCommand(agent, thread, hook)
+		require.NoError(t, err)
+		cmd = cmd.WithStream(true).WithSuppressRedundantFinal(true)
+
+		fut := NewFuture(DefaultUnmarshal[string]())
+		require.NoError(t, NewLocal().Run(context.Background(), cmd, fut))
+		result, err := fut.Get()
+		require.NoError(t, err)
+		assert.Equal(t, final, result)
+		require.Len(t, thread.Messages(), 2, "the final message is kept in the thread")
+		return published
+	}
+
+	t.Run("suppresses a final response identical to the chunks", func(t *testing.T) {
+		assert.Empty(t, run("streaming chunk"))
+	})
+
+	t.Run("keeps a final response that differs from the chunks", func(t *testing.T) {
+		assert.Equal(t, []string{"streaming chunk, edited"}, run("streaming chunk, edited"))
+	})
+}
+
+func TestRunDelegatedSubRunCarriesParentRunID(t *testing.T) {
+	var parentMeta []string
+	subHook := &mockHook{
+		onAssistantMessage: func(_ context.Context, msg messages.Message[messages.AssistantMessage]) {
+			parentMeta = append(parentMeta, msg.Meta.Get("parent_run_id").String())
+		},
+	}
+	researcher := &mockAgent{
+		testName: "researcher",
+		testModel: testModel{provider: &mockProvider{
+			responses: []provider.StreamEvent{
+				provider.Response[messages.AssistantMessage]{
+					Response: messages.AssistantMessage{Content: messages.AssistantContentOrParts{Content: "researched"}},
+				},
+			},
+		}},
+	}
+	finisher := &mockAgent{
+		testName: "finisher",
+		testModel: testModel{provider: &mockProvider{
+			responses: []provider.StreamEvent{
+				provider.Response[messages.AssistantMessage]{
+					Response: messages.AssistantMessage{Content: messages.AssistantContentOrParts{Content: "done"}},
+				},
+			},
+		}},
+	}
+
+	var subRunErr error
+	coordinator := &mockAgent{
+		testName: "coordinator",
+		testModel: testModel{provider: &mockProvider{
+			responses: []provider.StreamEvent{
+				provider.Response[messages.ToolCallMessage]{
+					Response: messages.ToolCallMessage{
+						ToolCalls: []messages.ToolCallData{{ID: "call-1", Name: "delegate", Arguments: "{}"}},
+					},
+				},
+			},
+		}},
+		testTools: []tool.Definition{
+			{Name: "delegate", Function: func(ctx context.Context) api.Agent {
+				thread := shorttermmemory.New()
+				thread.AddUserPrompt(messages.New().UserPrompt("research this"))
+				cmd, err := NewRunCommand(researcher, thread, subHook)
+				if err != nil {
+					subRunErr = err
+					return finisher
+				}
+				subRunErr = NewLocal().Run(ctx, cmd, NewFuture(DefaultUnmarshal[string]()))
+				return finisher
+			}},
+		},
+	}
+
+	var ownMeta []string
+	hook := &mockHook{
+		onAssistantMessage: func(_ context.Context, msg messages.Message[messages.AssistantMessage]) {
+			ownMeta = append(ownMeta, msg.Meta.Get("parent_run_id").String())
+		},
+	}
+	cmd, err := NewRunCommand(coordinator, promptedThread(), hook)
+	require.NoError(t, err)
+
+	fut := NewFuture(DefaultUnmarshal[string]())
+	require.NoError(t, NewLocal().Run(context.Background(), cmd, fut))
+	result, err := fut.Get()
+	require.NoError(t, err)
+	assert.Equal(t, "done", result)
+
+	require.NoError(t, subRunErr)
+	assert.Equal(t, []string{cmd.ID().String()}, parentMeta, "the sub-run is tagged with the run that delegated to it")
+	assert.Equal(t, []string{""}, ownMeta, "the run that wasn't delegated has no parent")
+}
+
+func TestRunRecordsToolCallDuration(t *testing.T) {
+	const sleep = 20 * time.Millisecond
+
+	agent := &mockAgent{
+		testName: "test_agent",
+		testModel: testModel{provider: &mockProvider{
+			responses: []provider.StreamEvent{
+				provider.Response[messages.ToolCallMessage]{
+					Response: messages.ToolCallMessage{
+						ToolCalls: []messages.ToolCallData{{ID: "call-1", Name: "slow", Arguments: "{}"}},
+					},
+				},
+			},
+		}},
+		testTools: []tool.Definition{
+			{Name: "slow", Function: func() tool.StopRun {
+				time.Sleep(sleep)
+				return tool.Stop("finally")
+			}},
+		},
+	}
+
+	var responses []messages.Message[messages.ToolResponse]
+	hook := &mockHook{
+		onToolCallResponse: func(_ context.Context, msg messages.Message[messages.ToolResponse]) {
+			responses = append(responses, msg)
+		},
+	}
+	cmd, err := NewRunCommand(agent, promptedThread(), hook)
+	require.NoError(t, err)
+
+	fut := NewFuture(DefaultUnmarshal[string]())
+	require.NoError(t, NewLocal().Run(context.Background(), cmd, fut))
+	_, err = fut.Get()
+	require.NoError(t, err)
+
+	require.Len(t, responses, 1)
+	duration := responses[0].Meta.Get("duration_ms")
+	require.True(t, duration.Exists(), "the tool response carries the duration of the call")
+	assert.GreaterOrEqual(t, duration.Int(), sleep.Milliseconds())
+}
+
+func TestRunSummaryReasoningTokens(t *testing.T) {
+	agent2 := &mockAgent{
+		testName: "agent2",
+		testModel: testModel{provider: &mockProvider{
+			responses: []provider.StreamEvent{
+				provider.Response[messages.AssistantMessage]{
+					Response: messages.AssistantMessage{Content: messages.AssistantContentOrParts{Content: "done"}},
+					Meta:     gjson.Parse(`{"usage":{"total_tokens":40,"completion_tokens_details":{"reasoning_tokens":0}}}`),
+				},
+			},
+		}},
+	}
+	agent1 := &mockAgent{
+		testName: "agent1",
+		testModel: testModel{provider: &mockProvider{
+			responses: []provider.StreamEvent{
+				provider.Response[messages.ToolCallMessage]{
+					Response: messages.ToolCallMessage{
+						ToolCalls: []messages.ToolCallData{{ID: "call-1", Name: "transfer_to_agent2", Arguments: "{}"}},
+					},
+					Meta: gjson.Parse(`{"usage":{"total_tokens":170,"completion_tokens_details":{"reasoning_tokens":128}}}`),
+				},
+			},
+		}},
+		testTools: []tool.Definition{
+			{Name: "transfer_to_agent2", Function: func() api.Agent { return agent2 }},
+		},
+	}
+
+	hook := newRecordingHook()
+	cmd, err := NewRunCommand(agent1, promptedThread(), hook)
+	require.NoError(t, err)
+
+	fut := NewFuture(DefaultUnmarshal[string]())
+	require.NoError(t, NewLocal().Run(context.Background(), cmd, fut))
+	_, err = fut.Get()
+	require.NoError(t, err)
+
+	require.Len(t, hook.summaries, 1)
+	summary := hook.summaries[0]
+	assert.Equal(t, int64(210), summary.TotalTokens)
+	assert.Equal(t, int64(128), summary.ReasoningTokens)
+	assert.Equal(t, []int64{128, 0}, summary.TurnReasoningTokens)
+}
+
+func TestRunWithSenderName(t *testing.T) {
+	agent2 := &mockAgent{
+		testName: "agent2",
+		testModel: testModel{provider: &mockProvider{
+			responses: []provider.StreamEvent{
+				provider.Response[messages.AssistantMessage]{
+					Response: messages.AssistantMessage{Content: messages.AssistantContentOrParts{Content: "done"}},
+				},
+			},
+		}},
+	}
+	agent1 := &mockAgent{
+		testName: "agent1",
+		testModel: testModel{provider: &mockProvider{
+			responses: []provider.StreamEvent{
+				provider.Response[messages.ToolCallMessage]{
+					Response: messages.ToolCallMessage{
+						ToolCalls: []messages.ToolCallData{{ID: "call-1", Name: "transfer_to_agent2", Arguments: "{}"}},
+					},
+				},
+			},
+		}},
+		testTools: []tool.Definition{
+			{Name: "transfer_to_agent2", Function: func() api.Agent { return agent2 }},
+		},
+	}
+
+	var senders []string
+	hook := newRecordingHook()
+	hook.onToolCallMessage = func(_ context.Context, msg messages.Message[messages.ToolCallMessage]) {
+		senders = append(senders, msg.Sender)
+	}
+	hook.onAssistantMessage = func(_ context.Context, msg messages.Message[messages.AssistantMessage]) {
+		senders = append(senders, msg.Sender)
+	}
+	thread := promptedThread()
+	cmd, err := NewRunCommand(agent1, thread, hook)
+	require.NoError(t, err)
+	cmd = cmd.WithSenderName("agent1", "Acme Triage").WithSenderName("agent2", "Acme Support")
+
+	fut := NewFuture(DefaultUnmarshal[string]())
+	require.NoError(t, NewLocal().Run(context.Background(), cmd, fut))
+	result, err := fut.Get()
+	require.NoError(t, err)
+	assert.Equal(t, "done", result)
+
+	assert.Equal(t, []string{"Acme Triage", "Acme Support"}, senders)
+	require.Len(t, hook.summaries, 1)
+	assert.Equal(t, "Acme Support", hook.summaries[0].Sender)
+
+	// the thread keeps the agent names, so the agents are still resolved by them
+	msgs := thread.Messages()
+	require.NotEmpty(t, msgs)
+	assert.Equal(t, "agent2", msgs[len(msgs)-1].Sender)
+}
+
+func TestRunPublishesInstructions(t *testing.T) {
+	agent := buboagent.New(
+		buboagent.Name("concierge"),
+		buboagent.Model(testModel{provider: &mockProvider{
+			responses: []provider.StreamEvent{
+				provider.Response[messages.AssistantMessage]{
+					Response: messages.AssistantMessage{Content: messages.AssistantContentOrParts{Content: "hello"}},
+				},
+			},
+		}}),
+		buboagent.Instructions("You are the concierge of {{ .hotel }}, greet {{ .guest }} by name."),
+	)
+
+	hook := newRecordingHook()
+	cmd, err := NewRunCommand(agent, promptedThread(), hook)
+	require.NoError(t, err)
+	cmd = cmd.WithContextVariables(types.ContextVars{"hotel": "The Grand", "guest": "Ada"})
+
+	fut := NewFuture(DefaultUnmarshal[string]())
+	require.NoError(t, NewLocal().Run(context.Background(), cmd, fut))
+	_, err = fut.Get()
+	require.NoError(t, err)
+
+	require.Len(t, hook.instructions, 1)
+	msg := hook.instructions[0]
+	assert.Equal(t, "You are the concierge of The Grand, greet Ada by name.", msg.Payload.Content)
+	assert.Equal(t, cmd.ID(), msg.RunID)
+	assert.Equal(t, "concierge", msg.Sender)
+}
+
+func TestHandleToolCallsSideEffectOnly(t *testing.T) {
+	agent := newTestAgent()
+	agent.testTools = []tool.Definition{
+		tool.Must(func(channel string) string {
+			return "notified " + channel + " with message id 1234"
+		}, tool.Name("notify"), tool.Parameters("channel"), tool.SideEffectOnly()),
+	}
+
+	var published []messages.Message[messages.ToolResponse]
+	hook := &mockHook{
+		onToolCallResponse: func(_ context.Context, msg messages.Message[messages.ToolResponse]) {
+			published = append(published, msg)
+		},
+	}
+
+	mem := shorttermmemory.New()
+	_, err := NewLocal().handleToolCalls(context.Background(), toolCallParams{
+		runID: uuidx.New(),
+		agent: agent,
+		mem:   mem,
+		hook:  hook,
+		toolCalls: messages.ToolCallMessage{ToolCalls: []messages.ToolCallData{
+			{ID: "call-1", Name: "notify", Arguments: `{"channel":"ops"}`},
+		}},
+	})
+	require.NoError(t, err)
+
+	require.Len(t, published, 1)
+	assert.Equal(t, "notified ops with message id 1234", published[0].Payload.Content)
+
+	msgs := mem.Messages()
+	require.Len(t, msgs, 1)
+	response, ok := msgs[0].Payload.(messages.ToolResponse)
+	require.True(t, ok)
+	assert.Equal(t, "call-1", response.ToolCallID)
+	assert.Equal(t, "tool call notify completed", response.Content)
+}
+
+func TestHandleToolCallsPublishesStatus(t *testing.T) {
+	agent := newTestAgent()
+	agent.testTools = []tool.Definition{
+		tool.Must(func(query string) string { return "found " + query }, tool.Name("lookup"), tool.Parameters("query")),
+		tool.Must(func() string { return "sent" }, tool.Name("notify")),
+	}
+
+	// the number of statuses that were published before the response of each call
+	hook := newRecordingHook()
+	responded := make(map[string]int)
+	hook.onToolCallResponse = func(_ context.Context, msg messages.Message[messages.ToolResponse]) {
+		responded[msg.Payload.ToolCallID] = len(hook.statuses)
+	}
+
+	_, err := NewLocal().handleToolCalls(context.Background(), toolCallParams{
+		runID: uuidx.New(),
+		agent: agent,
+		mem:   shorttermmemory.New(),
+		hook:  hook,
+		toolCalls: messages.ToolCallMessage{ToolCalls: []messages.ToolCallData{
+			{ID: "call-1", Name: "lookup", Arguments: `{"query":"bubo"}`},
+			{ID: "call-2", Name: "notify", Arguments: `{}`},
+		}},
+	})
+	require.NoError(t, err)
+
+	var log []string
+	for _, status := range hook.statuses {
+		log = append(log, string(status.State)+" "+status.ToolCallID+" "+status.ToolName)
+	}
+	assert.Equal(t, []string{
+		"started call-1 lookup",
+		"finished call-1 lookup",
+		"started call-2 notify",
+		"finished call-2 notify",
+	}, log)
+	assert.Equal(t, map[string]int{"call-1": 2, "call-2": 4}, responded)
+}
+
+func TestHandleParallelToolCallsSerializesTheHook(t *testing.T) {
+	agent := newTestAgent()
+	agent.parallel = true
+	agent.testTools = []tool.Definition{
+		tool.Must(func() string { return "a" }, tool.Name("a")),
+		tool.Must(func() string { return "b" }, tool.Name("b")),
+		tool.Must(func() string { return "c" }, tool.Name("c")),
+		tool.Must(func() string { return "d" }, tool.Name("d"), tool.RequireApproval()),
+	}
+
+	// recordingHook isn't safe for concurrent use, the race detector catches concurrent calls
+	hook := newRecordingHook()
+	var responses []string
+	hook.onToolCallResponse = func(_ context.Context, msg messages.Message[messages.ToolResponse]) {
+		assert.Len(t, hook.statuses, 6, "the responses are published after all the calls finished")
+		responses = append(responses, msg.Payload.ToolCallID)
+	}
+
+	_, err := NewLocal().handleToolCalls(context.Background(), toolCallParams{
+		runID:      uuidx.New(),
+		agent:      agent,
+		mem:        shorttermmemory.New(),
+		hook:       hook,
+		concurrent: true,
+		toolCalls: messages.ToolCallMessage{ToolCalls: []messages.ToolCallData{
+			{ID: "call-1", Name: "a", Arguments: `{}`},
+			{ID: "call-2", Name: "b", Arguments: `{}`},
+			{ID: "call-3", Name: "c", Arguments: `{}`},
+			{ID: "call-4", Name: "d", Arguments: `{}`},
+		}},
+	})
+	require.NoError(t, err)
+
+	// the call that wasn't approved never started, the responses keep the order of the calls
+	assert.Len(t, hook.statuses, 6)
+	assert.Equal(t, []string{"call-1", "call-2", "call-3", "call-4"}, responses)
+}
+
+func TestRunAutoContinue(t *testing.T) {
+	truncatedTurns := func() [][]provider.StreamEvent {
+		return [][]provider.StreamEvent{
+			{
+				provider.Response[messages.AssistantMessage]{
+					Response:     messages.AssistantMessage{Content: messages.AssistantContentOrParts{Content: "The quick brown "}},
+					FinishReason: "length",
+				},
+			},
+			{
+				provider.Response[messages.AssistantMessage]{
+					Response:     messages.AssistantMessage{Content: messages.AssistantContentOrParts{Content: "fox jumps over the lazy dog."}},
+					FinishReason: "stop",
+				},
+			},
+		}
+	}
+
+	t.Run("assembles the continued response", func(t *testing.T) {
+		prov := &turnsProvider{turns: truncatedTurns()}
+		agent := &mockAgent{testName: "test_agent", testModel: testModel{provider: prov}}
+
+		thread := promptedThread()
+		cmd, err := NewRunCommand(agent, thread, &mockHook{})
+		require.NoError(t, err)
+		cmd = cmd.WithAutoContinue(2)
+
+		fut := NewFuture(DefaultUnmarshal[string]())
+		require.NoError(t, NewLocal().Run(context.Background(), cmd, fut))
+		result, err := fut.Get()
+		require.NoError(t, err)
+		assert.Equal(t, "The quick brown fox jumps over the lazy dog.", result)
+		assert.Len(t, prov.tools, 2, "the truncated response is continued in a second completion")
+
+		// the continuation prompt stays out of the thread, it only has the assembled response
+		msgs := thread.Messages()
+		require.Len(t, msgs, 2)
+		response, ok := msgs[1].Payload.(messages.AssistantMessage)
+		require.True(t, ok, "expected the assembled response, got %T", msgs[1].Payload)
+		assert.Equal(t, "The quick brown fox jumps over the lazy dog.", response.Content.Content)
+		assert.Equal(t, "stop", msgs[1].Meta.Get("finish_reason").String())
+	})
+
+	t.Run("disabled by default", func(t *testing.T) {
+		prov := &turnsProvider{turns: truncatedTurns()}
+		agent := &mockAgent{testName: "test_agent", testModel: testModel{provider: prov}}
+
+		cmd, err := NewRunCommand(agent, promptedThread(), &mockHook{})
+		require.NoError(t, err)
+
+		fut := NewFuture(DefaultUnmarshal[string]())
+		require.NoError(t, NewLocal().Run(context.Background(), cmd, fut))
+		result, err := fut.Get()
+		require.NoError(t, err)
+		assert.Equal(t, "The quick brown ", result)
+		assert.Len(t, prov.tools, 1)
+	})
+}
+
+func TestHandleToolCallsParamDefault(t *testing.T) {
+	agent := newTestAgent()
+	agent.testTools = []tool.Definition{
+		tool.Must(func(query string, limit int) string {
+			return fmt.Sprintf("%d results for %s", limit, query)
+		}, tool.Name("search"), tool.Parameters("query", "limit"), tool.ParamDefault("limit", 10)),
+	}
+
+	var published []messages.Message[messages.ToolResponse]
+	hook := &mockHook{
+		onToolCallResponse: func(_ context.Context, msg messages.Message[messages.ToolResponse]) {
+			published = append(published, msg)
+		},
+	}
+
+	_, err := NewLocal().handleToolCalls(context.Background(), toolCallParams{
+		runID: uuidx.New(),
+		agent: agent,
+		mem:   shorttermmemory.New(),
+		hook:  hook,
+		toolCalls: messages.ToolCallMessage{ToolCalls: []messages.ToolCallData{
+			{ID: "call-1", Name: "search", Arguments: `{"query":"owls"}`},
+			{ID: "call-2", Name: "search", Arguments: `{"query":"owls","limit":3}`},
+		}},
+	})
+	require.NoError(t, err)
+
+	require.Len(t, published, 2)
+	assert.Equal(t, "10 results for owls", published[0].Payload.Content)
+	assert.Equal(t, "3 results for owls", published[1].Payload.Content)
+}
+
+func TestRunPublishesRequests(t *testing.T) {
+	prov := &turnsProvider{
+		turns: [][]provider.StreamEvent{
+			{
+				provider.Response[messages.ToolCallMessage]{
+					Response: messages.ToolCallMessage{
+						ToolCalls: []messages.ToolCallData{{ID: "call-1", Name: "lookup", Arguments: "{}"}},
+					},
+				},
+			},
+			{
+				provider.Response[messages.AssistantMessage]{
+					Response: messages.AssistantMessage{Content: messages.AssistantContentOrParts{Content: "done"}},
+				},
+			},
+		},
+	}
+	agent := &mockAgent{
+		testName:  "test_agent",
+		testModel: testModel{provider: prov},
+	}
+	// the tool hands the conversation back to the agent, which starts the next turn
+	agent.testTools = []tool.Definition{{Name: "lookup", Function: func() api.Agent { return agent }}}
+
+	thread := shorttermmemory.New()
+	thread.AddUserPrompt(messages.New().WithSender("user").UserPrompt("find it"))
+
+	hook := newRecordingHook()
+	cmd, err := NewRunCommand(agent, thread, hook)
+	require.NoError(t, err)
+
+	fut := NewFuture(DefaultUnmarshal[string]())
+	require.NoError(t, NewLocal().Run(context.Background(), cmd, fut))
+
+	require.Len(t, hook.requests, 2, "one request per turn")
+	for _, request := range hook.requests {
+		assert.Equal(t, "test_model", request.Model)
+		assert.Equal(t, "mock instructions", request.Instructions)
+		require.Len(t, request.Tools, 1)
+		assert.Equal(t, "lookup", request.Tools[0].Name)
+
+		require.NotEmpty(t, request.Messages)
+		prompt, ok := request.Messages[0].Payload.(messages.UserMessage)
+		require.True(t, ok, "expected the user prompt, got %T", request.Messages[0].Payload)
+		assert.Equal(t, "find it", prompt.Content.Content)
+	}
+	assert.NotEqual(t, uuid.Nil, hook.requestTurnIDs[0])
+}
+
+type namedModel struct {
+	testModel
+	name string
+}
+
+func (m namedModel) Name() string { return m.name }
+
+func TestRunModelSelector(t *testing.T) {
+	mini := namedModel{name: "gpt-4o-mini"}
+	full := namedModel{name: "gpt-4o"}
+	selector := func(_ context.Context, msgs []messages.Message[messages.ModelMessage]) api.Model {
+		prompt, ok := msgs[len(msgs)-1].Payload.(messages.UserMessage)
+		if ok && len(prompt.Content.Content) < 20 {
+			return mini
+		}
+		return full
+	}
+
+	tests := []struct {
+		name   string
+		prompt string
+		want   string
+	}{
+		{name: "short prompt", prompt: "hi there", want: "gpt-4o-mini"},
+		{name: "long prompt", prompt: "compare the migration patterns of three owl species", want: "gpt-4o"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prov := &mockProvider{
+				responses: []provider.StreamEvent{
+					provider.Response[messages.AssistantMessage]{
+						Response: messages.AssistantMessage{Content: messages.AssistantContentOrParts{Content: "done"}},
+					},
+				},
+			}
+			mini.provider, full.provider = prov, prov
+			agent := &mockAgent{testName: "test_agent", testModel: testModel{provider: &mockProvider{err: errors.New("the model of the agent was used")}}}
+
+			thread := shorttermmemory.New()
+			thread.AddUserPrompt(messages.New().WithSender("user").UserPrompt(tt.prompt))
+
+			cmd, err := NewRunCommand(agent, thread, &mockHook{})
+			require.NoError(t, err)
+			cmd = cmd.WithModelSelector(selector)
+
+			fut := NewFuture(DefaultUnmarshal[string]())
+			require.NoError(t, NewLocal().Run(context.Background(), cmd, fut))
+			result, err := fut.Get()
+			require.NoError(t, err)
+			assert.Equal(t, "done", result)
+			assert.Equal(t, tt.want, prov.lastParams.Model.Name())
+		})
+	}
+}
+
+func TestRunMeasuresTTFT(t *testing.T) {
+	const delay = 50 * time.Millisecond
+	stream := make(chan provider.StreamEvent, 2)
+	prov := &mockProvider{
+		streamCh: stream,
+		chatCompletionHook: func() {
+			go func() {
+				time.Sleep(delay)
+				stream <- provider.Chunk[messages.AssistantMessage]{
+					Chunk: messages.AssistantMessage{Content: messages.AssistantContentOrParts{Content: "do"}},
+				}
+				stream <- provider.Response[messages.AssistantMessage]{
+					Response: messages.AssistantMessage{Content: messages.AssistantContentOrParts{Content: "done"}},
+				}
+				close(stream)
+			}()
+		},
+	}
+	agent := &mockAgent{testName: "test_agent", testModel: testModel{provider: prov}}
+
+	var meta gjson.Result
+	hook := &mockHook{
+		onAssistantMessage: func(_ context.Context, msg messages.Message[messages.AssistantMessage]) {
+			meta = msg.Meta
+		},
+	}
+
+	thread := shorttermmemory.New()
+	thread.AddUserPrompt(messages.New().WithSender("user").UserPrompt("hello"))
+	cmd, err := NewRunCommand(agent, thread, hook)
+	require.NoError(t, err)
+
+	fut := NewFuture(DefaultUnmarshal[string]())
+	require.NoError(t, NewLocal().Run(context.Background(), cmd, fut))
+	_, err = fut.Get()
+	require.NoError(t, err)
+
+	ttft := meta.Get("ttft_ms")
+	require.True(t, ttft.Exists(), "the response has no ttft_ms: %s", meta.Raw)
+	assert.GreaterOrEqual(t, ttft.Int(), delay.Milliseconds())
+}
+
+// versionedCodec prefixes the JSON encoding of the checkpoints with a format version
+type versionedCodec struct{}
+
+func (versionedCodec) Encode(checkpoint provider.Checkpoint) ([]byte, error) {
+	data, err := provider.JSONCheckpointCodec{}.Encode(checkpoint)
+	return append([]byte("v1:"), data...), err
+}
+
+func (versionedCodec) Decode(data []byte) (provider.Checkpoint, error) {
+	encoded, ok := bytes.CutPrefix(data, []byte("v1:"))
+	if !ok {
+		return provider.Checkpoint{}, errors.New("unknown checkpoint version")
+	}
+	return provider.JSONCheckpointCodec{}.Decode(encoded)
+}
+
+func TestRunResumesFromCheckpoint(t *testing.T) {
+	answer := func(content string) *mockProvider {
+		return &mockProvider{
+			responses: []provider.StreamEvent{
+				provider.Response[messages.AssistantMessage]{
+					Response: messages.AssistantMessage{Content: messages.AssistantContentOrParts{Content: content}},
+				},
+			},
+		}
+	}
+
+	first := shorttermmemory.New()
+	first.AddUserPrompt(messages.New().WithSender("user").UserPrompt("my name is Ada"))
+	agent := &mockAgent{testName: "test_agent", testModel: testModel{provider: answer("Hi Ada")}}
+
+	hook := newRecordingHook()
+	cmd, err := NewRunCommand(agent, first, hook)
+	require.NoError(t, err)
+	fut := NewFuture(DefaultUnmarshal[string]())
+	require.NoError(t, NewLocal().Run(context.Background(), cmd.WithCheckpointCodec(versionedCodec{}), fut))
+	require.Len(t, hook.checkpoints, 1)
+	stored := hook.checkpoints[0]
+	assert.True(t, bytes.HasPrefix(stored, []byte("v1:")), "the checkpoint is encoded with the codec of the run")
+
+	checkpoint, err := versionedCodec{}.Decode(stored)
+	require.NoError(t, err)
+	thread := shorttermmemory.New()
+	checkpoint.MergeInto(thread)
+	thread.AddUserPrompt(messages.New().WithSender("user").UserPrompt("what's my name?"))
+
+	prov := answer("Your name is Ada")
+	agent = &mockAgent{testName: "test_agent", testModel: testModel{provider: prov}}
+	cmd, err = NewRunCommand(agent, thread, &mockHook{})
+	require.NoError(t, err)
+	fut = NewFuture(DefaultUnmarshal[string]())
+	require.NoError(t, NewLocal().Run(context.Background(), cmd, fut))
+	result, err := fut.Get()
+	require.NoError(t, err)
+	assert.Equal(t, "Your name is Ada", result)
+
+	sent := prov.lastParams.Thread.Messages()
+	require.GreaterOrEqual(t, len(sent), 3)
+	assert.Equal(t, messages.UserMessage{Content: messages.ContentOrParts{Content: "my name is Ada"}}, sent[0].Payload)
+	assert.Equal(t, messages.AssistantMessage{Content: messages.AssistantContentOrParts{Content: "Hi Ada"}}, sent[1].Payload)
+}
+
+func TestRunRequiresUserInput(t *testing.T) {
+	tests := []struct {
+		name   string
+		thread func() *shorttermmemory.Aggregator
+	}{
+		{
+			name:   "empty thread",
+			thread: shorttermmemory.New,
+		},
+		{
+			name: "blank prompt",
+			thread: func() *shorttermmemory.Aggregator {
+				thread := shorttermmemory.New()
+				thread.AddUserPrompt(messages.New().UserPrompt(" \n"))
+				return thread
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prov := &mockProvider{err: errors.New("the provider should not be called")}
+			agent := &mockAgent{testName: "test_agent", testModel: testModel{provider: prov}}
+
+			cmd, err := NewRunCommand(agent, tt.thread(), &mockHook{})
+			require.NoError(t, err)
+
+			fut := NewFuture(DefaultUnmarshal[string]())
+			err = NewLocal().Run(context.Background(), cmd, fut)
+			require.ErrorIs(t, err, api.ErrNoUserInput)
+			assert.Zero(t, prov.lastParams, "the provider is not called")
+
+			_, err = fut.Get()
+			require.ErrorIs(t, err, api.ErrNoUserInput)
+		})
+	}
+}
+
+func TestRunAuditsToolCalls(t *testing.T) {
+	run := func(t *testing.T, fn any) ([]events.ToolAuditRecord, error) {
+		agent := &mockAgent{
+			testName: "test_agent",
+			testModel: testModel{provider: &mockProvider{
+				responses: []provider.StreamEvent{
+					provider.Response[messages.ToolCallMessage]{
+						Response: messages.ToolCallMessage{
+							ToolCalls: []messages.ToolCallData{{ID: "call-1", Name: "weather", Arguments: `{"location":"Paris"}`}},
+						},
+					},
+				},
+			}},
+			testTools: []tool.Definition{{
+				Name:       "weather",
+				Parameters: map[string]string{"param0": "location"},
+				Function:   fn,
+			}},
+		}
+
+		hook := newRecordingHook()
+		cmd, err := NewRunCommand(agent, promptedThread(), hook)
+		require.NoError(t, err)
+
+		fut := NewFuture(DefaultUnmarshal[string]())
+		err = NewLocal().Run(context.Background(), cmd, fut)
+		return hook.audits, err
+	}
+
+	t.Run("successful tool", func(t *testing.T) {
+		records, err := run(t, func(location string) tool.StopRun {
+			return tool.Stop("sunny in " + location)
+		})
+		require.NoError(t, err)
+
+		require.Len(t, records, 1)
+		record := records[0]
+		assert.Equal(t, "call-1", record.ToolCallID)
+		assert.Equal(t, "weather", record.ToolName)
+		assert.JSONEq(t, `{"location":"Paris"}`, record.Arguments)
+		assert.Equal(t, "sunny in Paris", record.Result)
+		assert.Equal(t, events.ToolSucceeded, record.Outcome)
+		assert.Empty(t, record.Error)
+		assert.Equal(t, "test_agent", record.Sender)
+	})
+
+	t.Run("failing tool", func(t *testing.T) {
+		records, err := run(t, func(location string) error {
+			return errors.New("weather service unavailable")
+		})
+		require.Error(t, err)
+
+		require.Len(t, records, 1)
+		record := records[0]
+		assert.Equal(t, "call-1", record.ToolCallID)
+		assert.JSONEq(t, `{"location":"Paris"}`, record.Arguments)
+		assert.Empty(t, record.Result)
+		assert.Equal(t, events.ToolFailed, record.Outcome)
+		assert.Equal(t, "weather service unavailable", record.Error)
+	})
+}
+
+// promptedThread returns a thread with a user prompt, so the run has something to respond to.
+func promptedThread() *shorttermmemory.Aggregator {
+	thread := shorttermmemory.New()
+	thread.AddUserPrompt(messages.New().UserPrompt("hello"))
+	return thread
+}
@@ -0,0 +1,152 @@
+package executor
+
+import (
+	"context"
+
+	"github.com/casualjim/bubo/events"
+	"github.com/casualjim/bubo/messages"
+	"github.com/google/uuid"
+)
+
+// displayNames returns a hook that replaces the sender of the events with its display name
+// before passing them on to next. The thread keeps the real agent names, so the routing
+// of the run isn't affected.
+func displayNames(next events.Hook, names map[string]string) events.Hook {
+	if len(names) == 0 {
+		return next
+	}
+	return &senderNames{next: next, names: names}
+}
+
+type senderNames struct {
+	next  events.Hook
+	names map[string]string
+}
+
+var (
+	_ events.Hook              = (*senderNames)(nil)
+	_ events.ApprovalHook      = (*senderNames)(nil)
+	_ events.InstructionsHook  = (*senderNames)(nil)
+	_ events.ContentFilterHook = (*senderNames)(nil)
+	_ events.SummaryHook       = (*senderNames)(nil)
+	_ events.CancelToolHook    = (*senderNames)(nil)
+	_ events.CancelHook        = (*senderNames)(nil)
+	_ events.StatusHook        = (*senderNames)(nil)
+	_ events.RequestHook       = (*senderNames)(nil)
+	_ events.CheckpointHook    = (*senderNames)(nil)
+	_ events.ToolAuditHook     = (*senderNames)(nil)
+)
+
+func (s *senderNames) name(sender string) string {
+	if name, ok := s.names[sender]; ok {
+		return name
+	}
+	return sender
+}
+
+func rename[T messages.ModelMessage](s *senderNames, msg messages.Message[T]) messages.Message[T] {
+	msg.Sender = s.name(msg.Sender)
+	return msg
+}
+
+func (s *senderNames) OnUserPrompt(ctx context.Context, msg messages.Message[messages.UserMessage]) {
+	s.next.OnUserPrompt(ctx, rename(s, msg))
+}
+
+func (s *senderNames) OnAssistantChunk(ctx context.Context, msg messages.Message[messages.AssistantMessage]) {
+	s.next.OnAssistantChunk(ctx, rename(s, msg))
+}
+
+func (s *senderNames) OnToolCallChunk(ctx context.Context, msg messages.Message[messages.ToolCallMessage]) {
+	s.next.OnToolCallChunk(ctx, rename(s, msg))
+}
+
+func (s *senderNames) OnAssistantMessage(ctx context.Context, msg messages.Message[messages.AssistantMessage]) {
+	s.next.OnAssistantMessage(ctx, rename(s, msg))
+}
+
+func (s *senderNames) OnToolCallMessage(ctx context.Context, msg messages.Message[messages.ToolCallMessage]) {
+	s.next.OnToolCallMessage(ctx, rename(s, msg))
+}
+
+func (s *senderNames) OnToolCallResponse(ctx context.Context, msg messages.Message[messages.ToolResponse]) {
+	s.next.OnToolCallResponse(ctx, rename(s, msg))
+}
+
+func (s *senderNames) OnApprovalRequest(ctx context.Context, msg messages.Message[messages.ApprovalRequest]) {
+	if ah, ok := s.next.(events.ApprovalHook); ok {
+		ah.OnApprovalRequest(ctx, rename(s, msg))
+	}
+}
+
+func (s *senderNames) OnApproval(ctx context.Context, msg messages.Message[messages.Approval]) {
+	if ah, ok := s.next.(events.ApprovalHook); ok {
+		ah.OnApproval(ctx, rename(s, msg))
+	}
+}
+
+func (s *senderNames) OnInstructions(ctx context.Context, msg messages.Message[messages.InstructionsMessage]) {
+	if ih, ok := s.next.(events.InstructionsHook); ok {
+		ih.OnInstructions(ctx, rename(s, msg))
+	}
+}
+
+func (s *senderNames) OnContentFilter(ctx context.Context, event events.ContentFilter) {
+	if ch, ok := s.next.(events.ContentFilterHook); ok {
+		event.Sender = s.name(event.Sender)
+		ch.OnContentFilter(ctx, event)
+	}
+}
+
+func (s *senderNames) OnSummary(ctx context.Context, event events.Summary) {
+	if sh, ok := s.next.(events.SummaryHook); ok {
+		event.Sender = s.name(event.Sender)
+		sh.OnSummary(ctx, event)
+	}
+}
+
+func (s *senderNames) OnStatus(ctx context.Context, event events.Status) {
+	if sh, ok := s.next.(events.StatusHook); ok {
+		event.Sender = s.name(event.Sender)
+		sh.OnStatus(ctx, event)
+	}
+}
+
+func (s *senderNames) OnCancelTool(ctx context.Context, event events.CancelTool) {
+	if ch, ok := s.next.(events.CancelToolHook); ok {
+		ch.OnCancelTool(ctx, event)
+	}
+}
+
+func (s *senderNames) OnRequest(ctx context.Context, runID, turnID uuid.UUID, request events.CompletionRequest) {
+	if rh, ok := s.next.(events.RequestHook); ok {
+		rh.OnRequest(ctx, runID, turnID, request)
+	}
+}
+
+func (s *senderNames) OnToolAudit(ctx context.Context, record events.ToolAuditRecord) {
+	if ah, ok := s.next.(events.ToolAuditHook); ok {
+		record.Sender = s.name(record.Sender)
+		ah.OnToolAudit(ctx, record)
+	}
+}
+
+func (s *senderNames) OnCheckpoint(ctx context.Context, runID, turnID uuid.UUID, checkpoint []byte) {
+	if ch, ok := s.next.(events.CheckpointHook); ok {
+		ch.OnCheckpoint(ctx, runID, turnID, checkpoint)
+	}
+}
+
+func (s *senderNames) OnCancel(ctx context.Context, runID uuid.UUID, reason string) {
+	if ch, ok := s.next.(events.CancelHook); ok {
+		ch.OnCancel(ctx, runID, reason)
+	}
+}
+
+func (s *senderNames) OnError(ctx context.Context, err error) {
+	if event, ok := err.(events.Error); ok {
+		event.Sender = s.name(event.Sender)
+		err = event
+	}
+	s.next.OnError(ctx, err)
+}
@@ -14,16 +14,18 @@ import (
 
 	"github.com/casualjim/bubo/agent"
 	"github.com/casualjim/bubo/api"
+	"github.com/casualjim/bubo/broker"
 	"github.com/casualjim/bubo/events"
-	"github.com/casualjim/bubo/internal/broker"
 	"github.com/casualjim/bubo/internal/shorttermmemory"
 	"github.com/casualjim/bubo/messages"
+	"github.com/casualjim/bubo/pkg/uuidx"
 	"github.com/casualjim/bubo/provider"
 	"github.com/casualjim/bubo/provider/models"
 	"github.com/casualjim/bubo/tool"
 	"github.com/casualjim/bubo/types"
 	"github.com/go-openapi/strfmt"
 	"github.com/google/uuid"
+	"github.com/tidwall/gjson"
 	"go.temporal.io/sdk/activity"
 	"go.temporal.io/sdk/client"
 	"go.temporal.io/sdk/temporal"
@@ -40,6 +42,26 @@ func (t *TemporalProxy) Run(ctx context.Context, cmd RunCommand, promise Promise
 		promise.Error(err)
 		return err
 	}
+	if !hasInput(cmd.Thread) {
+		promise.Error(api.ErrNoUserInput)
+		return api.ErrNoUserInput
+	}
+	if cmd.ToolsFunc != nil {
+		err := errors.New("a tools func can't be sent to a temporal worker, use the tools of the agent")
+		promise.Error(err)
+		return err
+	}
+	if cmd.ModelSelector != nil {
+		err := errors.New("a model selector can't be sent to a temporal worker, use the model of the agent")
+		promise.Error(err)
+		return err
+	}
+	if cmd.RunState != nil {
+		// every tool call runs in its own activity, they can't share the state of the run
+		err := errors.New("a run state can't be shared by the tools on a temporal worker, use context variables")
+		promise.Error(err)
+		return err
+	}
 
 	params := runParams{
 		runID:  cmd.ID(),
@@ -76,6 +98,11 @@ func (t *TemporalProxy) Run(ctx context.Context, cmd RunCommand, promise Promise
 	}
 
 	result.Checkpoint.MergeInto(cmd.Thread)
+	recordFinishReason(promise, result.FinishReason)
+	if result.Stopped {
+		completeStopped(promise, cmd.StructuredOutput != nil, result.Result)
+		return nil
+	}
 	promise.Complete(result.Result)
 	return nil
 }
@@ -106,52 +133,172 @@ type runParams struct {
 }
 
 func (t *TemporalProxy) publishError(ctx context.Context, params *runParams, err error) {
-	if ee, hasErr := wrapErr(params.runID, params.turnID, params.agent.Name(), err); hasErr {
+	reqCtx := &events.RequestContext{Agent: params.agent.Name()}
+	if model := params.agent.Model(); model != nil {
+		reqCtx.Model = model.Name()
+	}
+	if ee, hasErr := wrapErr(params.runID, params.turnID, params.agent.Name(), reqCtx, err); hasErr {
 		params.hook.OnError(ctx, ee)
 	}
 }
 
 type Temporal struct {
 	broker broker.Broker
+	// router picks the topics the events are published to, they go to the topic of their run when it's nil
+	router broker.TopicRouter
+	// hook receives the callbacks that aren't published to the broker, like OnRequest, on the worker
+	hook events.Hook
+}
+
+// topic returns the topic the event of the run is published to
+func (t *Temporal) topic(ctx context.Context, runID uuid.UUID, event events.Event) broker.Topic {
+	router := t.router
+	if router == nil {
+		router = broker.ByRun
+	}
+	return t.broker.Topic(ctx, router(runID, event))
 }
 
 type RemoteRunCommand struct {
-	ID               uuid.UUID                  `json:"id"`
-	Agent            RemoteAgent                `json:"agent"`
-	StructuredOutput *provider.StructuredOutput `json:"structured_output,omitempty"`
-	Stream           bool                       `json:"stream"`
-	MaxTurns         int                        `json:"max_turns"`
-	ContextVariables types.ContextVars          `json:"context_variables,omitempty"`
-	Checkpoint       shorttermmemory.Checkpoint `json:"checkpoint"`
+	ID                     uuid.UUID                  `json:"id"`
+	ParentRunID            uuid.UUID                  `json:"parent_run_id,omitempty"`
+	Agent                  RemoteAgent                `json:"agent"`
+	StructuredOutput       *provider.StructuredOutput `json:"structured_output,omitempty"`
+	Stream                 bool                       `json:"stream"`
+	MaxTurns               int                        `json:"max_turns"`
+	ContextVariables       types.ContextVars          `json:"context_variables,omitempty"`
+	Checkpoint             shorttermmemory.Checkpoint `json:"checkpoint"`
+	UserID                 string                     `json:"user_id,omitempty"`
+	HashUserID             bool                       `json:"hash_user_id,omitempty"`
+	MaxToolCallsPerTurn    int                        `json:"max_tool_calls_per_turn,omitempty"`
+	AssistantPrefill       string                     `json:"assistant_prefill,omitempty"`
+	StopSequences          []string                   `json:"stop_sequences,omitempty"`
+	IncludeStreamUsage     bool                       `json:"include_stream_usage,omitempty"`
+	SuppressChunks         bool                       `json:"suppress_chunks,omitempty"`
+	SuppressRedundantFinal bool                       `json:"suppress_redundant_final,omitempty"`
+	ApprovalTimeout        time.Duration              `json:"approval_timeout,omitempty"`
+	ModelParams            provider.ModelParams       `json:"model_params,omitempty"`
 }
 
 type RemoteAgent struct {
-	Name              string `json:"name"`
-	Model             string `json:"model"`
-	Instructions      string `json:"instructions"`
-	ParallelToolCalls bool   `json:"parallelToolCalls"`
+	Name              string               `json:"name"`
+	Model             string               `json:"model"`
+	Instructions      string               `json:"instructions"`
+	ParallelToolCalls bool                 `json:"parallelToolCalls"`
+	ModelParams       provider.ModelParams `json:"model_params,omitempty"`
+	// AwaitSignals maps the names of the tools that wait for a signal to the name of the signal
+	AwaitSignals map[string]string `json:"await_signals,omitempty"`
+	// SignalTimeouts maps the names of the tools that wait for a signal to how long they wait,
+	// tools without one wait DefaultSignalTimeout
+	SignalTimeouts map[string]time.Duration `json:"signal_timeouts,omitempty"`
+	// ApprovalTools are the names of the tools that wait for an approval before they're called
+	ApprovalTools []string `json:"approval_tools,omitempty"`
+	// NowFormat and TodayFormat are the time layouts of the {{.now}} and {{.today}} instruction variables
+	NowFormat   string `json:"now_format,omitempty"`
+	TodayFormat string `json:"today_format,omitempty"`
+}
+
+// remoteAgent returns the description of the agent that is sent to the workflow
+func remoteAgent(a api.Agent) RemoteAgent {
+	var signals map[string]string
+	var signalTimeouts map[string]time.Duration
+	var approvalTools []string
+	for _, def := range a.Tools() {
+		if def.RequiresApproval {
+			approvalTools = append(approvalTools, def.Name)
+		}
+		if def.AwaitSignal == "" {
+			continue
+		}
+		if signals == nil {
+			signals = make(map[string]string)
+		}
+		signals[def.Name] = def.AwaitSignal
+		if def.SignalTimeout > 0 {
+			if signalTimeouts == nil {
+				signalTimeouts = make(map[string]time.Duration)
+			}
+			signalTimeouts[def.Name] = def.SignalTimeout
+		}
+	}
+	var nowFormat, todayFormat string
+	if clock, ok := a.(api.InstructionClock); ok {
+		nowFormat, todayFormat = clock.NowFormat(), clock.TodayFormat()
+	}
+	return RemoteAgent{
+		Name:              a.Name(),
+		Model:             a.Model().Name(),
+		Instructions:      a.Instructions(),
+		ParallelToolCalls: a.ParallelToolCalls(),
+		ModelParams:       api.ModelParamsOf(a),
+		AwaitSignals:      signals,
+		SignalTimeouts:    signalTimeouts,
+		ApprovalTools:     approvalTools,
+		NowFormat:         nowFormat,
+		TodayFormat:       todayFormat,
+	}
 }
 
 // RenderInstructions renders the agent's instructions with the provided context variables.
-func (a *RemoteAgent) RenderInstructions(cv types.ContextVars) (string, error) {
+// The {{.now}} and {{.today}} variables use the clock of the agent when it's registered on the worker
+// with one, otherwise they use now, the time of the workflow. A zero now uses the current time.
+// The template functions of the agent are only available when it's registered on the worker,
+// the functions that were registered globally are always available.
+func (a *RemoteAgent) RenderInstructions(cv types.ContextVars, now time.Time) (string, error) {
 	if !strings.Contains(a.Instructions, "{{") {
 		return a.Instructions, nil
 	}
-	return renderTemplate("instructions", a.Instructions, cv)
+	if now.IsZero() {
+		now = time.Now()
+	}
+	var funcs template.FuncMap
+	if registered, ok := agent.Get(a.Name); ok {
+		if clock, ok := registered.(api.InstructionClock); ok && clock.Clock() != nil {
+			now = clock.Clock()()
+		}
+		if withFuncs, ok := registered.(api.InstructionFuncs); ok {
+			funcs = withFuncs.TemplateFuncs()
+		}
+	}
+	return agent.RenderTemplate("instructions", a.Instructions, funcs, cv.WithTime(now, a.NowFormat, a.TodayFormat))
 }
 
-func renderTemplate(name, templateStr string, cv types.ContextVars) (string, error) {
-	tmpl, err := template.New(name).Option("missingkey=error").Parse(templateStr)
-	if err != nil {
-		return "", err
-	}
+// DefaultSignalTimeout is how long a workflow waits for the signal of a tool when no timeout is configured.
+const DefaultSignalTimeout = 24 * time.Hour
 
-	var buf strings.Builder
-	if err := tmpl.Execute(&buf, cv); err != nil {
-		return "", err
-	}
+// ErrSignalTimeout is returned when the signal of a tool didn't arrive in time.
+var ErrSignalTimeout = errors.New("timed out waiting for the signal")
 
-	return buf.String(), nil
+// awaitSignal waits for the value of the signal, until the timeout expires or the workflow is cancelled
+func awaitSignal(ctx workflow.Context, signal string, timeout time.Duration) (string, error) {
+	if timeout <= 0 {
+		timeout = DefaultSignalTimeout
+	}
+	timerCtx, cancelTimer := workflow.WithCancel(ctx)
+	defer cancelTimer()
+
+	var value string
+	var received, timedOut bool
+	selector := workflow.NewSelector(ctx)
+	selector.AddReceive(workflow.GetSignalChannel(ctx, signal), func(c workflow.ReceiveChannel, _ bool) {
+		c.Receive(ctx, &value)
+		received = true
+	})
+	selector.AddFuture(workflow.NewTimer(timerCtx, timeout), func(f workflow.Future) {
+		// a cancelled timer also resolves the future, with an error
+		timedOut = f.Get(timerCtx, nil) == nil
+	})
+	selector.AddReceive(ctx.Done(), func(workflow.ReceiveChannel, bool) {})
+	selector.Select(ctx)
+
+	switch {
+	case received:
+		return value, nil
+	case timedOut:
+		return "", fmt.Errorf("signal %s: %w after %s", signal, ErrSignalTimeout, timeout)
+	default:
+		return "", ctx.Err()
+	}
 }
 
 type RemoteRunResultType uint8
@@ -166,32 +313,42 @@ type RemoteRunResult struct {
 	ID               uuid.UUID                  `json:"id"`
 	Checkpoint       shorttermmemory.Checkpoint `json:"checkpoint"`
 	Result           string                     `json:"result"`
+	FinishReason     string                     `json:"finish_reason,omitempty"`
 	Type             RemoteRunResultType        `json:"type"`
 	ToolCalls        *messages.ToolCallMessage  `json:"tool_calls,omitempty"`
 	ContextVariables types.ContextVars          `json:"context_variables,omitempty"`
+	Stopped          bool                       `json:"stopped,omitempty"`
 }
 
 func RemoteRunCommandFromRunCommand(cmd RunCommand) RemoteRunCommand {
 	return RemoteRunCommand{
-		ID: cmd.id,
-		Agent: RemoteAgent{
-			Name:              cmd.Agent.Name(),
-			Model:             cmd.Agent.Model().Name(),
-			Instructions:      cmd.Agent.Instructions(),
-			ParallelToolCalls: cmd.Agent.ParallelToolCalls(),
-		},
-		StructuredOutput: cmd.StructuredOutput,
-		Stream:           cmd.Stream,
-		MaxTurns:         cmd.MaxTurns,
-		ContextVariables: cmd.ContextVariables,
+		ID:                     cmd.id,
+		Agent:                  remoteAgent(cmd.Agent),
+		StructuredOutput:       cmd.StructuredOutput,
+		Stream:                 cmd.Stream,
+		MaxTurns:               cmd.MaxTurns,
+		ContextVariables:       cmd.ContextVariables,
+		UserID:                 cmd.UserID,
+		HashUserID:             cmd.HashUserID,
+		MaxToolCallsPerTurn:    cmd.MaxToolCallsPerTurn,
+		AssistantPrefill:       cmd.AssistantPrefill,
+		StopSequences:          cmd.StopSequences,
+		IncludeStreamUsage:     cmd.IncludeStreamUsage,
+		SuppressChunks:         cmd.SuppressChunks,
+		SuppressRedundantFinal: cmd.SuppressRedundantFinal,
+		ParentRunID:            cmd.ParentRunID,
+		ApprovalTimeout:        cmd.ApprovalTimeout,
+		ModelParams:            cmd.ModelParams,
 	}
 }
 
-func (t *Temporal) RunChildWorkflow(ctx workflow.Context, cmd RemoteRunCommand) (string, error) {
+func (t *Temporal) RunChildWorkflow(ctx workflow.Context, cmd RemoteRunCommand) (RemoteRunResult, error) {
 	return t.Run(ctx, cmd)
 }
 
-func (t *Temporal) Run(ctx workflow.Context, cmd RemoteRunCommand) (string, error) {
+// Run is the workflow of a run, its result has the final response, the reason the provider
+// gave for finishing it and the thread with all the messages of the run.
+func (t *Temporal) Run(ctx workflow.Context, cmd RemoteRunCommand) (RemoteRunResult, error) {
 	mem := shorttermmemory.New()
 	cmd.Checkpoint.MergeInto(mem)
 
@@ -206,37 +363,76 @@ func (t *Temporal) Run(ctx workflow.Context, cmd RemoteRunCommand) (string, erro
 	for remainingTurns > 0 {
 		remainingTurns--
 		res, err := t.runCompletionActivity(ctx, completionParams{
-			RunID:            cmd.ID,
-			Agent:            activeAgent,
-			Checkpoint:       mem.Checkpoint(),
-			ContextVariables: ctxVars,
-			StructuredOutput: cmd.StructuredOutput,
-			Stream:           cmd.Stream,
+			RunID:                  cmd.ID,
+			ParentRunID:            cmd.ParentRunID,
+			Agent:                  activeAgent,
+			Checkpoint:             mem.Checkpoint(),
+			ContextVariables:       ctxVars,
+			Now:                    workflow.Now(ctx),
+			StructuredOutput:       cmd.StructuredOutput,
+			Stream:                 cmd.Stream,
+			UserID:                 cmd.UserID,
+			HashUserID:             cmd.HashUserID,
+			AssistantPrefill:       cmd.AssistantPrefill,
+			StopSequences:          cmd.StopSequences,
+			IncludeStreamUsage:     cmd.IncludeStreamUsage,
+			SuppressChunks:         cmd.SuppressChunks,
+			SuppressRedundantFinal: cmd.SuppressRedundantFinal,
+			ModelParams:            cmd.ModelParams,
 		})
 		if err != nil {
 			var continueErr *continueError
 			if errors.As(err, &continueErr) {
 				continue // Agent transfer occurred
 			}
-			return "", err
+			return RemoteRunResult{}, err
 		}
 
 		switch res.Type {
 		case RemoteRunResultTypeCompletion:
 			res.Checkpoint.MergeInto(mem)
-			return res.Result, nil
+			return RemoteRunResult{
+				ID:           cmd.ID,
+				Checkpoint:   mem.Checkpoint(),
+				Result:       res.Result,
+				FinishReason: res.FinishReason,
+				Type:         RemoteRunResultTypeCompletion,
+			}, nil
 		case RemoteRunResultTypeToolCall:
 			if res.ToolCalls == nil {
 				continue
 			}
+			toolCalls, skipped := limitToolCalls(res.ToolCalls.ToolCalls, cmd.MaxToolCallsPerTurn)
+			for _, call := range skipped {
+				msg := skippedToolCallResponse(call, cmd.MaxToolCallsPerTurn)
+				msg.RunID = cmd.ID
+				msg.TurnID = mem.ID()
+				msg.Sender = activeAgent.Name
+				msg.Timestamp = strfmt.DateTime(workflow.Now(ctx))
+				mem.AddToolResponse(msg)
+			}
+
 			// Handle each tool call as a separate activity
-			for _, call := range res.ToolCalls.ToolCalls {
+			for _, call := range toolCalls {
+				var signaled *string
+				if signal, ok := activeAgent.AwaitSignals[call.Name]; ok {
+					// The result of the tool is delivered from outside the run
+					value, err := awaitSignal(ctx, signal, activeAgent.SignalTimeouts[call.Name])
+					if err != nil {
+						return RemoteRunResult{}, err
+					}
+					signaled = &value
+				}
+
 				toolResult, err := t.runToolCallActivity(ctx, remoteToolCallParams{
 					RunID:    cmd.ID,
 					TurnID:   mem.ID(),
 					Agent:    activeAgent,
 					ToolCall: call,
 					CtxVars:  ctxVars,
+					Signaled: signaled,
+
+					ApprovalTimeout: cmd.ApprovalTimeout,
 				})
 
 				// Update context variables from tool result
@@ -244,7 +440,7 @@ func (t *Temporal) Run(ctx workflow.Context, cmd RemoteRunCommand) (string, erro
 					maps.Copy(ctxVars, toolResult.CtxVars)
 				}
 				if err != nil {
-					return "", err
+					return RemoteRunResult{}, err
 				}
 
 				// Handle potential agent transfer
@@ -256,19 +452,30 @@ func (t *Temporal) Run(ctx workflow.Context, cmd RemoteRunCommand) (string, erro
 					}
 					ctx = workflow.WithChildOptions(ctx, cwo)
 
-					var childResult string
+					var childResult RemoteRunResult
 					childFuture := workflow.ExecuteChildWorkflow(ctx, t.RunChildWorkflow, RemoteRunCommand{
-						ID:               cmd.ID,
-						Agent:            *toolResult.Agent,
-						StructuredOutput: cmd.StructuredOutput,
-						Stream:           cmd.Stream,
-						MaxTurns:         remainingTurns,
-						ContextVariables: ctxVars,
-						Checkpoint:       mem.Checkpoint(),
+						ID:                     cmd.ID,
+						ParentRunID:            cmd.ParentRunID,
+						Agent:                  *toolResult.Agent,
+						StructuredOutput:       cmd.StructuredOutput,
+						Stream:                 cmd.Stream,
+						MaxTurns:               remainingTurns,
+						ContextVariables:       ctxVars,
+						Checkpoint:             mem.Checkpoint(),
+						UserID:                 cmd.UserID,
+						HashUserID:             cmd.HashUserID,
+						AssistantPrefill:       cmd.AssistantPrefill,
+						StopSequences:          cmd.StopSequences,
+						IncludeStreamUsage:     cmd.IncludeStreamUsage,
+						SuppressChunks:         cmd.SuppressChunks,
+						SuppressRedundantFinal: cmd.SuppressRedundantFinal,
+						MaxToolCallsPerTurn:    cmd.MaxToolCallsPerTurn,
+						ApprovalTimeout:        cmd.ApprovalTimeout,
+						ModelParams:            cmd.ModelParams,
 					})
 
 					if err := childFuture.Get(ctx, &childResult); err != nil {
-						return "", fmt.Errorf("child workflow failed: %w", err)
+						return RemoteRunResult{}, fmt.Errorf("child workflow failed: %w", err)
 					}
 					continue
 				}
@@ -277,6 +484,17 @@ func (t *Temporal) Run(ctx workflow.Context, cmd RemoteRunCommand) (string, erro
 				if toolResult.Message != nil {
 					mem.AddToolResponse(*toolResult.Message)
 				}
+
+				// The tool ended the run with a final message
+				if toolResult.Stop != nil {
+					return RemoteRunResult{
+						ID:         cmd.ID,
+						Checkpoint: mem.Checkpoint(),
+						Result:     *toolResult.Stop,
+						Type:       RemoteRunResultTypeCompletion,
+						Stopped:    true,
+					}, nil
+				}
 			}
 		}
 	}
@@ -297,9 +515,9 @@ func (t *Temporal) Run(ctx workflow.Context, cmd RemoteRunCommand) (string, erro
 		Agent:      activeAgent,
 		Checkpoint: mem.Checkpoint(),
 	}, "max turns reached").Get(ctx, nil); err != nil {
-		return "", fmt.Errorf("failed to publish max turns error: %w", err)
+		return RemoteRunResult{}, fmt.Errorf("failed to publish max turns error: %w", err)
 	}
-	return "", errors.New("max turns reached")
+	return RemoteRunResult{}, errors.New("max turns reached")
 }
 
 func (t *Temporal) runCompletionActivity(ctx workflow.Context, cmd completionParams) (RemoteRunResult, error) {
@@ -329,17 +547,29 @@ type remoteToolCallParams struct {
 	Agent    RemoteAgent
 	ToolCall messages.ToolCallData
 	CtxVars  types.ContextVars
+	// Signaled is the result the workflow received for a tool that awaits a signal,
+	// the tool isn't called when it's set
+	Signaled *string
+
+	ApprovalTimeout time.Duration
 }
 
 type remoteToolCallResult struct {
 	Message *messages.Message[messages.ToolResponse] `json:"message,omitempty"`
 	Agent   *RemoteAgent                             `json:"agent,omitempty"`
 	CtxVars types.ContextVars                        `json:"context_variables,omitempty"`
+	Stop    *string                                  `json:"stop,omitempty"`
 }
 
 func (t *Temporal) runToolCallActivity(ctx workflow.Context, toolCall remoteToolCallParams) (remoteToolCallResult, error) {
+	startToClose := 1 * time.Minute // Most tool calls should complete faster
+	if slices.Contains(toolCall.Agent.ApprovalTools, toolCall.ToolCall.Name) {
+		// Leave room for a human to answer approval requests
+		startToClose += effectiveApprovalTimeout(toolCall.ApprovalTimeout)
+	}
+
 	cctx := workflow.WithActivityOptions(ctx, workflow.ActivityOptions{
-		StartToCloseTimeout:    1 * time.Minute,  // Most tool calls should complete faster
+		StartToCloseTimeout:    startToClose,
 		ScheduleToStartTimeout: 10 * time.Second, // Allow reasonable time for worker pickup
 		HeartbeatTimeout:       10 * time.Second, // For long-running tools
 		RetryPolicy: &temporal.RetryPolicy{
@@ -358,12 +588,22 @@ func (t *Temporal) runToolCallActivity(ctx workflow.Context, toolCall remoteTool
 }
 
 type completionParams struct {
-	RunID            uuid.UUID                  `json:"run_id"`
-	Agent            RemoteAgent                `json:"agent"`
-	Checkpoint       shorttermmemory.Checkpoint `json:"checkpoint"`
-	ContextVariables types.ContextVars          `json:"context_variables,omitempty"`
-	StructuredOutput *provider.StructuredOutput `json:"strutured_output,omitempty"`
-	Stream           bool                       `json:"stream,omitempty"`
+	RunID                  uuid.UUID                  `json:"run_id"`
+	ParentRunID            uuid.UUID                  `json:"parent_run_id,omitempty"`
+	Agent                  RemoteAgent                `json:"agent"`
+	Checkpoint             shorttermmemory.Checkpoint `json:"checkpoint"`
+	ContextVariables       types.ContextVars          `json:"context_variables,omitempty"`
+	Now                    time.Time                  `json:"now"`
+	StructuredOutput       *provider.StructuredOutput `json:"strutured_output,omitempty"`
+	Stream                 bool                       `json:"stream,omitempty"`
+	UserID                 string                     `json:"user_id,omitempty"`
+	HashUserID             bool                       `json:"hash_user_id,omitempty"`
+	AssistantPrefill       string                     `json:"assistant_prefill,omitempty"`
+	StopSequences          []string                   `json:"stop_sequences,omitempty"`
+	IncludeStreamUsage     bool                       `json:"include_stream_usage,omitempty"`
+	SuppressChunks         bool                       `json:"suppress_chunks,omitempty"`
+	SuppressRedundantFinal bool                       `json:"suppress_redundant_final,omitempty"`
+	ModelParams            provider.ModelParams       `json:"model_params,omitempty"`
 }
 
 func (t *Temporal) RunCompletion(ctx context.Context, cmd completionParams) (RemoteRunResult, error) {
@@ -375,7 +615,7 @@ func (t *Temporal) RunCompletion(ctx context.Context, cmd completionParams) (Rem
 		ctxVars = make(types.ContextVars)
 	}
 
-	instructions, err := cmd.Agent.RenderInstructions(ctxVars)
+	instructions, err := cmd.Agent.RenderInstructions(ctxVars, cmd.Now)
 	if err != nil {
 		return RemoteRunResult{}, fmt.Errorf("failed to render instructions: %w", err)
 	}
@@ -388,18 +628,33 @@ func (t *Temporal) RunCompletion(ctx context.Context, cmd completionParams) (Rem
 	agg := shorttermmemory.New()
 	cmd.Checkpoint.MergeInto(agg)
 
+	if hook, ok := t.hook.(events.RequestHook); ok {
+		hook.OnRequest(ctx, cmd.RunID, cmd.Checkpoint.ID(), events.CompletionRequest{
+			Model:        model.Name(),
+			Instructions: instructions,
+			Messages:     agg.Messages(),
+		})
+	}
+
 	stream, err := model.Provider().ChatCompletion(ctx, provider.CompletionParams{
-		RunID:          cmd.RunID,
-		Instructions:   instructions,
-		Thread:         agg,
-		Stream:         cmd.Stream,
-		ResponseSchema: cmd.StructuredOutput,
-		Model:          model,
+		RunID:              cmd.RunID,
+		Instructions:       instructions,
+		Thread:             agg,
+		Stream:             cmd.Stream,
+		ResponseSchema:     cmd.StructuredOutput,
+		Model:              model,
+		UserID:             cmd.UserID,
+		HashUserID:         cmd.HashUserID,
+		AssistantPrefill:   cmd.AssistantPrefill,
+		StopSequences:      cmd.StopSequences,
+		IncludeStreamUsage: cmd.IncludeStreamUsage,
+		ModelParams:        cmd.Agent.ModelParams.Merge(cmd.ModelParams),
 	})
 	if err != nil {
 		return RemoteRunResult{}, fmt.Errorf("failed to get chat completion: %w", err)
 	}
 
+	var streamed strings.Builder
 	for {
 		select {
 		case event, hasMore := <-stream:
@@ -413,10 +668,11 @@ func (t *Temporal) RunCompletion(ctx context.Context, cmd completionParams) (Rem
 
 				if assistantMsg, ok := lastMsg.Payload.(messages.AssistantMessage); ok {
 					return RemoteRunResult{
-						ID:         cmd.RunID,
-						Result:     assistantMsg.Content.Content,
-						Checkpoint: agg.Checkpoint(),
-						Type:       RemoteRunResultTypeCompletion,
+						ID:           cmd.RunID,
+						Result:       assistantMsg.Content.Content,
+						FinishReason: lastMsg.Meta.Get("finish_reason").String(),
+						Checkpoint:   agg.Checkpoint(),
+						Type:         RemoteRunResultTypeCompletion,
 					}, nil
 				}
 
@@ -432,7 +688,7 @@ func (t *Temporal) RunCompletion(ctx context.Context, cmd completionParams) (Rem
 				return RemoteRunResult{}, fmt.Errorf("unexpected last message type")
 			}
 
-			if err := t.processStreamEvent(ctx, event, &cmd, agg); err != nil {
+			if err := t.processStreamEvent(ctx, event, &cmd, agg, &streamed); err != nil {
 				return RemoteRunResult{}, err
 			}
 		case <-ctx.Done():
@@ -441,7 +697,11 @@ func (t *Temporal) RunCompletion(ctx context.Context, cmd completionParams) (Rem
 	}
 }
 
-func (t *Temporal) processStreamEvent(ctx context.Context, event provider.StreamEvent, params *completionParams, agg *shorttermmemory.Aggregator) error {
+func (t *Temporal) processStreamEvent(ctx context.Context, event provider.StreamEvent, params *completionParams, agg *shorttermmemory.Aggregator, streamed *strings.Builder) error {
+	event = provider.WithMeta(event, "model", params.Agent.Model)
+	if params.ParentRunID != uuid.Nil {
+		event = provider.WithMeta(event, "parent_run_id", params.ParentRunID.String())
+	}
 	switch event := event.(type) {
 	case provider.Delim:
 		return nil
@@ -450,13 +710,24 @@ func (t *Temporal) processStreamEvent(ctx context.Context, event provider.Stream
 			return err
 		}
 		return event.Err
+	case provider.ContentFilter:
+		return publishEvent[messages.AssistantMessage](ctx, t, event.RunID, params.Agent.Name, event, uuid.Nil)
 	case provider.Chunk[messages.AssistantMessage]:
-		return publishEvent[messages.AssistantMessage](ctx, t.broker, event.RunID.String(), params.Agent.Name, event)
+		if params.SuppressChunks {
+			return nil
+		}
+		streamed.WriteString(event.Chunk.Content.Content)
+		return publishEvent[messages.AssistantMessage](ctx, t, event.RunID, params.Agent.Name, event, uuidx.New())
 	case provider.Chunk[messages.ToolCallMessage]:
-		return publishEvent[messages.ToolCallMessage](ctx, t.broker, event.RunID.String(), params.Agent.Name, event)
+		if params.SuppressChunks {
+			return nil
+		}
+		return publishEvent[messages.ToolCallMessage](ctx, t, event.RunID, params.Agent.Name, event, uuidx.New())
 	case provider.Response[messages.ToolCallMessage]:
 		event.Checkpoint.MergeInto(agg)
+		event.Meta = withFinishReason(event.Meta, event.FinishReason)
 		msg := messages.Message[messages.ToolCallMessage]{
+			MessageID: uuidx.New(),
 			RunID:     event.RunID,
 			TurnID:    event.TurnID,
 			Payload:   event.Response,
@@ -465,10 +736,19 @@ func (t *Temporal) processStreamEvent(ctx context.Context, event provider.Stream
 			Meta:      event.Meta,
 		}
 		agg.AddToolCall(msg)
-		return publishEvent[messages.ToolCallMessage](ctx, t.broker, event.RunID.String(), params.Agent.Name, event)
+		return publishEvent[messages.ToolCallMessage](ctx, t, event.RunID, params.Agent.Name, event, msg.MessageID)
 	case provider.Response[messages.AssistantMessage]:
+		if err := event.Response.Validate(); err != nil {
+			err = fmt.Errorf("agent %s produced an invalid response: %w", params.Agent.Name, err)
+			if perr := t.PublishError(ctx, *params, err.Error()); perr != nil {
+				return perr
+			}
+			return err
+		}
 		event.Checkpoint.MergeInto(agg)
+		event.Meta = withFinishReason(event.Meta, event.FinishReason)
 		msg := messages.Message[messages.AssistantMessage]{
+			MessageID: uuidx.New(),
 			RunID:     event.RunID,
 			TurnID:    event.TurnID,
 			Payload:   event.Response,
@@ -477,27 +757,56 @@ func (t *Temporal) processStreamEvent(ctx context.Context, event provider.Stream
 			Meta:      event.Meta,
 		}
 		agg.AddAssistantMessage(msg)
-		return publishEvent[messages.AssistantMessage](ctx, t.broker, event.RunID.String(), params.Agent.Name, event)
+		if params.SuppressRedundantFinal && streamed.Len() > 0 && streamed.String() == event.Response.Content.Content {
+			// the subscribers already have the whole response from the chunks
+			return nil
+		}
+		return publishEvent[messages.AssistantMessage](ctx, t, event.RunID, params.Agent.Name, event, msg.MessageID)
 	default:
 		panic(fmt.Sprintf("unknown event type %T", event))
 	}
 }
 
-func publishEvent[T messages.ModelMessage](ctx context.Context, broker broker.Broker, topic, sender string, event provider.StreamEvent) error {
+// publishEvent publishes the stream event, the chunks and responses are published with the ID of the message they're part of
+func publishEvent[T messages.ModelMessage](ctx context.Context, t *Temporal, runID uuid.UUID, sender string, event provider.StreamEvent, messageID uuid.UUID) error {
 	log := activity.GetLogger(ctx)
-	if err := broker.Topic(ctx, topic).Publish(ctx, events.FromStreamEvent(event, sender)); err != nil {
+	published := withMessageID(events.FromStreamEvent(event, sender), messageID)
+	if err := t.topic(ctx, runID, published).Publish(ctx, published); err != nil {
 		log.Error("failed to publish event", "error", err)
 		return fmt.Errorf("failed to publish event: %w", err)
 	}
 	return nil
 }
 
+func withMessageID(event events.Event, id uuid.UUID) events.Event {
+	switch e := event.(type) {
+	case events.Chunk[messages.AssistantMessage]:
+		e.MessageID = id
+		return e
+	case events.Chunk[messages.ToolCallMessage]:
+		e.MessageID = id
+		return e
+	case events.Response[messages.AssistantMessage]:
+		e.MessageID = id
+		return e
+	case events.Response[messages.ToolCallMessage]:
+		e.MessageID = id
+		return e
+	default:
+		return event
+	}
+}
+
 // PublishError is an activity that publishes error events
 func (t *Temporal) PublishError(ctx context.Context, params completionParams, errMsg string) error {
 	log := activity.GetLogger(ctx)
 	err := errors.New(errMsg)
-	if ee, hasErr := wrapErr(params.RunID, params.Checkpoint.ID(), params.Agent.Name, err); hasErr {
-		if perr := t.broker.Topic(ctx, params.RunID.String()).Publish(ctx, ee); perr != nil {
+	reqCtx := &events.RequestContext{
+		Model: params.Agent.Model,
+		Agent: params.Agent.Name,
+	}
+	if ee, hasErr := wrapErr(params.RunID, params.Checkpoint.ID(), params.Agent.Name, reqCtx, err); hasErr {
+		if perr := t.topic(ctx, params.RunID, ee).Publish(ctx, ee); perr != nil {
 			log.Error("failed to publish error", "error", perr)
 			return fmt.Errorf("failed to publish error: %w", perr)
 		}
@@ -532,16 +841,56 @@ func (t *Temporal) CallTool(ctx context.Context, tc remoteToolCallParams) (remot
 		}
 	}
 
-	args := buildArgList(tc.ToolCall.Arguments, agentTool.Parameters)
+	if agentTool.Builtin {
+		// the provider already executed the tool, its result is part of the response
+		return remoteToolCallResult{CtxVars: tc.CtxVars}, nil
+	}
+
 	// Create a copy of context variables to avoid modifying the original
 	ctxVars := maps.Clone(tc.CtxVars)
 	if ctxVars == nil {
 		ctxVars = make(types.ContextVars)
 	}
 
-	result, err := callFunction(agentTool.Function, args, ctxVars)
-	if err != nil {
-		return remoteToolCallResult{}, err
+	var result toolResult
+	var duration time.Duration
+	// invalid arguments are sent back to the model before anyone is asked to approve the call
+	retry, invalid := validateToolArgs(tc.ToolCall, *agentTool)
+	var approval messages.Approval
+	if agentTool.RequiresApproval && tc.Signaled == nil && !invalid {
+		var err error
+		approval, err = awaitApproval(ctx, approvalParams{
+			topic:     t.broker.Topic(ctx, tc.RunID.String()),
+			timeout:   tc.ApprovalTimeout,
+			runID:     tc.RunID,
+			turnID:    tc.TurnID,
+			sender:    agent.Name(),
+			heartbeat: func() { activity.RecordHeartbeat(ctx) },
+		}, tc.ToolCall)
+		if err != nil {
+			return remoteToolCallResult{}, err
+		}
+	}
+
+	if tc.Signaled != nil {
+		result.Value = *tc.Signaled
+	} else if invalid {
+		retryMsg, err := toolRetryResponse(retry)
+		if err != nil {
+			return remoteToolCallResult{}, err
+		}
+		result.Value = retryMsg.Payload.Content
+	} else if agentTool.RequiresApproval && !approval.Approved {
+		result.Value = deniedToolCallResponse(tc.ToolCall, approval).Payload.Content
+	} else {
+		args := buildArgList(tc.ToolCall.Arguments, agentTool.Parameters, agentTool.Defaults)
+		started := time.Now()
+		var err error
+		result, err = callFunction(ctx, agentTool.Function, args, ctxVars, nil)
+		duration = time.Since(started)
+		if err != nil {
+			return remoteToolCallResult{}, err
+		}
 	}
 
 	// Update original context variables with any new values
@@ -550,20 +899,20 @@ func (t *Temporal) CallTool(ctx context.Context, tc remoteToolCallParams) (remot
 	}
 
 	if result.Agent != nil {
+		if err := checkHandoff(agent, result.Agent); err != nil {
+			return remoteToolCallResult{}, err
+		}
+		next := remoteAgent(result.Agent)
 		return remoteToolCallResult{
-			Agent: &RemoteAgent{
-				Name:              result.Agent.Name(),
-				Model:             result.Agent.Model().Name(),
-				Instructions:      result.Agent.Instructions(),
-				ParallelToolCalls: result.Agent.ParallelToolCalls(),
-			},
+			Agent:   &next,
 			CtxVars: ctxVars,
 		}, nil
 	}
 
 	msg := messages.Message[messages.ToolResponse]{
-		RunID:  tc.RunID,
-		TurnID: tc.TurnID,
+		MessageID: uuidx.New(),
+		RunID:     tc.RunID,
+		TurnID:    tc.TurnID,
 		Payload: messages.ToolResponse{
 			ToolName:   tc.ToolCall.Name,
 			ToolCallID: tc.ToolCall.ID,
@@ -571,22 +920,38 @@ func (t *Temporal) CallTool(ctx context.Context, tc remoteToolCallParams) (remot
 		},
 		Sender:    agentTool.Name,
 		Timestamp: strfmt.DateTime(time.Now()),
+		Meta:      withDuration(gjson.Result{}, duration),
+	}
+	if agentTool.RawJSONResult && result.JSON != "" {
+		msg.Payload.Content = result.JSON
+		msg.Payload.RawJSON = true
+	}
+	if result.File != nil {
+		msg.Payload.Data = result.File.Data
+		msg.Payload.MIMEType = result.File.MIMEType
 	}
 
 	// Publish tool response event
-	if err := t.broker.Topic(ctx, tc.RunID.String()).Publish(ctx, events.Request[messages.ToolResponse]{
-		Message: msg.Payload,
-		RunID:   tc.RunID,
-		TurnID:  tc.TurnID,
-		Sender:  agentTool.Name,
-	}); err != nil {
+	response := events.Request[messages.ToolResponse]{
+		MessageID: msg.MessageID,
+		Message:   msg.Payload,
+		RunID:     tc.RunID,
+		TurnID:    tc.TurnID,
+		Sender:    agentTool.Name,
+		Meta:      msg.Meta,
+	}
+	if err := t.topic(ctx, tc.RunID, response).Publish(ctx, response); err != nil {
 		log.Error("failed to publish tool response", "error", err)
 		return remoteToolCallResult{}, fmt.Errorf("failed to publish tool response: %w", err)
 	}
+	if agentTool.SideEffectOnly {
+		msg = sideEffectAck(msg)
+	}
 
 	return remoteToolCallResult{
 		Message: &msg,
 		CtxVars: ctxVars,
+		Stop:    result.Stop,
 	}, nil
 }
 
@@ -594,3 +959,80 @@ func nameAsID(name string) string {
 	hashVal := sha256.Sum256([]byte(name))
 	return hex.EncodeToString(hashVal[:])
 }
+
+// The payloads that cross workflow and activity boundaries encode their context variables
+// with TypedContextVarsCodec, so the Go types of the values are preserved.
+
+// MarshalJSON implements custom JSON marshaling for RemoteRunCommand
+func (c RemoteRunCommand) MarshalJSON() ([]byte, error) {
+	type plain RemoteRunCommand
+	cv := c.ContextVariables
+	c.ContextVariables = nil
+	return marshalWithContextVars(plain(c), "context_variables", cv)
+}
+
+// UnmarshalJSON implements custom JSON unmarshaling for RemoteRunCommand
+func (c *RemoteRunCommand) UnmarshalJSON(data []byte) error {
+	type plain RemoteRunCommand
+	cv, err := unmarshalWithContextVars(data, "context_variables", (*plain)(c))
+	c.ContextVariables = cv
+	return err
+}
+
+// MarshalJSON implements custom JSON marshaling for RemoteRunResult
+func (r RemoteRunResult) MarshalJSON() ([]byte, error) {
+	type plain RemoteRunResult
+	cv := r.ContextVariables
+	r.ContextVariables = nil
+	return marshalWithContextVars(plain(r), "context_variables", cv)
+}
+
+// UnmarshalJSON implements custom JSON unmarshaling for RemoteRunResult
+func (r *RemoteRunResult) UnmarshalJSON(data []byte) error {
+	type plain RemoteRunResult
+	cv, err := unmarshalWithContextVars(data, "context_variables", (*plain)(r))
+	r.ContextVariables = cv
+	return err
+}
+
+func (c completionParams) MarshalJSON() ([]byte, error) {
+	type plain completionParams
+	cv := c.ContextVariables
+	c.ContextVariables = nil
+	return marshalWithContextVars(plain(c), "context_variables", cv)
+}
+
+func (c *completionParams) UnmarshalJSON(data []byte) error {
+	type plain completionParams
+	cv, err := unmarshalWithContextVars(data, "context_variables", (*plain)(c))
+	c.ContextVariables = cv
+	return err
+}
+
+func (p remoteToolCallParams) MarshalJSON() ([]byte, error) {
+	type plain remoteToolCallParams
+	cv := p.CtxVars
+	p.CtxVars = nil
+	return marshalWithContextVars(plain(p), "CtxVars", cv)
+}
+
+func (p *remoteToolCallParams) UnmarshalJSON(data []byte) error {
+	type plain remoteToolCallParams
+	cv, err := unmarshalWithContextVars(data, "CtxVars", (*plain)(p))
+	p.CtxVars = cv
+	return err
+}
+
+func (r remoteToolCallResult) MarshalJSON() ([]byte, error) {
+	type plain remoteToolCallResult
+	cv := r.CtxVars
+	r.CtxVars = nil
+	return marshalWithContextVars(plain(r), "context_variables", cv)
+}
+
+func (r *remoteToolCallResult) UnmarshalJSON(data []byte) error {
+	type plain remoteToolCallResult
+	cv, err := unmarshalWithContextVars(data, "context_variables", (*plain)(r))
+	r.CtxVars = cv
+	return err
+}
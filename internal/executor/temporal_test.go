@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"strings"
 	"testing"
+	"text/template"
 	"time"
 
 	buboagent "github.com/casualjim/bubo/agent"
@@ -160,7 +161,7 @@ func TestTemporalRunCompletion(t *testing.T) {
 			},
 		}
 		// Execute workflow
-		var result string
+		var result RemoteRunResult
 		env.env.ExecuteWorkflow(env.temporal.Run, RemoteRunCommand{
 			ID:         params.RunID,
 			Agent:      params.Agent,
@@ -172,7 +173,7 @@ func TestTemporalRunCompletion(t *testing.T) {
 		require.True(t, env.env.IsWorkflowCompleted())
 		require.NoError(t, env.env.GetWorkflowError())
 		require.NoError(t, env.env.GetWorkflowResult(&result))
-		assert.Equal(t, expectedResult, result)
+		assert.Equal(t, expectedResult, result.Result)
 	})
 
 	t.Run("error handling", func(t *testing.T) {
@@ -312,7 +313,7 @@ func TestTemporalRunCompletion(t *testing.T) {
 		env.env.RegisterActivity(env.temporal.RunCompletion)
 		env.env.RegisterActivity(env.temporal.CallTool)
 
-		var result string
+		var result RemoteRunResult
 		env.env.ExecuteWorkflow(env.temporal.Run, RemoteRunCommand{
 			ID: runID,
 			Agent: RemoteAgent{
@@ -328,7 +329,7 @@ func TestTemporalRunCompletion(t *testing.T) {
 		require.True(t, env.env.IsWorkflowCompleted())
 		require.NoError(t, env.env.GetWorkflowError())
 		require.NoError(t, env.env.GetWorkflowResult(&result))
-		assert.Equal(t, expectedResult, result)
+		assert.Equal(t, expectedResult, result.Result)
 	})
 }
 
@@ -460,7 +461,7 @@ func TestTemporalToolCallsWithComplexTypes(t *testing.T) {
 			return true
 		})).Return(nil).Times(3)
 
-		var result string
+		var result RemoteRunResult
 		env.env.ExecuteWorkflow(env.temporal.Run, RemoteRunCommand{
 			ID: runID,
 			Agent: RemoteAgent{
@@ -474,7 +475,7 @@ func TestTemporalToolCallsWithComplexTypes(t *testing.T) {
 		require.True(t, env.env.IsWorkflowCompleted())
 		require.NoError(t, env.env.GetWorkflowError())
 		require.NoError(t, env.env.GetWorkflowResult(&result))
-		assert.Equal(t, "final response", result)
+		assert.Equal(t, "final response", result.Result)
 		assert.Contains(t, toolResponse, `{"Name":"test","Value":42,"Nested":{"Flag":true}}`)
 	})
 
@@ -936,6 +937,134 @@ func TestTemporalToolCallsWithContextPropagation(t *testing.T) {
 		require.NoError(t, env.env.GetWorkflowError())
 		assert.Contains(t, toolResponses[2], "counter value: 2", "Context variables should update through chain of tools")
 	})
+
+	t.Run("typed values", func(t *testing.T) {
+		env := setupTestEnvironment(t)
+
+		// Register workflow and activities
+		env.env.RegisterWorkflow(env.temporal.Run)
+		env.env.RegisterWorkflow(env.temporal.RunChildWorkflow)
+		env.env.RegisterActivity(env.temporal.RunCompletion)
+		env.env.RegisterActivity(env.temporal.CallTool)
+
+		agent := mocks.NewAgent(t)
+		prov := mocks.NewProvider(t)
+		model := mocks.NewModel(t)
+
+		runID := uuidx.New()
+		turnID := uuidx.New()
+
+		// The tools rely on the counter being an int after crossing the activity boundary
+		agent.EXPECT().Name().Return("test_agent")
+		agent.EXPECT().Tools().Return([]tool.Definition{
+			{
+				Name: "increment_counter",
+				Parameters: map[string]string{
+					"param0": "cv",
+				},
+				Function: func(cv types.ContextVars) types.ContextVars {
+					counter, ok := cv["counter"].(int)
+					if !ok {
+						return types.ContextVars{"error": fmt.Sprintf("counter is a %T", cv["counter"])}
+					}
+					cv["counter"] = counter + 1
+					return cv
+				},
+			},
+			{
+				Name: "get_counter",
+				Parameters: map[string]string{
+					"param0": "cv",
+				},
+				Function: func(cv types.ContextVars) string {
+					return fmt.Sprintf("counter value: %T %v", cv["counter"], cv["counter"])
+				},
+			},
+		})
+		buboagent.Add(agent)
+
+		// Set up and register mock model
+		model.EXPECT().Name().Return("test_model")
+		model.EXPECT().Provider().Return(prov)
+		models.Add(model)
+
+		// Clean up registries after test
+		t.Cleanup(func() {
+			buboagent.Del("test_agent")
+			models.Del("test_model")
+		})
+
+		toolCallEvents := make(chan provider.StreamEvent, 1)
+		toolCallEvents <- provider.Response[messages.ToolCallMessage]{
+			RunID:  runID,
+			TurnID: turnID,
+			Response: messages.ToolCallMessage{
+				ToolCalls: []messages.ToolCallData{
+					{
+						ID:        "tool1",
+						Name:      "increment_counter",
+						Arguments: `{"cv": {}}`,
+					},
+					{
+						ID:        "tool2",
+						Name:      "get_counter",
+						Arguments: `{"cv": {}}`,
+					},
+				},
+			},
+		}
+		close(toolCallEvents)
+
+		finalEvents := make(chan provider.StreamEvent, 1)
+		finalEvents <- provider.Response[messages.AssistantMessage]{
+			RunID:  runID,
+			TurnID: turnID,
+			Response: messages.AssistantMessage{
+				Content: messages.AssistantContentOrParts{
+					Content: "final response",
+				},
+			},
+		}
+		close(finalEvents)
+
+		prov.EXPECT().ChatCompletion(mock.Anything, mock.MatchedBy(func(p provider.CompletionParams) bool {
+			return p.RunID == runID
+		})).Return(toolCallEvents, nil).Once()
+
+		prov.EXPECT().ChatCompletion(mock.Anything, mock.MatchedBy(func(p provider.CompletionParams) bool {
+			return p.RunID == runID
+		})).Return(finalEvents, nil).Once()
+
+		mockTopic := mocks.NewTopic(t)
+		env.broker.EXPECT().Topic(mock.Anything, runID.String()).Return(mockTopic).Times(4)
+
+		var toolResponses []string
+		mockTopic.EXPECT().Publish(mock.Anything, mock.MatchedBy(func(msg interface{}) bool {
+			evt, ok := msg.(events.Event)
+			if !ok {
+				return false
+			}
+			if resp, ok := evt.(events.Request[messages.ToolResponse]); ok {
+				toolResponses = append(toolResponses, resp.Message.Content)
+			}
+			return true
+		})).Return(nil).Times(4)
+
+		env.env.ExecuteWorkflow(env.temporal.Run, RemoteRunCommand{
+			ID: runID,
+			Agent: RemoteAgent{
+				Name:  "test_agent",
+				Model: "test_model",
+			},
+			ContextVariables: types.ContextVars{"counter": 1},
+			MaxTurns:         10,
+		})
+
+		require.True(t, env.env.IsWorkflowCompleted())
+		require.NoError(t, env.env.GetWorkflowError())
+		require.Len(t, toolResponses, 2)
+		assert.Equal(t, "counter value: int 2", toolResponses[1], "An int context variable should survive the workflow boundary as an int")
+	})
 }
 
 func TestTemporalToolCalls(t *testing.T) {
@@ -1106,7 +1235,7 @@ func TestTemporalToolCalls(t *testing.T) {
 			return ok && resp.Response.Content.Content == "final result with tool: tool result: test input"
 		})).Return(nil).Once()
 
-		var result string
+		var result RemoteRunResult
 		env.env.ExecuteWorkflow(env.temporal.Run, RemoteRunCommand{
 			ID: runID,
 			Agent: RemoteAgent{
@@ -1121,7 +1250,7 @@ func TestTemporalToolCalls(t *testing.T) {
 		require.True(t, env.env.IsWorkflowCompleted())
 		require.NoError(t, env.env.GetWorkflowError())
 		require.NoError(t, env.env.GetWorkflowResult(&result))
-		assert.Equal(t, "final result with tool: tool result: test input", result)
+		assert.Equal(t, "final result with tool: tool result: test input", result.Result)
 	})
 
 	t.Run("parallel tool calls", func(t *testing.T) {
@@ -1328,7 +1457,7 @@ func TestTemporalToolCalls(t *testing.T) {
 			return ok && resp.Response.Content.Content == "final result with tools: tool1 result: input1, tool2 result: input2"
 		})).Return(nil).Once()
 
-		var result string
+		var result RemoteRunResult
 		env.env.ExecuteWorkflow(env.temporal.Run, RemoteRunCommand{
 			ID: runID,
 			Agent: RemoteAgent{
@@ -1343,7 +1472,7 @@ func TestTemporalToolCalls(t *testing.T) {
 		require.True(t, env.env.IsWorkflowCompleted())
 		require.NoError(t, env.env.GetWorkflowError())
 		require.NoError(t, env.env.GetWorkflowResult(&result))
-		assert.Equal(t, "final result with tools: tool1 result: input1, tool2 result: input2", result)
+		assert.Equal(t, "final result with tools: tool1 result: input1, tool2 result: input2", result.Result)
 	})
 }
 
@@ -1537,6 +1666,7 @@ func TestTemporalRunWithAgentChain(t *testing.T) {
 	agent2.EXPECT().Model().Return(model).Times(1)                      // Called for registration and completion
 	agent2.EXPECT().Instructions().Return("agent2 instructions").Once() // Called during completion
 	agent2.EXPECT().ParallelToolCalls().Return(false).Once()            // Called during completion
+	agent2.EXPECT().Tools().Return(nil).Once()                          // Called to find the tools that await a signal
 	buboagent.Add(agent2)
 
 	// Set up model expectations
@@ -1636,7 +1766,7 @@ func TestTemporalRunWithAgentChain(t *testing.T) {
 		return ok
 	})).Return(nil).Times(2) // Called for initial completion, tool call, child workflow completion, and final completion
 
-	var result string
+	var result RemoteRunResult
 	env.env.ExecuteWorkflow(env.temporal.Run, RemoteRunCommand{
 		ID: runID,
 		Agent: RemoteAgent{
@@ -1651,5 +1781,401 @@ func TestTemporalRunWithAgentChain(t *testing.T) {
 	require.True(t, env.env.IsWorkflowCompleted())
 	require.NoError(t, env.env.GetWorkflowError())
 	require.NoError(t, env.env.GetWorkflowResult(&result))
-	assert.Equal(t, "final result", result)
+	assert.Equal(t, "final result", result.Result)
+}
+
+func TestTemporalToolAwaitSignal(t *testing.T) {
+	env := setupTestEnvironment(t)
+
+	env.env.RegisterWorkflow(env.temporal.Run)
+	env.env.RegisterWorkflow(env.temporal.RunChildWorkflow)
+	env.env.RegisterActivity(env.temporal.RunCompletion)
+	env.env.RegisterActivity(env.temporal.CallTool)
+
+	agent := mocks.NewAgent(t)
+	prov := mocks.NewProvider(t)
+	model := mocks.NewModel(t)
+
+	runID := uuidx.New()
+	turnID := uuidx.New()
+
+	agent.EXPECT().Name().Return("test_agent")
+	agent.EXPECT().Tools().Return([]tool.Definition{
+		{
+			Name: "ask_human",
+			Parameters: map[string]string{
+				"param0": "question",
+			},
+			Function: func(question string) string {
+				t.Error("a tool that awaits a signal should not be called")
+				return ""
+			},
+			AwaitSignal: "human_answer",
+		},
+	})
+	buboagent.Add(agent)
+
+	model.EXPECT().Name().Return("test_model")
+	model.EXPECT().Provider().Return(prov)
+	models.Add(model)
+
+	t.Cleanup(func() {
+		buboagent.Del("test_agent")
+		models.Del("test_model")
+	})
+
+	mem := shorttermmemory.New()
+	mem.AddUserPrompt(messages.Message[messages.UserMessage]{
+		RunID:  runID,
+		TurnID: turnID,
+		Payload: messages.UserMessage{
+			Content: messages.ContentOrParts{
+				Content: "What is the answer?",
+			},
+		},
+		Sender:    "user",
+		Timestamp: strfmt.DateTime(time.Now()),
+	})
+
+	toolCall := messages.ToolCallMessage{
+		ToolCalls: []messages.ToolCallData{
+			{
+				ID:        "tool1",
+				Name:      "ask_human",
+				Arguments: `{"question":"What is the answer?"}`,
+			},
+		},
+	}
+
+	toolCallEvents := make(chan provider.StreamEvent, 1)
+	toolCallEvents <- provider.Response[messages.ToolCallMessage]{
+		RunID:      runID,
+		TurnID:     turnID,
+		Checkpoint: mem.Checkpoint(),
+		Response:   toolCall,
+	}
+	close(toolCallEvents)
+
+	finalEvents := make(chan provider.StreamEvent, 1)
+	finalEvents <- provider.Response[messages.AssistantMessage]{
+		RunID:      runID,
+		TurnID:     turnID,
+		Checkpoint: mem.Checkpoint(),
+		Response: messages.AssistantMessage{
+			Content: messages.AssistantContentOrParts{
+				Content: "the answer is 42",
+			},
+		},
+		FinishReason: "stop",
+	}
+	close(finalEvents)
+
+	prov.EXPECT().ChatCompletion(mock.Anything, mock.MatchedBy(func(p provider.CompletionParams) bool {
+		return p.RunID == runID
+	})).Return(toolCallEvents, nil).Once()
+
+	prov.EXPECT().ChatCompletion(mock.Anything, mock.MatchedBy(func(p provider.CompletionParams) bool {
+		if p.RunID != runID {
+			return false
+		}
+		// The second completion must see the signaled value as the tool response
+		for msg := range p.Thread.MessagesIter() {
+			if resp, ok := msg.Payload.(messages.ToolResponse); ok {
+				return resp.ToolCallID == "tool1" && resp.Content == "42"
+			}
+		}
+		return false
+	})).Return(finalEvents, nil).Once()
+
+	mockTopic := mocks.NewTopic(t)
+	env.broker.EXPECT().Topic(mock.Anything, runID.String()).Return(mockTopic).Times(3)
+
+	mockTopic.EXPECT().Publish(mock.Anything, mock.MatchedBy(func(msg interface{}) bool {
+		_, ok := msg.(events.Response[messages.ToolCallMessage])
+		return ok
+	})).Return(nil).Once()
+
+	mockTopic.EXPECT().Publish(mock.Anything, mock.MatchedBy(func(msg interface{}) bool {
+		resp, ok := msg.(events.Request[messages.ToolResponse])
+		return ok && resp.Message.ToolCallID == "tool1" && resp.Message.Content == "42"
+	})).Return(nil).Once()
+
+	mockTopic.EXPECT().Publish(mock.Anything, mock.MatchedBy(func(msg interface{}) bool {
+		_, ok := msg.(events.Response[messages.AssistantMessage])
+		return ok
+	})).Return(nil).Once()
+
+	env.env.RegisterDelayedCallback(func() {
+		env.env.SignalWorkflow("human_answer", "42")
+	}, time.Minute)
+
+	var result RemoteRunResult
+	env.env.ExecuteWorkflow(env.temporal.Run, RemoteRunCommand{
+		ID: runID,
+		Agent: RemoteAgent{
+			Name:         "test_agent",
+			Model:        "test_model",
+			AwaitSignals: map[string]string{"ask_human": "human_answer"},
+		},
+		MaxTurns:   10,
+		Checkpoint: mem.Checkpoint(),
+	})
+
+	require.True(t, env.env.IsWorkflowCompleted())
+	require.NoError(t, env.env.GetWorkflowError())
+	require.NoError(t, env.env.GetWorkflowResult(&result))
+	assert.Equal(t, "the answer is 42", result.Result)
+	assert.Equal(t, "stop", result.FinishReason)
+}
+
+func TestTemporalCallToolValidatesBeforeApproval(t *testing.T) {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestActivityEnvironment()
+	mockBroker := mocks.NewBroker(t)
+	temporal := &Temporal{broker: mockBroker}
+	env.RegisterActivity(temporal.CallTool)
+
+	deploy := tool.Definition{
+		Name:             "deploy",
+		Parameters:       map[string]string{"param0": "service"},
+		RequiresApproval: true,
+		Function: func(service string) string {
+			t.Error("a tool with invalid arguments should not be called")
+			return ""
+		},
+	}
+	agent := mocks.NewAgent(t)
+	agent.EXPECT().Name().Return("approval_agent")
+	agent.EXPECT().Tools().Return([]tool.Definition{deploy})
+	buboagent.Add(agent)
+	t.Cleanup(func() { buboagent.Del("approval_agent") })
+
+	described := newTestAgent()
+	described.testTools = []tool.Definition{deploy, {Name: "lookup", Function: func() string { return "" }}}
+	assert.Equal(t, []string{"deploy"}, remoteAgent(described).ApprovalTools)
+
+	runID := uuidx.New()
+	mockTopic := mocks.NewTopic(t)
+	mockBroker.EXPECT().Topic(mock.Anything, runID.String()).Return(mockTopic).Once()
+	// only the retry is published, the approval is never requested
+	mockTopic.EXPECT().Publish(mock.Anything, mock.MatchedBy(func(msg interface{}) bool {
+		resp, ok := msg.(events.Request[messages.ToolResponse])
+		return ok && resp.Message.ToolCallID == "call-1" && strings.Contains(resp.Message.Content, "provide a value for: service")
+	})).Return(nil).Once()
+
+	val, err := env.ExecuteActivity(temporal.CallTool, remoteToolCallParams{
+		RunID:    runID,
+		TurnID:   uuidx.New(),
+		Agent:    RemoteAgent{Name: "approval_agent"},
+		ToolCall: messages.ToolCallData{ID: "call-1", Name: "deploy", Arguments: "{}"},
+	})
+	require.NoError(t, err)
+
+	var result remoteToolCallResult
+	require.NoError(t, val.Get(&result))
+	require.NotNil(t, result.Message)
+	assert.Contains(t, result.Message.Payload.Content, "provide a value for: service")
+}
+
+func TestTemporalToolAwaitSignalTimeout(t *testing.T) {
+	env := setupTestEnvironment(t)
+
+	env.env.RegisterWorkflow(env.temporal.Run)
+	env.env.RegisterActivity(env.temporal.RunCompletion)
+	env.env.RegisterActivity(env.temporal.CallTool)
+
+	prov := mocks.NewProvider(t)
+	model := mocks.NewModel(t)
+	model.EXPECT().Name().Return("signal_timeout_model")
+	model.EXPECT().Provider().Return(prov)
+	models.Add(model)
+	t.Cleanup(func() { models.Del("signal_timeout_model") })
+
+	runID := uuidx.New()
+	mem := shorttermmemory.New()
+	mem.AddUserPrompt(messages.New().WithSender("user").UserPrompt("What is the answer?"))
+
+	toolCallEvents := make(chan provider.StreamEvent, 1)
+	toolCallEvents <- provider.Response[messages.ToolCallMessage]{
+		RunID:      runID,
+		TurnID:     mem.ID(),
+		Checkpoint: mem.Checkpoint(),
+		Response: messages.ToolCallMessage{
+			ToolCalls: []messages.ToolCallData{{ID: "tool1", Name: "ask_human", Arguments: `{"question":"What is the answer?"}`}},
+		},
+	}
+	close(toolCallEvents)
+	prov.EXPECT().ChatCompletion(mock.Anything, mock.Anything).Return(toolCallEvents, nil).Once()
+
+	mockTopic := mocks.NewTopic(t)
+	env.broker.EXPECT().Topic(mock.Anything, runID.String()).Return(mockTopic)
+	mockTopic.EXPECT().Publish(mock.Anything, mock.Anything).Return(nil)
+
+	// the signal arrives after the tool stopped waiting for it
+	env.env.RegisterDelayedCallback(func() {
+		env.env.SignalWorkflow("human_answer", "42")
+	}, 3*time.Minute)
+
+	env.env.ExecuteWorkflow(env.temporal.Run, RemoteRunCommand{
+		ID: runID,
+		Agent: RemoteAgent{
+			Name:           "test_agent",
+			Model:          "signal_timeout_model",
+			AwaitSignals:   map[string]string{"ask_human": "human_answer"},
+			SignalTimeouts: map[string]time.Duration{"ask_human": time.Minute},
+		},
+		MaxTurns:   10,
+		Checkpoint: mem.Checkpoint(),
+	})
+
+	require.True(t, env.env.IsWorkflowCompleted())
+	err := env.env.GetWorkflowError()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), ErrSignalTimeout.Error())
+}
+
+func TestTemporalProxyRejectsLocalOnlySettings(t *testing.T) {
+	agent := &mockAgent{testName: "test_agent", testModel: testModel{provider: &mockProvider{}}}
+
+	tests := []struct {
+		name   string
+		modify func(RunCommand) RunCommand
+		want   string
+	}{
+		{
+			name: "tools func",
+			modify: func(cmd RunCommand) RunCommand {
+				return cmd.WithToolsFunc(func(context.Context, types.ContextVars) []tool.Definition { return nil })
+			},
+			want: "tools func",
+		},
+		{
+			name:   "run state",
+			modify: func(cmd RunCommand) RunCommand { return cmd.WithRunState(types.NewRunState()) },
+			want:   "run state",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd, err := NewRunCommand(agent, promptedThread(), &mockHook{})
+			require.NoError(t, err)
+
+			fut := NewFuture(DefaultUnmarshal[string]())
+			err = (&TemporalProxy{}).Run(context.Background(), tt.modify(cmd), fut)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.want)
+
+			_, err = fut.Get()
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestTemporalRunCompletionPublishesRequest(t *testing.T) {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestActivityEnvironment()
+
+	mockBroker := mocks.NewBroker(t)
+	hook := newRecordingHook()
+	temporal := &Temporal{broker: mockBroker, hook: hook}
+	env.RegisterActivity(temporal.RunCompletion)
+
+	prov := mocks.NewProvider(t)
+	model := mocks.NewModel(t)
+	model.EXPECT().Name().Return("request_model")
+	model.EXPECT().Provider().Return(prov)
+	models.Add(model)
+	t.Cleanup(func() { models.Del("request_model") })
+
+	mem := shorttermmemory.New()
+	mem.AddUserPrompt(messages.New().WithSender("user").UserPrompt("find it"))
+
+	runID := uuidx.New()
+	stream := make(chan provider.StreamEvent, 1)
+	stream <- provider.Response[messages.AssistantMessage]{
+		RunID:    runID,
+		TurnID:   uuidx.New(),
+		Response: messages.AssistantMessage{Content: messages.AssistantContentOrParts{Content: "done"}},
+	}
+	close(stream)
+	prov.EXPECT().ChatCompletion(mock.Anything, mock.Anything).Return(stream, nil).Once()
+
+	mockTopic := mocks.NewTopic(t)
+	mockBroker.EXPECT().Topic(mock.Anything, runID.String()).Return(mockTopic)
+	mockTopic.EXPECT().Publish(mock.Anything, mock.Anything).Return(nil)
+
+	_, err := env.ExecuteActivity(temporal.RunCompletion, completionParams{
+		RunID: runID,
+		Agent: RemoteAgent{
+			Name:         "test_agent",
+			Model:        "request_model",
+			Instructions: "be helpful",
+		},
+		Checkpoint: mem.Checkpoint(),
+	})
+	require.NoError(t, err)
+
+	require.Len(t, hook.requests, 1)
+	request := hook.requests[0]
+	assert.Equal(t, "request_model", request.Model)
+	assert.Equal(t, "be helpful", request.Instructions)
+	require.Len(t, request.Messages, 1)
+	prompt, ok := request.Messages[0].Payload.(messages.UserMessage)
+	require.True(t, ok, "expected the user prompt, got %T", request.Messages[0].Payload)
+	assert.Equal(t, "find it", prompt.Content.Content)
+	assert.Equal(t, mem.ID(), hook.requestTurnIDs[0])
+}
+
+func TestRemoteAgentRenderInstructions(t *testing.T) {
+	workflowNow := time.Date(2025, 3, 14, 15, 9, 26, 0, time.UTC)
+
+	t.Run("uses the time of the workflow", func(t *testing.T) {
+		remote := remoteAgent(buboagent.New(
+			buboagent.Name("remote_unregistered"),
+			buboagent.Instructions("{{.today}} {{.now}}"),
+			buboagent.NowFormat(time.Kitchen),
+			buboagent.TodayFormat("02/01/2006"),
+		))
+
+		result, err := remote.RenderInstructions(types.ContextVars{}, workflowNow)
+		require.NoError(t, err)
+		assert.Equal(t, "14/03/2025 3:09PM", result)
+	})
+
+	t.Run("uses the clock of a registered agent", func(t *testing.T) {
+		agentNow := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+		registered := buboagent.New(
+			buboagent.Name("remote_registered"),
+			buboagent.Instructions("{{.today}}"),
+			buboagent.Clock(func() time.Time { return agentNow }),
+		)
+		buboagent.Add(registered)
+		t.Cleanup(func() { buboagent.Del("remote_registered") })
+
+		remote := remoteAgent(registered)
+		result, err := remote.RenderInstructions(types.ContextVars{}, workflowNow)
+		require.NoError(t, err)
+		assert.Equal(t, "2024-01-02", result)
+	})
+
+	t.Run("uses the template functions of a registered agent", func(t *testing.T) {
+		buboagent.RegisterTemplateFuncs(template.FuncMap{"shout": func(s string) string { return s + "!" }})
+		registered := buboagent.New(
+			buboagent.Name("remote_funcs"),
+			buboagent.Instructions("{{upper .name}} {{shout .name}}"),
+			buboagent.WithTemplateFuncs(template.FuncMap{"upper": strings.ToUpper}),
+		)
+		remote := remoteAgent(registered)
+
+		_, err := remote.RenderInstructions(types.ContextVars{"name": "world"}, workflowNow)
+		require.Error(t, err, "the functions of the agent aren't known before it's registered")
+
+		buboagent.Add(registered)
+		t.Cleanup(func() { buboagent.Del("remote_funcs") })
+
+		result, err := remote.RenderInstructions(types.ContextVars{"name": "world"}, workflowNow)
+		require.NoError(t, err)
+		assert.Equal(t, "WORLD world!", result)
+	})
 }
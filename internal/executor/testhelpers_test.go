@@ -9,6 +9,7 @@ import (
 	"github.com/casualjim/bubo/provider"
 	"github.com/casualjim/bubo/tool"
 	"github.com/casualjim/bubo/types"
+	"github.com/google/uuid"
 )
 
 // Mock Provider
@@ -53,6 +54,7 @@ type mockAgent struct {
 	testName  string
 	testModel testModel
 	testTools []tool.Definition
+	parallel  bool
 }
 
 func (m *mockAgent) Name() string {
@@ -79,7 +81,7 @@ func (m *mockAgent) ToolChoice() string {
 }
 
 func (m *mockAgent) ParallelToolCalls() bool {
-	return false
+	return m.parallel
 }
 
 func (m *mockAgent) RenderInstructions(cv types.ContextVars) (string, error) {
@@ -131,6 +133,76 @@ func (h *mockHook) OnToolCallResponse(ctx context.Context, msg messages.Message[
 
 func (h *mockHook) OnError(ctx context.Context, err error) {}
 
+// recordingHook is a mockHook that also keeps the events of the optional hooks.
+// It isn't safe for concurrent use, so the race detector catches concurrent calls.
+type recordingHook struct {
+	*mockHook
+	contentFilters []events.ContentFilter
+	summaries      []events.Summary
+	instructions   []messages.Message[messages.InstructionsMessage]
+	statuses       []events.Status
+	requestTurnIDs []uuid.UUID
+	requests       []events.CompletionRequest
+	checkpoints    [][]byte
+	audits         []events.ToolAuditRecord
+	cancels        []recordedCancel
+}
+
+// recordedCancel is a call of OnCancel, with the error of its context at the time of the call
+type recordedCancel struct {
+	runID  uuid.UUID
+	reason string
+	ctxErr error
+}
+
+func newRecordingHook() *recordingHook {
+	return &recordingHook{mockHook: &mockHook{}}
+}
+
+func (h *recordingHook) OnContentFilter(_ context.Context, event events.ContentFilter) {
+	h.contentFilters = append(h.contentFilters, event)
+}
+
+func (h *recordingHook) OnSummary(_ context.Context, event events.Summary) {
+	h.summaries = append(h.summaries, event)
+}
+
+func (h *recordingHook) OnInstructions(_ context.Context, msg messages.Message[messages.InstructionsMessage]) {
+	h.instructions = append(h.instructions, msg)
+}
+
+func (h *recordingHook) OnStatus(_ context.Context, event events.Status) {
+	h.statuses = append(h.statuses, event)
+}
+
+func (h *recordingHook) OnRequest(_ context.Context, _, turnID uuid.UUID, request events.CompletionRequest) {
+	h.requestTurnIDs = append(h.requestTurnIDs, turnID)
+	h.requests = append(h.requests, request)
+}
+
+func (h *recordingHook) OnCheckpoint(_ context.Context, _, _ uuid.UUID, checkpoint []byte) {
+	h.checkpoints = append(h.checkpoints, checkpoint)
+}
+
+func (h *recordingHook) OnToolAudit(_ context.Context, record events.ToolAuditRecord) {
+	h.audits = append(h.audits, record)
+}
+
+func (h *recordingHook) OnCancel(ctx context.Context, runID uuid.UUID, reason string) {
+	h.cancels = append(h.cancels, recordedCancel{runID: runID, reason: reason, ctxErr: ctx.Err()})
+}
+
+var (
+	_ events.ContentFilterHook = (*recordingHook)(nil)
+	_ events.SummaryHook       = (*recordingHook)(nil)
+	_ events.InstructionsHook  = (*recordingHook)(nil)
+	_ events.StatusHook        = (*recordingHook)(nil)
+	_ events.RequestHook       = (*recordingHook)(nil)
+	_ events.CheckpointHook    = (*recordingHook)(nil)
+	_ events.ToolAuditHook     = (*recordingHook)(nil)
+	_ events.CancelHook        = (*recordingHook)(nil)
+)
+
 // Test Model
 
 type testModel struct {
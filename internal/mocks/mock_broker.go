@@ -5,7 +5,7 @@ package mocks
 import (
 	context "context"
 
-	broker "github.com/casualjim/bubo/internal/broker"
+	broker "github.com/casualjim/bubo/broker"
 
 	mock "github.com/stretchr/testify/mock"
 )
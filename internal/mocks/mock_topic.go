@@ -5,7 +5,7 @@ package mocks
 import (
 	context "context"
 
-	broker "github.com/casualjim/bubo/internal/broker"
+	broker "github.com/casualjim/bubo/broker"
 
 	events "github.com/casualjim/bubo/events"
 
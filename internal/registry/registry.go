@@ -1,36 +1,191 @@
 package registry
 
-import "github.com/alphadose/haxmap"
+import (
+	"slices"
+	"sync"
+	"sync/atomic"
+
+	"github.com/fogfish/opts"
+)
 
 type Registry[T any] interface {
 	Get(name string) (T, bool)
+	// Add registers a value that is never evicted.
 	Add(name string, value T)
+	// AddEphemeral registers a value that can be evicted when the registry is bounded.
+	AddEphemeral(name string, value T)
+	// GetOrAdd returns the value registered with the name, or registers the value of valueFn as an ephemeral value.
+	// valueFn is called without holding the lock, when it's called concurrently for the same name
+	// only the first value is kept.
 	GetOrAdd(name string, value func() T) (T, bool)
 	Del(name string)
+	// List returns the names of the registered values in sorted order.
+	List() []string
+	// Clear removes all the registered values.
+	Clear()
+	// SetMaxSize bounds the registry to n entries, evicting the least recently used ephemeral
+	// entries when the bound is exceeded. Values registered with Add are never evicted, they can
+	// keep the registry above the bound. A value <= 0 makes the registry unbounded.
+	SetMaxSize(n int)
+}
+
+type config struct {
+	maxSize int
+}
+
+// Option configures a registry
+type Option = opts.Option[config]
+
+// WithMaxSize bounds the registry to the given number of entries,
+// the least recently used ephemeral entries are evicted first.
+var WithMaxSize = opts.ForName[config, int]("maxSize")
+
+type entry[T any] struct {
+	value T
+	// pinned entries were registered with Add, they're never evicted
+	pinned bool
+	// lastUsed is the tick of the registry clock when the entry was last used
+	lastUsed atomic.Uint64
 }
 
 type registry[T any] struct {
-	values *haxmap.Map[string, T]
+	mu      sync.RWMutex
+	values  map[string]*entry[T]
+	clock   atomic.Uint64
+	maxSize int
 }
 
-func New[T any]() Registry[T] {
+func New[T any](options ...Option) Registry[T] {
+	var cfg config
+	if err := opts.Apply(&cfg, options); err != nil {
+		panic(err)
+	}
+
 	return &registry[T]{
-		values: haxmap.New[string, T](),
+		values:  make(map[string]*entry[T]),
+		maxSize: cfg.maxSize,
 	}
 }
 
 func (r *registry[T]) Get(name string) (T, bool) {
-	return r.values.Get(name)
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	e, ok := r.values[name]
+	if !ok {
+		var zero T
+		return zero, false
+	}
+	r.touch(e)
+	return e.value, true
 }
 
 func (r *registry[T]) Add(name string, value T) {
-	r.values.Set(name, value)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.set(name, value, true)
+}
+
+func (r *registry[T]) AddEphemeral(name string, value T) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.set(name, value, false)
 }
 
 func (r *registry[T]) GetOrAdd(name string, valueFn func() T) (T, bool) {
-	return r.values.GetOrCompute(name, valueFn)
+	if value, ok := r.Get(name); ok {
+		return value, true
+	}
+
+	value := valueFn()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// another caller may have registered the name while valueFn was running
+	if e, ok := r.values[name]; ok {
+		r.touch(e)
+		return e.value, true
+	}
+	r.set(name, value, false)
+	return value, false
 }
 
 func (r *registry[T]) Del(name string) {
-	r.values.Del(name)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.values, name)
+}
+
+func (r *registry[T]) List() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	names := make([]string, 0, len(r.values))
+	for name := range r.values {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+func (r *registry[T]) Clear() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.values = make(map[string]*entry[T])
+}
+
+func (r *registry[T]) SetMaxSize(n int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.maxSize = n
+	r.evict()
+}
+
+func (r *registry[T]) touch(e *entry[T]) {
+	e.lastUsed.Store(r.clock.Add(1))
+}
+
+func (r *registry[T]) set(name string, value T, pinned bool) {
+	if e, ok := r.values[name]; ok {
+		e.value = value
+		e.pinned = e.pinned || pinned
+		r.touch(e)
+		return
+	}
+
+	e := &entry[T]{value: value, pinned: pinned}
+	r.touch(e)
+	r.values[name] = e
+	r.evict()
+}
+
+// evict removes the least recently used ephemeral entries until the registry fits its bound,
+// or only pinned entries are left
+func (r *registry[T]) evict() {
+	if r.maxSize <= 0 {
+		return
+	}
+	for len(r.values) > r.maxSize {
+		var oldest string
+		var oldestUse uint64
+		found := false
+		for name, e := range r.values {
+			if e.pinned {
+				continue
+			}
+			if used := e.lastUsed.Load(); !found || used < oldestUse {
+				oldest, oldestUse, found = name, used, true
+			}
+		}
+		if !found {
+			return
+		}
+		delete(r.values, oldest)
+	}
 }
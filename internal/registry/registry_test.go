@@ -0,0 +1,122 @@
+package registry
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistry_List(t *testing.T) {
+	r := New[int]()
+	r.Add("b", 2)
+	r.Add("a", 1)
+	r.Add("c", 3)
+
+	assert.Equal(t, []string{"a", "b", "c"}, r.List())
+
+	r.Del("b")
+	assert.Equal(t, []string{"a", "c"}, r.List())
+
+	r.Clear()
+	assert.Empty(t, r.List())
+
+	_, ok := r.Get("a")
+	assert.False(t, ok)
+}
+
+func TestRegistry_GetOrAdd(t *testing.T) {
+	r := New[int]()
+
+	v, loaded := r.GetOrAdd("a", func() int { return 1 })
+	assert.False(t, loaded)
+	assert.Equal(t, 1, v)
+
+	v, loaded = r.GetOrAdd("a", func() int { return 2 })
+	assert.True(t, loaded)
+	assert.Equal(t, 1, v)
+}
+
+func TestRegistry_Eviction(t *testing.T) {
+	r := New[int](WithMaxSize(2))
+	r.AddEphemeral("a", 1)
+	r.AddEphemeral("b", 2)
+
+	// touch a so b becomes the least recently used entry
+	_, ok := r.Get("a")
+	require.True(t, ok)
+
+	r.AddEphemeral("c", 3)
+	assert.Equal(t, []string{"a", "c"}, r.List())
+
+	_, ok = r.Get("b")
+	assert.False(t, ok)
+
+	r.GetOrAdd("d", func() int { return 4 })
+	assert.Equal(t, []string{"c", "d"}, r.List())
+}
+
+func TestRegistry_EvictionKeepsPinnedEntries(t *testing.T) {
+	r := New[int](WithMaxSize(1))
+	r.Add("pinned", 1)
+	r.AddEphemeral("a", 2)
+	assert.Equal(t, []string{"pinned"}, r.List())
+
+	r.Add("other", 3)
+	assert.Equal(t, []string{"other", "pinned"}, r.List(), "pinned entries can exceed the bound")
+
+	// pinning an ephemeral entry keeps it from being evicted
+	r.AddEphemeral("b", 4)
+	r.Add("b", 5)
+	r.AddEphemeral("c", 6)
+	assert.Equal(t, []string{"b", "other", "pinned"}, r.List())
+}
+
+func TestRegistry_SetMaxSize(t *testing.T) {
+	r := New[int]()
+	r.AddEphemeral("a", 1)
+	r.AddEphemeral("b", 2)
+	r.AddEphemeral("c", 3)
+
+	r.SetMaxSize(1)
+	assert.Equal(t, []string{"c"}, r.List())
+
+	r.SetMaxSize(0)
+	r.AddEphemeral("d", 4)
+	r.AddEphemeral("e", 5)
+	assert.Equal(t, []string{"c", "d", "e"}, r.List())
+}
+
+func TestRegistry_GetOrAddCallsValueFnWithoutLock(t *testing.T) {
+	r := New[int]()
+
+	v, loaded := r.GetOrAdd("outer", func() int {
+		// the registry must stay usable while the value is built
+		inner, _ := r.GetOrAdd("inner", func() int { return 1 })
+		return inner + 1
+	})
+	assert.False(t, loaded)
+	assert.Equal(t, 2, v)
+	assert.Equal(t, []string{"inner", "outer"}, r.List())
+}
+
+func TestRegistry_ConcurrentGetOrAdd(t *testing.T) {
+	r := New[int](WithMaxSize(8))
+
+	var wg sync.WaitGroup
+	results := make([]int, 16)
+	for i := range results {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], _ = r.GetOrAdd("shared", func() int { return i })
+			r.Get("shared")
+		}()
+	}
+	wg.Wait()
+
+	for _, v := range results {
+		assert.Equal(t, results[0], v, "only the first value is kept")
+	}
+}
@@ -79,17 +79,31 @@ func (a *Aggregator) MessagesIter() iter.Seq[messages.Message[messages.ModelMess
 	return slices.Values(a.messages)
 }
 
+// MessagesForTurn returns the messages that belong to the turn, in the order they were added.
+// It lets a UI collapse the tool calls and responses of a turn, it returns nil when the turn is unknown.
+func (a *Aggregator) MessagesForTurn(turnID uuid.UUID) []messages.Message[messages.ModelMessage] {
+	var result []messages.Message[messages.ModelMessage]
+	for _, msg := range a.messages {
+		if msg.TurnID == turnID {
+			result = append(result, msg)
+		}
+	}
+	return result
+}
+
 // eraseType converts a Message[T] to Message[ModelMessage] while preserving all fields.
 // This is used internally to store messages of different specific types in the aggregator
 // while maintaining type safety. The conversion is safe because T is constrained to ModelMessage.
 func eraseType[T messages.ModelMessage](m messages.Message[T]) messages.Message[messages.ModelMessage] {
 	return messages.Message[messages.ModelMessage]{
+		MessageID: m.MessageID,
 		RunID:     m.RunID,
 		TurnID:    m.TurnID,
 		Payload:   m.Payload,
 		Sender:    m.Sender,
 		Timestamp: m.Timestamp,
 		Meta:      m.Meta,
+		DedupKey:  m.DedupKey,
 	}
 }
 
@@ -159,6 +173,95 @@ func (a *Aggregator) add(m messages.Message[messages.ModelMessage]) {
 	a.messages = append(a.messages, m)
 }
 
+// Rewind removes the last n messages from the aggregator and returns them in their original order.
+// Messages that were inherited when the aggregator was forked are never removed, so at most
+// TurnLen messages are rewound. A value of n <= 0 removes nothing.
+//
+// Example:
+//
+//	agg.AddUserPrompt(messages.New().UserPrompt("What's the weather?"))
+//	agg.AddAssistantMessage(messages.New().AssistantMessage("It's sunny."))
+//	removed := agg.Rewind(2)  // removes the prompt and the answer
+//	agg.AddUserPrompt(messages.New().UserPrompt("What's the weather in Paris?"))
+func (a *Aggregator) Rewind(n int) AggregatedMessages {
+	n = min(n, a.TurnLen())
+	if n <= 0 {
+		return nil
+	}
+	idx := len(a.messages) - n
+	removed := slices.Clone(a.messages[idx:])
+	a.messages = slices.Delete(a.messages, idx, len(a.messages))
+	return removed
+}
+
+// KeepLastTurns removes the messages of all but the last n turns and returns them in their original order.
+// A turn is made up of the messages that share a TurnID, turns are kept or removed as a whole.
+// A tool call and its responses are never separated: when they belong to different turns and one of
+// those turns is kept, the other one is kept as well. A value of n <= 0 removes all the messages.
+//
+// Example:
+//
+//	removed := agg.KeepLastTurns(5)  // the context window only holds the last 5 turns
+func (a *Aggregator) KeepLastTurns(n int) AggregatedMessages {
+	kept := make(map[uuid.UUID]bool)
+	for _, msg := range slices.Backward(a.messages) {
+		if len(kept) >= n {
+			break
+		}
+		kept[msg.TurnID] = true
+	}
+	a.keepToolCallTurns(kept)
+
+	var removed AggregatedMessages
+	remaining := make(AggregatedMessages, 0, len(a.messages))
+	initLen := a.initLen
+	for i, msg := range a.messages {
+		if kept[msg.TurnID] {
+			remaining = append(remaining, msg)
+			continue
+		}
+		removed = append(removed, msg)
+		if i < a.initLen {
+			initLen--
+		}
+	}
+	a.messages = remaining
+	a.initLen = initLen
+	return removed
+}
+
+// keepToolCallTurns adds the turns of the tool calls and tool responses that belong with a kept turn
+func (a *Aggregator) keepToolCallTurns(kept map[uuid.UUID]bool) {
+	callTurns := make(map[string]uuid.UUID)
+	responseTurns := make(map[string][]uuid.UUID)
+	for _, msg := range a.messages {
+		switch payload := msg.Payload.(type) {
+		case messages.ToolCallMessage:
+			for _, call := range payload.ToolCalls {
+				callTurns[call.ID] = msg.TurnID
+			}
+		case messages.ToolResponse:
+			responseTurns[payload.ToolCallID] = append(responseTurns[payload.ToolCallID], msg.TurnID)
+		}
+	}
+
+	for changed := true; changed; {
+		changed = false
+		for id, callTurn := range callTurns {
+			related := append([]uuid.UUID{callTurn}, responseTurns[id]...)
+			if !slices.ContainsFunc(related, func(turn uuid.UUID) bool { return kept[turn] }) {
+				continue
+			}
+			for _, turn := range related {
+				if !kept[turn] {
+					kept[turn] = true
+					changed = true
+				}
+			}
+		}
+	}
+}
+
 // Usage returns the current usage statistics for this aggregator.
 // This includes token counts for prompts and completions, as well as
 // detailed breakdowns of token usage by category.
@@ -623,4 +623,141 @@ func TestAggregator(t *testing.T) {
 			assert.Equal(t, source.usage.PromptTokensDetails, usage.PromptTokensDetails)
 		})
 	})
+
+	t.Run("Rewind", func(t *testing.T) {
+		t.Run("removes the last messages", func(t *testing.T) {
+			agg := newAggregator()
+			prompt := messages.New().UserPrompt("first question")
+			agg.AddUserPrompt(prompt)
+			agg.AddAssistantMessage(messages.New().AssistantMessage("first answer"))
+			agg.AddUserPrompt(messages.New().UserPrompt("second question"))
+			agg.AddToolCall(messages.New().ToolCall([]messages.ToolCallData{{ID: "call-1", Name: "lookup", Arguments: "{}"}}))
+			agg.AddToolResponse(messages.New().ToolResponse("call-1", "lookup", "result"))
+
+			removed := agg.Rewind(3)
+			require.Len(t, removed, 3)
+			assert.Equal(t, messages.UserMessage{Content: messages.ContentOrParts{Content: "second question"}}, removed[0].Payload)
+			assert.IsType(t, messages.ToolCallMessage{}, removed[1].Payload)
+			assert.IsType(t, messages.ToolResponse{}, removed[2].Payload)
+			assert.Equal(t, 2, agg.Len())
+
+			agg.AddUserPrompt(messages.New().UserPrompt("edited question"))
+			msgs := agg.Messages()
+			require.Len(t, msgs, 3)
+			assert.Equal(t, eraseType(prompt), msgs[0])
+			assert.Equal(t, messages.UserMessage{Content: messages.ContentOrParts{Content: "edited question"}}, msgs[2].Payload)
+		})
+
+		t.Run("does not remove messages from before the fork", func(t *testing.T) {
+			agg := newAggregator()
+			agg.AddUserPrompt(messages.New().UserPrompt("inherited"))
+			forked := agg.Fork()
+			forked.AddUserPrompt(messages.New().UserPrompt("new"))
+
+			removed := forked.Rewind(5)
+			require.Len(t, removed, 1)
+			assert.Equal(t, 1, forked.Len())
+			assert.Equal(t, 0, forked.TurnLen())
+
+			forked.AddUserPrompt(messages.New().UserPrompt("replacement"))
+			agg.Join(forked)
+			require.Equal(t, 2, agg.Len())
+			assert.Equal(t, messages.UserMessage{Content: messages.ContentOrParts{Content: "replacement"}}, agg.Messages()[1].Payload)
+		})
+
+		t.Run("zero or negative removes nothing", func(t *testing.T) {
+			agg := newAggregator()
+			agg.AddUserPrompt(messages.New().UserPrompt("message"))
+			assert.Nil(t, agg.Rewind(0))
+			assert.Nil(t, agg.Rewind(-1))
+			assert.Equal(t, 1, agg.Len())
+		})
+	})
+
+	t.Run("KeepLastTurns", func(t *testing.T) {
+		turn1, turn2, turn3 := uuid.New(), uuid.New(), uuid.New()
+		conversation := func() *Aggregator {
+			agg := newAggregator()
+			agg.AddUserPrompt(messages.New().WithTurnID(turn1).UserPrompt("first question"))
+			agg.AddAssistantMessage(messages.New().WithTurnID(turn1).AssistantMessage("first answer"))
+			agg.AddUserPrompt(messages.New().WithTurnID(turn2).UserPrompt("second question"))
+			agg.AddToolCall(messages.New().WithTurnID(turn2).ToolCall([]messages.ToolCallData{{ID: "call-1", Name: "lookup", Arguments: "{}"}}))
+			agg.AddToolResponse(messages.New().WithTurnID(turn2).ToolResponse("call-1", "lookup", "result"))
+			agg.AddAssistantMessage(messages.New().WithTurnID(turn2).AssistantMessage("second answer"))
+			agg.AddUserPrompt(messages.New().WithTurnID(turn3).UserPrompt("third question"))
+			agg.AddAssistantMessage(messages.New().WithTurnID(turn3).AssistantMessage("third answer"))
+			return agg
+		}
+		turnsOf := func(msgs AggregatedMessages) []uuid.UUID {
+			var turns []uuid.UUID
+			for _, msg := range msgs {
+				turns = append(turns, msg.TurnID)
+			}
+			return turns
+		}
+
+		t.Run("drops whole turns", func(t *testing.T) {
+			agg := conversation()
+			removed := agg.KeepLastTurns(2)
+			assert.Equal(t, []uuid.UUID{turn1, turn1}, turnsOf(removed))
+			assert.Equal(t, []uuid.UUID{turn2, turn2, turn2, turn2, turn3, turn3}, turnsOf(agg.Messages()))
+		})
+
+		t.Run("keeps the tool call with its response", func(t *testing.T) {
+			agg := conversation()
+			removed := agg.KeepLastTurns(1)
+			assert.Len(t, removed, 6)
+			assert.Equal(t, []uuid.UUID{turn3, turn3}, turnsOf(agg.Messages()))
+
+			// the response of the call ends up in a later turn than the call itself
+			split := newAggregator()
+			split.AddToolCall(messages.New().WithTurnID(turn1).ToolCall([]messages.ToolCallData{{ID: "call-1", Name: "lookup", Arguments: "{}"}}))
+			split.AddToolResponse(messages.New().WithTurnID(turn2).ToolResponse("call-1", "lookup", "result"))
+			split.AddAssistantMessage(messages.New().WithTurnID(turn2).AssistantMessage("answer"))
+			assert.Empty(t, split.KeepLastTurns(1))
+			assert.Equal(t, 3, split.Len())
+		})
+
+		t.Run("keeps everything when there are fewer turns", func(t *testing.T) {
+			agg := conversation()
+			assert.Empty(t, agg.KeepLastTurns(5))
+			assert.Equal(t, 8, agg.Len())
+		})
+
+		t.Run("adjusts the fork point", func(t *testing.T) {
+			forked := conversation().Fork()
+			forked.AddUserPrompt(messages.New().WithTurnID(turn3).UserPrompt("fourth question"))
+			forked.KeepLastTurns(1)
+			assert.Equal(t, 3, forked.Len())
+			assert.Equal(t, 1, forked.TurnLen())
+
+			target := newAggregator()
+			target.Join(forked)
+			require.Equal(t, 1, target.Len())
+			assert.Equal(t, messages.UserMessage{Content: messages.ContentOrParts{Content: "fourth question"}}, target.Messages()[0].Payload)
+		})
+	})
+
+	t.Run("MessagesForTurn", func(t *testing.T) {
+		turn1, turn2 := uuid.New(), uuid.New()
+		agg := newAggregator()
+		agg.AddUserPrompt(messages.New().WithTurnID(turn1).UserPrompt("what's the weather?"))
+		agg.AddToolCall(messages.New().WithTurnID(turn1).ToolCall([]messages.ToolCallData{{ID: "call-1", Name: "weather", Arguments: "{}"}}))
+		agg.AddUserPrompt(messages.New().WithTurnID(turn2).UserPrompt("and tomorrow?"))
+		agg.AddToolResponse(messages.New().WithTurnID(turn1).ToolResponse("call-1", "weather", "sunny"))
+		agg.AddAssistantMessage(messages.New().WithTurnID(turn2).AssistantMessage("rain"))
+
+		first := agg.MessagesForTurn(turn1)
+		require.Len(t, first, 3)
+		assert.IsType(t, messages.UserMessage{}, first[0].Payload)
+		assert.IsType(t, messages.ToolCallMessage{}, first[1].Payload)
+		assert.IsType(t, messages.ToolResponse{}, first[2].Payload)
+
+		second := agg.MessagesForTurn(turn2)
+		require.Len(t, second, 2)
+		assert.IsType(t, messages.UserMessage{}, second[0].Payload)
+		assert.Equal(t, messages.AssistantMessage{Content: messages.AssistantContentOrParts{Content: "rain"}}, second[1].Payload)
+
+		assert.Empty(t, agg.MessagesForTurn(uuid.New()))
+	})
 }
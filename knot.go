@@ -5,15 +5,15 @@ package bubo
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"slices"
 
 	"github.com/alphadose/haxmap"
+	"github.com/casualjim/bubo/agent"
 	"github.com/casualjim/bubo/api"
-	"github.com/casualjim/bubo/internal/executor"
 	"github.com/casualjim/bubo/internal/shorttermmemory"
 	"github.com/casualjim/bubo/messages"
-	"github.com/casualjim/bubo/provider"
 	"github.com/fogfish/opts"
 )
 
@@ -24,6 +24,9 @@ type Knot struct {
 	name   string                         // The name of the conversation initiator
 	agents *haxmap.Map[string, api.Agent] // Registry of available agents
 	steps  []ConversationStep             // Ordered sequence of conversation steps
+
+	validateAgents bool          // Validate the registered agents when the knot is created
+	refusalPolicy  RefusalPolicy // What to do when the agent of a step refuses
 }
 
 // Agents creates an option to register one or more agents with the Knot.
@@ -51,6 +54,14 @@ func Steps(step ConversationStep, extraSteps ...ConversationStep) opts.Option[Kn
 // Name is an option to set the name of the conversation initiator.
 var Name = opts.ForName[Knot, string]("name")
 
+// ValidateAgents is an option to validate the configuration of every registered agent
+// with agent.Validate when the Knot is created. New panics when an agent is misconfigured.
+var ValidateAgents = opts.ForName[Knot, bool]("validateAgents")
+
+// OnRefusal is an option to set the policy that is consulted when the agent of a step refuses to answer.
+// By default a refused step is skipped, use RefusalAbort or RefusalFallback to change that.
+var OnRefusal = opts.ForName[Knot, RefusalPolicy]("refusalPolicy")
+
 // New creates a new Knot instance with the provided options.
 // It initializes a default name of "User" and an empty agent registry.
 // Options can be used to customize the name, add agents, and define conversation steps.
@@ -62,9 +73,24 @@ func New(options ...opts.Option[Knot]) *Knot {
 	if err := opts.Apply(p, options); err != nil {
 		panic(err)
 	}
+	if p.validateAgents {
+		if err := p.checkAgents(); err != nil {
+			panic(err)
+		}
+	}
 	return p
 }
 
+// checkAgents validates the configuration of every registered agent
+func (p *Knot) checkAgents() error {
+	var errs error
+	p.agents.ForEach(func(_ string, a api.Agent) bool {
+		errs = errors.Join(errs, agent.Validate(a))
+		return true
+	})
+	return errs
+}
+
 // Run executes the conversation workflow defined by the Knot's steps.
 // It processes each step sequentially using the provided execution context.
 // The last step's output can be structured according to the response schema if specified.
@@ -74,23 +100,15 @@ func (p *Knot) Run(ctx context.Context, rc ExecutionContext) error {
 	maxItems := len(p.steps) - 1
 
 	for i, step := range p.steps {
-		var promise executor.Promise
-		var schema *provider.StructuredOutput
+		// every step runs with the options of the execution context,
+		// only the last step completes the promise with the structured output
+		stepCtx := rc
 		if i < maxItems {
-			promise = noopPromise{}
-		} else {
-			promise = rc.promise
-			schema = rc.responseSchema
+			stepCtx.promise = noopPromise{}
+			stepCtx.responseSchema = nil
 		}
 
-		if err := p.runStep(ctx, step.agentName, step.task, ExecutionContext{
-			executor:       rc.executor,
-			hook:           rc.hook,
-			promise:        promise,
-			contextVars:    rc.contextVars,
-			onClose:        rc.onClose,
-			responseSchema: schema,
-		}); err != nil {
+		if err := p.runStep(ctx, step.agentName, step.task, stepCtx); err != nil {
 			return err
 		}
 	}
@@ -104,6 +122,46 @@ func (p *Knot) runStep(ctx context.Context, agentName string, prompt task, rc Ex
 		return fmt.Errorf("agent %s not found", agentName)
 	}
 
+	if p.refusalPolicy.action == skipOnRefusal {
+		_, err := p.runAgent(ctx, agent, prompt, rc)
+		return err
+	}
+
+	// hold on to the outcome of the step until we know whether the agent refused
+	promise := rc.promise
+	held := &heldPromise{}
+	rc.promise = held
+
+	state, err := p.runAgent(ctx, agent, prompt, rc)
+	if err == nil {
+		refusal, refused := lastRefusal(state)
+		if refused && p.refusalPolicy.action == fallbackOnRefusal {
+			agent = p.refusalPolicy.fallback
+			held = &heldPromise{}
+			rc.promise = held
+			state, err = p.runAgent(ctx, agent, prompt, rc)
+			if err == nil {
+				refusal, refused = lastRefusal(state)
+			}
+		}
+		if err == nil && refused {
+			err = &RefusalError{Agent: agent.Name(), Refusal: refusal}
+			promise.Error(err)
+			return err
+		}
+	}
+
+	if held.done {
+		if held.err != nil {
+			promise.Error(held.err)
+		} else {
+			promise.Complete(held.value)
+		}
+	}
+	return err
+}
+
+func (p *Knot) runAgent(ctx context.Context, agent api.Agent, prompt task, rc ExecutionContext) (*shorttermmemory.Aggregator, error) {
 	state := shorttermmemory.New()
 
 	var message messages.Message[messages.UserMessage]
@@ -113,18 +171,20 @@ func (p *Knot) runStep(ctx context.Context, agentName string, prompt task, rc Ex
 	case messageTask:
 		message = messages.Message[messages.UserMessage](tsk)
 	default:
-		return fmt.Errorf("unknown task type %T", tsk)
+		return nil, fmt.Errorf("unknown task type %T", tsk)
 	}
-	state.AddUserPrompt(message)
-	rc.hook.OnUserPrompt(ctx, message)
-
 	cmd, err := rc.createCommand(agent, state)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
+	// the prompt belongs to the run, so all the events of the run share its ID
+	message.RunID = cmd.ID()
+	state.AddUserPrompt(message)
+	rc.hook.OnUserPrompt(ctx, message)
+
 	if err := rc.executor.Run(ctx, cmd, rc.promise); err != nil {
-		return err
+		return nil, err
 	}
-	return nil
+	return state, nil
 }
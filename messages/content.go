@@ -236,9 +236,11 @@ func Image(url string) ImageContentPart {
 // ImageContentPart represents an image content part with a URL.
 // It implements the ContentPart interface.
 type ImageContentPart struct {
-	URL    string   `json:"image_url"` // URL pointing to the image
-	Detail string   `json:"detail"`
-	_      struct{} // require keyed usage
+	URL    string `json:"image_url"` // URL pointing to the image
+	Detail string `json:"detail"`
+	// AltText describes the image, it takes the place of the image when the image can't be loaded
+	AltText string   `json:"alt_text,omitempty"`
+	_       struct{} // require keyed usage
 }
 
 func (ImageContentPart) contentPart() {}
@@ -248,7 +250,11 @@ var icpJSON = []byte(`{"type":"image"}`)
 // MarshalJSON implements json.Marshaler interface for ImageContentPart.
 // Serializes the image URL with a "type":"image" field.
 func (i ImageContentPart) MarshalJSON() ([]byte, error) {
-	return sjson.SetBytes(icpJSON, "image_url", i.URL)
+	result, err := sjson.SetBytes(icpJSON, "image_url", i.URL)
+	if err != nil || i.AltText == "" {
+		return result, err
+	}
+	return sjson.SetBytes(result, "alt_text", i.AltText)
 }
 
 // UnmarshalJSON implements json.Unmarshaler interface for ImageContentPart.
@@ -259,6 +265,7 @@ func (i *ImageContentPart) UnmarshalJSON(input []byte) error {
 		return errors.New("missing required field 'image_url")
 	}
 	i.URL = uri.String()
+	i.AltText = gjson.GetBytes(input, "alt_text").String()
 	return nil
 }
 
@@ -411,6 +411,11 @@ func TestImageContentPart(t *testing.T) {
 			input: `{"type":"image","image_url":""}`,
 			want:  ImageContentPart{URL: ""},
 		},
+		{
+			name:  "with alt text",
+			input: `{"type":"image","image_url":"http://example.com/cat.jpg","alt_text":"a sleeping cat"}`,
+			want:  ImageContentPart{URL: "http://example.com/cat.jpg", AltText: "a sleeping cat"},
+		},
 	}
 
 	for _, tt := range tests {
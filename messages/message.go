@@ -4,8 +4,10 @@
 package messages
 
 import (
+	"encoding/base64"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/casualjim/bubo/pkg/uuidx"
@@ -23,6 +25,8 @@ var (
 	toolCallJSON     = []byte(`{"type":"tool_call"}`)
 	toolResponseJSON = []byte(`{"type":"tool_response"}`)
 	retryJSON        = []byte(`{"type":"retry"}`)
+	approvalReqJSON  = []byte(`{"type":"approval_request"}`)
+	approvalJSON     = []byte(`{"type":"approval"}`)
 )
 
 // ModelMessage is a marker interface that all message types must implement.
@@ -52,15 +56,18 @@ type messageBuilder struct {
 	sender    string          // The entity that sent the message
 	timestamp strfmt.DateTime // When the message was created
 	metadata  gjson.Result    // Additional metadata to be included with the message
+	dedupKey  string          // Client supplied key to deduplicate the message
 }
 
 func wrap[T ModelMessage](bldr *messageBuilder, msg T) Message[T] {
 	return Message[T]{
+		MessageID: uuidx.New(),
 		RunID:     bldr.runID,
 		TurnID:    bldr.turnID,
 		Sender:    bldr.sender,
 		Timestamp: bldr.timestamp,
 		Meta:      bldr.metadata,
+		DedupKey:  bldr.dedupKey,
 		Payload:   msg,
 	}
 }
@@ -106,6 +113,13 @@ func (b messageBuilder) WithMetadata(metadata gjson.Result) messageBuilder {
 	return b
 }
 
+// WithDedupKey sets the deduplication key in the messageBuilder and returns a new builder instance.
+// Stores that receive the same message twice, for example when ingestion is retried, can drop it by its key.
+func (b messageBuilder) WithDedupKey(key string) messageBuilder {
+	b.dedupKey = key
+	return b
+}
+
 // Instructions creates a new instruction message with the given content.
 // This type of message is typically used to provide system-level instructions.
 func (b messageBuilder) Instructions(content string) Message[InstructionsMessage] {
@@ -186,15 +200,29 @@ func (b messageBuilder) ToolError(id, name string, error error) Message[Retry] {
 	})
 }
 
+// ToolArgumentsError creates a new retry message when the arguments for a tool call are invalid.
+// It carries the offending arguments and a suggestion so the model can correct its next attempt.
+func (b messageBuilder) ToolArgumentsError(id, name, arguments, suggestion string, error error) Message[Retry] {
+	return wrap(&b, Retry{
+		ToolCallID: id,
+		ToolName:   name,
+		Arguments:  arguments,
+		Suggestion: suggestion,
+		Error:      error,
+	})
+}
+
 // Message is a generic container for all message types in the system.
 // It includes common metadata like sender and timestamp alongside the specific message payload.
 type Message[T ModelMessage] struct {
-	RunID     uuid.UUID       `json:"run_id,omitempty"`  // ID of the run this message belongs to
-	TurnID    uuid.UUID       `json:"turn_id,omitempty"` // ID of the turn this message belongs to
+	MessageID uuid.UUID       `json:"message_id,omitempty"` // Unique ID of the message, so other messages can refer to it
+	RunID     uuid.UUID       `json:"run_id,omitempty"`     // ID of the run this message belongs to
+	TurnID    uuid.UUID       `json:"turn_id,omitempty"`    // ID of the turn this message belongs to
 	Payload   T               `json:",inline"`
 	Sender    string          `json:"sender,omitempty"`
 	Timestamp strfmt.DateTime `json:"timestamp,omitempty"`
-	Meta      gjson.Result    `json:"meta,omitempty"` // Additional metadata that can be attached to any message type
+	Meta      gjson.Result    `json:"meta,omitempty"`      // Additional metadata that can be attached to any message type
+	DedupKey  string          `json:"dedup_key,omitempty"` // Client supplied key, so stores can drop messages they already have
 }
 
 // MarshalJSON implements custom JSON marshaling for Message[T]
@@ -209,6 +237,11 @@ func (m Message[T]) MarshalJSON() ([]byte, error) {
 	result := payloadBytes
 
 	// Add other fields if they're present
+	if m.MessageID != uuid.Nil {
+		if result, err = sjson.SetBytes(result, "message_id", m.MessageID.String()); err != nil {
+			return nil, err
+		}
+	}
 	if m.RunID != uuid.Nil {
 		if result, err = sjson.SetBytes(result, "run_id", m.RunID.String()); err != nil {
 			return nil, err
@@ -225,7 +258,7 @@ func (m Message[T]) MarshalJSON() ([]byte, error) {
 		}
 	}
 	if !m.Timestamp.IsZero() {
-		if result, err = sjson.SetBytes(result, "timestamp", m.Timestamp.String()); err != nil {
+		if result, err = sjson.SetBytes(result, "timestamp", MarshalTimestamp(m.Timestamp)); err != nil {
 			return nil, err
 		}
 	}
@@ -234,6 +267,11 @@ func (m Message[T]) MarshalJSON() ([]byte, error) {
 			return nil, err
 		}
 	}
+	if m.DedupKey != "" {
+		if result, err = sjson.SetBytes(result, "dedup_key", m.DedupKey); err != nil {
+			return nil, err
+		}
+	}
 
 	return result, nil
 }
@@ -319,11 +357,37 @@ func (m *Message[T]) UnmarshalJSON(data []byte) error {
 		if !ok {
 			return fmt.Errorf("type mismatch: expected Retry")
 		}
+	case "approval_request":
+		var msg ApprovalRequest
+		if err := msg.UnmarshalJSON(data); err != nil {
+			return err
+		}
+		var ok bool
+		payload, ok = any(msg).(T)
+		if !ok {
+			return fmt.Errorf("type mismatch: expected ApprovalRequest")
+		}
+	case "approval":
+		var msg Approval
+		if err := msg.UnmarshalJSON(data); err != nil {
+			return err
+		}
+		var ok bool
+		payload, ok = any(msg).(T)
+		if !ok {
+			return fmt.Errorf("type mismatch: expected Approval")
+		}
 	default:
 		return fmt.Errorf("unknown message type: %s", msgType.String())
 	}
 
 	// Extract the basic fields
+	if messageID := parsed.Get("message_id"); messageID.Exists() {
+		if err := m.MessageID.UnmarshalText([]byte(messageID.String())); err != nil {
+			return fmt.Errorf("invalid message_id: %w", err)
+		}
+	}
+
 	if runID := parsed.Get("run_id"); runID.Exists() {
 		if err := m.RunID.UnmarshalText([]byte(runID.String())); err != nil {
 			return fmt.Errorf("invalid run_id: %w", err)
@@ -341,7 +405,7 @@ func (m *Message[T]) UnmarshalJSON(data []byte) error {
 	}
 
 	if timestamp := parsed.Get("timestamp"); timestamp.Exists() {
-		if err := m.Timestamp.UnmarshalText([]byte(timestamp.String())); err != nil {
+		if err := UnmarshalTimestamp(timestamp, &m.Timestamp); err != nil {
 			return fmt.Errorf("invalid timestamp: %w", err)
 		}
 	}
@@ -350,6 +414,10 @@ func (m *Message[T]) UnmarshalJSON(data []byte) error {
 		m.Meta = meta
 	}
 
+	if dedupKey := parsed.Get("dedup_key"); dedupKey.Exists() {
+		m.DedupKey = dedupKey.String()
+	}
+
 	m.Payload = payload
 	return nil
 }
@@ -387,6 +455,7 @@ func (i *InstructionsMessage) UnmarshalJSON(data []byte) error {
 }
 
 func (InstructionsMessage) message() {}
+func (InstructionsMessage) request() {}
 
 // UserMessage represents a message from a user.
 // It can contain either simple text content or multiple content parts.
@@ -434,10 +503,24 @@ type AssistantMessage struct {
 	_       struct{}                // require keyed usage
 }
 
+// Validate reports whether the assistant message can be serialized.
+// A message can carry either content or a refusal, but not both. Blank text counts as unset,
+// and the error only reports the lengths of the fields so the text doesn't end up in logs.
+func (a AssistantMessage) Validate() error {
+	content := strings.TrimSpace(a.Content.Content)
+	if refusal := strings.TrimSpace(a.Refusal); content != "" && refusal != "" {
+		return fmt.Errorf("invalid assistant message: both Content and Refusal cannot be set (content: %d bytes, refusal: %d bytes)", len(content), len(refusal))
+	}
+	if refusal := strings.TrimSpace(a.Content.Refusal); content != "" && refusal != "" {
+		return fmt.Errorf("invalid assistant message: both Content and Content.Refusal cannot be set (content: %d bytes, refusal: %d bytes)", len(content), len(refusal))
+	}
+	return nil
+}
+
 // MarshalJSON implements custom JSON marshaling for AssistantMessage
 func (a AssistantMessage) MarshalJSON() ([]byte, error) {
-	if a.Content.Content != "" && a.Refusal != "" {
-		return nil, fmt.Errorf("both Content and Refusal cannot be set")
+	if err := a.Validate(); err != nil {
+		return nil, err
 	}
 
 	result := assistantJSON
@@ -500,6 +583,19 @@ type ToolCallData struct {
 	_         struct{} // require keyed usage
 }
 
+// DecodeToolArgs decodes the JSON arguments of a tool call into a value of type T.
+// Empty arguments decode into the zero value of T.
+func DecodeToolArgs[T any](call ToolCallData) (T, error) {
+	var args T
+	if call.Arguments == "" {
+		return args, nil
+	}
+	if err := json.Unmarshal([]byte(call.Arguments), &args); err != nil {
+		return args, fmt.Errorf("failed to decode arguments for tool call %s (%s) into %T: %w", call.Name, call.ID, args, err)
+	}
+	return args, nil
+}
+
 // ToolCallMessage represents a request to execute one or more tools.
 type ToolCallMessage struct {
 	ToolCalls []ToolCallData `json:"tool_calls"`
@@ -549,10 +645,16 @@ func (ToolCallMessage) response() {}
 // ToolResponse represents the successful result of a tool execution.
 // It includes the tool name, call ID, and the execution result.
 type ToolResponse struct {
-	ToolName   string   `json:"tool_name"`
-	ToolCallID string   `json:"tool_call_id"`
-	Content    string   `json:"content"`
-	_          struct{} // require keyed usage
+	ToolName   string `json:"tool_name"`
+	ToolCallID string `json:"tool_call_id"`
+	Content    string `json:"content"`
+	// RawJSON marks content that is a JSON document, it's embedded as is when the response is serialized
+	RawJSON bool `json:"-"`
+	// Data is binary data produced by the tool, like a generated file, it's serialized as base64
+	Data []byte `json:"data,omitempty"`
+	// MIMEType is the media type of Data
+	MIMEType string   `json:"mime_type,omitempty"`
+	_        struct{} // require keyed usage
 }
 
 // MarshalJSON implements custom JSON marshaling for ToolResponse
@@ -570,6 +672,20 @@ func (t ToolResponse) MarshalJSON() ([]byte, error) {
 		return nil, err
 	}
 
+	if len(t.Data) > 0 {
+		result, err = sjson.SetBytes(result, "data", base64.StdEncoding.EncodeToString(t.Data))
+		if err != nil {
+			return nil, err
+		}
+		result, err = sjson.SetBytes(result, "mime_type", t.MIMEType)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if t.RawJSON && gjson.Valid(t.Content) {
+		return sjson.SetRawBytes(result, "content", []byte(t.Content))
+	}
 	result, err = sjson.SetBytes(result, "content", t.Content)
 	return result, err
 }
@@ -602,19 +718,148 @@ func (t *ToolResponse) UnmarshalJSON(data []byte) error {
 
 	t.ToolName = toolName.String()
 	t.ToolCallID = toolCallID.String()
-	t.Content = content.String()
+	if content.Type == gjson.String {
+		t.Content = content.String()
+	} else {
+		t.Content = content.Raw
+		t.RawJSON = true
+	}
+
+	if encoded := gjson.GetBytes(data, "data"); encoded.Exists() {
+		decoded, err := base64.StdEncoding.DecodeString(encoded.String())
+		if err != nil {
+			return fmt.Errorf("invalid base64 data: %w", err)
+		}
+		t.Data = decoded
+		t.MIMEType = gjson.GetBytes(data, "mime_type").String()
+	}
 	return nil
 }
 
 func (ToolResponse) message() {}
 func (ToolResponse) request() {}
 
+// ApprovalRequest asks a human to approve a tool call before it is executed.
+// It is published for tools that require approval, the run waits for a matching Approval.
+type ApprovalRequest struct {
+	ToolName   string   `json:"tool_name"`
+	ToolCallID string   `json:"tool_call_id"`
+	Arguments  string   `json:"arguments,omitempty"`
+	_          struct{} // require keyed usage
+}
+
+// MarshalJSON implements custom JSON marshaling for ApprovalRequest
+func (a ApprovalRequest) MarshalJSON() ([]byte, error) {
+	result := approvalReqJSON
+
+	var err error
+	result, err = sjson.SetBytes(result, "tool_name", a.ToolName)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err = sjson.SetBytes(result, "tool_call_id", a.ToolCallID)
+	if err != nil {
+		return nil, err
+	}
+
+	if a.Arguments != "" {
+		result, err = sjson.SetBytes(result, "arguments", a.Arguments)
+	}
+	return result, err
+}
+
+// UnmarshalJSON implements custom JSON unmarshaling for ApprovalRequest
+func (a *ApprovalRequest) UnmarshalJSON(data []byte) error {
+	if !gjson.ValidBytes(data) {
+		return fmt.Errorf("invalid json: %s", data)
+	}
+
+	msgType := gjson.GetBytes(data, "type")
+	if !msgType.Exists() || msgType.String() != "approval_request" {
+		return fmt.Errorf("missing or invalid message type, expected 'approval_request'")
+	}
+
+	toolCallID := gjson.GetBytes(data, "tool_call_id")
+	if !toolCallID.Exists() {
+		return fmt.Errorf("missing required field 'tool_call_id'")
+	}
+
+	a.ToolName = gjson.GetBytes(data, "tool_name").String()
+	a.ToolCallID = toolCallID.String()
+	a.Arguments = gjson.GetBytes(data, "arguments").String()
+	return nil
+}
+
+func (ApprovalRequest) message() {}
+func (ApprovalRequest) request() {}
+
+// Approval is the answer to an ApprovalRequest.
+// It approves or denies the tool call with the matching id, the reason is passed
+// to the model when the call is denied.
+type Approval struct {
+	ToolCallID string   `json:"tool_call_id"`
+	Approved   bool     `json:"approved"`
+	Reason     string   `json:"reason,omitempty"`
+	_          struct{} // require keyed usage
+}
+
+// MarshalJSON implements custom JSON marshaling for Approval
+func (a Approval) MarshalJSON() ([]byte, error) {
+	result := approvalJSON
+
+	var err error
+	result, err = sjson.SetBytes(result, "tool_call_id", a.ToolCallID)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err = sjson.SetBytes(result, "approved", a.Approved)
+	if err != nil {
+		return nil, err
+	}
+
+	if a.Reason != "" {
+		result, err = sjson.SetBytes(result, "reason", a.Reason)
+	}
+	return result, err
+}
+
+// UnmarshalJSON implements custom JSON unmarshaling for Approval
+func (a *Approval) UnmarshalJSON(data []byte) error {
+	if !gjson.ValidBytes(data) {
+		return fmt.Errorf("invalid json: %s", data)
+	}
+
+	msgType := gjson.GetBytes(data, "type")
+	if !msgType.Exists() || msgType.String() != "approval" {
+		return fmt.Errorf("missing or invalid message type, expected 'approval'")
+	}
+
+	toolCallID := gjson.GetBytes(data, "tool_call_id")
+	if !toolCallID.Exists() {
+		return fmt.Errorf("missing required field 'tool_call_id'")
+	}
+
+	a.ToolCallID = toolCallID.String()
+	a.Approved = gjson.GetBytes(data, "approved").Bool()
+	a.Reason = gjson.GetBytes(data, "reason").String()
+	return nil
+}
+
+func (Approval) message() {}
+func (Approval) request() {}
+
 // Retry represents a failed tool execution that may need to be retried.
 // It includes error information and details about the failed tool call.
 type Retry struct {
-	Error      error    `json:"error"`
-	ToolName   string   `json:"tool_name,omitempty"`
-	ToolCallID string   `json:"tool_call_id,omitempty"`
+	Error      error  `json:"error"`
+	ToolName   string `json:"tool_name,omitempty"`
+	ToolCallID string `json:"tool_call_id,omitempty"`
+	// Arguments holds the raw arguments of the failed tool call so the model can correct them
+	Arguments string `json:"arguments,omitempty"`
+	// Suggestion is a hint for the model on how to fix its next attempt
+	Suggestion string   `json:"suggestion,omitempty"`
 	_          struct{} // require keyed usage
 }
 
@@ -644,6 +889,20 @@ func (r Retry) MarshalJSON() ([]byte, error) {
 		}
 	}
 
+	if r.Arguments != "" {
+		result, err = sjson.SetBytes(result, "arguments", r.Arguments)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if r.Suggestion != "" {
+		result, err = sjson.SetBytes(result, "suggestion", r.Suggestion)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	return result, nil
 }
 
@@ -673,6 +932,14 @@ func (r *Retry) UnmarshalJSON(data []byte) error {
 		r.ToolCallID = toolCallID.String()
 	}
 
+	if arguments := gjson.GetBytes(data, "arguments"); arguments.Exists() {
+		r.Arguments = arguments.String()
+	}
+
+	if suggestion := gjson.GetBytes(data, "suggestion"); suggestion.Exists() {
+		r.Suggestion = suggestion.String()
+	}
+
 	return nil
 }
 
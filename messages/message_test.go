@@ -1,12 +1,14 @@
 package messages
 
 import (
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"testing"
 	"time"
 
+	"github.com/casualjim/bubo/pkg/uuidx"
 	"github.com/go-openapi/strfmt"
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
@@ -55,6 +57,24 @@ func TestAssistantMessage_response(t *testing.T) {
 	a.response()
 }
 
+func TestAssistantMessage_Validate(t *testing.T) {
+	require.NoError(t, AssistantMessage{Content: AssistantContentOrParts{Content: "hello"}}.Validate())
+	require.NoError(t, AssistantMessage{Refusal: "no"}.Validate())
+
+	require.NoError(t, AssistantMessage{Content: AssistantContentOrParts{Content: " \n"}, Refusal: "no"}.Validate())
+	require.NoError(t, AssistantMessage{Content: AssistantContentOrParts{Content: "hello"}, Refusal: " "}.Validate())
+
+	err := AssistantMessage{Content: AssistantContentOrParts{Content: "hello"}, Refusal: "no"}.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "both Content and Refusal cannot be set (content: 5 bytes, refusal: 2 bytes)")
+	assert.NotContains(t, err.Error(), "hello")
+
+	err = AssistantMessage{Content: AssistantContentOrParts{Content: "hello", Refusal: "no"}}.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "both Content and Content.Refusal cannot be set (content: 5 bytes, refusal: 2 bytes)")
+	assert.NotContains(t, err.Error(), "hello")
+}
+
 func TestAssistantMessage(t *testing.T) {
 	content := AssistantContentOrParts{Content: "test content"}
 	a := AssistantMessage{
@@ -91,6 +111,50 @@ func TestToolCall(t *testing.T) {
 	assert.Equal(t, "test args", tc.ToolCalls[0].Arguments)
 }
 
+func TestDecodeToolArgs(t *testing.T) {
+	type weatherArgs struct {
+		Location string `json:"location"`
+		Days     int    `json:"days"`
+	}
+
+	t.Run("valid arguments", func(t *testing.T) {
+		args, err := DecodeToolArgs[weatherArgs](ToolCallData{
+			ID:        "call-1",
+			Name:      "weather",
+			Arguments: `{"location":"Paris","days":3}`,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, weatherArgs{Location: "Paris", Days: 3}, args)
+	})
+
+	t.Run("empty arguments", func(t *testing.T) {
+		args, err := DecodeToolArgs[weatherArgs](ToolCallData{Name: "weather"})
+		require.NoError(t, err)
+		assert.Zero(t, args)
+	})
+
+	t.Run("type mismatch", func(t *testing.T) {
+		_, err := DecodeToolArgs[weatherArgs](ToolCallData{
+			ID:        "call-1",
+			Name:      "weather",
+			Arguments: `{"location":"Paris","days":"three"}`,
+		})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "failed to decode arguments for tool call weather (call-1)")
+		assert.Contains(t, err.Error(), "weatherArgs")
+	})
+
+	t.Run("invalid json", func(t *testing.T) {
+		_, err := DecodeToolArgs[weatherArgs](ToolCallData{
+			ID:        "call-1",
+			Name:      "weather",
+			Arguments: `{"location":`,
+		})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "weather")
+	})
+}
+
 func TestToolResponse_message(t *testing.T) {
 	tr := ToolResponse{}
 	tr.message()
@@ -112,6 +176,58 @@ func TestToolResponse(t *testing.T) {
 	assert.Equal(t, "test content", tr.Content)
 }
 
+func TestToolResponse_JSONWithRawContent(t *testing.T) {
+	tr := ToolResponse{
+		ToolName:   "count",
+		ToolCallID: "call-1",
+		Content:    "42",
+		RawJSON:    true,
+	}
+
+	data, err := json.Marshal(tr)
+	require.NoError(t, err)
+	content := gjson.GetBytes(data, "content")
+	assert.Equal(t, gjson.Number, content.Type)
+	assert.Equal(t, "42", content.Raw)
+
+	var decoded ToolResponse
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	assert.Equal(t, "42", decoded.Content)
+	assert.True(t, decoded.RawJSON)
+
+	tr.RawJSON = false
+	data, err = json.Marshal(tr)
+	require.NoError(t, err)
+	assert.Equal(t, `"42"`, gjson.GetBytes(data, "content").Raw)
+}
+
+func TestToolResponse_JSONWithData(t *testing.T) {
+	tr := ToolResponse{
+		ToolName:   "render",
+		ToolCallID: "call-1",
+		Content:    "the rendered chart",
+		Data:       []byte{0x89, 'P', 'N', 'G', 0x00, 0xff},
+		MIMEType:   "image/png",
+	}
+
+	data, err := json.Marshal(tr)
+	require.NoError(t, err)
+	assert.Equal(t, base64.StdEncoding.EncodeToString(tr.Data), gjson.GetBytes(data, "data").String())
+	assert.Equal(t, "image/png", gjson.GetBytes(data, "mime_type").String())
+
+	var decoded ToolResponse
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	assert.Equal(t, tr.Data, decoded.Data)
+	assert.Equal(t, "image/png", decoded.MIMEType)
+	assert.Equal(t, "the rendered chart", decoded.Content)
+
+	withoutData, err := json.Marshal(ToolResponse{ToolName: "render", ToolCallID: "call-1", Content: "text"})
+	require.NoError(t, err)
+	assert.False(t, gjson.GetBytes(withoutData, "data").Exists())
+
+	require.Error(t, json.Unmarshal([]byte(`{"type":"tool_response","tool_name":"render","tool_call_id":"call-1","content":"","data":"not base64!"}`), &decoded))
+}
+
 func TestRetry_message(t *testing.T) {
 	r := Retry{}
 	r.message()
@@ -134,6 +250,28 @@ func TestRetry(t *testing.T) {
 	assert.Equal(t, "test-call-id", r.ToolCallID)
 }
 
+func TestRetry_JSONWithArguments(t *testing.T) {
+	r := Retry{
+		Error:      errors.New("missing location"),
+		ToolName:   "weather",
+		ToolCallID: "call-1",
+		Arguments:  `{"unit":"celsius"}`,
+		Suggestion: "provide a value for: location",
+	}
+
+	data, err := json.Marshal(r)
+	require.NoError(t, err)
+	assert.Equal(t, `{"unit":"celsius"}`, gjson.GetBytes(data, "arguments").String())
+
+	var decoded Retry
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	assert.Equal(t, "missing location", decoded.Error.Error())
+	assert.Equal(t, "weather", decoded.ToolName)
+	assert.Equal(t, "call-1", decoded.ToolCallID)
+	assert.Equal(t, `{"unit":"celsius"}`, decoded.Arguments)
+	assert.Equal(t, "provide a value for: location", decoded.Suggestion)
+}
+
 func TestNew(t *testing.T) {
 	builder := New()
 	assert.NotZero(t, builder.timestamp)
@@ -625,3 +763,101 @@ func TestToolOperations(t *testing.T) {
 		assert.Equal(t, metadata.Raw, msg.Meta.Raw)
 	})
 }
+
+func TestMessage_DedupKey(t *testing.T) {
+	t.Run("round trip", func(t *testing.T) {
+		msg := New().WithDedupKey("ingest-42").UserPrompt("hello")
+
+		data, err := json.Marshal(msg)
+		require.NoError(t, err)
+		assert.Equal(t, "ingest-42", gjson.GetBytes(data, "dedup_key").String())
+
+		var decoded Message[UserMessage]
+		require.NoError(t, json.Unmarshal(data, &decoded))
+		assert.Equal(t, "ingest-42", decoded.DedupKey)
+		assert.Equal(t, msg.Payload, decoded.Payload)
+	})
+
+	t.Run("unset", func(t *testing.T) {
+		data, err := json.Marshal(New().UserPrompt("hello"))
+		require.NoError(t, err)
+		assert.False(t, gjson.GetBytes(data, "dedup_key").Exists())
+
+		var decoded Message[UserMessage]
+		require.NoError(t, json.Unmarshal(data, &decoded))
+		assert.Empty(t, decoded.DedupKey)
+	})
+}
+
+func TestMessage_MessageID(t *testing.T) {
+	t.Run("unique per message", func(t *testing.T) {
+		bldr := New()
+		first := bldr.UserPrompt("hello")
+		second := bldr.UserPrompt("hello")
+		assert.NotEqual(t, uuid.Nil, first.MessageID)
+		assert.NotEqual(t, first.MessageID, second.MessageID)
+		assert.Equal(t, first.TurnID, second.TurnID, "the ID is distinct from the turn")
+	})
+
+	t.Run("round trip", func(t *testing.T) {
+		msg := New().AssistantMessage("hi")
+
+		data, err := json.Marshal(msg)
+		require.NoError(t, err)
+		assert.Equal(t, msg.MessageID.String(), gjson.GetBytes(data, "message_id").String())
+
+		var decoded Message[AssistantMessage]
+		require.NoError(t, json.Unmarshal(data, &decoded))
+		assert.Equal(t, msg.MessageID, decoded.MessageID)
+	})
+
+	t.Run("uses the ID generator", func(t *testing.T) {
+		fixed := uuid.MustParse("01890a5d-ac96-774b-bcce-b302099a8057")
+		uuidx.SetGenerator(func() uuid.UUID { return fixed })
+		t.Cleanup(func() { uuidx.SetGenerator(nil) })
+
+		assert.Equal(t, fixed, New().UserPrompt("hello").MessageID)
+	})
+}
+
+func TestMessage_TimestampFormat(t *testing.T) {
+	t.Cleanup(func() { SetTimestampFormat(RFC3339Timestamps) })
+
+	ts := strfmt.DateTime(time.Date(2024, 3, 1, 12, 30, 45, 123000000, time.UTC))
+	msg := New().WithSender("user").WithTimestamp(ts).UserPrompt("hello")
+
+	t.Run("rfc3339", func(t *testing.T) {
+		SetTimestampFormat(RFC3339Timestamps)
+
+		data, err := json.Marshal(msg)
+		require.NoError(t, err)
+		assert.Equal(t, gjson.String, gjson.GetBytes(data, "timestamp").Type)
+		assert.Equal(t, "2024-03-01T12:30:45.123Z", gjson.GetBytes(data, "timestamp").String())
+
+		var decoded Message[UserMessage]
+		require.NoError(t, json.Unmarshal(data, &decoded))
+		assert.True(t, time.Time(ts).Equal(time.Time(decoded.Timestamp)))
+		assert.Equal(t, msg.Payload, decoded.Payload)
+	})
+
+	t.Run("unix millis", func(t *testing.T) {
+		SetTimestampFormat(UnixMillisTimestamps)
+
+		data, err := json.Marshal(msg)
+		require.NoError(t, err)
+		assert.Equal(t, gjson.Number, gjson.GetBytes(data, "timestamp").Type)
+		assert.Equal(t, int64(1709296245123), gjson.GetBytes(data, "timestamp").Int())
+
+		var decoded Message[UserMessage]
+		require.NoError(t, json.Unmarshal(data, &decoded))
+		assert.True(t, time.Time(ts).Equal(time.Time(decoded.Timestamp)))
+		assert.Equal(t, msg.Payload, decoded.Payload)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		var decoded Message[UserMessage]
+		err := json.Unmarshal([]byte(`{"type":"user","content":"hi","timestamp":true}`), &decoded)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "invalid timestamp")
+	})
+}
@@ -0,0 +1,50 @@
+package messages
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-openapi/strfmt"
+	"github.com/tidwall/gjson"
+)
+
+// TimestampFormat is the representation of timestamps in the JSON of messages and events.
+type TimestampFormat int32
+
+const (
+	// RFC3339Timestamps serializes timestamps as RFC3339 strings, this is the default.
+	RFC3339Timestamps TimestampFormat = iota
+	// UnixMillisTimestamps serializes timestamps as the number of milliseconds since the unix epoch.
+	UnixMillisTimestamps
+)
+
+var timestampFormat atomic.Int32
+
+// SetTimestampFormat configures how timestamps are serialized in the JSON of messages and events.
+// It applies to the whole process, so it's best called once at startup.
+// Parsing accepts both formats, regardless of this setting.
+func SetTimestampFormat(format TimestampFormat) {
+	timestampFormat.Store(int32(format))
+}
+
+// MarshalTimestamp returns the JSON value of the timestamp in the configured format.
+func MarshalTimestamp(ts strfmt.DateTime) any {
+	if TimestampFormat(timestampFormat.Load()) == UnixMillisTimestamps {
+		return time.Time(ts).UnixMilli()
+	}
+	return ts.String()
+}
+
+// UnmarshalTimestamp parses a JSON timestamp, numbers are read as unix millis and strings as RFC3339.
+func UnmarshalTimestamp(value gjson.Result, ts *strfmt.DateTime) error {
+	switch value.Type {
+	case gjson.Number:
+		*ts = strfmt.DateTime(time.UnixMilli(value.Int()).UTC())
+		return nil
+	case gjson.String:
+		return ts.UnmarshalText([]byte(value.String()))
+	default:
+		return fmt.Errorf("expected a string or a number, got %s", value.Type)
+	}
+}
@@ -0,0 +1,142 @@
+// Package bubo provides a framework for building conversational AI agents that can interact
+// in a structured manner. It supports multi-agent conversations, structured output,
+// and flexible execution contexts.
+package bubo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/casualjim/bubo/internal/executor"
+)
+
+// ParallelResult is the outcome of a single step run by ParallelSteps.
+// Index is the position of the step in the list of steps passed to ParallelSteps.
+type ParallelResult[T any] struct {
+	Index  int
+	Result T
+	Err    error
+}
+
+// StepResult is the outcome of a single step in the list returned by ParallelRun.Outcomes.
+// Err is set when the step failed, Value is the zero value then.
+type StepResult[T any] struct {
+	Index int
+	Value T
+	Err   error
+}
+
+// ParallelRun tracks the steps started by ParallelSteps.
+// Results are delivered on the channel returned by Results as soon as each step
+// completes, Wait returns all the results in the order of the steps.
+type ParallelRun[T any] struct {
+	results chan ParallelResult[T]
+	done    chan struct{}
+	values  []T
+	err     error
+	// outcomes are the outcomes of the steps ordered by index
+	outcomes []StepResult[T]
+	// failed is the error of the step that failed first, it's only reported with FailFast
+	failed error
+}
+
+// Results returns a channel that receives the result of every step in completion order.
+// The channel is buffered for all the steps and closed once every step has completed,
+// so it is safe to only call Wait.
+func (r *ParallelRun[T]) Results() <-chan ParallelResult[T] {
+	return r.results
+}
+
+// Wait blocks until every step has completed and returns the results ordered by step index.
+// The returned error joins the errors of all the steps that failed.
+func (r *ParallelRun[T]) Wait() ([]T, error) {
+	<-r.done
+	return r.values, r.err
+}
+
+// Outcomes blocks until every step has completed and returns the outcome of every step ordered by step index,
+// so the steps that succeeded can be used when others failed. The returned error is only set when the
+// execution context is configured with FailFast, it is the error of the step that failed first.
+func (r *ParallelRun[T]) Outcomes() ([]StepResult[T], error) {
+	<-r.done
+	return r.outcomes, r.failed
+}
+
+// ParallelSteps runs the steps concurrently with the agents registered on the knot.
+// Every step gets its own conversation thread and result, the hook of the execution
+// context receives the events of all the steps. The result of each step is decoded into T,
+// using the structured output of the execution context when one is configured.
+// A failing step doesn't stop the others, unless the execution context is configured with FailFast,
+// then the remaining steps are cancelled.
+//
+// Example usage:
+//
+//	run := bubo.ParallelSteps[Summary](ctx, knot, bubo.Local[Summary](hook),
+//	    bubo.Step("summarizer", "Summarize the first document"),
+//	    bubo.Step("summarizer", "Summarize the second document"),
+//	)
+//	for res := range run.Results() {
+//	    // handle res.Index, res.Result and res.Err as soon as each step is done
+//	}
+//	summaries, err := run.Wait()
+func ParallelSteps[T any](ctx context.Context, k *Knot, rc ExecutionContext, steps ...ConversationStep) *ParallelRun[T] {
+	run := &ParallelRun[T]{
+		results:  make(chan ParallelResult[T], len(steps)),
+		done:     make(chan struct{}),
+		values:   make([]T, len(steps)),
+		outcomes: make([]StepResult[T], len(steps)),
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var errs error
+	for i, step := range steps {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			result, err := runParallelStep[T](ctx, k, step, rc)
+			if err != nil {
+				err = fmt.Errorf("step %d: %w", i, err)
+				mu.Lock()
+				errs = errors.Join(errs, err)
+				if rc.failFast && run.failed == nil {
+					run.failed = err
+					cancel()
+				}
+				mu.Unlock()
+			}
+			run.values[i] = result
+			run.outcomes[i] = StepResult[T]{Index: i, Value: result, Err: err}
+			run.results <- ParallelResult[T]{Index: i, Result: result, Err: err}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		cancel()
+		run.err = errs
+		close(run.results)
+		close(run.done)
+	}()
+
+	return run
+}
+
+func runParallelStep[T any](ctx context.Context, k *Knot, step ConversationStep, rc ExecutionContext) (T, error) {
+	fut := executor.NewFuture(executor.DefaultUnmarshal[T]())
+
+	stepCtx := rc
+	stepCtx.promise = fut
+	err := k.runStep(ctx, step.agentName, step.task, stepCtx)
+	if err != nil {
+		fut.Error(err)
+	} else {
+		// the future only takes the first outcome, this is a no-op when the step produced a result
+		fut.Error(errors.New("step finished without a result"))
+	}
+	return fut.Get()
+}
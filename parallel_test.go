@@ -0,0 +1,144 @@
+package bubo
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/casualjim/bubo/agent"
+	"github.com/casualjim/bubo/api"
+	"github.com/casualjim/bubo/internal/executor"
+	"github.com/casualjim/bubo/internal/mocks"
+	"github.com/casualjim/bubo/messages"
+	"github.com/casualjim/bubo/provider"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// delayedProvider answers every completion with content after a delay
+type delayedProvider struct {
+	delay   time.Duration
+	content string
+	err     error
+}
+
+func (p *delayedProvider) ChatCompletion(ctx context.Context, params provider.CompletionParams) (<-chan provider.StreamEvent, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+	ch := make(chan provider.StreamEvent, 1)
+	go func() {
+		defer close(ch)
+		select {
+		case <-time.After(p.delay):
+		case <-ctx.Done():
+			return
+		}
+		ch <- provider.Response[messages.AssistantMessage]{
+			RunID: params.RunID,
+			Response: messages.AssistantMessage{
+				Content: messages.AssistantContentOrParts{Content: p.content},
+			},
+		}
+	}()
+	return ch, nil
+}
+
+func delayedAgent(t *testing.T, name string, p provider.Provider) api.Agent {
+	model := mocks.NewModel(t)
+	model.EXPECT().Name().Return("test-model").Maybe()
+	model.EXPECT().Provider().Return(p).Maybe()
+	return agent.New(agent.Name(name), agent.Model(model), agent.Instructions("You are a test agent"))
+}
+
+func TestParallelSteps(t *testing.T) {
+	rc := ExecutionContext{executor: executor.NewLocal(), hook: noopHook{}}
+
+	t.Run("results in completion order", func(t *testing.T) {
+		knot := New(Agents(
+			delayedAgent(t, "slow", &delayedProvider{delay: 200 * time.Millisecond, content: "slow result"}),
+			delayedAgent(t, "fast", &delayedProvider{delay: 10 * time.Millisecond, content: "fast result"}),
+		))
+
+		run := ParallelSteps[string](context.Background(), knot, rc,
+			Step("slow", "take your time"),
+			Step("fast", "be quick"),
+		)
+
+		var completed []ParallelResult[string]
+		for res := range run.Results() {
+			completed = append(completed, res)
+		}
+		require.Len(t, completed, 2)
+		assert.Equal(t, ParallelResult[string]{Index: 1, Result: "fast result"}, completed[0])
+		assert.Equal(t, ParallelResult[string]{Index: 0, Result: "slow result"}, completed[1])
+
+		results, err := run.Wait()
+		require.NoError(t, err)
+		assert.Equal(t, []string{"slow result", "fast result"}, results)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		failure := errors.New("provider unavailable")
+		knot := New(Agents(
+			delayedAgent(t, "ok", &delayedProvider{content: "ok"}),
+			delayedAgent(t, "broken", &delayedProvider{err: failure}),
+		))
+
+		run := ParallelSteps[string](context.Background(), knot, rc,
+			Step("ok", "hello"),
+			Step("broken", "hello"),
+		)
+
+		results, err := run.Wait()
+		require.Error(t, err)
+		assert.ErrorIs(t, err, failure)
+		assert.Contains(t, err.Error(), "step 1")
+		assert.Equal(t, []string{"ok", ""}, results)
+	})
+}
+
+func TestParallelStepsOutcomes(t *testing.T) {
+	failure := errors.New("provider unavailable")
+	newKnot := func(t *testing.T) *Knot {
+		return New(Agents(
+			delayedAgent(t, "first", &delayedProvider{delay: 50 * time.Millisecond, content: "first result"}),
+			delayedAgent(t, "broken", &delayedProvider{err: failure}),
+			delayedAgent(t, "third", &delayedProvider{delay: 50 * time.Millisecond, content: "third result"}),
+		))
+	}
+	steps := []ConversationStep{
+		Step("first", "hello"),
+		Step("broken", "hello"),
+		Step("third", "hello"),
+	}
+
+	t.Run("partial failure", func(t *testing.T) {
+		rc := ExecutionContext{executor: executor.NewLocal(), hook: noopHook{}}
+		run := ParallelSteps[string](context.Background(), newKnot(t), rc, steps...)
+
+		outcomes, err := run.Outcomes()
+		require.NoError(t, err)
+		require.Len(t, outcomes, 3)
+
+		assert.Equal(t, StepResult[string]{Index: 0, Value: "first result"}, outcomes[0])
+		assert.Equal(t, 1, outcomes[1].Index)
+		assert.Empty(t, outcomes[1].Value)
+		assert.ErrorIs(t, outcomes[1].Err, failure)
+		assert.Equal(t, StepResult[string]{Index: 2, Value: "third result"}, outcomes[2])
+	})
+
+	t.Run("fail fast", func(t *testing.T) {
+		rc := ExecutionContext{executor: executor.NewLocal(), hook: noopHook{}, failFast: true}
+		run := ParallelSteps[string](context.Background(), newKnot(t), rc, steps...)
+
+		outcomes, err := run.Outcomes()
+		require.Error(t, err)
+		assert.ErrorIs(t, err, failure)
+		assert.Contains(t, err.Error(), "step 1")
+		require.Len(t, outcomes, 3)
+		assert.Error(t, outcomes[0].Err, "the remaining steps should be cancelled")
+		assert.Error(t, outcomes[2].Err, "the remaining steps should be cancelled")
+	})
+}
@@ -1,10 +1,29 @@
 package uuidx
 
-import "github.com/google/uuid"
+import (
+	"sync/atomic"
+
+	"github.com/google/uuid"
+)
+
+var generator atomic.Pointer[func() uuid.UUID]
+
+// SetGenerator replaces the function New uses to generate IDs, for example to get
+// predictable IDs in tests. Passing nil restores the default version 7 generator.
+func SetGenerator(fn func() uuid.UUID) {
+	if fn == nil {
+		generator.Store(nil)
+		return
+	}
+	generator.Store(&fn)
+}
 
 // New generates a new UUID using the version 7 format and returns it.
 // It panics if the UUID generation fails.
 func New() uuid.UUID {
+	if fn := generator.Load(); fn != nil {
+		return (*fn)()
+	}
 	return uuid.Must(uuid.NewV7())
 }
 
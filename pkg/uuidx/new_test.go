@@ -37,3 +37,13 @@ func TestNewString_Format(t *testing.T) {
 	assert.Regexp(t, "^[0-9a-f]{8}-[0-9a-f]{4}-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$", idStr,
 		"UUID string should match standard UUID v7 format")
 }
+
+func TestSetGenerator(t *testing.T) {
+	fixed := uuid.MustParse("01890a5d-ac96-774b-bcce-b302099a8057")
+	SetGenerator(func() uuid.UUID { return fixed })
+	assert.Equal(t, fixed, New())
+	assert.Equal(t, fixed.String(), NewString())
+
+	SetGenerator(nil)
+	assert.NotEqual(t, fixed, New(), "nil restores the default generator")
+}
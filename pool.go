@@ -0,0 +1,58 @@
+// Package bubo provides a framework for building conversational AI agents that can interact
+// in a structured manner. It supports multi-agent conversations, structured output,
+// and flexible execution contexts.
+package bubo
+
+import (
+	"context"
+	"fmt"
+)
+
+// Pool bounds the number of runs that execute at the same time, to cap the concurrent requests
+// to the providers when one process drives many runs.
+// Runs beyond the cap wait in line until a run finishes or their context is done.
+//
+// Example usage:
+//
+//	pool := bubo.RunPool(4)
+//	for _, prompt := range prompts {
+//	    go func() {
+//	        knot := bubo.New(bubo.Agents(agent), bubo.Steps(bubo.Step(agent.Name(), prompt)))
+//	        if err := pool.Run(ctx, knot, bubo.Local(hook)); err != nil {
+//	            // Handle error
+//	        }
+//	    }()
+//	}
+type Pool struct {
+	slots chan struct{}
+}
+
+// RunPool creates a pool that runs at most maxConcurrent runs at the same time.
+// It panics when maxConcurrent is less than 1.
+func RunPool(maxConcurrent int) *Pool {
+	if maxConcurrent < 1 {
+		panic(fmt.Sprintf("run pool needs at least 1 concurrent run, got %d", maxConcurrent))
+	}
+	return &Pool{slots: make(chan struct{}, maxConcurrent)}
+}
+
+// Run waits for a free slot in the pool and then runs the knot with the execution context.
+// When the context is done while the run is waiting, the run fails with the error of the context,
+// without executing any step.
+func (p *Pool) Run(ctx context.Context, k *Knot, rc ExecutionContext) error {
+	select {
+	case p.slots <- struct{}{}:
+	case <-ctx.Done():
+		// the run never started, release whoever waits for its result
+		if rc.promise != nil {
+			rc.promise.Error(ctx.Err())
+		}
+		if rc.onClose != nil {
+			rc.onClose(ctx)
+		}
+		return ctx.Err()
+	}
+	defer func() { <-p.slots }()
+
+	return k.Run(ctx, rc)
+}
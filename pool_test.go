@@ -0,0 +1,107 @@
+package bubo
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/casualjim/bubo/provider"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// inFlightProvider tracks how many completions run at the same time
+type inFlightProvider struct {
+	delayedProvider
+	current atomic.Int32
+	peak    atomic.Int32
+}
+
+func (p *inFlightProvider) ChatCompletion(ctx context.Context, params provider.CompletionParams) (<-chan provider.StreamEvent, error) {
+	n := p.current.Add(1)
+	for {
+		peak := p.peak.Load()
+		if n <= peak || p.peak.CompareAndSwap(peak, n) {
+			break
+		}
+	}
+	ch, err := p.delayedProvider.ChatCompletion(ctx, params)
+	if err != nil {
+		p.current.Add(-1)
+		return nil, err
+	}
+
+	out := make(chan provider.StreamEvent, 1)
+	go func() {
+		defer close(out)
+		defer p.current.Add(-1)
+		for event := range ch {
+			out <- event
+		}
+	}()
+	return out, nil
+}
+
+func TestRunPool(t *testing.T) {
+	t.Run("caps the runs in flight", func(t *testing.T) {
+		const maxConcurrent = 2
+		prov := &inFlightProvider{delayedProvider: delayedProvider{delay: 20 * time.Millisecond, content: "done"}}
+		pool := RunPool(maxConcurrent)
+
+		var wg sync.WaitGroup
+		results := make([]string, 6)
+		errs := make([]error, len(results))
+		for i := range results {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				knot := New(
+					Agents(delayedAgent(t, "worker", prov)),
+					Steps(Step("worker", "work")),
+				)
+				execCtx, fut := local[string](noopResultHook[string]{})
+				errs[i] = pool.Run(context.Background(), knot, execCtx)
+				if errs[i] == nil {
+					results[i], errs[i] = fut.Get()
+				}
+			}()
+		}
+		wg.Wait()
+
+		for i := range results {
+			require.NoError(t, errs[i])
+			assert.Equal(t, "done", results[i])
+		}
+		assert.LessOrEqual(t, prov.peak.Load(), int32(maxConcurrent))
+		assert.Equal(t, int32(maxConcurrent), prov.peak.Load(), "the pool should use all its slots")
+	})
+
+	t.Run("cancelled while queued", func(t *testing.T) {
+		prov := &delayedProvider{delay: 200 * time.Millisecond, content: "done"}
+		pool := RunPool(1)
+		knot := New(
+			Agents(delayedAgent(t, "worker", prov)),
+			Steps(Step("worker", "work")),
+		)
+
+		started := make(chan struct{})
+		go func() {
+			execCtx, _ := local[string](noopResultHook[string]{})
+			close(started)
+			_ = pool.Run(context.Background(), knot, execCtx)
+		}()
+		<-started
+		time.Sleep(20 * time.Millisecond)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		execCtx, fut := local[string](noopResultHook[string]{})
+		err := pool.Run(ctx, knot, execCtx)
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+
+		_, err = fut.Get()
+		require.ErrorIs(t, err, context.DeadlineExceeded, "the result of a run that never started should fail")
+	})
+}
@@ -5,8 +5,10 @@ package bubo
 
 import (
 	"context"
+	"errors"
 	"sync"
 
+	"github.com/casualjim/bubo/events"
 	"github.com/casualjim/bubo/internal/executor"
 )
 
@@ -19,6 +21,9 @@ type Future[T any] interface {
 	Get() (T, error)
 }
 
+// errNoResult is the outcome of a run that finished without completing its promise
+var errNoResult = errors.New("run finished without a result")
+
 // deferredPromise implements a promise pattern for handling asynchronous results
 // of type T. It coordinates between the executor's CompletableFuture and the
 // conversation hook, ensuring thread-safe access to results and proper error handling.
@@ -27,16 +32,24 @@ type deferredPromise[T any] struct {
 	hook    Hook[T]                       // Hook for handling results and errors
 	mu      sync.Mutex                    // Mutex for thread-safe access to value and error
 	value   string                        // The raw result value
+	reason  string                        // Why the provider finished the final response
 	err     error                         // Any error that occurred during execution
+	settled bool                          // Whether the run completed or failed the promise
 	once    sync.Once                     // Ensures one-time completion/error setting
 }
 
 // Forward processes the promise's result or error, propagating it to both the
 // CompletableFuture and the hook. This method ensures proper synchronization
 // and handles both successful results and errors appropriately.
+// A run that never completed the promise is reported as errNoResult.
 func (d *deferredPromise[T]) Forward(ctx context.Context) {
 	d.mu.Lock()
 	defer d.mu.Unlock()
+	if !d.settled {
+		d.promise.Error(errNoResult)
+		d.hook.OnError(ctx, errNoResult)
+		return
+	}
 	if d.err != nil {
 		d.promise.Error(d.err)
 		return
@@ -48,9 +61,20 @@ func (d *deferredPromise[T]) Forward(ctx context.Context) {
 		d.hook.OnError(ctx, err)
 		return
 	}
+	if fh, ok := d.hook.(events.FinishReasonHook); ok && d.reason != "" {
+		fh.OnFinishReason(ctx, d.reason)
+	}
 	d.hook.OnResult(ctx, res)
 }
 
+// RecordFinishReason keeps the finish reason of the final response, it's passed to the hook
+// along with the result.
+func (d *deferredPromise[T]) RecordFinishReason(reason string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.reason = reason
+}
+
 // Complete marks the promise as successfully completed with the given result.
 // This method is thread-safe and ensures the result is set only once.
 func (d *deferredPromise[T]) Complete(result string) {
@@ -58,6 +82,7 @@ func (d *deferredPromise[T]) Complete(result string) {
 		d.mu.Lock()
 		defer d.mu.Unlock()
 		d.value = result
+		d.settled = true
 	})
 }
 
@@ -68,6 +93,7 @@ func (d *deferredPromise[T]) Error(err error) {
 		d.mu.Lock()
 		defer d.mu.Unlock()
 		d.err = err
+		d.settled = true
 	})
 }
 
@@ -0,0 +1,68 @@
+package provider
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/casualjim/bubo/messages"
+)
+
+// Capabilities describes the kinds of input a model accepts besides text.
+type Capabilities struct {
+	// ImageInput is true when the model accepts images
+	ImageInput bool
+	// AudioInput is true when the model accepts audio
+	AudioInput bool
+}
+
+// CapableModel is implemented by models that report their capabilities.
+type CapableModel interface {
+	Capabilities() Capabilities
+}
+
+// ValidateMessage checks that the model supports every content part of the message,
+// so unsupported input fails before the request is sent to the provider.
+// Models that don't implement CapableModel are assumed to support all the content.
+//
+// Example:
+//
+//	if err := provider.ValidateMessage(openai.GPT4oMini(), msg.Payload); err != nil {
+//	    // model gpt-4o-mini does not support audio input
+//	}
+func ValidateMessage(model interface{ Name() string }, msg messages.ModelMessage) error {
+	cm, ok := model.(CapableModel)
+	if !ok {
+		return nil
+	}
+	caps := cm.Capabilities()
+
+	unsupported := func(kind string) error {
+		return fmt.Errorf("model %s does not support %s input", model.Name(), kind)
+	}
+	switch m := msg.(type) {
+	case messages.UserMessage:
+		for _, part := range m.Content.Parts {
+			switch part.(type) {
+			case messages.ImageContentPart:
+				if !caps.ImageInput {
+					return unsupported("image")
+				}
+			case messages.AudioContentPart:
+				if !caps.AudioInput {
+					return unsupported("audio")
+				}
+			}
+		}
+	case messages.ToolResponse:
+		if len(m.Data) == 0 {
+			return nil
+		}
+		if strings.HasPrefix(m.MIMEType, "image/") && !caps.ImageInput {
+			return unsupported("image")
+		}
+		if strings.HasPrefix(m.MIMEType, "audio/") && !caps.AudioInput {
+			return unsupported("audio")
+		}
+	}
+	return nil
+}
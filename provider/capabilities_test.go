@@ -0,0 +1,58 @@
+package provider
+
+import (
+	"testing"
+
+	"github.com/casualjim/bubo/messages"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type capableModel struct {
+	name string
+	caps Capabilities
+}
+
+func (m capableModel) Name() string               { return m.name }
+func (m capableModel) Capabilities() Capabilities { return m.caps }
+
+type plainModel struct{}
+
+func (plainModel) Name() string { return "plain" }
+
+func TestValidateMessage(t *testing.T) {
+	vision := capableModel{name: "gpt-4o-mini", caps: Capabilities{ImageInput: true}}
+	textOnly := capableModel{name: "o1-mini"}
+
+	withParts := func(parts ...messages.ContentPart) messages.UserMessage {
+		return messages.UserMessage{Content: messages.ContentOrParts{Parts: parts}}
+	}
+
+	t.Run("vision model receiving audio", func(t *testing.T) {
+		err := ValidateMessage(vision, withParts(messages.Text("listen"), messages.Audio([]byte("RIFF"), "wav")))
+		require.Error(t, err)
+		assert.EqualError(t, err, "model gpt-4o-mini does not support audio input")
+	})
+
+	t.Run("vision model receiving an image", func(t *testing.T) {
+		assert.NoError(t, ValidateMessage(vision, withParts(messages.Image("https://example.com/cat.png"))))
+	})
+
+	t.Run("text model receiving an image", func(t *testing.T) {
+		err := ValidateMessage(textOnly, withParts(messages.Text("look"), messages.Image("https://example.com/cat.png")))
+		assert.EqualError(t, err, "model o1-mini does not support image input")
+	})
+
+	t.Run("text model receiving text", func(t *testing.T) {
+		assert.NoError(t, ValidateMessage(textOnly, messages.UserMessage{Content: messages.ContentOrParts{Content: "hello"}}))
+	})
+
+	t.Run("text model receiving an image from a tool", func(t *testing.T) {
+		err := ValidateMessage(textOnly, messages.ToolResponse{ToolName: "chart", Data: []byte{0x89, 'P', 'N', 'G'}, MIMEType: "image/png"})
+		assert.EqualError(t, err, "model o1-mini does not support image input")
+	})
+
+	t.Run("model without capabilities", func(t *testing.T) {
+		assert.NoError(t, ValidateMessage(plainModel{}, withParts(messages.Audio([]byte("RIFF"), "wav"))))
+	})
+}
@@ -0,0 +1,30 @@
+package provider
+
+import (
+	"github.com/casualjim/bubo/internal/shorttermmemory"
+	json "github.com/goccy/go-json"
+)
+
+// Checkpoint is the snapshot of the conversation that a provider attaches to its responses.
+type Checkpoint = shorttermmemory.Checkpoint
+
+// CheckpointCodec encodes the checkpoints that are handed out to be persisted,
+// so a more compact format like gob or msgpack can be plugged in.
+// The codec of a run is set with the WithCheckpointCodec option of the execution context.
+type CheckpointCodec interface {
+	Encode(Checkpoint) ([]byte, error)
+	Decode(data []byte) (Checkpoint, error)
+}
+
+// JSONCheckpointCodec encodes checkpoints as JSON, it's the default codec.
+type JSONCheckpointCodec struct{}
+
+func (JSONCheckpointCodec) Encode(checkpoint Checkpoint) ([]byte, error) {
+	return json.Marshal(checkpoint)
+}
+
+func (JSONCheckpointCodec) Decode(data []byte) (Checkpoint, error) {
+	var checkpoint Checkpoint
+	err := json.Unmarshal(data, &checkpoint)
+	return checkpoint, err
+}
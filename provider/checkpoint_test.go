@@ -0,0 +1,89 @@
+package provider
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"testing"
+
+	"github.com/casualjim/bubo/internal/shorttermmemory"
+	"github.com/casualjim/bubo/messages"
+	json "github.com/goccy/go-json"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+)
+
+// gzipCodec compresses the JSON encoding of the checkpoints
+type gzipCodec struct{}
+
+func (gzipCodec) Encode(checkpoint Checkpoint) ([]byte, error) {
+	data, err := JSONCheckpointCodec{}.Encode(checkpoint)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gzipCodec) Decode(data []byte) (Checkpoint, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return Checkpoint{}, err
+	}
+	decompressed, err := io.ReadAll(zr)
+	if err != nil {
+		return Checkpoint{}, err
+	}
+	return JSONCheckpointCodec{}.Decode(decompressed)
+}
+
+func TestCheckpointCodec(t *testing.T) {
+	thread := shorttermmemory.New()
+	thread.AddUserPrompt(messages.New().WithSender("user").UserPrompt("my name is Ada"))
+	thread.AddAssistantMessage(messages.New().WithSender("agent").AssistantMessage("Hi Ada"))
+
+	response := Response[messages.AssistantMessage]{
+		RunID:      uuid.New(),
+		TurnID:     thread.ID(),
+		Checkpoint: thread.Checkpoint(),
+		Response:   messages.AssistantMessage{Content: messages.AssistantContentOrParts{Content: "Hi Ada"}},
+	}
+
+	t.Run("responses embed the JSON checkpoint", func(t *testing.T) {
+		data, err := json.Marshal(response)
+		require.NoError(t, err)
+		assert.True(t, gjson.GetBytes(data, "checkpoint").IsObject())
+	})
+
+	t.Run("custom codec", func(t *testing.T) {
+		var codec CheckpointCodec = gzipCodec{}
+		data, err := codec.Encode(response.Checkpoint)
+		require.NoError(t, err)
+		assert.False(t, gjson.ValidBytes(data), "the checkpoint is binary")
+
+		decoded, err := codec.Decode(data)
+		require.NoError(t, err)
+		assert.Equal(t, thread.ID(), decoded.ID())
+		restored := decoded.Messages()
+		require.Len(t, restored, 2)
+		for i, msg := range thread.Messages() {
+			assert.Equal(t, msg.MessageID, restored[i].MessageID)
+			assert.Equal(t, msg.Sender, restored[i].Sender)
+			assert.Equal(t, msg.Payload, restored[i].Payload)
+		}
+
+		// the checkpoint can be resumed into a new thread
+		resumed := shorttermmemory.New()
+		decoded.MergeInto(resumed)
+		assert.Equal(t, 2, resumed.Len())
+	})
+}
@@ -0,0 +1,123 @@
+package provider
+
+import (
+	"fmt"
+
+	"github.com/casualjim/bubo/messages"
+	"github.com/go-openapi/strfmt"
+	"github.com/google/uuid"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+var contentFilterJSON = []byte(`{"type":"content_filter"}`)
+
+// ContentFilter is emitted when the provider's content filter flagged the output of a turn.
+// It is sent before the response of the turn, which may be empty or truncated.
+type ContentFilter struct {
+	RunID  uuid.UUID `json:"run_id"`
+	TurnID uuid.UUID `json:"turn_id"`
+	// Categories are the policy categories that were flagged, e.g. hate, violence or self_harm.
+	// It is empty when the provider didn't say why the output was filtered.
+	Categories   []string        `json:"categories,omitempty"`
+	FinishReason string          `json:"finish_reason,omitempty"`
+	Timestamp    strfmt.DateTime `json:"timestamp,omitempty"`
+	Meta         gjson.Result    `json:"meta,omitempty"`
+}
+
+func (ContentFilter) streamEvent() {}
+
+// MarshalJSON implements custom JSON marshaling for ContentFilter
+func (c ContentFilter) MarshalJSON() ([]byte, error) {
+	result := contentFilterJSON
+
+	var err error
+	result, err = sjson.SetBytes(result, "run_id", c.RunID.String())
+	if err != nil {
+		return nil, err
+	}
+
+	result, err = sjson.SetBytes(result, "turn_id", c.TurnID.String())
+	if err != nil {
+		return nil, err
+	}
+
+	if len(c.Categories) > 0 {
+		result, err = sjson.SetBytes(result, "categories", c.Categories)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if c.FinishReason != "" {
+		result, err = sjson.SetBytes(result, "finish_reason", c.FinishReason)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if !c.Timestamp.IsZero() {
+		result, err = sjson.SetBytes(result, "timestamp", messages.MarshalTimestamp(c.Timestamp))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if c.Meta.Exists() {
+		result, err = sjson.SetRawBytes(result, "meta", []byte(c.Meta.Raw))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+// UnmarshalJSON implements custom JSON unmarshaling for ContentFilter
+func (c *ContentFilter) UnmarshalJSON(data []byte) error {
+	if !gjson.ValidBytes(data) {
+		return fmt.Errorf("invalid json: %s", data)
+	}
+
+	msgType := gjson.GetBytes(data, "type")
+	if !msgType.Exists() || msgType.String() != "content_filter" {
+		return fmt.Errorf("missing or invalid type, expected 'content_filter'")
+	}
+
+	runID := gjson.GetBytes(data, "run_id")
+	if !runID.Exists() {
+		return fmt.Errorf("missing required field 'run_id'")
+	}
+	if err := c.RunID.UnmarshalText([]byte(runID.String())); err != nil {
+		return fmt.Errorf("invalid run_id: %w", err)
+	}
+
+	turnID := gjson.GetBytes(data, "turn_id")
+	if !turnID.Exists() {
+		return fmt.Errorf("missing required field 'turn_id'")
+	}
+	if err := c.TurnID.UnmarshalText([]byte(turnID.String())); err != nil {
+		return fmt.Errorf("invalid turn_id: %w", err)
+	}
+
+	c.Categories = nil
+	for _, category := range gjson.GetBytes(data, "categories").Array() {
+		c.Categories = append(c.Categories, category.String())
+	}
+
+	if finishReason := gjson.GetBytes(data, "finish_reason"); finishReason.Exists() {
+		c.FinishReason = finishReason.String()
+	}
+
+	if timestamp := gjson.GetBytes(data, "timestamp"); timestamp.Exists() {
+		if err := messages.UnmarshalTimestamp(timestamp, &c.Timestamp); err != nil {
+			return fmt.Errorf("invalid timestamp: %w", err)
+		}
+	}
+
+	if meta := gjson.GetBytes(data, "meta"); meta.Exists() {
+		c.Meta = meta
+	}
+
+	return nil
+}
@@ -17,7 +17,7 @@
 //   - Checkpoint: Captures conversation state for context management
 //
 // The streaming architecture uses four main event types:
-//  1. Delim: Delimiter events marking stream boundaries
+//  1. Delim: Delimiter events marking stream, content and tool call boundaries
 //  2. Chunk: Incremental response fragments
 //  3. Response: Complete responses with checkpoints
 //  4. Error: Error events with preserved context
@@ -44,7 +44,11 @@
 //	    case Response[messages.AssistantMessage]:
 //	        // Handle complete response
 //	    case Error:
-//	        // Handle error with context
+//	        // Handle error with context, the category tells how to recover
+//	        var rateErr *RateLimitError
+//	        if errors.As(e, &rateErr) {
+//	            time.Sleep(rateErr.RetryAfter)
+//	        }
 //	    }
 //	}
 //
@@ -0,0 +1,84 @@
+package provider
+
+import (
+	"fmt"
+	"time"
+)
+
+// The errors below categorize the failures of a provider, so callers can decide how to recover
+// with errors.As, for example retrying after a RateLimitError or falling back to another model
+// after a ServerError. Providers wrap the error of their client, it's available with errors.Unwrap.
+
+// AuthError is returned when the provider rejects the credentials, retrying won't help.
+type AuthError struct {
+	StatusCode int
+	Err        error
+}
+
+func (e *AuthError) Error() string {
+	return fmt.Sprintf("authentication failed: %v", e.Err)
+}
+
+func (e *AuthError) Unwrap() error {
+	return e.Err
+}
+
+// RateLimitError is returned when the provider throttles the requests.
+// RetryAfter is how long the provider asked to wait before the next request, zero when it didn't say.
+type RateLimitError struct {
+	RetryAfter time.Duration
+	Err        error
+}
+
+func (e *RateLimitError) Error() string {
+	if e.RetryAfter > 0 {
+		return fmt.Sprintf("rate limited, retry after %s: %v", e.RetryAfter, e.Err)
+	}
+	return fmt.Sprintf("rate limited: %v", e.Err)
+}
+
+func (e *RateLimitError) Unwrap() error {
+	return e.Err
+}
+
+// InvalidRequestError is returned when the provider rejects the request itself,
+// like an unknown model or a context that is too long. The same request fails again.
+type InvalidRequestError struct {
+	StatusCode int
+	Err        error
+}
+
+func (e *InvalidRequestError) Error() string {
+	return fmt.Sprintf("invalid request: %v", e.Err)
+}
+
+func (e *InvalidRequestError) Unwrap() error {
+	return e.Err
+}
+
+// ServerError is returned when the provider failed to handle the request, it's usually transient.
+type ServerError struct {
+	StatusCode int
+	Err        error
+}
+
+func (e *ServerError) Error() string {
+	return fmt.Sprintf("server error: %v", e.Err)
+}
+
+func (e *ServerError) Unwrap() error {
+	return e.Err
+}
+
+// NetworkError is returned when the provider couldn't be reached or the connection dropped.
+type NetworkError struct {
+	Err error
+}
+
+func (e *NetworkError) Error() string {
+	return fmt.Sprintf("network error: %v", e.Err)
+}
+
+func (e *NetworkError) Unwrap() error {
+	return e.Err
+}
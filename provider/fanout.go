@@ -0,0 +1,200 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/casualjim/bubo/messages"
+)
+
+// Fanout creates an ensemble that sends the same completion request to all the given
+// providers concurrently, to merge their event streams or pick a single response.
+func Fanout(providers ...Provider) *Ensemble {
+	return &Ensemble{providers: providers}
+}
+
+// Ensemble queries several providers with the same request, it's created with Fanout.
+//
+// An ensemble isn't a Provider: its merged stream holds a pair of delimiters and a response
+// for every provider, which the executors can't consume. Use First or Majority to pick
+// a single response from it.
+type Ensemble struct {
+	providers []Provider
+}
+
+// Stream sends the request to all the providers and merges their event streams into a single channel.
+//
+// Every chunk, response and error on the merged stream is tagged with its source in
+// the event metadata: "provider" holds the name of the provider and "provider_index"
+// its position in the list of providers. Delimiters are forwarded as-is.
+//
+// The providers run until their streams end or the context is cancelled, cancel the context
+// when the merged stream isn't read to the end.
+func (e *Ensemble) Stream(ctx context.Context, params CompletionParams) (<-chan StreamEvent, error) {
+	if len(e.providers) == 0 {
+		return nil, errors.New("fanout requires at least one provider")
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	streams := make([]<-chan StreamEvent, len(e.providers))
+	for i, p := range e.providers {
+		stream, err := p.ChatCompletion(ctx, params)
+		if err != nil {
+			// stop the providers that already started and release their streams
+			cancel()
+			for _, started := range streams[:i] {
+				go drain(started)
+			}
+			return nil, fmt.Errorf("provider %s failed to start completion: %w", providerName(p), err)
+		}
+		streams[i] = stream
+	}
+
+	merged := make(chan StreamEvent, 10*len(streams))
+	var wg sync.WaitGroup
+	wg.Add(len(streams))
+	for i, stream := range streams {
+		go func() {
+			defer wg.Done()
+			// a provider that doesn't watch the context can't block on a stream nobody reads
+			defer drain(stream)
+			name := providerName(e.providers[i])
+			for event := range stream {
+				select {
+				case merged <- tagEvent(event, name, i):
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		cancel()
+		close(merged)
+	}()
+
+	return merged, nil
+}
+
+// First sends the request to all the providers and returns the first complete assistant response,
+// the other providers are cancelled as soon as it arrives.
+func (e *Ensemble) First(ctx context.Context, params CompletionParams) (Response[messages.AssistantMessage], error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	events, err := e.Stream(ctx, params)
+	if err != nil {
+		return Response[messages.AssistantMessage]{}, err
+	}
+	return First(ctx, events)
+}
+
+// Majority sends the request to all the providers and returns the assistant response
+// whose content was produced by the most providers.
+func (e *Ensemble) Majority(ctx context.Context, params CompletionParams) (Response[messages.AssistantMessage], error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	events, err := e.Stream(ctx, params)
+	if err != nil {
+		return Response[messages.AssistantMessage]{}, err
+	}
+	return Majority(ctx, events)
+}
+
+// First returns the first complete assistant response on the stream.
+// It returns an error when the stream ends without producing an assistant response.
+// The rest of the stream is drained in the background, cancel the context of the stream
+// to stop its producers.
+func First(ctx context.Context, events <-chan StreamEvent) (Response[messages.AssistantMessage], error) {
+	var errs error
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return Response[messages.AssistantMessage]{}, noResponseErr(errs)
+			}
+			switch event := event.(type) {
+			case Response[messages.AssistantMessage]:
+				go drain(events)
+				return event, nil
+			case Error:
+				errs = errors.Join(errs, event)
+			}
+		case <-ctx.Done():
+			go drain(events)
+			return Response[messages.AssistantMessage]{}, ctx.Err()
+		}
+	}
+}
+
+// Majority waits for the stream to end and returns the assistant response whose content
+// was produced by the most providers. Ties are resolved in favor of the earliest response.
+// It returns an error when the stream ends without producing an assistant response.
+func Majority(ctx context.Context, events <-chan StreamEvent) (Response[messages.AssistantMessage], error) {
+	var errs error
+	var responses []Response[messages.AssistantMessage]
+	votes := make(map[string]int)
+
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				if len(responses) == 0 {
+					return Response[messages.AssistantMessage]{}, noResponseErr(errs)
+				}
+
+				winner := responses[0]
+				for _, resp := range responses[1:] {
+					if votes[responseKey(resp)] > votes[responseKey(winner)] {
+						winner = resp
+					}
+				}
+				return winner, nil
+			}
+			switch event := event.(type) {
+			case Response[messages.AssistantMessage]:
+				responses = append(responses, event)
+				votes[responseKey(event)]++
+			case Error:
+				errs = errors.Join(errs, event)
+			}
+		case <-ctx.Done():
+			go drain(events)
+			return Response[messages.AssistantMessage]{}, ctx.Err()
+		}
+	}
+}
+
+// drain reads the stream to the end so its producer isn't blocked
+func drain(events <-chan StreamEvent) {
+	for range events {
+	}
+}
+
+func noResponseErr(errs error) error {
+	if errs != nil {
+		return fmt.Errorf("no assistant response: %w", errs)
+	}
+	return errors.New("no assistant response")
+}
+
+func responseKey(resp Response[messages.AssistantMessage]) string {
+	return strings.TrimSpace(resp.Response.Content.Content)
+}
+
+func providerName(p Provider) string {
+	if s, ok := p.(fmt.Stringer); ok {
+		return s.String()
+	}
+	return fmt.Sprintf("%T", p)
+}
+
+func tagEvent(event StreamEvent, name string, index int) StreamEvent {
+	return WithMeta(WithMeta(event, "provider", name), "provider_index", index)
+}
@@ -0,0 +1,189 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/casualjim/bubo/messages"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeProvider struct {
+	name   string
+	events []StreamEvent
+	err    error
+}
+
+func (f *fakeProvider) String() string { return f.name }
+
+func (f *fakeProvider) ChatCompletion(context.Context, CompletionParams) (<-chan StreamEvent, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	ch := make(chan StreamEvent, len(f.events))
+	for _, event := range f.events {
+		ch <- event
+	}
+	close(ch)
+	return ch, nil
+}
+
+func assistantResponse(content string) Response[messages.AssistantMessage] {
+	return Response[messages.AssistantMessage]{
+		Response: messages.AssistantMessage{
+			Content: messages.AssistantContentOrParts{Content: content},
+		},
+	}
+}
+
+func assistantChunk(content string) Chunk[messages.AssistantMessage] {
+	return Chunk[messages.AssistantMessage]{
+		Chunk: messages.AssistantMessage{
+			Content: messages.AssistantContentOrParts{Content: content},
+		},
+	}
+}
+
+func TestFanout_TagsAndMergesStreams(t *testing.T) {
+	p := Fanout(
+		&fakeProvider{name: "first", events: []StreamEvent{assistantChunk("hel"), assistantResponse("hello")}},
+		&fakeProvider{name: "second", events: []StreamEvent{assistantChunk("hi"), assistantResponse("hi")}},
+	)
+
+	events, err := p.Stream(context.Background(), CompletionParams{})
+	require.NoError(t, err)
+
+	indexes := map[string]int64{"first": 0, "second": 1}
+	sources := make(map[string][]string)
+	for event := range events {
+		switch e := event.(type) {
+		case Chunk[messages.AssistantMessage]:
+			name := e.Meta.Get("provider").String()
+			assert.Equal(t, indexes[name], e.Meta.Get("provider_index").Int())
+			sources[name] = append(sources[name], "chunk:"+e.Chunk.Content.Content)
+		case Response[messages.AssistantMessage]:
+			name := e.Meta.Get("provider").String()
+			assert.Equal(t, indexes[name], e.Meta.Get("provider_index").Int())
+			sources[name] = append(sources[name], "response:"+e.Response.Content.Content)
+		default:
+			t.Fatalf("unexpected event %T", event)
+		}
+	}
+
+	assert.Equal(t, map[string][]string{
+		"first":  {"chunk:hel", "response:hello"},
+		"second": {"chunk:hi", "response:hi"},
+	}, sources)
+}
+
+// blockingProvider streams nothing until its context is cancelled
+type blockingProvider struct {
+	cancelled chan struct{}
+}
+
+func newBlockingProvider() *blockingProvider {
+	return &blockingProvider{cancelled: make(chan struct{})}
+}
+
+func (b *blockingProvider) ChatCompletion(ctx context.Context, _ CompletionParams) (<-chan StreamEvent, error) {
+	ch := make(chan StreamEvent)
+	go func() {
+		defer close(ch)
+		<-ctx.Done()
+		close(b.cancelled)
+	}()
+	return ch, nil
+}
+
+func requireCancelled(t *testing.T, p *blockingProvider) {
+	t.Helper()
+	select {
+	case <-p.cancelled:
+	case <-time.After(time.Second):
+		t.Fatal("the provider wasn't cancelled")
+	}
+}
+
+func TestFanout_StartError(t *testing.T) {
+	started := newBlockingProvider()
+	p := Fanout(
+		started,
+		&fakeProvider{name: "broken", err: errors.New("boom")},
+	)
+
+	_, err := p.Stream(context.Background(), CompletionParams{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "broken")
+	requireCancelled(t, started)
+}
+
+func TestEnsemble_FirstCancelsOtherProviders(t *testing.T) {
+	slow := newBlockingProvider()
+	p := Fanout(
+		slow,
+		&fakeProvider{name: "fast", events: []StreamEvent{assistantResponse("hi")}},
+	)
+
+	resp, err := p.First(context.Background(), CompletionParams{})
+	require.NoError(t, err)
+	assert.Equal(t, "fast", resp.Meta.Get("provider").String())
+	requireCancelled(t, slow)
+}
+
+func TestEnsemble_Majority(t *testing.T) {
+	p := Fanout(
+		&fakeProvider{name: "a", events: []StreamEvent{assistantResponse("yes")}},
+		&fakeProvider{name: "b", events: []StreamEvent{assistantResponse("no")}},
+		&fakeProvider{name: "c", events: []StreamEvent{assistantResponse("no")}},
+	)
+
+	resp, err := p.Majority(context.Background(), CompletionParams{})
+	require.NoError(t, err)
+	assert.Equal(t, "no", responseKey(resp))
+}
+
+func TestFirst(t *testing.T) {
+	p := Fanout(
+		&fakeProvider{name: "first", events: []StreamEvent{Error{Err: errors.New("boom")}}},
+		&fakeProvider{name: "second", events: []StreamEvent{assistantResponse("hi")}},
+	)
+
+	events, err := p.Stream(context.Background(), CompletionParams{})
+	require.NoError(t, err)
+
+	resp, err := First(context.Background(), events)
+	require.NoError(t, err)
+	assert.Equal(t, "hi", resp.Response.Content.Content)
+	assert.Equal(t, "second", resp.Meta.Get("provider").String())
+}
+
+func TestMajority(t *testing.T) {
+	p := Fanout(
+		&fakeProvider{name: "a", events: []StreamEvent{assistantResponse("yes")}},
+		&fakeProvider{name: "b", events: []StreamEvent{assistantResponse("no")}},
+		&fakeProvider{name: "c", events: []StreamEvent{assistantResponse(" no ")}},
+	)
+
+	events, err := p.Stream(context.Background(), CompletionParams{})
+	require.NoError(t, err)
+
+	resp, err := Majority(context.Background(), events)
+	require.NoError(t, err)
+	assert.Equal(t, "no", responseKey(resp))
+}
+
+func TestMajority_NoResponse(t *testing.T) {
+	p := Fanout(
+		&fakeProvider{name: "a", events: []StreamEvent{Error{Err: errors.New("boom")}}},
+	)
+
+	events, err := p.Stream(context.Background(), CompletionParams{})
+	require.NoError(t, err)
+
+	_, err = Majority(context.Background(), events)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "boom")
+}
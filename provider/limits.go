@@ -0,0 +1,105 @@
+package provider
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/casualjim/bubo/messages"
+	"github.com/casualjim/bubo/pkg/stdx"
+	"github.com/fogfish/opts"
+)
+
+// ContentLimits caps the number and size of the media parts a single message may contain.
+// Providers reject requests with too many images, the limits let them fail before the request is sent.
+// A zero limit means there is no limit.
+type ContentLimits struct {
+	// MaxImagesPerMessage is the maximum number of image parts in a message
+	MaxImagesPerMessage int
+	// MaxAudioPerMessage is the maximum number of audio parts in a message
+	MaxAudioPerMessage int
+	// MaxInlineBytes is the maximum size of the data that is sent inline, like audio data,
+	// images in data URLs and the files returned by tools
+	MaxInlineBytes int
+}
+
+// LimitOption configures the content limits of a provider.
+type LimitOption = opts.Option[ContentLimits]
+
+var (
+	// WithMaxImagesPerMessage limits the number of image parts in a user message.
+	WithMaxImagesPerMessage = opts.ForName[ContentLimits, int]("MaxImagesPerMessage")
+	// WithMaxAudioPerMessage limits the number of audio parts in a user message.
+	WithMaxAudioPerMessage = opts.ForName[ContentLimits, int]("MaxAudioPerMessage")
+	// WithMaxInlineBytes limits the size of the inline data of a content part or tool response.
+	WithMaxInlineBytes = opts.ForName[ContentLimits, int]("MaxInlineBytes")
+)
+
+// NewContentLimits creates the content limits from the options.
+//
+// Example:
+//
+//	limits := provider.NewContentLimits(provider.WithMaxImagesPerMessage(10))
+func NewContentLimits(options ...LimitOption) ContentLimits {
+	var limits ContentLimits
+	stdx.Must0(opts.Apply(&limits, options))
+	return limits
+}
+
+// Validate checks that the message doesn't contain more image or audio parts than allowed,
+// and that their inline data isn't larger than allowed.
+func (l ContentLimits) Validate(msg messages.UserMessage) error {
+	var images, audio int
+	for _, part := range msg.Content.Parts {
+		switch p := part.(type) {
+		case messages.ImageContentPart:
+			images++
+			if err := l.checkInlineImage(p.URL); err != nil {
+				return err
+			}
+		case *messages.ImageContentPart:
+			images++
+			if err := l.checkInlineImage(p.URL); err != nil {
+				return err
+			}
+		case messages.AudioContentPart:
+			audio++
+			if err := l.checkInline("audio part", len(p.InputAudio.Data)); err != nil {
+				return err
+			}
+		case *messages.AudioContentPart:
+			audio++
+			if err := l.checkInline("audio part", len(p.InputAudio.Data)); err != nil {
+				return err
+			}
+		}
+	}
+
+	if l.MaxImagesPerMessage > 0 && images > l.MaxImagesPerMessage {
+		return fmt.Errorf("message has %d image parts, at most %d are allowed", images, l.MaxImagesPerMessage)
+	}
+	if l.MaxAudioPerMessage > 0 && audio > l.MaxAudioPerMessage {
+		return fmt.Errorf("message has %d audio parts, at most %d are allowed", audio, l.MaxAudioPerMessage)
+	}
+	return nil
+}
+
+// ValidateToolResponse checks that the file returned by a tool isn't larger than allowed inline.
+func (l ContentLimits) ValidateToolResponse(msg messages.ToolResponse) error {
+	return l.checkInline(fmt.Sprintf("file of tool %s", msg.ToolName), len(msg.Data))
+}
+
+// checkInlineImage checks the size of images that are sent inline as a data URL,
+// images that are referenced by URL aren't limited.
+func (l ContentLimits) checkInlineImage(url string) error {
+	if !strings.HasPrefix(url, "data:") {
+		return nil
+	}
+	return l.checkInline("image data URL", len(url))
+}
+
+func (l ContentLimits) checkInline(what string, size int) error {
+	if l.MaxInlineBytes > 0 && size > l.MaxInlineBytes {
+		return fmt.Errorf("%s is %d bytes, at most %d bytes are allowed inline", what, size, l.MaxInlineBytes)
+	}
+	return nil
+}
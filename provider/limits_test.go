@@ -0,0 +1,50 @@
+package provider
+
+import (
+	"testing"
+
+	"github.com/casualjim/bubo/messages"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContentLimits(t *testing.T) {
+	withParts := func(parts ...messages.ContentPart) messages.UserMessage {
+		return messages.UserMessage{Content: messages.ContentOrParts{Parts: parts}}
+	}
+	twoImages := withParts(messages.Image("https://example.com/1.png"), messages.Image("https://example.com/2.png"))
+
+	t.Run("too many images", func(t *testing.T) {
+		limits := NewContentLimits(WithMaxImagesPerMessage(1))
+		assert.EqualError(t, limits.Validate(twoImages), "message has 2 image parts, at most 1 are allowed")
+	})
+
+	t.Run("too many audio parts", func(t *testing.T) {
+		limits := NewContentLimits(WithMaxAudioPerMessage(1))
+		msg := withParts(messages.Audio([]byte("RIFF"), "wav"), messages.Audio([]byte("RIFF"), "wav"))
+		assert.EqualError(t, limits.Validate(msg), "message has 2 audio parts, at most 1 are allowed")
+	})
+
+	t.Run("within the limits", func(t *testing.T) {
+		limits := NewContentLimits(WithMaxImagesPerMessage(2), WithMaxAudioPerMessage(1))
+		assert.NoError(t, limits.Validate(twoImages))
+	})
+
+	t.Run("inline data too large", func(t *testing.T) {
+		limits := NewContentLimits(WithMaxInlineBytes(16))
+
+		audio := withParts(messages.Audio(make([]byte, 32), "wav"))
+		assert.EqualError(t, limits.Validate(audio), "audio part is 32 bytes, at most 16 bytes are allowed inline")
+
+		image := withParts(messages.Image("data:image/png;base64,iVBORw0KGgoAAAANSUhEUg=="))
+		assert.EqualError(t, limits.Validate(image), "image data URL is 46 bytes, at most 16 bytes are allowed inline")
+
+		file := messages.ToolResponse{ToolName: "render", Data: make([]byte, 17), MIMEType: "application/pdf"}
+		assert.EqualError(t, limits.ValidateToolResponse(file), "file of tool render is 17 bytes, at most 16 bytes are allowed inline")
+
+		assert.NoError(t, limits.Validate(twoImages), "images referenced by URL aren't inline")
+	})
+
+	t.Run("no limits", func(t *testing.T) {
+		assert.NoError(t, NewContentLimits().Validate(twoImages))
+	})
+}
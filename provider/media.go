@@ -0,0 +1,145 @@
+package provider
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/casualjim/bubo/messages"
+)
+
+// UnreachableMediaPolicy decides what happens to an image that can't be fetched
+// when a provider loads the media of a message before sending it.
+type UnreachableMediaPolicy uint8
+
+const (
+	// UnreachableMediaError fails the request when an image can't be fetched
+	UnreachableMediaError UnreachableMediaPolicy = iota + 1
+	// UnreachableMediaSkip leaves images that can't be fetched out of the message
+	UnreachableMediaSkip
+	// UnreachableMediaAltText replaces images that can't be fetched with their alt text,
+	// images without alt text are left out
+	UnreachableMediaAltText
+)
+
+func (p UnreachableMediaPolicy) String() string {
+	switch p {
+	case UnreachableMediaError:
+		return "error"
+	case UnreachableMediaSkip:
+		return "skip"
+	case UnreachableMediaAltText:
+		return "alt_text"
+	default:
+		return "none"
+	}
+}
+
+// DefaultMaxInlineMediaBytes bounds the size of the images InlineMedia fetches when no limit is given.
+const DefaultMaxInlineMediaBytes = 20 << 20
+
+// InlineMedia fetches the images of the message that are referenced by an http(s) URL and
+// embeds them as data URLs, so the model doesn't have to fetch them itself.
+// Images larger than maxBytes, or that aren't served with an image content type, count as
+// images that can't be fetched and are handled according to the policy.
+// A maxBytes <= 0 uses DefaultMaxInlineMediaBytes.
+func InlineMedia(ctx context.Context, client *http.Client, policy UnreachableMediaPolicy, maxBytes int, msg messages.UserMessage) (messages.UserMessage, error) {
+	if len(msg.Content.Parts) == 0 {
+		return msg, nil
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	if maxBytes <= 0 {
+		maxBytes = DefaultMaxInlineMediaBytes
+	}
+
+	parts := make([]messages.ContentPart, 0, len(msg.Content.Parts))
+	for _, part := range msg.Content.Parts {
+		var image messages.ImageContentPart
+		switch p := part.(type) {
+		case messages.ImageContentPart:
+			image = p
+		case *messages.ImageContentPart:
+			image = *p
+		default:
+			parts = append(parts, part)
+			continue
+		}
+		if !isHTTPURL(image.URL) {
+			parts = append(parts, part)
+			continue
+		}
+
+		dataURL, err := fetchDataURL(ctx, client, image.URL, maxBytes)
+		if err == nil {
+			image.URL = dataURL
+			if _, isPtr := part.(*messages.ImageContentPart); isPtr {
+				parts = append(parts, &image)
+			} else {
+				parts = append(parts, image)
+			}
+			continue
+		}
+
+		switch policy {
+		case UnreachableMediaSkip:
+		case UnreachableMediaAltText:
+			if image.AltText != "" {
+				parts = append(parts, messages.Text(image.AltText))
+			}
+		default:
+			return msg, err
+		}
+	}
+
+	msg.Content = messages.ContentOrParts{Content: msg.Content.Content, Parts: parts}
+	return msg, nil
+}
+
+func isHTTPURL(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	return (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+func fetchDataURL(ctx context.Context, client *http.Client, imageURL string, maxBytes int) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, imageURL, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch image %s: %w", imageURL, err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch image %s: %w", imageURL, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return "", fmt.Errorf("failed to fetch image %s: %s", imageURL, resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, int64(maxBytes)+1))
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch image %s: %w", imageURL, err)
+	}
+	if len(data) > maxBytes {
+		return "", fmt.Errorf("failed to fetch image %s: it's larger than %d bytes", imageURL, maxBytes)
+	}
+
+	mimeType := http.DetectContentType(data)
+	if contentType := resp.Header.Get("Content-Type"); contentType != "" {
+		if mimeType, _, err = mime.ParseMediaType(contentType); err != nil {
+			return "", fmt.Errorf("failed to fetch image %s: invalid content type %q: %w", imageURL, contentType, err)
+		}
+	}
+	if !strings.HasPrefix(mimeType, "image/") {
+		return "", fmt.Errorf("failed to fetch image %s: content type %s is not an image", imageURL, mimeType)
+	}
+	return fmt.Sprintf("data:%s;base64,%s", mimeType, base64.StdEncoding.EncodeToString(data)), nil
+}
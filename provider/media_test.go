@@ -0,0 +1,85 @@
+package provider
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/casualjim/bubo/messages"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInlineMedia(t *testing.T) {
+	png := []byte("\x89PNG\r\n\x1a\n")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/cat.png":
+			w.Header().Set("Content-Type", "image/png; charset=binary")
+			_, _ = w.Write(png)
+		case "/large.png":
+			w.Header().Set("Content-Type", "image/png")
+			_, _ = w.Write([]byte(strings.Repeat("x", 64)))
+		case "/page.html":
+			w.Header().Set("Content-Type", "text/html")
+			_, _ = w.Write([]byte("<html></html>"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	dataURL := "data:image/png;base64," + base64.StdEncoding.EncodeToString(png)
+	withParts := func(parts ...messages.ContentPart) messages.UserMessage {
+		return messages.UserMessage{Content: messages.ContentOrParts{Parts: parts}}
+	}
+
+	t.Run("value and pointer parts", func(t *testing.T) {
+		msg := withParts(
+			messages.ImageContentPart{URL: server.URL + "/cat.png"},
+			&messages.ImageContentPart{URL: server.URL + "/cat.png"},
+		)
+		inlined, err := InlineMedia(context.Background(), nil, UnreachableMediaError, 0, msg)
+		require.NoError(t, err)
+		require.Len(t, inlined.Content.Parts, 2)
+		assert.Equal(t, dataURL, inlined.Content.Parts[0].(messages.ImageContentPart).URL)
+		assert.Equal(t, dataURL, inlined.Content.Parts[1].(*messages.ImageContentPart).URL)
+		assert.Equal(t, server.URL+"/cat.png", msg.Content.Parts[1].(*messages.ImageContentPart).URL, "the original part is left alone")
+	})
+
+	t.Run("larger than the limit", func(t *testing.T) {
+		msg := withParts(messages.ImageContentPart{URL: server.URL + "/large.png", AltText: "a large image"})
+
+		_, err := InlineMedia(context.Background(), nil, UnreachableMediaError, 32, msg)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "larger than 32 bytes")
+
+		inlined, err := InlineMedia(context.Background(), nil, UnreachableMediaAltText, 32, msg)
+		require.NoError(t, err)
+		assert.Equal(t, []messages.ContentPart{messages.Text("a large image")}, inlined.Content.Parts)
+
+		inlined, err = InlineMedia(context.Background(), nil, UnreachableMediaError, 64, msg)
+		require.NoError(t, err)
+		assert.True(t, strings.HasPrefix(inlined.Content.Parts[0].(messages.ImageContentPart).URL, "data:image/png;base64,"))
+	})
+
+	t.Run("not an image", func(t *testing.T) {
+		msg := withParts(messages.ImageContentPart{URL: server.URL + "/page.html"})
+		_, err := InlineMedia(context.Background(), nil, UnreachableMediaError, 0, msg)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "text/html is not an image")
+	})
+
+	t.Run("only http urls are fetched", func(t *testing.T) {
+		msg := withParts(
+			messages.ImageContentPart{URL: "file:///etc/passwd"},
+			messages.ImageContentPart{URL: dataURL},
+		)
+		inlined, err := InlineMedia(context.Background(), nil, UnreachableMediaError, 0, msg)
+		require.NoError(t, err)
+		assert.Equal(t, msg.Content.Parts, inlined.Content.Parts)
+	})
+}
@@ -48,10 +48,74 @@ type CompletionParams struct {
 	// Tools defines the available functions/capabilities the AI can use
 	Tools []tool.Definition
 
+	// UserID identifies the end-user on whose behalf the request is made.
+	// When set, it overrides the value derived from the sender of the user messages.
+	UserID string
+
+	// HashUserID indicates whether the user identifier should be hashed before
+	// it is sent to the provider, so the raw value never leaves the process.
+	HashUserID bool
+
+	// AssistantPrefill seeds the start of the assistant's response to steer its format.
+	// Providers that don't support prefilling ignore it and log a warning.
+	AssistantPrefill string
+
+	// StopSequences are sequences where the provider stops generating further tokens.
+	// The returned content does not contain the stop sequence.
+	StopSequences []string
+
+	// IncludeStreamUsage asks the provider to report the token usage of a streamed completion.
+	// Providers that support it add the usage to the metadata of the response under "usage".
+	IncludeStreamUsage bool
+
+	// ModelParams are the generation parameters like the temperature, unset parameters
+	// are left to the defaults of the provider.
+	ModelParams ModelParams
+
+	// Modalities are the kinds of output the model should generate, e.g. text and audio.
+	// Models that only generate text don't need it.
+	Modalities []string
+
+	// Audio configures the audio output, it's required when the modalities include audio.
+	Audio *AudioConfig
+
 	// Prevents unkeyed literals
 	_ struct{}
 }
 
+// AudioConfig configures the audio that is generated by models with audio output.
+type AudioConfig struct {
+	// Voice is the voice the model uses, e.g. alloy
+	Voice string `json:"voice"`
+	// Format is the format of the audio, e.g. wav or mp3
+	Format string `json:"format"`
+}
+
+// ModelParams are the generation parameters of a completion.
+// Nil fields are not set, so the provider uses its own default for them.
+type ModelParams struct {
+	// Temperature controls the randomness of the output, lower is more deterministic
+	Temperature *float64 `json:"temperature,omitempty"`
+	// TopP samples from the tokens that make up the top p probability mass
+	TopP *float64 `json:"top_p,omitempty"`
+	// MaxTokens limits the number of tokens that are generated
+	MaxTokens *int64 `json:"max_tokens,omitempty"`
+}
+
+// Merge returns the parameters with the fields that are set in override replacing their own.
+func (p ModelParams) Merge(override ModelParams) ModelParams {
+	if override.Temperature != nil {
+		p.Temperature = override.Temperature
+	}
+	if override.TopP != nil {
+		p.TopP = override.TopP
+	}
+	if override.MaxTokens != nil {
+		p.MaxTokens = override.MaxTokens
+	}
+	return p
+}
+
 // StructuredOutput defines a schema for formatted AI responses.
 // This allows requesting responses in specific formats for easier parsing
 // and validation.
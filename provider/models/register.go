@@ -23,3 +23,19 @@ func GetOrAdd(name string, modelF func() api.Model) api.Model {
 func Del(name string) {
 	Global.Del(name)
 }
+
+// List returns the names of all the registered models
+func List() []string {
+	return Global.List()
+}
+
+// Clear removes all the registered models
+func Clear() {
+	Global.Clear()
+}
+
+// SetMaxSize bounds the number of registered models, evicting the least recently used ones
+// that were added with GetOrAdd. A value <= 0 removes the bound.
+func SetMaxSize(n int) {
+	Global.SetMaxSize(n)
+}
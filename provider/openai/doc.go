@@ -66,7 +66,7 @@ The package supports various message types:
 The package implements efficient streaming:
 
 1. Event Types
-  - Delim: Stream boundary markers
+  - Delim: Stream, content and tool call boundary markers
   - Chunk: Incremental response pieces
   - Response: Complete messages
   - Error: Error events with context
@@ -143,7 +143,7 @@ The package is designed to be thread-safe:
 The package supports various configuration options:
 
 1. API Configuration
-  - API keys
+  - API keys, static or fetched per request with WithKeyProvider
   - Organization ID
   - Base URL
   - Timeouts
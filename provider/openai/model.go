@@ -1,6 +1,7 @@
 package openai
 
 import (
+	"strings"
 	"sync"
 
 	"github.com/casualjim/bubo/api"
@@ -35,7 +36,37 @@ func Model(name string, opts ...option.RequestOption) api.Model {
 	})
 }
 
-var _ api.Model = (*model)(nil)
+// Models returns the models with the given names, they share one provider that is created with opts.
+// It's meant for models that use the same configuration, like several fine-tuned models of an account.
+//
+// Example:
+//
+//	ms := openai.Models([]string{"ft:gpt-4o-mini:acme:support", "ft:gpt-4o-mini:acme:sales"}, option.WithAPIKey(key))
+func Models(names []string, opts ...option.RequestOption) map[string]api.Model {
+	prov := New(opts...)
+	result := make(map[string]api.Model, len(names))
+	for _, name := range names {
+		result[name] = prov.Model(name)
+	}
+	return result
+}
+
+// Model returns a new model with the given name that sends its requests through the provider.
+// The model is registered under its name, it replaces a model that was registered before
+// so that a lookup by name uses the provider that was configured last.
+func (p *Provider) Model(name string) api.Model {
+	m := &model{
+		name: name,
+		prov: p,
+	}
+	models.Add(m)
+	return m
+}
+
+var (
+	_ api.Model             = (*model)(nil)
+	_ provider.CapableModel = (*model)(nil)
+)
 
 type model struct {
 	name string
@@ -51,7 +82,22 @@ func (m *model) Name() string {
 
 func (m *model) Provider() provider.Provider {
 	m.provOnce.Do(func() {
-		m.prov = New(m.opts...)
+		if m.prov == nil {
+			m.prov = New(m.opts...)
+		}
 	})
 	return m.prov
 }
+
+// Capabilities reports the input the model accepts, it's derived from the name of the model.
+// The audio models take audio, the mini reasoning and legacy models only text and the others images.
+func (m *model) Capabilities() provider.Capabilities {
+	switch {
+	case strings.Contains(m.name, "audio"):
+		return provider.Capabilities{AudioInput: true}
+	case strings.HasPrefix(m.name, "o1-mini"), strings.HasPrefix(m.name, "o3-mini"), strings.HasPrefix(m.name, "gpt-3.5"):
+		return provider.Capabilities{}
+	default:
+		return provider.Capabilities{ImageInput: true}
+	}
+}
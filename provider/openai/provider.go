@@ -1,26 +1,42 @@
 package openai
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
 	"iter"
+	"log/slog"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/casualjim/bubo/internal/shorttermmemory"
 	"github.com/casualjim/bubo/messages"
 	"github.com/casualjim/bubo/pkg/jsonx"
 	"github.com/casualjim/bubo/provider"
+	"github.com/casualjim/bubo/tool"
 	"github.com/go-openapi/strfmt"
 	"github.com/openai/openai-go"
 	"github.com/openai/openai-go/option"
 	"github.com/openai/openai-go/shared"
+	"github.com/tidwall/gjson"
 )
 
 // Provider represents a service provider that interacts with the OpenAI API.
 // It contains a client to communicate with the OpenAI service.
 type Provider struct {
-	client *openai.Client
+	client      *openai.Client
+	limits      provider.ContentLimits
+	mediaPolicy provider.UnreachableMediaPolicy
 }
 
 // New creates a new instance of Provider with the given request options.
@@ -41,11 +57,133 @@ func New(options ...option.RequestOption) *Provider {
 	}
 }
 
-func (p *Provider) buildRequest(_ context.Context, params *provider.CompletionParams) (openai.ChatCompletionNewParams, error) {
-	result, user := messagesToOpenAI(params.Instructions, params.Thread.MessagesIter())
+// WithContentLimits returns a copy of the provider that rejects messages with more
+// image or audio parts, or larger inline data, than the limits allow, before the request is sent.
+//
+// Example:
+//
+//	provider := openai.New().WithContentLimits(provider.WithMaxImagesPerMessage(10))
+func (p *Provider) WithContentLimits(options ...provider.LimitOption) *Provider {
+	return &Provider{
+		client:      p.client,
+		limits:      provider.NewContentLimits(options...),
+		mediaPolicy: p.mediaPolicy,
+	}
+}
+
+// WithUnreachableMediaPolicy returns a copy of the provider that fetches the images of the user
+// messages itself and sends them inline. The policy decides what happens to images that can't be fetched.
+//
+// Example:
+//
+//	provider := openai.New().WithUnreachableMediaPolicy(provider.UnreachableMediaAltText)
+func (p *Provider) WithUnreachableMediaPolicy(policy provider.UnreachableMediaPolicy) *Provider {
+	return &Provider{
+		client:      p.client,
+		limits:      p.limits,
+		mediaPolicy: policy,
+	}
+}
+
+// KeyProvider returns the API key to use for a request.
+type KeyProvider func(ctx context.Context) (string, error)
+
+// WithKeyProvider returns a request option that fetches the API key from the key provider
+// for every request, so keys can be rotated without restarting the process.
+// The key from the key provider takes precedence over the one set with option.WithAPIKey.
+//
+// Example:
+//
+//	provider := openai.New(openai.WithKeyProvider(func(ctx context.Context) (string, error) {
+//	    return vault.ReadSecret(ctx, "openai/api-key")
+//	}))
+func WithKeyProvider(keys KeyProvider) option.RequestOption {
+	return option.WithMiddleware(func(req *http.Request, next option.MiddlewareNext) (*http.Response, error) {
+		key, err := keys(req.Context())
+		if err != nil {
+			return nil, fmt.Errorf("failed to get api key: %w", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+key)
+		return next(req)
+	})
+}
+
+// WithHeader returns a request option that sets the header on every request, for example
+// the routing or authentication headers of a gateway in front of the API.
+//
+// Example:
+//
+//	provider := openai.New(openai.WithHeader("X-Gateway-Route", "eu-west"))
+func WithHeader(key, value string) option.RequestOption {
+	return option.WithMiddleware(func(req *http.Request, next option.MiddlewareNext) (*http.Response, error) {
+		req.Header.Set(key, value)
+		return next(req)
+	})
+}
+
+// HeaderFunc returns the value of a header for a request.
+type HeaderFunc func(ctx context.Context) (string, error)
+
+// WithHeaderFunc returns a request option that sets the header on every request to the value
+// returned by fn, so the value can change between requests. The header is left out when the value is empty.
+//
+// Example:
+//
+//	provider := openai.New(openai.WithHeaderFunc("X-Tenant-ID", func(ctx context.Context) (string, error) {
+//	    return tenant.FromContext(ctx), nil
+//	}))
+func WithHeaderFunc(key string, fn HeaderFunc) option.RequestOption {
+	return option.WithMiddleware(func(req *http.Request, next option.MiddlewareNext) (*http.Response, error) {
+		value, err := fn(req.Context())
+		if err != nil {
+			return nil, fmt.Errorf("failed to get header %s: %w", key, err)
+		}
+		if value != "" {
+			req.Header.Set(key, value)
+		}
+		return next(req)
+	})
+}
+
+func (p *Provider) buildRequest(ctx context.Context, params *provider.CompletionParams) (openai.ChatCompletionNewParams, error) {
+	if params.AssistantPrefill != "" {
+		slog.WarnContext(ctx, "assistant prefill is not supported by the openai provider, ignoring it")
+	}
+
+	thread := params.Thread.MessagesIter()
+	if p.mediaPolicy != 0 {
+		inlined, err := p.inlineMedia(ctx, thread)
+		if err != nil {
+			return openai.ChatCompletionNewParams{}, err
+		}
+		thread = slices.Values(inlined)
+	}
+
+	for message := range thread {
+		switch msg := message.Payload.(type) {
+		case messages.UserMessage:
+			if err := p.limits.Validate(msg); err != nil {
+				return openai.ChatCompletionNewParams{}, err
+			}
+		case messages.ToolResponse:
+			if err := p.limits.ValidateToolResponse(msg); err != nil {
+				return openai.ChatCompletionNewParams{}, err
+			}
+		}
+	}
+
+	result, user := messagesToOpenAI(params.Instructions, thread)
+
+	tools := make([]openai.ChatCompletionToolParam, 0, len(params.Tools))
+	for _, tool := range params.Tools {
+		if tool.Builtin {
+			// builtin tools are executed by openai, they're enabled with their own field of the request
+			if _, ok := builtinTools[tool.Name]; !ok {
+				return openai.ChatCompletionNewParams{}, fmt.Errorf("builtin tool %s isn't supported by the openai chat completions API", tool.Name)
+			}
+			continue
+		}
 
-	tools := make([]openai.ChatCompletionToolParam, len(params.Tools))
-	for i, tool := range params.Tools {
 		// Validate the tool function before conversion
 		if tool.Function == nil {
 			return openai.ChatCompletionNewParams{}, fmt.Errorf("tool %s has nil function", tool.Name)
@@ -66,10 +204,10 @@ func (p *Provider) buildRequest(_ context.Context, params *provider.CompletionPa
 			def.Description = openai.String(tool.Description)
 		}
 
-		tools[i] = openai.ChatCompletionToolParam{
+		tools = append(tools, openai.ChatCompletionToolParam{
 			Type:     openai.F(openai.ChatCompletionToolTypeFunction),
 			Function: openai.F(def),
-		}
+		})
 	}
 
 	oaiParams := openai.ChatCompletionNewParams{
@@ -78,11 +216,47 @@ func (p *Provider) buildRequest(_ context.Context, params *provider.CompletionPa
 		N:           openai.Int(1),
 		Temperature: openai.Float(0.1),
 	}
+	if temperature := params.ModelParams.Temperature; temperature != nil {
+		oaiParams.Temperature = openai.Float(*temperature)
+	}
+	if topP := params.ModelParams.TopP; topP != nil {
+		oaiParams.TopP = openai.Float(*topP)
+	}
+	if maxTokens := params.ModelParams.MaxTokens; maxTokens != nil {
+		oaiParams.MaxCompletionTokens = openai.Int(*maxTokens)
+	}
 	if len(tools) > 0 {
 		oaiParams.Tools = openai.F(tools)
 		oaiParams.ParallelToolCalls = openai.Bool(true)
 	}
+	if params.Stream && params.IncludeStreamUsage {
+		oaiParams.StreamOptions = openai.F(openai.ChatCompletionStreamOptionsParam{
+			IncludeUsage: openai.Bool(true),
+		})
+	}
+	if len(params.Modalities) > 0 {
+		modalities := make([]openai.ChatCompletionModality, len(params.Modalities))
+		for i, modality := range params.Modalities {
+			modalities[i] = openai.ChatCompletionModality(modality)
+		}
+		oaiParams.Modalities = openai.F(modalities)
+	}
+	if params.Audio != nil {
+		oaiParams.Audio = openai.F(openai.ChatCompletionAudioParam{
+			Voice:  openai.F(openai.ChatCompletionAudioParamVoice(params.Audio.Voice)),
+			Format: openai.F(openai.ChatCompletionAudioParamFormat(params.Audio.Format)),
+		})
+	}
+	if len(params.StopSequences) > 0 {
+		oaiParams.Stop = openai.F[openai.ChatCompletionNewParamsStopUnion](openai.ChatCompletionNewParamsStopArray(params.StopSequences))
+	}
+	if strings.TrimSpace(params.UserID) != "" {
+		user = params.UserID
+	}
 	if strings.TrimSpace(user) != "" {
+		if params.HashUserID {
+			user = hashUserID(user)
+		}
 		oaiParams.User = openai.String(user)
 	}
 	if params.ResponseSchema != nil {
@@ -106,97 +280,508 @@ func (p *Provider) ChatCompletion(ctx context.Context, params provider.Completio
 	if err != nil {
 		return nil, fmt.Errorf("failed to build request: %w", err)
 	}
+	reqOptions := builtinToolOptions(params.Tools)
 
 	events := make(chan provider.StreamEvent, 10)
 	go func() {
 		defer close(events)
 		if params.Stream {
-			p.runStream(ctx, chatParams, &params, events)
+			p.runStream(ctx, chatParams, &params, events, reqOptions...)
 		} else {
-			p.runOnce(ctx, chatParams, &params, events)
+			p.runOnce(ctx, chatParams, &params, events, reqOptions...)
 		}
 	}()
 	return events, nil
 }
 
-func (p *Provider) runStream(ctx context.Context, params openai.ChatCompletionNewParams, command *provider.CompletionParams, events chan<- provider.StreamEvent) {
-	strm := p.client.Chat.Completions.NewStreaming(ctx, params)
+// builtinTools maps the builtin tools the chat completions API supports to the field of the request that enables them,
+// they aren't sent as tools because the API only accepts function tools.
+var builtinTools = map[string]string{
+	"web_search": "web_search_options",
+}
 
-	if strm.Err() != nil {
-		events <- provider.Error{
-			Err:       strm.Err(),
-			RunID:     command.RunID,
-			TurnID:    command.Thread.ID(),
-			Timestamp: strfmt.DateTime(time.Now()),
+// builtinToolOptions returns the request options that enable the builtin tools
+func builtinToolOptions(tools []tool.Definition) []option.RequestOption {
+	var reqOptions []option.RequestOption
+	for _, def := range tools {
+		if field, ok := builtinTools[def.Name]; ok && def.Builtin {
+			reqOptions = append(reqOptions, option.WithJSONSet(field, map[string]any{}))
 		}
-		strm.Close()
-		return
 	}
+	return reqOptions
+}
 
-	// Ensure cleanup on all exit paths
+// maxStreamResumes is how many times a stream that ends before [DONE] is resumed
+const maxStreamResumes = 1
+
+func (p *Provider) runStream(ctx context.Context, params openai.ChatCompletionNewParams, command *provider.CompletionParams, events chan<- provider.StreamEvent, reqOptions ...option.RequestOption) {
+	var reqID requestID
+	// Ensure the cancellation is reported on all exit paths
 	defer func() {
-		strm.Close()
-		// Send error if context was cancelled
 		if err := ctx.Err(); err != nil {
-			events <- provider.Error{
+			events <- reqID.tag(provider.Error{
 				Err:       err,
 				RunID:     command.RunID,
 				TurnID:    command.Thread.ID(),
 				Timestamp: strfmt.DateTime(time.Now()),
-			}
+			})
 		}
 	}()
 
 	var notFirst bool
 	var acc openai.ChatCompletionAccumulator
+	var sections sectionTracker
+	var filtered []string
+	var usage *shorttermmemory.Usage
+	// partial is the content received before the stream was cut off, a resumed stream continues after it
+	var partial string
+	// a stream that was cut off after tool call deltas were sent isn't resumed, they'd be sent again
+	var sentToolCalls bool
 
-	for strm.Next() {
-		// Check context before processing each chunk
-		if err := ctx.Err(); err != nil {
+	for attempt := 0; ; attempt++ {
+		var done doneDetector
+		strm := p.client.Chat.Completions.NewStreaming(ctx, params, append(reqOptions, option.WithMiddleware(done.middleware), option.WithMiddleware(reqID.middleware))...)
+		if strm.Err() != nil {
+			events <- reqID.tag(provider.Error{
+				Err:       categorizeError(strm.Err()),
+				RunID:     command.RunID,
+				TurnID:    command.Thread.ID(),
+				Timestamp: strfmt.DateTime(time.Now()),
+			})
+			strm.Close()
 			return
 		}
 
-		if !notFirst {
-			notFirst = true
-			events <- provider.Delim{Delim: "start"}
+		for strm.Next() {
+			// Check context before processing each chunk
+			if err := ctx.Err(); err != nil {
+				strm.Close()
+				return
+			}
+
+			if !notFirst {
+				notFirst = true
+				events <- provider.Delim{Delim: provider.DelimStart}
+			}
+
+			chunk := strm.Current()
+			if strm.Err() != nil {
+				events <- reqID.tag(provider.Error{
+					Err:       categorizeError(strm.Err()),
+					RunID:     command.RunID,
+					TurnID:    command.Thread.ID(),
+					Timestamp: strfmt.DateTime(time.Now()),
+				})
+				strm.Close()
+				return
+			}
+
+			acc.AddChunk(chunk)
+			if len(chunk.Choices) > 0 {
+				filtered = appendFilteredCategories(filtered, chunk.Choices[0].JSON.RawJSON())
+			}
+			if err := validateStreamingArgs(&acc, &chunk, command.Tools); err != nil {
+				events <- reqID.tag(provider.Error{
+					Err:       err,
+					RunID:     command.RunID,
+					TurnID:    command.Thread.ID(),
+					Timestamp: strfmt.DateTime(time.Now()),
+				})
+				strm.Close()
+				return
+			}
+			if command.IncludeStreamUsage && !chunk.JSON.Usage.IsNull() {
+				// with include_usage the usage is only sent in the last chunk, it has no choices
+				usage = usageFromOpenAI(chunk.Usage)
+			}
+			for _, delim := range sections.next(&chunk) {
+				events <- provider.Delim{Delim: delim}
+			}
+			if len(chunk.Choices) > 0 && len(chunk.Choices[0].Delta.ToolCalls) > 0 {
+				sentToolCalls = true
+			}
+			events <- completionChunkToStreamEvent(&chunk, command)
 		}
+		strm.Close()
 
-		chunk := strm.Current()
-		if strm.Err() != nil {
-			events <- provider.Error{
-				Err:       strm.Err(),
+		if done.seen() || strm.Err() != nil || ctx.Err() != nil {
+			break
+		}
+		if sentToolCalls {
+			// the tool calls may be incomplete, and a resumed stream would send them again
+			events <- reqID.tag(provider.Error{
+				Err:       fmt.Errorf("stream ended before the tool calls were complete: %w", io.ErrUnexpectedEOF),
 				RunID:     command.RunID,
 				TurnID:    command.Thread.ID(),
 				Timestamp: strfmt.DateTime(time.Now()),
-			}
+			})
 			return
 		}
+		if attempt >= maxStreamResumes {
+			break
+		}
 
-		acc.AddChunk(chunk)
-		events <- completionChunkToStreamEvent(&chunk, command)
+		// the connection dropped before [DONE], restart the completion from the content received so far
+		if len(acc.Choices) > 0 {
+			partial += acc.Choices[0].Message.Content
+		}
+		slog.WarnContext(ctx, "stream ended before completion, resuming", slog.Int("attempt", attempt+1))
+		params = resumeParams(params, partial)
+		acc = openai.ChatCompletionAccumulator{}
 	}
 
 	// Only send completion events if we started streaming and context wasn't cancelled
 	if notFirst && ctx.Err() == nil {
-		events <- provider.Delim{Delim: "end"}
+		for _, delim := range sections.close() {
+			events <- provider.Delim{Delim: delim}
+		}
+		events <- provider.Delim{Delim: provider.DelimEnd}
 		compl := &acc.ChatCompletion
-		events <- completionToStreamEvent(compl, command)
+		if len(compl.Choices) > 0 {
+			compl.Choices[0].Message.Content = partial + compl.Choices[0].Message.Content
+			if cf, ok := contentFilterEvent(string(compl.Choices[0].FinishReason), filtered, command); ok {
+				events <- cf
+			}
+		}
+		event := completionToStreamEvent(compl, command)
+		if usage != nil {
+			event = provider.WithMeta(event, "usage", usage)
+		}
+		events <- reqID.tag(event)
+	}
+}
+
+// validateStreamingArgs checks the arguments of the tool calls in the chunk so far,
+// for the tools that validate their arguments while streaming
+func validateStreamingArgs(acc *openai.ChatCompletionAccumulator, chunk *openai.ChatCompletionChunk, tools []tool.Definition) error {
+	if len(chunk.Choices) == 0 || len(acc.Choices) == 0 {
+		return nil
+	}
+	calls := acc.Choices[0].Message.ToolCalls
+	for _, delta := range chunk.Choices[0].Delta.ToolCalls {
+		if int(delta.Index) >= len(calls) {
+			continue
+		}
+		call := calls[delta.Index]
+		idx := slices.IndexFunc(tools, func(def tool.Definition) bool { return def.Name == call.Function.Name })
+		if idx < 0 || !tools[idx].ValidateWhileStreaming {
+			continue
+		}
+		if err := tools[idx].ValidatePartialArguments(call.Function.Arguments); err != nil {
+			return fmt.Errorf("tool %s received invalid arguments: %w", call.Function.Name, err)
+		}
 	}
+	return nil
 }
 
-func (p *Provider) runOnce(ctx context.Context, params openai.ChatCompletionNewParams, command *provider.CompletionParams, events chan<- provider.StreamEvent) {
-	chat, err := p.client.Chat.Completions.New(ctx, params)
+// resumeParams returns the request that continues a completion after the partial content
+func resumeParams(params openai.ChatCompletionNewParams, partial string) openai.ChatCompletionNewParams {
+	if partial == "" {
+		return params
+	}
+	msgs := slices.Clone(params.Messages.Value)
+	msgs = append(msgs, openai.AssistantMessage(partial))
+	params.Messages = openai.F(msgs)
+	return params
+}
+
+// requestID records the x-request-id header openai sends with every response,
+// support asks for it when a request is investigated.
+type requestID struct {
+	mu sync.Mutex
+	id string
+}
+
+func (r *requestID) middleware(req *http.Request, next option.MiddlewareNext) (*http.Response, error) {
+	resp, err := next(req)
+	if resp != nil {
+		if id := resp.Header.Get("x-request-id"); id != "" {
+			r.mu.Lock()
+			r.id = id
+			r.mu.Unlock()
+		}
+	}
+	return resp, err
+}
+
+// tag adds the request ID of the last response to the metadata of the event under "request_id"
+func (r *requestID) tag(event provider.StreamEvent) provider.StreamEvent {
+	r.mu.Lock()
+	id := r.id
+	r.mu.Unlock()
+	if id == "" {
+		return event
+	}
+	return provider.WithMeta(event, "request_id", id)
+}
+
+// doneDetector watches the body of a streaming response for the [DONE] event,
+// a stream that ends without it was cut off.
+type doneDetector struct {
+	mu   sync.Mutex
+	line []byte // the line that is read so far
+	done bool
+}
+
+func (d *doneDetector) middleware(req *http.Request, next option.MiddlewareNext) (*http.Response, error) {
+	resp, err := next(req)
+	if err != nil || resp == nil || resp.Body == nil {
+		return resp, err
+	}
+	resp.Body = &doneBody{ReadCloser: resp.Body, detector: d}
+	return resp, nil
+}
+
+func (d *doneDetector) observe(data []byte) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.done {
+		return
+	}
+	// the event can be split across reads, the line is kept until its end is read
+	d.line = append(d.line, data...)
+	for {
+		idx := bytes.IndexByte(d.line, '\n')
+		if idx < 0 {
+			return
+		}
+		if isSSEDone(d.line[:idx]) {
+			d.done = true
+			d.line = nil
+			return
+		}
+		d.line = d.line[idx+1:]
+	}
+}
+
+// isSSEDone reports whether the line of a server-sent event stream is the data line of the [DONE] event
+func isSSEDone(line []byte) bool {
+	line = bytes.TrimSuffix(line, []byte("\r"))
+	data, ok := bytes.CutPrefix(line, []byte("data:"))
+	if !ok {
+		return false
+	}
+	// a single space after the colon isn't part of the value
+	data = bytes.TrimPrefix(data, []byte(" "))
+	return string(data) == "[DONE]"
+}
+
+func (d *doneDetector) seen() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.done
+}
+
+type doneBody struct {
+	io.ReadCloser
+	detector *doneDetector
+}
+
+func (b *doneBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		b.detector.observe(p[:n])
+	}
+	return n, err
+}
+
+func usageFromOpenAI(u openai.CompletionUsage) *shorttermmemory.Usage {
+	return &shorttermmemory.Usage{
+		CompletionTokens: u.CompletionTokens,
+		PromptTokens:     u.PromptTokens,
+		TotalTokens:      u.TotalTokens,
+		CompletionTokensDetails: shorttermmemory.CompletionTokensDetails{
+			AcceptedPredictionTokens: u.CompletionTokensDetails.AcceptedPredictionTokens,
+			AudioTokens:              u.CompletionTokensDetails.AudioTokens,
+			ReasoningTokens:          u.CompletionTokensDetails.ReasoningTokens,
+			RejectedPredictionTokens: u.CompletionTokensDetails.RejectedPredictionTokens,
+		},
+		PromptTokensDetails: shorttermmemory.PromptTokensDetails{
+			AudioTokens:  u.PromptTokensDetails.AudioTokens,
+			CachedTokens: u.PromptTokensDetails.CachedTokens,
+		},
+	}
+}
+
+type sectionKind int
+
+const (
+	noSection sectionKind = iota
+	contentSection
+	toolCallSection
+)
+
+// sectionTracker keeps track of the section of the assistant message a stream is in,
+// it produces the delimiters to emit when a chunk moves the stream to a new section.
+type sectionTracker struct {
+	kind  sectionKind
+	index int64
+}
+
+func (s *sectionTracker) next(chunk *openai.ChatCompletionChunk) []string {
+	if len(chunk.Choices) == 0 {
+		return nil
+	}
+
+	delta := chunk.Choices[0].Delta
+	var delims []string
+	for _, tc := range delta.ToolCalls {
+		if s.kind == toolCallSection && s.index == tc.Index {
+			continue
+		}
+		delims = append(delims, s.close()...)
+		delims = append(delims, provider.DelimToolCallStart)
+		s.kind, s.index = toolCallSection, tc.Index
+	}
+	// a refusal is streamed in the content section, it takes the place of the content
+	if len(delta.ToolCalls) == 0 && (delta.Content != "" || delta.Refusal != "") && s.kind != contentSection {
+		delims = append(delims, s.close()...)
+		delims = append(delims, provider.DelimContentStart)
+		s.kind = contentSection
+	}
+	return delims
+}
+
+func (s *sectionTracker) close() []string {
+	kind := s.kind
+	s.kind, s.index = noSection, 0
+	switch kind {
+	case contentSection:
+		return []string{provider.DelimContentEnd}
+	case toolCallSection:
+		return []string{provider.DelimToolCallEnd}
+	default:
+		return nil
+	}
+}
+
+func (p *Provider) runOnce(ctx context.Context, params openai.ChatCompletionNewParams, command *provider.CompletionParams, events chan<- provider.StreamEvent, reqOptions ...option.RequestOption) {
+	var reqID requestID
+	chat, err := p.client.Chat.Completions.New(ctx, params, append(reqOptions, option.WithMiddleware(reqID.middleware))...)
 	if err != nil {
-		events <- provider.Error{
-			Err:       err,
+		events <- reqID.tag(provider.Error{
+			Err:       categorizeError(err),
 			RunID:     command.RunID,
 			TurnID:    command.Thread.ID(),
 			Timestamp: strfmt.DateTime(time.Now()),
-		}
+		})
 		return
 	}
 
-	events <- completionToStreamEvent(chat, command)
+	if len(chat.Choices) > 0 {
+		filtered := appendFilteredCategories(nil, chat.Choices[0].JSON.RawJSON())
+		if cf, ok := contentFilterEvent(string(chat.Choices[0].FinishReason), filtered, command); ok {
+			events <- cf
+		}
+	}
+	event := completionToStreamEvent(chat, command)
+	if !chat.JSON.Usage.IsNull() {
+		event = provider.WithMeta(event, "usage", usageFromOpenAI(chat.Usage))
+	}
+	events <- reqID.tag(event)
+}
+
+// categorizeError wraps the error of the openai client in the provider error of its category,
+// errors it can't categorize, like a cancelled context, are returned as is.
+func categorizeError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var apiErr *openai.Error
+	if errors.As(err, &apiErr) {
+		switch code := apiErr.StatusCode; {
+		case code == http.StatusUnauthorized || code == http.StatusForbidden:
+			return &provider.AuthError{StatusCode: code, Err: err}
+		case code == http.StatusTooManyRequests:
+			return &provider.RateLimitError{RetryAfter: retryAfter(apiErr.Response, time.Now()), Err: err}
+		case code >= http.StatusInternalServerError:
+			return &provider.ServerError{StatusCode: code, Err: err}
+		case code >= http.StatusBadRequest:
+			return &provider.InvalidRequestError{StatusCode: code, Err: err}
+		}
+		return err
+	}
+
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) {
+		return &provider.NetworkError{Err: err}
+	}
+	return err
+}
+
+// retryAfter reads how long to wait before retrying from the headers of a throttled response,
+// openai sends retry-after-ms next to the standard Retry-After in seconds or as an HTTP date.
+func retryAfter(resp *http.Response, now time.Time) time.Duration {
+	if resp == nil {
+		return 0
+	}
+	if ms, err := strconv.ParseFloat(resp.Header.Get("Retry-After-Ms"), 64); err == nil && ms > 0 {
+		return time.Duration(ms * float64(time.Millisecond))
+	}
+	value := resp.Header.Get("Retry-After")
+	if secs, err := strconv.ParseFloat(value, 64); err == nil && secs > 0 {
+		return time.Duration(secs * float64(time.Second))
+	}
+	if at, err := http.ParseTime(value); err == nil && at.After(now) {
+		return at.Sub(now)
+	}
+	return 0
+}
+
+// appendFilteredCategories adds the categories the content filter flagged in the raw choice,
+// some deployments (e.g. Azure OpenAI) report them in content_filter_results.
+func appendFilteredCategories(categories []string, rawChoice string) []string {
+	if rawChoice == "" {
+		return categories
+	}
+	gjson.Get(rawChoice, "content_filter_results").ForEach(func(key, value gjson.Result) bool {
+		if value.Get("filtered").Bool() && !slices.Contains(categories, key.String()) {
+			categories = append(categories, key.String())
+		}
+		return true
+	})
+	return categories
+}
+
+// contentFilterEvent returns the content filter event for a turn that finished because
+// of the content filter or for which the content filter flagged categories.
+func contentFilterEvent(finishReason string, categories []string, command *provider.CompletionParams) (provider.ContentFilter, bool) {
+	if finishReason != string(openai.ChatCompletionChoicesFinishReasonContentFilter) && len(categories) == 0 {
+		return provider.ContentFilter{}, false
+	}
+	return provider.ContentFilter{
+		RunID:        command.RunID,
+		TurnID:       command.Thread.ID(),
+		Categories:   categories,
+		FinishReason: finishReason,
+		Timestamp:    strfmt.DateTime(time.Now()),
+	}, true
+}
+
+// hashUserID returns a stable, opaque identifier for the given user id
+func hashUserID(id string) string {
+	sum := sha256.Sum256([]byte(id))
+	return hex.EncodeToString(sum[:])
+}
+
+// inlineMedia copies the messages of the thread with the images of the user messages fetched and inlined.
+func (p *Provider) inlineMedia(ctx context.Context, thread iter.Seq[messages.Message[messages.ModelMessage]]) ([]messages.Message[messages.ModelMessage], error) {
+	var result []messages.Message[messages.ModelMessage]
+	for message := range thread {
+		if msg, ok := message.Payload.(messages.UserMessage); ok {
+			inlined, err := provider.InlineMedia(ctx, nil, p.mediaPolicy, p.limits.MaxInlineBytes, msg)
+			if err != nil {
+				return nil, err
+			}
+			message.Payload = inlined
+		}
+		result = append(result, message)
+	}
+	return result, nil
 }
 
 func messagesToOpenAI(instructions string, iter iter.Seq[messages.Message[messages.ModelMessage]]) ([]openai.ChatCompletionMessageParamUnion, string) {
@@ -204,10 +789,32 @@ func messagesToOpenAI(instructions string, iter iter.Seq[messages.Message[messag
 		openai.SystemMessage(instructions),
 	}
 	var user string
+	// attachments of tool responses follow the tool responses of the turn, openai only accepts
+	// the tool responses right after the tool calls
+	var attachments []openai.ChatCompletionMessageParamUnion
 	for message := range iter {
+		if _, isToolResponse := message.Payload.(messages.ToolResponse); !isToolResponse && len(attachments) > 0 {
+			result = append(result, attachments...)
+			attachments = nil
+		}
+
 		switch msg := message.Payload.(type) {
 		case messages.ToolResponse:
-			result = append(result, openai.ToolMessage(msg.ToolCallID, msg.Content))
+			content := msg.Content
+			if len(msg.Data) > 0 {
+				if part, ok := attachmentPart(msg.Data, msg.MIMEType); ok {
+					if content == "" {
+						content = "The result is attached in the next message."
+					}
+					attachments = append(attachments, openai.UserMessageParts(
+						openai.TextPart(fmt.Sprintf("Attachment of the %s tool call %s:", msg.ToolName, msg.ToolCallID)),
+						part,
+					))
+				} else {
+					content += fmt.Sprintf("\n\n[attachment of type %s (%d bytes) is not supported by the model]", msg.MIMEType, len(msg.Data))
+				}
+			}
+			result = append(result, openai.ToolMessage(msg.ToolCallID, content))
 		case messages.UserMessage:
 			if message.Sender != "" {
 				user = message.Sender
@@ -296,12 +903,39 @@ func messagesToOpenAI(instructions string, iter iter.Seq[messages.Message[messag
 			result = append(result, am)
 		}
 	}
+	result = append(result, attachments...)
 	return result, user
 }
 
+// attachmentPart converts the binary data of a tool response into a content part,
+// openai accepts images and some audio formats.
+func attachmentPart(data []byte, mimeType string) (openai.ChatCompletionContentPartUnionParam, bool) {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	switch {
+	case strings.HasPrefix(mimeType, "image/"):
+		return openai.ImagePart(fmt.Sprintf("data:%s;base64,%s", mimeType, encoded)), true
+	case mimeType == "audio/wav" || mimeType == "audio/x-wav":
+		return inputAudioPart(encoded, openai.ChatCompletionContentPartInputAudioInputAudioFormatWAV), true
+	case mimeType == "audio/mpeg" || mimeType == "audio/mp3":
+		return inputAudioPart(encoded, openai.ChatCompletionContentPartInputAudioInputAudioFormatMP3), true
+	default:
+		return nil, false
+	}
+}
+
+func inputAudioPart(encoded string, format openai.ChatCompletionContentPartInputAudioInputAudioFormat) openai.ChatCompletionContentPartInputAudioParam {
+	return openai.ChatCompletionContentPartInputAudioParam{
+		InputAudio: openai.F(openai.ChatCompletionContentPartInputAudioInputAudioParam{
+			Data:   openai.String(encoded),
+			Format: openai.F(format),
+		}),
+		Type: openai.F(openai.ChatCompletionContentPartInputAudioTypeInputAudio),
+	}
+}
+
 func completionChunkToStreamEvent(chunk *openai.ChatCompletionChunk, command *provider.CompletionParams) provider.StreamEvent {
 	if len(chunk.Choices) == 0 {
-		return provider.Delim{Delim: "empty"}
+		return provider.Delim{Delim: provider.DelimEmpty}
 	}
 
 	choice := chunk.Choices[0].Delta
@@ -332,6 +966,7 @@ func completionChunkToStreamEvent(chunk *openai.ChatCompletionChunk, command *pr
 			Content: messages.AssistantContentOrParts{
 				Content: choice.Content,
 			},
+			Refusal: choice.Refusal,
 		},
 		Timestamp: strfmt.DateTime(time.Now()),
 	}
@@ -339,10 +974,11 @@ func completionChunkToStreamEvent(chunk *openai.ChatCompletionChunk, command *pr
 
 func completionToStreamEvent(chat *openai.ChatCompletion, command *provider.CompletionParams) provider.StreamEvent {
 	if len(chat.Choices) == 0 {
-		return provider.Delim{Delim: "empty"}
+		return provider.Delim{Delim: provider.DelimEmpty}
 	}
 
 	choice := chat.Choices[0].Message
+	finishReason := string(chat.Choices[0].FinishReason)
 	if len(choice.ToolCalls) > 0 {
 		tcd := make([]messages.ToolCallData, len(choice.ToolCalls))
 		for i, tc := range choice.ToolCalls {
@@ -360,19 +996,43 @@ func completionToStreamEvent(chat *openai.ChatCompletion, command *provider.Comp
 			Response: messages.ToolCallMessage{
 				ToolCalls: tcd,
 			},
-			Timestamp: strfmt.DateTime(time.Now()),
+			Timestamp:    strfmt.DateTime(time.Now()),
+			FinishReason: finishReason,
 		}
 	}
 
-	return provider.Response[messages.AssistantMessage]{
-		RunID:      command.RunID,
-		TurnID:     command.Thread.ID(),
-		Checkpoint: command.Thread.Checkpoint(),
-		Response: messages.AssistantMessage{
-			Content: messages.AssistantContentOrParts{
-				Content: choice.Content,
-			},
+	response := messages.AssistantMessage{
+		Content: messages.AssistantContentOrParts{
+			Content: stripStopSequences(choice.Content, command.StopSequences),
 		},
-		Timestamp: strfmt.DateTime(time.Now()),
 	}
+	if choice.Refusal != "" {
+		// a message can't have both, the model refused so whatever content it produced is dropped
+		response = messages.AssistantMessage{Refusal: choice.Refusal}
+	}
+
+	return provider.Response[messages.AssistantMessage]{
+		RunID:        command.RunID,
+		TurnID:       command.Thread.ID(),
+		Checkpoint:   command.Thread.Checkpoint(),
+		Response:     response,
+		Timestamp:    strfmt.DateTime(time.Now()),
+		FinishReason: finishReason,
+	}
+}
+
+// stripStopSequences cuts the content at the first stop sequence it contains.
+// The API should never return a stop sequence, but streamed content can contain one
+// when it was accumulated from chunks. Only a complete stop sequence is cut, a model
+// that finished normally can end with text that looks like the start of one.
+func stripStopSequences(content string, stop []string) string {
+	for _, seq := range stop {
+		if seq == "" {
+			continue
+		}
+		if idx := strings.Index(content, seq); idx >= 0 {
+			content = content[:idx]
+		}
+	}
+	return content
 }
@@ -2,9 +2,13 @@ package openai
 
 import (
 	"context"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"slices"
@@ -14,6 +18,7 @@ import (
 	"github.com/casualjim/bubo/internal/shorttermmemory"
 	"github.com/casualjim/bubo/messages"
 	"github.com/casualjim/bubo/provider"
+	"github.com/casualjim/bubo/provider/models"
 	"github.com/casualjim/bubo/tool"
 	"github.com/google/uuid"
 	"github.com/invopop/jsonschema"
@@ -21,6 +26,7 @@ import (
 	"github.com/openai/openai-go/option"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
 	orderedmap "github.com/wk8/go-ordered-map/v2"
 )
 
@@ -30,6 +36,47 @@ func TestNew(t *testing.T) {
 	assert.NotNil(t, p.client)
 }
 
+func TestModels(t *testing.T) {
+	names := []string{"ft:gpt-4o-mini:acme:support", "ft:gpt-4o-mini:acme:sales"}
+	t.Cleanup(func() {
+		for _, name := range names {
+			models.Del(name)
+		}
+	})
+
+	ms := Models(names, option.WithAPIKey("test-key"))
+	require.Len(t, ms, 2)
+
+	first := ms[names[0]].Provider()
+	require.NotNil(t, first)
+	for _, name := range names {
+		assert.Equal(t, name, ms[name].Name())
+		assert.Same(t, first, ms[name].Provider(), "all models share the provider")
+
+		registered, ok := models.Get(name)
+		require.True(t, ok)
+		assert.Same(t, ms[name], registered)
+	}
+}
+
+func TestProvider_Model(t *testing.T) {
+	const name = "ft:gpt-4o-mini:acme:billing"
+	t.Cleanup(func() { models.Del(name) })
+
+	first := New(option.WithAPIKey("first-key"))
+	second := New(option.WithAPIKey("second-key"))
+
+	m1 := first.Model(name)
+	m2 := second.Model(name)
+
+	assert.Same(t, first, m1.Provider())
+	assert.Same(t, second, m2.Provider(), "the model uses the provider it was created with")
+
+	registered, ok := models.Get(name)
+	require.True(t, ok)
+	assert.Same(t, m2, registered)
+}
+
 func TestProvider_buildRequest_Error(t *testing.T) {
 	p := New()
 	ctx := context.Background()
@@ -165,6 +212,307 @@ func TestProvider_buildRequest(t *testing.T) {
 	assert.Equal(t, "A test tool", tools[0].Function.Value.Description.Value)
 }
 
+func TestProvider_buildRequest_ModelParams(t *testing.T) {
+	p := New()
+	aggregator := shorttermmemory.New()
+
+	t.Run("defaults", func(t *testing.T) {
+		chatParams, err := p.buildRequest(context.Background(), &provider.CompletionParams{
+			Thread: aggregator,
+			Model:  GPT4oMini(),
+		})
+		require.NoError(t, err)
+		assert.InDelta(t, 0.1, chatParams.Temperature.Value, 1e-9)
+		assert.False(t, chatParams.TopP.Present)
+		assert.False(t, chatParams.MaxCompletionTokens.Present)
+	})
+
+	t.Run("configured", func(t *testing.T) {
+		temperature, topP, maxTokens := 0.8, 0.5, int64(100)
+		chatParams, err := p.buildRequest(context.Background(), &provider.CompletionParams{
+			Thread: aggregator,
+			Model:  GPT4oMini(),
+			ModelParams: provider.ModelParams{
+				Temperature: &temperature,
+				TopP:        &topP,
+				MaxTokens:   &maxTokens,
+			},
+		})
+		require.NoError(t, err)
+		assert.InDelta(t, 0.8, chatParams.Temperature.Value, 1e-9)
+		assert.InDelta(t, 0.5, chatParams.TopP.Value, 1e-9)
+		assert.Equal(t, int64(100), chatParams.MaxCompletionTokens.Value)
+	})
+}
+
+func TestProvider_buildRequest_UserID(t *testing.T) {
+	p := New()
+	ctx := context.Background()
+	runID := uuid.New()
+	aggregator := shorttermmemory.New()
+
+	aggregator.AddUserPrompt(messages.Message[messages.UserMessage]{
+		RunID:  runID,
+		TurnID: aggregator.ID(),
+		Sender: "testUser",
+		Payload: messages.UserMessage{
+			Content: messages.ContentOrParts{
+				Content: "Hello",
+			},
+		},
+	})
+
+	t.Run("override", func(t *testing.T) {
+		chatParams, err := p.buildRequest(ctx, &provider.CompletionParams{
+			RunID:        runID,
+			Instructions: "Test instructions",
+			Thread:       aggregator,
+			Model:        GPT4oMini(),
+			UserID:       "user-123",
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "user-123", chatParams.User.Value)
+	})
+
+	t.Run("hashed override", func(t *testing.T) {
+		chatParams, err := p.buildRequest(ctx, &provider.CompletionParams{
+			RunID:        runID,
+			Instructions: "Test instructions",
+			Thread:       aggregator,
+			Model:        GPT4oMini(),
+			UserID:       "user-123",
+			HashUserID:   true,
+		})
+		require.NoError(t, err)
+
+		sum := sha256.Sum256([]byte("user-123"))
+		assert.Equal(t, hex.EncodeToString(sum[:]), chatParams.User.Value)
+	})
+
+	t.Run("hashed sender", func(t *testing.T) {
+		chatParams, err := p.buildRequest(ctx, &provider.CompletionParams{
+			RunID:        runID,
+			Instructions: "Test instructions",
+			Thread:       aggregator,
+			Model:        GPT4oMini(),
+			HashUserID:   true,
+		})
+		require.NoError(t, err)
+
+		sum := sha256.Sum256([]byte("testUser"))
+		assert.Equal(t, hex.EncodeToString(sum[:]), chatParams.User.Value)
+	})
+}
+
+func TestProvider_buildRequest_AssistantPrefill(t *testing.T) {
+	p := New()
+	ctx := context.Background()
+	runID := uuid.New()
+	aggregator := shorttermmemory.New()
+
+	aggregator.AddUserPrompt(messages.Message[messages.UserMessage]{
+		RunID:  runID,
+		TurnID: aggregator.ID(),
+		Sender: "testUser",
+		Payload: messages.UserMessage{
+			Content: messages.ContentOrParts{
+				Content: "Hello",
+			},
+		},
+	})
+
+	chatParams, err := p.buildRequest(ctx, &provider.CompletionParams{
+		RunID:            runID,
+		Instructions:     "Test instructions",
+		Thread:           aggregator,
+		Model:            GPT4oMini(),
+		AssistantPrefill: "{",
+	})
+	require.NoError(t, err)
+
+	// the prefill is not supported, so only the system and user messages are sent
+	msgs := chatParams.Messages.Value
+	require.Len(t, msgs, 2)
+	for _, msg := range msgs {
+		_, isAssistant := msg.(openai.ChatCompletionAssistantMessageParam)
+		assert.False(t, isAssistant)
+	}
+}
+
+func TestProvider_buildRequest_Modalities(t *testing.T) {
+	p := New()
+	aggregator := shorttermmemory.New()
+	aggregator.AddUserPrompt(messages.New().UserPrompt("Tell me a story"))
+
+	t.Run("audio output", func(t *testing.T) {
+		chatParams, err := p.buildRequest(context.Background(), &provider.CompletionParams{
+			Instructions: "Test instructions",
+			Thread:       aggregator,
+			Model:        Model(openai.ChatModelGPT4oAudioPreview),
+			Modalities:   []string{"text", "audio"},
+			Audio:        &provider.AudioConfig{Voice: "alloy", Format: "wav"},
+		})
+		require.NoError(t, err)
+
+		body, err := json.Marshal(chatParams)
+		require.NoError(t, err)
+		assert.JSONEq(t, `["text","audio"]`, gjson.GetBytes(body, "modalities").Raw)
+		assert.JSONEq(t, `{"voice":"alloy","format":"wav"}`, gjson.GetBytes(body, "audio").Raw)
+	})
+
+	t.Run("text output", func(t *testing.T) {
+		chatParams, err := p.buildRequest(context.Background(), &provider.CompletionParams{
+			Instructions: "Test instructions",
+			Thread:       aggregator,
+			Model:        GPT4oMini(),
+		})
+		require.NoError(t, err)
+
+		body, err := json.Marshal(chatParams)
+		require.NoError(t, err)
+		assert.False(t, gjson.GetBytes(body, "modalities").Exists())
+		assert.False(t, gjson.GetBytes(body, "audio").Exists())
+	})
+}
+
+func TestProvider_buildRequest_ContentLimits(t *testing.T) {
+	p := New().WithContentLimits(provider.WithMaxImagesPerMessage(2))
+
+	aggregator := shorttermmemory.New()
+	aggregator.AddUserPrompt(messages.Message[messages.UserMessage]{
+		Payload: messages.UserMessage{
+			Content: messages.ContentOrParts{Parts: []messages.ContentPart{
+				messages.Text("compare these"),
+				messages.Image("https://example.com/1.png"),
+				messages.Image("https://example.com/2.png"),
+				messages.Image("https://example.com/3.png"),
+			}},
+		},
+	})
+
+	_, err := p.buildRequest(context.Background(), &provider.CompletionParams{
+		Instructions: "Test instructions",
+		Thread:       aggregator,
+		Model:        GPT4oMini(),
+	})
+	require.Error(t, err)
+	assert.EqualError(t, err, "message has 3 image parts, at most 2 are allowed")
+}
+
+func TestProvider_buildRequest_MaxInlineBytes(t *testing.T) {
+	p := New().WithContentLimits(provider.WithMaxInlineBytes(1024))
+
+	aggregator := shorttermmemory.New()
+	aggregator.AddUserPrompt(messages.Message[messages.UserMessage]{
+		Payload: messages.UserMessage{
+			Content: messages.ContentOrParts{Parts: []messages.ContentPart{
+				messages.Text("transcribe this"),
+				messages.Audio(make([]byte, 4096), "wav"),
+			}},
+		},
+	})
+
+	_, err := p.buildRequest(context.Background(), &provider.CompletionParams{
+		Instructions: "Test instructions",
+		Thread:       aggregator,
+		Model:        GPT4oMini(),
+	})
+	assert.EqualError(t, err, "audio part is 4096 bytes, at most 1024 bytes are allowed inline")
+}
+
+func TestProvider_buildRequest_UnreachableMediaPolicy(t *testing.T) {
+	png := []byte("\x89PNG\r\n\x1a\n")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/cat.png" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "image/png")
+		_, _ = w.Write(png)
+	}))
+	defer server.Close()
+
+	request := func(p *Provider) (openai.ChatCompletionNewParams, error) {
+		aggregator := shorttermmemory.New()
+		aggregator.AddUserPrompt(messages.Message[messages.UserMessage]{
+			Payload: messages.UserMessage{
+				Content: messages.ContentOrParts{Parts: []messages.ContentPart{
+					messages.Text("compare these"),
+					messages.ImageContentPart{URL: server.URL + "/cat.png"},
+					messages.ImageContentPart{URL: server.URL + "/gone.png", AltText: "a photo of a dog"},
+				}},
+			},
+		})
+		return p.buildRequest(context.Background(), &provider.CompletionParams{
+			Instructions: "Test instructions",
+			Thread:       aggregator,
+			Model:        GPT4oMini(),
+		})
+	}
+	partsOf := func(t *testing.T, params openai.ChatCompletionNewParams) []openai.ChatCompletionContentPartUnionParam {
+		msgs := params.Messages.Value
+		require.Len(t, msgs, 2)
+		return msgs[1].(openai.ChatCompletionUserMessageParam).Content.Value
+	}
+	dataURL := "data:image/png;base64," + base64.StdEncoding.EncodeToString(png)
+
+	t.Run("without a policy the URLs are sent as is", func(t *testing.T) {
+		params, err := request(New())
+		require.NoError(t, err)
+		parts := partsOf(t, params)
+		require.Len(t, parts, 3)
+		assert.Equal(t, server.URL+"/gone.png", parts[2].(openai.ChatCompletionContentPartImageParam).ImageURL.Value.URL.Value)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		_, err := request(New().WithUnreachableMediaPolicy(provider.UnreachableMediaError))
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "/gone.png")
+		assert.Contains(t, err.Error(), "404")
+	})
+
+	t.Run("skip", func(t *testing.T) {
+		params, err := request(New().WithUnreachableMediaPolicy(provider.UnreachableMediaSkip))
+		require.NoError(t, err)
+		parts := partsOf(t, params)
+		require.Len(t, parts, 2)
+		assert.Equal(t, dataURL, parts[1].(openai.ChatCompletionContentPartImageParam).ImageURL.Value.URL.Value)
+	})
+
+	t.Run("alt text", func(t *testing.T) {
+		params, err := request(New().WithUnreachableMediaPolicy(provider.UnreachableMediaAltText))
+		require.NoError(t, err)
+		parts := partsOf(t, params)
+		require.Len(t, parts, 3)
+		assert.Equal(t, dataURL, parts[1].(openai.ChatCompletionContentPartImageParam).ImageURL.Value.URL.Value)
+		assert.Equal(t, "a photo of a dog", parts[2].(openai.ChatCompletionContentPartTextParam).Text.Value)
+	})
+
+	t.Run("unreachable host", func(t *testing.T) {
+		closed := httptest.NewServer(http.NotFoundHandler())
+		closed.Close()
+
+		aggregator := shorttermmemory.New()
+		aggregator.AddUserPrompt(messages.Message[messages.UserMessage]{
+			Payload: messages.UserMessage{
+				Content: messages.ContentOrParts{Parts: []messages.ContentPart{
+					messages.ImageContentPart{URL: closed.URL + "/cat.png", AltText: "a cat"},
+				}},
+			},
+		})
+		params := &provider.CompletionParams{Instructions: "Test instructions", Thread: aggregator, Model: GPT4oMini()}
+
+		_, err := New().WithUnreachableMediaPolicy(provider.UnreachableMediaError).buildRequest(context.Background(), params)
+		require.Error(t, err)
+
+		chatParams, err := New().WithUnreachableMediaPolicy(provider.UnreachableMediaAltText).buildRequest(context.Background(), params)
+		require.NoError(t, err)
+		parts := partsOf(t, chatParams)
+		require.Len(t, parts, 1)
+		assert.Equal(t, "a cat", parts[0].(openai.ChatCompletionContentPartTextParam).Text.Value)
+	})
+}
+
 func TestProvider_ChatCompletion_ContextCancellation(t *testing.T) {
 	serverDone := make(chan struct{})
 	p := setupTestServer(t, func(w http.ResponseWriter, r *http.Request) {
@@ -214,11 +562,14 @@ func TestProvider_ChatCompletion_ContextCancellation(t *testing.T) {
 	require.NoError(t, err)
 	require.NotNil(t, events)
 
-	// Read the start delimiter and first chunk
+	// Read the start delimiters and first chunk
 	event := <-events
 	assert.IsType(t, provider.Delim{}, event)
 	assert.Equal(t, "start", event.(provider.Delim).Delim)
 
+	event = <-events
+	assert.Equal(t, provider.Delim{Delim: provider.DelimContentStart}, event)
+
 	event = <-events
 	chunk, ok := event.(provider.Chunk[messages.AssistantMessage])
 	assert.True(t, ok)
@@ -301,6 +652,190 @@ func setupTestServer(t *testing.T, handler http.HandlerFunc) *Provider {
 	return p
 }
 
+func TestProvider_RequestID(t *testing.T) {
+	completion := func(stream bool) provider.CompletionParams {
+		return provider.CompletionParams{
+			RunID:  uuid.New(),
+			Thread: shorttermmemory.New(),
+			Model:  GPT4oMini(),
+			Stream: stream,
+		}
+	}
+
+	t.Run("success", func(t *testing.T) {
+		p := setupTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("x-request-id", "req_success_123")
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"id":"test-id","choices":[{"index":0,"finish_reason":"stop","message":{"role":"assistant","content":"hi"}}]}`))
+		})
+
+		events, err := p.ChatCompletion(context.Background(), completion(false))
+		require.NoError(t, err)
+
+		resp, ok := (<-events).(provider.Response[messages.AssistantMessage])
+		require.True(t, ok)
+		assert.Equal(t, "req_success_123", resp.Meta.Get("request_id").String())
+	})
+
+	t.Run("streaming", func(t *testing.T) {
+		p := setupTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("x-request-id", "req_stream_456")
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Write([]byte("data: {\"id\":\"test-id\",\"choices\":[{\"index\":0,\"delta\":{\"role\":\"assistant\",\"content\":\"hi\"}}]}\n\n"))
+			w.Write([]byte("data: {\"id\":\"test-id\",\"choices\":[{\"index\":0,\"delta\":{},\"finish_reason\":\"stop\"}]}\n\n"))
+			w.Write([]byte("data: [DONE]\n\n"))
+		})
+
+		events, err := p.ChatCompletion(context.Background(), completion(true))
+		require.NoError(t, err)
+
+		var resp provider.Response[messages.AssistantMessage]
+		for event := range events {
+			if r, ok := event.(provider.Response[messages.AssistantMessage]); ok {
+				resp = r
+			}
+		}
+		assert.Equal(t, "hi", resp.Response.Content.Content)
+		assert.Equal(t, "req_stream_456", resp.Meta.Get("request_id").String())
+	})
+
+	t.Run("error", func(t *testing.T) {
+		p := setupTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("x-request-id", "req_failed_789")
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":{"message":"invalid model","type":"invalid_request_error"}}`))
+		})
+
+		events, err := p.ChatCompletion(context.Background(), completion(false))
+		require.NoError(t, err)
+
+		providerErr, ok := (<-events).(provider.Error)
+		require.True(t, ok)
+		var invalid *provider.InvalidRequestError
+		assert.ErrorAs(t, providerErr.Err, &invalid)
+		assert.Equal(t, "req_failed_789", providerErr.Meta.Get("request_id").String())
+	})
+}
+
+func TestWithKeyProvider(t *testing.T) {
+	var received []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = append(received, r.Header.Get("Authorization"))
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(openai.ChatCompletion{
+			Choices: []openai.ChatCompletionChoice{{Message: openai.ChatCompletionMessage{Content: "ok"}}},
+		})
+	}))
+	t.Cleanup(server.Close)
+
+	var calls int
+	p := New(
+		option.WithBaseURL(server.URL+"/v1"),
+		option.WithAPIKey("static-key"),
+		WithKeyProvider(func(context.Context) (string, error) {
+			calls++
+			return fmt.Sprintf("rotated-key-%d", calls), nil
+		}),
+	)
+
+	for range 2 {
+		events, err := p.ChatCompletion(context.Background(), provider.CompletionParams{
+			RunID:  uuid.New(),
+			Thread: shorttermmemory.New(),
+			Model:  GPT4oMini(),
+		})
+		require.NoError(t, err)
+		_, ok := (<-events).(provider.Response[messages.AssistantMessage])
+		require.True(t, ok)
+	}
+
+	assert.Equal(t, []string{"Bearer rotated-key-1", "Bearer rotated-key-2"}, received)
+
+	t.Run("key provider error", func(t *testing.T) {
+		p := New(
+			option.WithBaseURL(server.URL+"/v1"),
+			option.WithMaxRetries(0),
+			WithKeyProvider(func(context.Context) (string, error) {
+				return "", errors.New("vault sealed")
+			}),
+		)
+
+		events, err := p.ChatCompletion(context.Background(), provider.CompletionParams{
+			RunID:  uuid.New(),
+			Thread: shorttermmemory.New(),
+			Model:  GPT4oMini(),
+		})
+		require.NoError(t, err)
+		perr, ok := (<-events).(provider.Error)
+		require.True(t, ok)
+		assert.Contains(t, perr.Err.Error(), "vault sealed")
+	})
+}
+
+func TestWithHeader(t *testing.T) {
+	type request struct {
+		path, route, tenant string
+	}
+	var received []request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = append(received, request{path: r.URL.Path, route: r.Header.Get("X-Gateway-Route"), tenant: r.Header.Get("X-Tenant-ID")})
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(openai.ChatCompletion{
+			Choices: []openai.ChatCompletionChoice{{Message: openai.ChatCompletionMessage{Content: "ok"}}},
+		})
+	}))
+	t.Cleanup(server.Close)
+
+	type tenantKey struct{}
+	p := New(
+		option.WithBaseURL(server.URL+"/v1/"),
+		option.WithAPIKey("test-key"),
+		WithHeader("X-Gateway-Route", "eu-west"),
+		WithHeaderFunc("X-Tenant-ID", func(ctx context.Context) (string, error) {
+			tenant, _ := ctx.Value(tenantKey{}).(string)
+			return tenant, nil
+		}),
+	)
+
+	for _, tenant := range []string{"acme", ""} {
+		ctx := context.WithValue(context.Background(), tenantKey{}, tenant)
+		events, err := p.ChatCompletion(ctx, provider.CompletionParams{
+			RunID:  uuid.New(),
+			Thread: shorttermmemory.New(),
+			Model:  GPT4oMini(),
+		})
+		require.NoError(t, err)
+		_, ok := (<-events).(provider.Response[messages.AssistantMessage])
+		require.True(t, ok)
+	}
+
+	assert.Equal(t, []request{
+		{path: "/v1/chat/completions", route: "eu-west", tenant: "acme"},
+		{path: "/v1/chat/completions", route: "eu-west"},
+	}, received)
+
+	t.Run("header func error", func(t *testing.T) {
+		p := New(
+			option.WithBaseURL(server.URL+"/v1"),
+			option.WithMaxRetries(0),
+			WithHeaderFunc("X-Tenant-ID", func(context.Context) (string, error) {
+				return "", errors.New("no tenant")
+			}),
+		)
+
+		events, err := p.ChatCompletion(context.Background(), provider.CompletionParams{
+			RunID:  uuid.New(),
+			Thread: shorttermmemory.New(),
+			Model:  GPT4oMini(),
+		})
+		require.NoError(t, err)
+		perr, ok := (<-events).(provider.Error)
+		require.True(t, ok)
+		assert.Contains(t, perr.Err.Error(), "no tenant")
+	})
+}
+
 func TestProvider_ChatCompletion(t *testing.T) {
 	mockResp := openai.ChatCompletion{
 		ID: "test-id",
@@ -348,6 +883,300 @@ func TestProvider_ChatCompletion(t *testing.T) {
 	assert.False(t, ok)
 }
 
+func TestProvider_ChatCompletion_ReasoningTokens(t *testing.T) {
+	p := setupTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{
+			"id": "test-id",
+			"choices": [{"index": 0, "finish_reason": "stop", "message": {"role": "assistant", "content": "42"}}],
+			"usage": {
+				"prompt_tokens": 20,
+				"completion_tokens": 150,
+				"total_tokens": 170,
+				"completion_tokens_details": {"reasoning_tokens": 128}
+			}
+		}`))
+	})
+
+	events, err := p.ChatCompletion(context.Background(), provider.CompletionParams{
+		RunID:  uuid.New(),
+		Thread: shorttermmemory.New(),
+		Model:  O1(),
+	})
+	require.NoError(t, err)
+
+	resp, ok := (<-events).(provider.Response[messages.AssistantMessage])
+	require.True(t, ok)
+	assert.Equal(t, int64(170), resp.Meta.Get("usage.total_tokens").Int())
+	assert.Equal(t, int64(128), resp.Meta.Get("usage.completion_tokens_details.reasoning_tokens").Int())
+}
+
+func TestProvider_ChatCompletion_StopSequences(t *testing.T) {
+	mockResp := openai.ChatCompletion{
+		ID: "test-id",
+		Choices: []openai.ChatCompletionChoice{
+			{
+				Message: openai.ChatCompletionMessage{
+					Content: "The answer is 42\nEND",
+				},
+				FinishReason: openai.ChatCompletionChoicesFinishReasonStop,
+			},
+		},
+	}
+
+	p := setupTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+		assert.Equal(t, []any{"\nEND"}, gjson.GetBytes(body, "stop").Value())
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(mockResp)
+	})
+
+	events, err := p.ChatCompletion(context.Background(), provider.CompletionParams{
+		RunID:         uuid.New(),
+		Instructions:  "Test instructions",
+		Thread:        shorttermmemory.New(),
+		Model:         GPT4oMini(),
+		StopSequences: []string{"\nEND"},
+	})
+	require.NoError(t, err)
+
+	event := <-events
+	resp, ok := event.(provider.Response[messages.AssistantMessage])
+	require.True(t, ok)
+	assert.Equal(t, "The answer is 42", resp.Response.Content.Content)
+	assert.NotContains(t, resp.Response.Content.Content, "END")
+}
+
+func TestStripStopSequences(t *testing.T) {
+	stop := []string{"\nEND"}
+
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{name: "no stop sequence", content: "The answer is 42", want: "The answer is 42"},
+		{name: "whole stop sequence", content: "The answer is 42\nEND", want: "The answer is 42"},
+		{name: "text after the stop sequence", content: "The answer is 42\nEND\nmore", want: "The answer is 42"},
+		{name: "start of the stop sequence is kept", content: "The answer is 42\nEN", want: "The answer is 42\nEN"},
+		{name: "trailing newline is kept", content: "The answer is 42\n", want: "The answer is 42\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, stripStopSequences(tt.content, stop))
+		})
+	}
+}
+
+func TestProvider_ChatCompletion_BuiltinTool(t *testing.T) {
+	p := setupTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+
+		tools := gjson.GetBytes(body, "tools").Array()
+		require.Len(t, tools, 1)
+		assert.Equal(t, "function", tools[0].Get("type").String())
+		assert.Equal(t, "lookup", tools[0].Get("function.name").String())
+		assert.JSONEq(t, `{}`, gjson.GetBytes(body, "web_search_options").Raw)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(openai.ChatCompletion{
+			ID: "test-id",
+			Choices: []openai.ChatCompletionChoice{{
+				Message:      openai.ChatCompletionMessage{Content: "It's sunny in Paris today"},
+				FinishReason: openai.ChatCompletionChoicesFinishReasonStop,
+			}},
+		})
+	})
+
+	events, err := p.ChatCompletion(context.Background(), provider.CompletionParams{
+		RunID:  uuid.New(),
+		Thread: shorttermmemory.New(),
+		Model:  GPT4oMini(),
+		Tools: []tool.Definition{
+			tool.Must(func(city string) string { return city }, tool.Name("lookup"), tool.Parameters("city")),
+			tool.Builtin("web_search"),
+		},
+	})
+	require.NoError(t, err)
+
+	resp, ok := (<-events).(provider.Response[messages.AssistantMessage])
+	require.True(t, ok)
+	assert.Equal(t, "It's sunny in Paris today", resp.Response.Content.Content)
+}
+
+func TestProvider_ChatCompletion_UnsupportedBuiltinTool(t *testing.T) {
+	p := setupTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		t.Error("the request shouldn't be sent")
+	})
+
+	_, err := p.ChatCompletion(context.Background(), provider.CompletionParams{
+		RunID:  uuid.New(),
+		Thread: shorttermmemory.New(),
+		Model:  GPT4oMini(),
+		Tools:  []tool.Definition{tool.Builtin("code_interpreter")},
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "builtin tool code_interpreter isn't supported")
+}
+
+func TestProvider_ChatCompletion_ContentFilter(t *testing.T) {
+	p := setupTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{
+			"id": "test-id",
+			"object": "chat.completion",
+			"choices": [{
+				"index": 0,
+				"finish_reason": "content_filter",
+				"message": {"role": "assistant", "content": ""},
+				"content_filter_results": {
+					"hate": {"filtered": false, "severity": "safe"},
+					"violence": {"filtered": true, "severity": "high"},
+					"self_harm": {"filtered": true, "severity": "medium"}
+				}
+			}]
+		}`)
+	})
+
+	runID := uuid.New()
+	thread := shorttermmemory.New()
+	events, err := p.ChatCompletion(context.Background(), provider.CompletionParams{
+		RunID:  runID,
+		Thread: thread,
+		Model:  GPT4oMini(),
+	})
+	require.NoError(t, err)
+
+	filtered, ok := (<-events).(provider.ContentFilter)
+	require.True(t, ok)
+	assert.Equal(t, runID, filtered.RunID)
+	assert.Equal(t, thread.ID(), filtered.TurnID)
+	assert.Equal(t, "content_filter", filtered.FinishReason)
+	assert.ElementsMatch(t, []string{"violence", "self_harm"}, filtered.Categories)
+
+	resp, ok := (<-events).(provider.Response[messages.AssistantMessage])
+	require.True(t, ok)
+	assert.Equal(t, "content_filter", resp.FinishReason)
+
+	_, ok = <-events
+	assert.False(t, ok)
+}
+
+func TestProvider_ChatCompletion_ErrorCategories(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		headers map[string]string
+		check   func(t *testing.T, err error)
+	}{
+		{
+			name:   "unauthorized",
+			status: http.StatusUnauthorized,
+			check: func(t *testing.T, err error) {
+				var authErr *provider.AuthError
+				require.ErrorAs(t, err, &authErr)
+				assert.Equal(t, http.StatusUnauthorized, authErr.StatusCode)
+			},
+		},
+		{
+			name:    "rate limited",
+			status:  http.StatusTooManyRequests,
+			headers: map[string]string{"Retry-After": "7"},
+			check: func(t *testing.T, err error) {
+				var rateErr *provider.RateLimitError
+				require.ErrorAs(t, err, &rateErr)
+				assert.Equal(t, 7*time.Second, rateErr.RetryAfter)
+			},
+		},
+		{
+			name:    "rate limited in milliseconds",
+			status:  http.StatusTooManyRequests,
+			headers: map[string]string{"Retry-After-Ms": "1500", "Retry-After": "2"},
+			check: func(t *testing.T, err error) {
+				var rateErr *provider.RateLimitError
+				require.ErrorAs(t, err, &rateErr)
+				assert.Equal(t, 1500*time.Millisecond, rateErr.RetryAfter)
+			},
+		},
+		{
+			name:   "bad request",
+			status: http.StatusBadRequest,
+			check: func(t *testing.T, err error) {
+				var reqErr *provider.InvalidRequestError
+				require.ErrorAs(t, err, &reqErr)
+				assert.Equal(t, http.StatusBadRequest, reqErr.StatusCode)
+			},
+		},
+		{
+			name:   "server error",
+			status: http.StatusInternalServerError,
+			check: func(t *testing.T, err error) {
+				var serverErr *provider.ServerError
+				require.ErrorAs(t, err, &serverErr)
+				assert.Equal(t, http.StatusInternalServerError, serverErr.StatusCode)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		for _, stream := range []bool{false, true} {
+			t.Run(fmt.Sprintf("%s stream=%t", tt.name, stream), func(t *testing.T) {
+				server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					for k, v := range tt.headers {
+						w.Header().Set(k, v)
+					}
+					w.Header().Set("Content-Type", "application/json")
+					w.WriteHeader(tt.status)
+					fmt.Fprint(w, `{"error":{"message":"nope","type":"error","param":null,"code":null}}`)
+				}))
+				t.Cleanup(server.Close)
+				p := New(option.WithBaseURL(server.URL+"/v1"), option.WithMaxRetries(0))
+
+				events, err := p.ChatCompletion(context.Background(), provider.CompletionParams{
+					RunID:  uuid.New(),
+					Thread: shorttermmemory.New(),
+					Stream: stream,
+					Model:  GPT4oMini(),
+				})
+				require.NoError(t, err)
+
+				var errEvent *provider.Error
+				for event := range events {
+					if e, ok := event.(provider.Error); ok {
+						errEvent = &e
+					}
+				}
+				require.NotNil(t, errEvent)
+				tt.check(t, *errEvent)
+			})
+		}
+	}
+
+	t.Run("network error", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+		server.Close()
+		p := New(option.WithBaseURL(server.URL+"/v1"), option.WithMaxRetries(0))
+
+		events, err := p.ChatCompletion(context.Background(), provider.CompletionParams{
+			RunID:  uuid.New(),
+			Thread: shorttermmemory.New(),
+			Model:  GPT4oMini(),
+		})
+		require.NoError(t, err)
+
+		var netErr *provider.NetworkError
+		for event := range events {
+			if e, ok := event.(provider.Error); ok {
+				require.ErrorAs(t, e, &netErr)
+			}
+		}
+		require.NotNil(t, netErr)
+	})
+}
+
 func TestMessagesToOpenAI_EmptyMessages(t *testing.T) {
 	result, user := messagesToOpenAI("Test instructions", slices.Values([]messages.Message[messages.ModelMessage]{}))
 
@@ -413,6 +1242,47 @@ func TestMessagesToOpenAI_ContentParts(t *testing.T) {
 	assert.Equal(t, []byte("audio data"), decodedAudio)
 }
 
+func TestMessagesToOpenAI_ToolResponseAttachments(t *testing.T) {
+	aggregator := shorttermmemory.New()
+	aggregator.AddToolCall(messages.New().ToolCall([]messages.ToolCallData{
+		{ID: "call-1", Name: "draw", Arguments: "{}"},
+		{ID: "call-2", Name: "report", Arguments: "{}"},
+	}))
+
+	image := messages.New().ToolResponse("call-1", "draw", "")
+	image.Payload.Data = []byte("png bytes")
+	image.Payload.MIMEType = "image/png"
+	aggregator.AddToolResponse(image)
+
+	pdf := messages.New().ToolResponse("call-2", "report", "the quarterly report")
+	pdf.Payload.Data = []byte("pdf bytes")
+	pdf.Payload.MIMEType = "application/pdf"
+	aggregator.AddToolResponse(pdf)
+
+	aggregator.AddUserPrompt(messages.New().UserPrompt("thanks"))
+
+	result, _ := messagesToOpenAI("Test instructions", aggregator.MessagesIter())
+	// system, tool calls, both tool responses, the image attachment and the user prompt
+	require.Len(t, result, 6)
+
+	imageResponse := result[2].(openai.ChatCompletionToolMessageParam)
+	assert.Equal(t, "call-1", imageResponse.ToolCallID.Value)
+	assert.Equal(t, "The result is attached in the next message.", imageResponse.Content.Value[0].Text.Value)
+
+	pdfResponse := result[3].(openai.ChatCompletionToolMessageParam)
+	assert.Equal(t, "call-2", pdfResponse.ToolCallID.Value)
+	assert.Equal(t, "the quarterly report\n\n[attachment of type application/pdf (9 bytes) is not supported by the model]", pdfResponse.Content.Value[0].Text.Value)
+
+	attachment := result[4].(openai.ChatCompletionUserMessageParam)
+	parts := attachment.Content.Value
+	require.Len(t, parts, 2)
+	imagePart := parts[1].(openai.ChatCompletionContentPartImageParam)
+	assert.Equal(t, "data:image/png;base64,"+base64.StdEncoding.EncodeToString([]byte("png bytes")), imagePart.ImageURL.Value.URL.Value)
+
+	_, isUser := result[5].(openai.ChatCompletionUserMessageParam)
+	assert.True(t, isUser)
+}
+
 func TestMessagesToOpenAI_ContentHandling(t *testing.T) {
 	runID := uuid.New()
 	aggregator := shorttermmemory.New()
@@ -566,6 +1436,28 @@ func TestCompletionChunkToStreamEvent(t *testing.T) {
 				assert.Equal(t, "Test chunk", chunk.Chunk.Content.Content)
 			},
 		},
+		{
+			name: "refusal chunk",
+			chunk: &openai.ChatCompletionChunk{
+				Choices: []openai.ChatCompletionChunkChoice{
+					{
+						Delta: openai.ChatCompletionChunkChoicesDelta{
+							Refusal: "I can't",
+						},
+					},
+				},
+			},
+			command: &provider.CompletionParams{
+				RunID:  runID,
+				Thread: aggregator,
+			},
+			validate: func(t *testing.T, event provider.StreamEvent) {
+				chunk, ok := event.(provider.Chunk[messages.AssistantMessage])
+				assert.True(t, ok)
+				assert.Equal(t, "I can't", chunk.Chunk.Refusal)
+				assert.Empty(t, chunk.Chunk.Content.Content)
+			},
+		},
 		{
 			name: "tool call chunk",
 			chunk: &openai.ChatCompletionChunk{
@@ -608,6 +1500,240 @@ func TestCompletionChunkToStreamEvent(t *testing.T) {
 	}
 }
 
+func TestProvider_ChatCompletion_StreamUsage(t *testing.T) {
+	chunks := []string{
+		`{"id":"test-id","object":"chat.completion.chunk","choices":[{"index":0,"delta":{"content":"Hello"}}],"usage":null}`,
+		`{"id":"test-id","object":"chat.completion.chunk","choices":[{"index":0,"delta":{},"finish_reason":"stop"}],"usage":null}`,
+		`{"id":"test-id","object":"chat.completion.chunk","choices":[],"usage":{"prompt_tokens":12,"completion_tokens":3,"total_tokens":15,"completion_tokens_details":{"reasoning_tokens":1},"prompt_tokens_details":{"cached_tokens":4}}}`,
+	}
+
+	p := setupTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+		assert.True(t, gjson.GetBytes(body, "stream_options.include_usage").Bool())
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		flusher, ok := w.(http.Flusher)
+		require.True(t, ok)
+		for _, chunk := range chunks {
+			fmt.Fprintf(w, "data: %s\n\n", chunk)
+			flusher.Flush()
+		}
+		fmt.Fprint(w, "data: [DONE]\n\n")
+		flusher.Flush()
+	})
+
+	events, err := p.ChatCompletion(context.Background(), provider.CompletionParams{
+		RunID:              uuid.New(),
+		Thread:             shorttermmemory.New(),
+		Stream:             true,
+		IncludeStreamUsage: true,
+		Model:              GPT4oMini(),
+	})
+	require.NoError(t, err)
+
+	var final provider.Response[messages.AssistantMessage]
+	for event := range events {
+		if resp, ok := event.(provider.Response[messages.AssistantMessage]); ok {
+			final = resp
+		}
+	}
+	assert.Equal(t, "Hello", final.Response.Content.Content)
+
+	var usage shorttermmemory.Usage
+	require.NoError(t, json.Unmarshal([]byte(final.Meta.Get("usage").Raw), &usage))
+	assert.Equal(t, shorttermmemory.Usage{
+		PromptTokens:     12,
+		CompletionTokens: 3,
+		TotalTokens:      15,
+		CompletionTokensDetails: shorttermmemory.CompletionTokensDetails{
+			ReasoningTokens: 1,
+		},
+		PromptTokensDetails: shorttermmemory.PromptTokensDetails{
+			CachedTokens: 4,
+		},
+	}, usage)
+}
+
+func TestProvider_ChatCompletion_StreamedRefusal(t *testing.T) {
+	chunks := []string{
+		`{"id":"test-id","object":"chat.completion.chunk","choices":[{"index":0,"delta":{"role":"assistant","refusal":"I can't "}}]}`,
+		`{"id":"test-id","object":"chat.completion.chunk","choices":[{"index":0,"delta":{"refusal":"help with that."}}]}`,
+		`{"id":"test-id","object":"chat.completion.chunk","choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}`,
+	}
+
+	p := setupTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		flusher, ok := w.(http.Flusher)
+		require.True(t, ok)
+		for _, chunk := range chunks {
+			fmt.Fprintf(w, "data: %s\n\n", chunk)
+			flusher.Flush()
+		}
+		fmt.Fprint(w, "data: [DONE]\n\n")
+		flusher.Flush()
+	})
+
+	events, err := p.ChatCompletion(context.Background(), provider.CompletionParams{
+		RunID:  uuid.New(),
+		Thread: shorttermmemory.New(),
+		Stream: true,
+		Model:  GPT4oMini(),
+	})
+	require.NoError(t, err)
+
+	var refusals []string
+	var delims []string
+	var final provider.Response[messages.AssistantMessage]
+	for event := range events {
+		switch event := event.(type) {
+		case provider.Chunk[messages.AssistantMessage]:
+			if event.Chunk.Refusal != "" {
+				refusals = append(refusals, event.Chunk.Refusal)
+			}
+		case provider.Delim:
+			delims = append(delims, event.Delim)
+		case provider.Response[messages.AssistantMessage]:
+			final = event
+		}
+	}
+
+	assert.Equal(t, []string{"I can't ", "help with that."}, refusals, "the refusal is streamed as it forms")
+	assert.Contains(t, delims, provider.DelimContentStart)
+	assert.Equal(t, "I can't help with that.", final.Response.Refusal)
+	assert.Empty(t, final.Response.Content.Content)
+	require.NoError(t, final.Response.Validate())
+}
+
+func TestProvider_ChatCompletion_StreamResumesAfterDisconnect(t *testing.T) {
+	var attempts int
+	p := setupTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		body, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		flusher, ok := w.(http.Flusher)
+		require.True(t, ok)
+
+		if attempts == 1 {
+			// the connection drops before the stream is done
+			fmt.Fprint(w, `data: {"id":"first","object":"chat.completion.chunk","choices":[{"index":0,"delta":{"content":"Hel"}}]}`+"\n\n")
+			flusher.Flush()
+			return
+		}
+
+		// the retry continues after the content that was already received
+		msgs := gjson.GetBytes(body, "messages").Array()
+		require.NotEmpty(t, msgs)
+		last := msgs[len(msgs)-1]
+		assert.Equal(t, "assistant", last.Get("role").String())
+		assert.Equal(t, "Hel", last.Get("content.0.text").String())
+
+		fmt.Fprint(w, `data: {"id":"second","object":"chat.completion.chunk","choices":[{"index":0,"delta":{"content":"lo"}}]}`+"\n\n")
+		fmt.Fprint(w, `data: {"id":"second","object":"chat.completion.chunk","choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}`+"\n\n")
+		fmt.Fprint(w, "data: [DONE]\n\n")
+		flusher.Flush()
+	})
+
+	events, err := p.ChatCompletion(context.Background(), provider.CompletionParams{
+		RunID:  uuid.New(),
+		Thread: shorttermmemory.New(),
+		Stream: true,
+		Model:  GPT4oMini(),
+	})
+	require.NoError(t, err)
+
+	var chunks []string
+	var final provider.Response[messages.AssistantMessage]
+	var starts int
+	for event := range events {
+		switch event := event.(type) {
+		case provider.Chunk[messages.AssistantMessage]:
+			chunks = append(chunks, event.Chunk.Content.Content)
+		case provider.Response[messages.AssistantMessage]:
+			final = event
+		case provider.Delim:
+			if event.Delim == provider.DelimStart {
+				starts++
+			}
+		case provider.Error:
+			t.Fatalf("unexpected error: %v", event.Err)
+		}
+	}
+
+	assert.Equal(t, 2, attempts)
+	assert.Equal(t, 1, starts, "the resumed stream continues the same response")
+	assert.Equal(t, []string{"Hel", "lo", ""}, chunks)
+	assert.Equal(t, "Hello", final.Response.Content.Content)
+	assert.Equal(t, "stop", final.FinishReason)
+}
+
+func TestProvider_ChatCompletion_StreamDropsDuringToolCall(t *testing.T) {
+	var attempts int
+	p := setupTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.Header().Set("Content-Type", "text/event-stream")
+		flusher, ok := w.(http.Flusher)
+		require.True(t, ok)
+
+		// the connection drops while the arguments of the tool call are streamed
+		fmt.Fprint(w, `data: {"id":"first","object":"chat.completion.chunk","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"lookup","arguments":"{\"ci"}}]}}]}`+"\n\n")
+		flusher.Flush()
+	})
+
+	events, err := p.ChatCompletion(context.Background(), provider.CompletionParams{
+		RunID:  uuid.New(),
+		Thread: shorttermmemory.New(),
+		Stream: true,
+		Model:  GPT4oMini(),
+	})
+	require.NoError(t, err)
+
+	var toolCallChunks int
+	var errs []error
+	for event := range events {
+		switch event := event.(type) {
+		case provider.Chunk[messages.ToolCallMessage]:
+			toolCallChunks++
+		case provider.Response[messages.ToolCallMessage]:
+			t.Fatalf("unexpected tool call response: %v", event.Response)
+		case provider.Error:
+			errs = append(errs, event.Err)
+		}
+	}
+
+	assert.Equal(t, 1, attempts, "the stream isn't resumed")
+	assert.Equal(t, 1, toolCallChunks, "the tool call deltas aren't sent again")
+	require.Len(t, errs, 1)
+	assert.ErrorIs(t, errs[0], io.ErrUnexpectedEOF)
+}
+
+func TestDoneDetector(t *testing.T) {
+	tests := []struct {
+		name  string
+		reads []string
+		want  bool
+	}{
+		{name: "done event", reads: []string{"data: {}\n\n", "data: [DONE]\n\n"}, want: true},
+		{name: "without a space", reads: []string{"data:[DONE]\n\n"}, want: true},
+		{name: "crlf line endings", reads: []string{"data: [DONE]\r\n\r\n"}, want: true},
+		{name: "split across reads", reads: []string{"data: [DO", "NE]\n\n"}, want: true},
+		{name: "cut off", reads: []string{"data: {}\n\n", "data: [DO"}, want: false},
+		{name: "marker in content", reads: []string{`data: {"delta":{"content":"data: [DONE]"}}` + "\n\n"}, want: false},
+		{name: "comment", reads: []string{": data: [DONE]\n\n"}, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var d doneDetector
+			for _, read := range tt.reads {
+				d.observe([]byte(read))
+			}
+			assert.Equal(t, tt.want, d.seen())
+		})
+	}
+}
+
 func TestProvider_ChatCompletion_Stream(t *testing.T) {
 	mockEvents := []openai.ChatCompletionChunk{
 		{
@@ -687,28 +1813,47 @@ func TestProvider_ChatCompletion_Stream(t *testing.T) {
 		responses = append(responses, event)
 	}
 
-	// Verify we got start, chunks, end, and final response
-	assert.Len(t, responses, 5)
+	// Verify we got start, content and tool call sections, end, and final response
+	require.Len(t, responses, 9)
+
+	var delims []string
+	for _, event := range responses {
+		if d, ok := event.(provider.Delim); ok {
+			delims = append(delims, d.Delim)
+		}
+	}
+	assert.Equal(t, []string{
+		provider.DelimStart,
+		provider.DelimContentStart,
+		provider.DelimContentEnd,
+		provider.DelimToolCallStart,
+		provider.DelimToolCallEnd,
+		provider.DelimEnd,
+	}, delims)
 
 	// Verify start delimiter
-	assert.IsType(t, provider.Delim{}, responses[0])
-	assert.Equal(t, "start", responses[0].(provider.Delim).Delim)
+	assert.Equal(t, provider.Delim{Delim: provider.DelimStart}, responses[0])
+	assert.Equal(t, provider.Delim{Delim: provider.DelimContentStart}, responses[1])
 
 	// Verify first chunk (text)
-	chunk1, ok := responses[1].(provider.Chunk[messages.AssistantMessage])
+	chunk1, ok := responses[2].(provider.Chunk[messages.AssistantMessage])
 	assert.True(t, ok)
 	assert.Equal(t, "Hello", chunk1.Chunk.Content.Content)
 
+	// Verify the text section ends before the tool call section starts
+	assert.Equal(t, provider.Delim{Delim: provider.DelimContentEnd}, responses[3])
+	assert.Equal(t, provider.Delim{Delim: provider.DelimToolCallStart}, responses[4])
+
 	// Verify second chunk (tool call)
-	chunk2, ok := responses[2].(provider.Chunk[messages.ToolCallMessage])
+	chunk2, ok := responses[5].(provider.Chunk[messages.ToolCallMessage])
 	assert.True(t, ok)
 	assert.Len(t, chunk2.Chunk.ToolCalls, 1)
 	assert.Equal(t, "tool1", chunk2.Chunk.ToolCalls[0].ID)
 	assert.Equal(t, "test_tool", chunk2.Chunk.ToolCalls[0].Name)
 
-	// Verify end delimiter
-	assert.IsType(t, provider.Delim{}, responses[3])
-	assert.Equal(t, "end", responses[3].(provider.Delim).Delim)
+	// Verify end delimiters
+	assert.Equal(t, provider.Delim{Delim: provider.DelimToolCallEnd}, responses[6])
+	assert.Equal(t, provider.Delim{Delim: provider.DelimEnd}, responses[7])
 }
 
 func TestCompletionToStreamEvent_MultipleToolCalls(t *testing.T) {
@@ -847,3 +1992,51 @@ func TestCompletionToStreamEvent(t *testing.T) {
 		})
 	}
 }
+
+func TestProvider_ChatCompletion_StreamRejectsInvalidToolArguments(t *testing.T) {
+	release := make(chan struct{})
+	p := setupTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		flusher, ok := w.(http.Flusher)
+		require.True(t, ok)
+
+		fmt.Fprint(w, `data: {"id":"call","object":"chat.completion.chunk","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"id":"call-1","type":"function","function":{"name":"set_age","arguments":"{\"age\": \"th"}}]}}]}`+"\n\n")
+		flusher.Flush()
+
+		// the rest of the call only arrives after the client gave up on it
+		select {
+		case <-release:
+		case <-r.Context().Done():
+			return
+		case <-time.After(5 * time.Second):
+		}
+		fmt.Fprint(w, `data: {"id":"call","object":"chat.completion.chunk","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"irty\"}"}}]}}]}`+"\n\n")
+		fmt.Fprint(w, `data: {"id":"call","object":"chat.completion.chunk","choices":[{"index":0,"delta":{},"finish_reason":"tool_calls"}]}`+"\n\n")
+		fmt.Fprint(w, "data: [DONE]\n\n")
+		flusher.Flush()
+	})
+	defer close(release)
+
+	setAge := tool.Must(func(age int) string { return "ok" }, tool.Name("set_age"), tool.Parameters("age"), tool.ValidateWhileStreaming())
+	events, err := p.ChatCompletion(context.Background(), provider.CompletionParams{
+		RunID:  uuid.New(),
+		Thread: shorttermmemory.New(),
+		Stream: true,
+		Model:  GPT4oMini(),
+		Tools:  []tool.Definition{setAge},
+	})
+	require.NoError(t, err)
+
+	var rejected error
+	for event := range events {
+		switch event := event.(type) {
+		case provider.Error:
+			rejected = event.Err
+		case provider.Response[messages.ToolCallMessage]:
+			t.Fatal("the invalid tool call should not complete")
+		}
+	}
+
+	require.Error(t, rejected)
+	assert.Contains(t, rejected.Error(), "tool set_age received invalid arguments: property age must be integer, got string")
+}
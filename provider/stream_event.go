@@ -24,6 +24,22 @@ type StreamEvent interface {
 	streamEvent()
 }
 
+// Delimiters emitted by providers to mark sections of a streamed response.
+//
+// DelimStart and DelimEnd wrap the whole stream. Within a stream, every run of text
+// content is wrapped in DelimContentStart and DelimContentEnd and every tool call is
+// wrapped in DelimToolCallStart and DelimToolCallEnd, so consumers can tell where
+// an assistant message switches from text to tool calls.
+const (
+	DelimStart         = "start"
+	DelimEnd           = "end"
+	DelimEmpty         = "empty"
+	DelimContentStart  = "content_start"
+	DelimContentEnd    = "content_end"
+	DelimToolCallStart = "tool_call_start"
+	DelimToolCallEnd   = "tool_call_end"
+)
+
 type Delim struct {
 	RunID  uuid.UUID `json:"run_id"`
 	TurnID uuid.UUID `json:"turn_id"`
@@ -63,6 +79,9 @@ type Response[T messages.Response] struct {
 	Response   T                          `json:"response"`
 	Timestamp  strfmt.DateTime            `json:"timestamp,omitempty"`
 	Meta       gjson.Result               `json:"meta,omitempty"`
+	// FinishReason is the reason the provider gave for ending this turn,
+	// e.g. stop, length, tool_calls or content_filter.
+	FinishReason string `json:"finish_reason,omitempty"`
 }
 
 func (Response[T]) streamEvent() {}
@@ -95,6 +114,53 @@ func (e Error) Error() string {
 	return fmt.Sprintf("run_id: %s, turn_id: %s, timestamp: %s, error: %v", e.RunID, e.TurnID, e.Timestamp, e.Err)
 }
 
+// Unwrap returns the underlying error.
+func (e Error) Unwrap() error {
+	return e.Err
+}
+
+// WithMeta returns a copy of the event with the key set to value in its metadata.
+// Delimiters carry no metadata and are returned unchanged.
+func WithMeta(event StreamEvent, key string, value any) StreamEvent {
+	switch e := event.(type) {
+	case Chunk[messages.AssistantMessage]:
+		e.Meta = SetMeta(e.Meta, key, value)
+		return e
+	case Chunk[messages.ToolCallMessage]:
+		e.Meta = SetMeta(e.Meta, key, value)
+		return e
+	case Response[messages.AssistantMessage]:
+		e.Meta = SetMeta(e.Meta, key, value)
+		return e
+	case Response[messages.ToolCallMessage]:
+		e.Meta = SetMeta(e.Meta, key, value)
+		return e
+	case Error:
+		e.Meta = SetMeta(e.Meta, key, value)
+		return e
+	case ContentFilter:
+		e.Meta = SetMeta(e.Meta, key, value)
+		return e
+	default:
+		return event
+	}
+}
+
+// SetMeta returns a copy of the metadata with the key set to value. Metadata that isn't
+// an object is replaced, and the metadata is returned unchanged when the value can't be set.
+func SetMeta(meta gjson.Result, key string, value any) gjson.Result {
+	raw := meta.Raw
+	if !meta.IsObject() {
+		raw = "{}"
+	}
+
+	updated, err := sjson.Set(raw, key, value)
+	if err != nil {
+		return meta
+	}
+	return gjson.Parse(updated)
+}
+
 // MarshalJSON implements custom JSON marshaling for Delim
 func (d Delim) MarshalJSON() ([]byte, error) {
 	result := delimJSON
@@ -175,7 +241,7 @@ func (c Chunk[T]) MarshalJSON() ([]byte, error) {
 	}
 
 	if !c.Timestamp.IsZero() {
-		result, err = sjson.SetBytes(result, "timestamp", c.Timestamp.String())
+		result, err = sjson.SetBytes(result, "timestamp", messages.MarshalTimestamp(c.Timestamp))
 		if err != nil {
 			return nil, err
 		}
@@ -227,7 +293,7 @@ func (c *Chunk[T]) UnmarshalJSON(data []byte) error {
 	}
 
 	if timestamp := gjson.GetBytes(data, "timestamp"); timestamp.Exists() {
-		if err := c.Timestamp.UnmarshalText([]byte(timestamp.String())); err != nil {
+		if err := messages.UnmarshalTimestamp(timestamp, &c.Timestamp); err != nil {
 			return fmt.Errorf("invalid timestamp: %w", err)
 		}
 	}
@@ -273,8 +339,15 @@ func (r Response[T]) MarshalJSON() ([]byte, error) {
 		return nil, err
 	}
 
+	if r.FinishReason != "" {
+		result, err = sjson.SetBytes(result, "finish_reason", r.FinishReason)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	if !r.Timestamp.IsZero() {
-		result, err = sjson.SetBytes(result, "timestamp", r.Timestamp.String())
+		result, err = sjson.SetBytes(result, "timestamp", messages.MarshalTimestamp(r.Timestamp))
 		if err != nil {
 			return nil, err
 		}
@@ -334,8 +407,12 @@ func (r *Response[T]) UnmarshalJSON(data []byte) error {
 		return fmt.Errorf("invalid response: %w", err)
 	}
 
+	if finishReason := gjson.GetBytes(data, "finish_reason"); finishReason.Exists() {
+		r.FinishReason = finishReason.String()
+	}
+
 	if timestamp := gjson.GetBytes(data, "timestamp"); timestamp.Exists() {
-		if err := r.Timestamp.UnmarshalText([]byte(timestamp.String())); err != nil {
+		if err := messages.UnmarshalTimestamp(timestamp, &r.Timestamp); err != nil {
 			return fmt.Errorf("invalid timestamp: %w", err)
 		}
 	}
@@ -370,7 +447,7 @@ func (e Error) MarshalJSON() ([]byte, error) {
 	}
 
 	if !e.Timestamp.IsZero() {
-		result, err = sjson.SetBytes(result, "timestamp", e.Timestamp.String())
+		result, err = sjson.SetBytes(result, "timestamp", messages.MarshalTimestamp(e.Timestamp))
 		if err != nil {
 			return nil, err
 		}
@@ -420,7 +497,7 @@ func (e *Error) UnmarshalJSON(data []byte) error {
 	e.Err = errors.New(errMsg.String())
 
 	if timestamp := gjson.GetBytes(data, "timestamp"); timestamp.Exists() {
-		if err := e.Timestamp.UnmarshalText([]byte(timestamp.String())); err != nil {
+		if err := messages.UnmarshalTimestamp(timestamp, &e.Timestamp); err != nil {
 			return fmt.Errorf("invalid timestamp: %w", err)
 		}
 	}
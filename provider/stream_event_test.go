@@ -128,7 +128,8 @@ func TestResponse_MarshalJSON(t *testing.T) {
 				Content: "test response",
 			},
 		},
-		Meta: gjson.Parse(`{"key": "value"}`),
+		Meta:         gjson.Parse(`{"key": "value"}`),
+		FinishReason: "length",
 	}
 
 	data, err := json.Marshal(response)
@@ -142,6 +143,7 @@ func TestResponse_MarshalJSON(t *testing.T) {
 	assert.Equal(t, turnID.String(), result.Get("turn_id").String())
 	assert.Equal(t, timestamp.String(), result.Get("timestamp").String())
 	assert.Equal(t, "value", result.Get("meta.key").String())
+	assert.Equal(t, "length", result.Get("finish_reason").String())
 }
 
 func TestResponse_UnmarshalJSON(t *testing.T) {
@@ -162,6 +164,7 @@ func TestResponse_UnmarshalJSON(t *testing.T) {
       "type": "assistant",
       "content": "test response"
     },
+    "finish_reason": "length",
     "meta": {
       "key": "value"
     }
@@ -175,6 +178,24 @@ func TestResponse_UnmarshalJSON(t *testing.T) {
 	assert.Equal(t, timestamp, response.Timestamp)
 	assert.Equal(t, "test response", response.Response.Content.Content)
 	assert.Equal(t, "value", response.Meta.Get("key").String())
+	assert.Equal(t, "length", response.FinishReason)
+}
+
+func TestWithMeta(t *testing.T) {
+	response := Response[messages.AssistantMessage]{
+		Meta: gjson.Parse(`{"key": "value"}`),
+	}
+
+	tagged := WithMeta(response, "model", "gpt-4o").(Response[messages.AssistantMessage])
+	assert.Equal(t, "gpt-4o", tagged.Meta.Get("model").String())
+	assert.Equal(t, "value", tagged.Meta.Get("key").String())
+	assert.False(t, response.Meta.Get("model").Exists(), "original event should not be modified")
+
+	chunk := WithMeta(Chunk[messages.ToolCallMessage]{}, "model", "gpt-4o").(Chunk[messages.ToolCallMessage])
+	assert.Equal(t, "gpt-4o", chunk.Meta.Get("model").String())
+
+	delim := Delim{Delim: "start"}
+	assert.Equal(t, delim, WithMeta(delim, "model", "gpt-4o"))
 }
 
 func TestError_MarshalJSON(t *testing.T) {
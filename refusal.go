@@ -0,0 +1,89 @@
+// Package bubo provides a framework for building conversational AI agents that can interact
+// in a structured manner. It supports multi-agent conversations, structured output,
+// and flexible execution contexts.
+package bubo
+
+import (
+	"fmt"
+
+	"github.com/casualjim/bubo/api"
+	"github.com/casualjim/bubo/internal/shorttermmemory"
+	"github.com/casualjim/bubo/messages"
+)
+
+type refusalAction uint8
+
+const (
+	skipOnRefusal refusalAction = iota
+	abortOnRefusal
+	fallbackOnRefusal
+)
+
+// RefusalPolicy decides what a Knot does when the agent of a step refuses to answer.
+// The zero value is RefusalSkip.
+type RefusalPolicy struct {
+	action   refusalAction
+	fallback api.Agent
+}
+
+var (
+	// RefusalSkip moves on to the next step when a step is refused, the refused step produces an empty result.
+	RefusalSkip = RefusalPolicy{action: skipOnRefusal}
+
+	// RefusalAbort stops the workflow with a *RefusalError when a step is refused.
+	RefusalAbort = RefusalPolicy{action: abortOnRefusal}
+)
+
+// RefusalFallback runs a refused step again with the fallback agent.
+// When the fallback agent refuses too, the workflow stops with a *RefusalError.
+func RefusalFallback(agent api.Agent) RefusalPolicy {
+	return RefusalPolicy{action: fallbackOnRefusal, fallback: agent}
+}
+
+// RefusalError is returned when a step is refused and the refusal policy doesn't allow the workflow to continue.
+type RefusalError struct {
+	Agent   string // The agent that refused
+	Refusal string // The refusal message of the agent
+}
+
+func (e *RefusalError) Error() string {
+	return fmt.Sprintf("agent %s refused: %s", e.Agent, e.Refusal)
+}
+
+// lastRefusal returns the refusal of the last assistant message in the thread, if it is one
+func lastRefusal(thread *shorttermmemory.Aggregator) (string, bool) {
+	msgs := thread.Messages()
+	if len(msgs) == 0 {
+		return "", false
+	}
+	msg, ok := msgs[len(msgs)-1].Payload.(messages.AssistantMessage)
+	if !ok {
+		return "", false
+	}
+	if msg.Refusal != "" {
+		return msg.Refusal, true
+	}
+	if msg.Content.Refusal != "" {
+		return msg.Content.Refusal, true
+	}
+	return "", false
+}
+
+// heldPromise keeps the outcome of a step until the refusal policy has been applied
+type heldPromise struct {
+	value string
+	err   error
+	done  bool
+}
+
+func (h *heldPromise) Complete(value string) {
+	if !h.done {
+		h.value, h.done = value, true
+	}
+}
+
+func (h *heldPromise) Error(err error) {
+	if !h.done {
+		h.err, h.done = err, true
+	}
+}
@@ -0,0 +1,92 @@
+package bubo
+
+import (
+	"context"
+	"testing"
+
+	"github.com/casualjim/bubo/internal/executor"
+	"github.com/casualjim/bubo/messages"
+	"github.com/casualjim/bubo/provider"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// refusingProvider refuses every completion
+type refusingProvider struct{}
+
+func (refusingProvider) ChatCompletion(_ context.Context, _ provider.CompletionParams) (<-chan provider.StreamEvent, error) {
+	ch := make(chan provider.StreamEvent, 1)
+	ch <- provider.Response[messages.AssistantMessage]{
+		Response: messages.AssistantMessage{Refusal: "I can't help with that"},
+	}
+	close(ch)
+	return ch, nil
+}
+
+func TestKnotRefusalPolicy(t *testing.T) {
+	run := func(t *testing.T, policy RefusalPolicy) (string, error) {
+		knot := New(
+			Agents(
+				delayedAgent(t, "refuser", refusingProvider{}),
+				delayedAgent(t, "finisher", &delayedProvider{content: "finished"}),
+			),
+			Steps(
+				Step("refuser", "do something questionable"),
+				Step("finisher", "wrap it up"),
+			),
+			OnRefusal(policy),
+		)
+
+		fut := executor.NewFuture(executor.DefaultUnmarshal[string]())
+		err := knot.Run(context.Background(), ExecutionContext{
+			executor: executor.NewLocal(),
+			hook:     noopHook{},
+			promise:  fut,
+			onClose:  func(context.Context) {},
+		})
+		if err != nil {
+			return "", err
+		}
+		return fut.Get()
+	}
+
+	t.Run("skip", func(t *testing.T) {
+		result, err := run(t, RefusalSkip)
+		require.NoError(t, err)
+		assert.Equal(t, "finished", result)
+	})
+
+	t.Run("abort", func(t *testing.T) {
+		_, err := run(t, RefusalAbort)
+		var refusal *RefusalError
+		require.ErrorAs(t, err, &refusal)
+		assert.Equal(t, "refuser", refusal.Agent)
+		assert.Equal(t, "I can't help with that", refusal.Refusal)
+	})
+
+	t.Run("fallback", func(t *testing.T) {
+		fallback := &countingProvider{delayedProvider: delayedProvider{content: "handled"}}
+		result, err := run(t, RefusalFallback(delayedAgent(t, "fallback", fallback)))
+		require.NoError(t, err)
+		assert.Equal(t, "finished", result)
+		assert.Equal(t, 1, fallback.calls)
+	})
+
+	t.Run("fallback refuses too", func(t *testing.T) {
+		_, err := run(t, RefusalFallback(delayedAgent(t, "fallback", refusingProvider{})))
+		var refusal *RefusalError
+		require.ErrorAs(t, err, &refusal)
+		assert.Equal(t, "fallback", refusal.Agent)
+	})
+}
+
+// countingProvider counts the completions it was asked for
+type countingProvider struct {
+	delayedProvider
+	calls int
+}
+
+func (p *countingProvider) ChatCompletion(ctx context.Context, params provider.CompletionParams) (<-chan provider.StreamEvent, error) {
+	p.calls++
+	return p.delayedProvider.ChatCompletion(ctx, params)
+}
@@ -0,0 +1,25 @@
+// Package replay re-executes recorded runs for regression tests.
+//
+// A run is recorded by wrapping the model of its agent with Record, the completions of the provider
+// are kept in the recorder. Model replays them in the same order, so the run can be executed again
+// with the same prompts and provider responses. The tools are called again, they must produce the
+// same output for the replay to match.
+//
+// Log keeps the events of a run in a canonical form: the IDs are numbered in the order they appear
+// and the timestamps and timings are left out, so the events of the replay are byte-identical to the
+// events of the recording when the run behaves the same.
+//
+// Example:
+//
+//	recorder := replay.Record(openai.GPT4oMini())
+//	recorded := replay.NewLog()
+//	_, err := bubo.RunOnce[string](ctx, agent.New(agent.Name("weather"), agent.Model(recorder)), prompt, recorded.Option())
+//
+//	replayed := replay.NewLog()
+//	model := replay.Model(recorder.Name(), recorder.Completions())
+//	_, err = bubo.RunOnce[string](ctx, agent.New(agent.Name("weather"), agent.Model(model)), prompt, replayed.Option())
+//
+//	if !bytes.Equal(recorded.Bytes(), replayed.Bytes()) {
+//	    // the run changed
+//	}
+package replay
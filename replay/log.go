@@ -0,0 +1,143 @@
+package replay
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"sync"
+
+	"github.com/casualjim/bubo"
+	"github.com/casualjim/bubo/broker"
+	"github.com/casualjim/bubo/events"
+	"github.com/fogfish/opts"
+)
+
+// volatileKeys are the fields that differ between two executions of the same run
+var volatileKeys = []string{"timestamp", "elapsed_ms", "duration_ms", "ttft_ms"}
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
+
+// Log keeps the events that are published by runs in the canonical form, in the order they were published.
+// It's a broker that only supports publishing, Option adds it to an execution context.
+type Log struct {
+	mu    sync.Mutex
+	lines [][]byte
+	ids   map[string]string
+}
+
+var _ broker.Broker = (*Log)(nil)
+
+// NewLog creates an empty log.
+func NewLog() *Log {
+	return &Log{ids: make(map[string]string)}
+}
+
+// Option returns the option that publishes the events of the runs of the execution context to the log.
+func (l *Log) Option() opts.Option[bubo.ExecutionContext] {
+	return bubo.WithBroker(l)
+}
+
+// Topic returns the topic the events of the run are published to, all the topics write to the log.
+func (l *Log) Topic(context.Context, string) broker.Topic {
+	return logTopic{log: l}
+}
+
+// Lines returns the canonical JSON of every event.
+func (l *Log) Lines() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	lines := make([]string, len(l.lines))
+	for i, line := range l.lines {
+		lines[i] = string(line)
+	}
+	return lines
+}
+
+// Bytes returns the canonical JSON of the events, one per line.
+func (l *Log) Bytes() []byte {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var buf bytes.Buffer
+	for _, line := range l.lines {
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes()
+}
+
+func (l *Log) add(event events.Event) error {
+	data, err := events.ToJSON(event)
+	if err != nil {
+		return err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var value any
+	if err := dec.Decode(&value); err != nil {
+		return fmt.Errorf("failed to decode event: %w", err)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	canonical, err := json.Marshal(l.canonicalize(value))
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %w", err)
+	}
+	l.lines = append(l.lines, canonical)
+	return nil
+}
+
+// canonicalize drops the volatile fields and replaces the IDs by their number in the order they appear
+func (l *Log) canonicalize(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		for _, key := range volatileKeys {
+			delete(v, key)
+		}
+		// the keys are visited in order, so the IDs are numbered the same way every time
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		slices.Sort(keys)
+		for _, key := range keys {
+			v[key] = l.canonicalize(v[key])
+		}
+		return v
+	case []any:
+		for i := range v {
+			v[i] = l.canonicalize(v[i])
+		}
+		return v
+	case string:
+		if !uuidPattern.MatchString(v) {
+			return v
+		}
+		id, ok := l.ids[v]
+		if !ok {
+			id = fmt.Sprintf("id-%d", len(l.ids)+1)
+			l.ids[v] = id
+		}
+		return id
+	default:
+		return v
+	}
+}
+
+type logTopic struct {
+	log *Log
+}
+
+func (t logTopic) Publish(_ context.Context, event events.Event) error {
+	return t.log.add(event)
+}
+
+// Subscribe returns a subscription that never receives events, the log only records them.
+// The runs subscribe to their topic for tool cancellations.
+func (t logTopic) Subscribe(ctx context.Context, hook events.Hook) (broker.Subscription, error) {
+	return broker.NewNoop().Topic(ctx, "").Subscribe(ctx, hook)
+}
@@ -0,0 +1,154 @@
+package replay
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/casualjim/bubo/api"
+	"github.com/casualjim/bubo/messages"
+	"github.com/casualjim/bubo/provider"
+)
+
+// Recorder is a model that keeps the completions of the provider of the model it wraps.
+type Recorder struct {
+	model api.Model
+
+	mu          sync.Mutex
+	completions [][]provider.StreamEvent
+}
+
+var _ api.Model = (*Recorder)(nil)
+
+// Record wraps the model so the completions of its provider are recorded.
+func Record(model api.Model) *Recorder {
+	return &Recorder{model: model}
+}
+
+// Name returns the name of the recorded model.
+func (r *Recorder) Name() string {
+	return r.model.Name()
+}
+
+// Provider returns the provider of the recorded model, the events of every completion are recorded
+// while they are passed on.
+func (r *Recorder) Provider() provider.Provider {
+	return &recordingProvider{recorder: r, provider: r.model.Provider()}
+}
+
+// Completions returns the events of the completions in the order they were requested.
+func (r *Recorder) Completions() [][]provider.StreamEvent {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	completions := make([][]provider.StreamEvent, len(r.completions))
+	copy(completions, r.completions)
+	return completions
+}
+
+type recordingProvider struct {
+	recorder *Recorder
+	provider provider.Provider
+}
+
+func (p *recordingProvider) ChatCompletion(ctx context.Context, params provider.CompletionParams) (<-chan provider.StreamEvent, error) {
+	stream, err := p.provider.ChatCompletion(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+
+	p.recorder.mu.Lock()
+	idx := len(p.recorder.completions)
+	p.recorder.completions = append(p.recorder.completions, nil)
+	p.recorder.mu.Unlock()
+
+	out := make(chan provider.StreamEvent)
+	go func() {
+		defer close(out)
+		for event := range stream {
+			p.recorder.mu.Lock()
+			p.recorder.completions[idx] = append(p.recorder.completions[idx], event)
+			p.recorder.mu.Unlock()
+
+			select {
+			case out <- event:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+// Model returns a model with the given name whose provider returns the recorded completions in order.
+// The events are stamped with the run and turn of the replay, like a live provider would do.
+// Requesting more completions than were recorded fails.
+func Model(name string, completions [][]provider.StreamEvent) api.Model {
+	return &replayModel{name: name, provider: &replayProvider{completions: completions}}
+}
+
+type replayModel struct {
+	name     string
+	provider *replayProvider
+}
+
+func (m *replayModel) Name() string {
+	return m.name
+}
+
+func (m *replayModel) Provider() provider.Provider {
+	return m.provider
+}
+
+type replayProvider struct {
+	mu          sync.Mutex
+	completions [][]provider.StreamEvent
+	next        int
+}
+
+func (p *replayProvider) ChatCompletion(ctx context.Context, params provider.CompletionParams) (<-chan provider.StreamEvent, error) {
+	p.mu.Lock()
+	if p.next >= len(p.completions) {
+		p.mu.Unlock()
+		return nil, fmt.Errorf("the recording has %d completions, the run requested more", len(p.completions))
+	}
+	completion := p.completions[p.next]
+	p.next++
+	p.mu.Unlock()
+
+	out := make(chan provider.StreamEvent, len(completion))
+	for _, event := range completion {
+		out <- restamp(event, params)
+	}
+	close(out)
+	return out, nil
+}
+
+// restamp moves the recorded event to the run and turn of the replay
+func restamp(event provider.StreamEvent, params provider.CompletionParams) provider.StreamEvent {
+	runID, turnID := params.RunID, params.Thread.ID()
+	switch e := event.(type) {
+	case provider.Delim:
+		e.RunID, e.TurnID = runID, turnID
+		return e
+	case provider.Chunk[messages.AssistantMessage]:
+		e.RunID, e.TurnID = runID, turnID
+		return e
+	case provider.Chunk[messages.ToolCallMessage]:
+		e.RunID, e.TurnID = runID, turnID
+		return e
+	case provider.Response[messages.AssistantMessage]:
+		e.RunID, e.TurnID, e.Checkpoint = runID, turnID, params.Thread.Checkpoint()
+		return e
+	case provider.Response[messages.ToolCallMessage]:
+		e.RunID, e.TurnID, e.Checkpoint = runID, turnID, params.Thread.Checkpoint()
+		return e
+	case provider.Error:
+		e.RunID, e.TurnID = runID, turnID
+		return e
+	case provider.ContentFilter:
+		e.RunID, e.TurnID = runID, turnID
+		return e
+	default:
+		return event
+	}
+}
@@ -0,0 +1,97 @@
+package replay
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/casualjim/bubo"
+	"github.com/casualjim/bubo/agent"
+	"github.com/casualjim/bubo/api"
+	"github.com/casualjim/bubo/messages"
+	"github.com/casualjim/bubo/provider"
+	"github.com/casualjim/bubo/tool"
+	"github.com/go-openapi/strfmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+)
+
+// weatherProvider hands off to the forecaster in the first turn and asks for the weather tool in the second one
+type weatherProvider struct {
+	turns int
+}
+
+func (p *weatherProvider) ChatCompletion(_ context.Context, params provider.CompletionParams) (<-chan provider.StreamEvent, error) {
+	p.turns++
+	call := messages.ToolCallData{ID: "call-1", Name: "transfer_to_forecaster", Arguments: "{}"}
+	if p.turns > 1 {
+		call = messages.ToolCallData{ID: "call-2", Name: "weather", Arguments: `{"city":"Paris"}`}
+	}
+
+	ch := make(chan provider.StreamEvent, 1)
+	ch <- provider.Response[messages.ToolCallMessage]{
+		RunID:     params.RunID,
+		TurnID:    params.Thread.ID(),
+		Response:  messages.ToolCallMessage{ToolCalls: []messages.ToolCallData{call}},
+		Timestamp: strfmt.DateTime(time.Now()),
+		Meta:      gjson.Parse(`{"usage":{"total_tokens":12}}`),
+	}
+	close(ch)
+	return ch, nil
+}
+
+type weatherModel struct {
+	provider provider.Provider
+}
+
+func (m weatherModel) Name() string                { return "weather-model" }
+func (m weatherModel) Provider() provider.Provider { return m.provider }
+
+func weatherAgent(model api.Model) api.Agent {
+	forecaster := agent.New(
+		agent.Name("forecaster"),
+		agent.Model(model),
+		agent.Instructions("You tell the weather"),
+		agent.Tools(tool.Must(func(city string) tool.StopRun {
+			return tool.Stop("It's sunny in " + city)
+		}, tool.Name("weather"), tool.Parameters("city"))),
+	)
+	return agent.New(
+		agent.Name("dispatcher"),
+		agent.Model(model),
+		agent.Instructions("You find the agent for the question"),
+		agent.Tools(tool.Must(func() api.Agent { return forecaster }, tool.Name("transfer_to_forecaster"))),
+	)
+}
+
+func TestReplay(t *testing.T) {
+	ctx := context.Background()
+	const prompt = "What's the weather in Paris?"
+
+	recorder := Record(weatherModel{provider: &weatherProvider{}})
+	recorded := NewLog()
+	result, err := bubo.RunOnce[string](ctx, weatherAgent(recorder), prompt, recorded.Option())
+	require.NoError(t, err)
+	assert.Equal(t, "It's sunny in Paris", result)
+	require.Len(t, recorder.Completions(), 2)
+
+	replayed := NewLog()
+	model := Model(recorder.Name(), recorder.Completions())
+	result, err = bubo.RunOnce[string](ctx, weatherAgent(model), prompt, replayed.Option())
+	require.NoError(t, err)
+	assert.Equal(t, "It's sunny in Paris", result)
+
+	lines := recorded.Lines()
+	require.NotEmpty(t, lines)
+	assert.Contains(t, lines[0], prompt)
+	assert.Equal(t, lines, replayed.Lines())
+	assert.True(t, bytes.Equal(recorded.Bytes(), replayed.Bytes()), "the replay publishes byte-identical events")
+
+	t.Run("more completions than recorded", func(t *testing.T) {
+		model := Model(recorder.Name(), recorder.Completions()[:1])
+		_, err := bubo.RunOnce[string](ctx, weatherAgent(model), prompt)
+		require.Error(t, err)
+	})
+}
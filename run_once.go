@@ -0,0 +1,61 @@
+// Package bubo provides a framework for building conversational AI agents that can interact
+// in a structured manner. It supports multi-agent conversations, structured output,
+// and flexible execution contexts.
+package bubo
+
+import (
+	"context"
+
+	"github.com/casualjim/bubo/api"
+	"github.com/casualjim/bubo/internal/executor"
+	"github.com/casualjim/bubo/pkg/stdx"
+	"github.com/casualjim/bubo/provider"
+	"github.com/fogfish/opts"
+)
+
+// RunOnce runs the agent with a single prompt on the local executor and waits for its result.
+// It is a shortcut for scripts that don't need hooks or multiple steps.
+//
+// When T is not a string or a gjson.Result, the agent is asked for structured output
+// matching the JSON schema of T, and the response is decoded into T.
+// The options configure the execution context in the same way as for Local.
+//
+// Example usage:
+//
+//	type Response struct {
+//	    Answer string `json:"answer"`
+//	}
+//
+//	result, err := bubo.RunOnce[Response](ctx, agent, "What is the capital of France?")
+func RunOnce[T any](ctx context.Context, agent api.Agent, prompt string, options ...opts.Option[ExecutionContext]) (T, error) {
+	fut := executor.NewFuture(executor.DefaultUnmarshal[T]())
+
+	rc := ExecutionContext{
+		executor: executor.NewLocal(),
+		hook:     noopHook{},
+		promise:  fut,
+		onClose:  func(context.Context) {},
+	}
+	if schema := jsonSchema[T](); schema != nil {
+		rc.responseSchema = &provider.StructuredOutput{
+			Name:        "response",
+			Description: "The response to the prompt",
+			Schema:      schema,
+		}
+	}
+	if err := opts.Apply(&rc, options); err != nil {
+		return stdx.Zero[T](), err
+	}
+
+	p := New(
+		Agents(agent),
+		Steps(Step(agent.Name(), prompt)),
+	)
+	if err := p.Run(ctx, rc); err != nil {
+		fut.Error(err)
+	} else {
+		// the future only takes the first outcome, this is a no-op when the run produced a result
+		fut.Error(errNoResult)
+	}
+	return fut.Get()
+}
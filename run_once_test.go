@@ -0,0 +1,65 @@
+package bubo
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/casualjim/bubo/provider"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// schemaProvider answers with content and records the response schema it was asked for
+type schemaProvider struct {
+	delayedProvider
+	schema *provider.StructuredOutput
+}
+
+func (p *schemaProvider) ChatCompletion(ctx context.Context, params provider.CompletionParams) (<-chan provider.StreamEvent, error) {
+	p.schema = params.ResponseSchema
+	return p.delayedProvider.ChatCompletion(ctx, params)
+}
+
+func TestRunOnce(t *testing.T) {
+	type Capital struct {
+		Country string `json:"country"`
+		City    string `json:"city"`
+	}
+
+	t.Run("structured output", func(t *testing.T) {
+		prov := &schemaProvider{delayedProvider: delayedProvider{content: `{"country":"France","city":"Paris"}`}}
+
+		result, err := RunOnce[Capital](context.Background(), delayedAgent(t, "geographer", prov), "What is the capital of France?")
+		require.NoError(t, err)
+		assert.Equal(t, Capital{Country: "France", City: "Paris"}, result)
+
+		require.NotNil(t, prov.schema)
+		assert.Equal(t, "response", prov.schema.Name)
+		_, hasCity := prov.schema.Schema.Properties.Get("city")
+		assert.True(t, hasCity)
+	})
+
+	t.Run("string", func(t *testing.T) {
+		prov := &schemaProvider{delayedProvider: delayedProvider{content: "Paris"}}
+
+		result, err := RunOnce[string](context.Background(), delayedAgent(t, "geographer", prov), "What is the capital of France?")
+		require.NoError(t, err)
+		assert.Equal(t, "Paris", result)
+		assert.Nil(t, prov.schema)
+	})
+
+	t.Run("invalid response", func(t *testing.T) {
+		prov := &schemaProvider{delayedProvider: delayedProvider{content: "Paris"}}
+
+		_, err := RunOnce[Capital](context.Background(), delayedAgent(t, "geographer", prov), "What is the capital of France?")
+		require.Error(t, err)
+	})
+
+	t.Run("provider error", func(t *testing.T) {
+		failure := errors.New("provider unavailable")
+
+		_, err := RunOnce[Capital](context.Background(), delayedAgent(t, "geographer", &delayedProvider{err: failure}), "What is the capital of France?")
+		require.ErrorIs(t, err, failure)
+	})
+}
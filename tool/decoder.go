@@ -0,0 +1,40 @@
+package tool
+
+import (
+	"reflect"
+	"sync"
+)
+
+// ArgDecoder decodes the JSON value of an argument into a value of the type it's registered for.
+type ArgDecoder func(data []byte) (any, error)
+
+var argDecoders sync.Map // reflect.Type -> ArgDecoder
+
+// RegisterArgDecoder makes the executor decode the arguments for parameters of type typ with fn,
+// for types the generic decoding of the arguments can't produce, like a time.Duration
+// that the model sends as "1h30m". A decoder that was registered for the type before is replaced.
+//
+// Example:
+//
+//	tool.RegisterArgDecoder(reflect.TypeFor[time.Duration](), func(data []byte) (any, error) {
+//	    var s string
+//	    if err := json.Unmarshal(data, &s); err != nil {
+//	        return nil, err
+//	    }
+//	    return time.ParseDuration(s)
+//	})
+func RegisterArgDecoder(typ reflect.Type, fn ArgDecoder) {
+	if typ == nil || fn == nil {
+		panic("tool: RegisterArgDecoder requires a type and a decoder")
+	}
+	argDecoders.Store(typ, fn)
+}
+
+// ArgDecoderFor returns the decoder that is registered for typ.
+func ArgDecoderFor(typ reflect.Type) (ArgDecoder, bool) {
+	fn, ok := argDecoders.Load(typ)
+	if !ok {
+		return nil, false
+	}
+	return fn.(ArgDecoder), true
+}
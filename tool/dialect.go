@@ -0,0 +1,99 @@
+package tool
+
+import (
+	"strings"
+
+	"github.com/invopop/jsonschema"
+)
+
+// SchemaDialect is the JSON Schema dialect of the parameters schema of a tool.
+// Providers validate the parameters against different drafts, the dialect selects
+// the $schema of the generated schema and the keywords that are used in it.
+type SchemaDialect string
+
+const (
+	// DialectDefault emits the schema without $schema, which is what OpenAI expects.
+	// The keywords are those of Draft 2020-12.
+	DialectDefault SchemaDialect = ""
+	// Draft07 emits a Draft-07 schema, tuples use an items array and definitions live under definitions.
+	Draft07 SchemaDialect = "http://json-schema.org/draft-07/schema#"
+	// Draft202012 emits a Draft 2020-12 schema, tuples use prefixItems and definitions live under $defs.
+	Draft202012 SchemaDialect = "https://json-schema.org/draft/2020-12/schema"
+)
+
+// applyDialect sets the $schema of the schema and rewrites the keywords that differ between the drafts.
+// The schemas are generated in Draft 2020-12 so only Draft-07 needs rewriting.
+func applyDialect(schema *jsonschema.Schema, dialect SchemaDialect) {
+	schema.Version = string(dialect)
+	if dialect == Draft07 {
+		toDraft07(schema)
+	}
+}
+
+func toDraft07(s *jsonschema.Schema) {
+	if s == nil {
+		return
+	}
+
+	for _, sub := range subschemas(s) {
+		toDraft07(sub)
+	}
+
+	if strings.HasPrefix(s.Ref, "#/$defs/") {
+		s.Ref = "#/definitions/" + strings.TrimPrefix(s.Ref, "#/$defs/")
+	}
+	if len(s.Definitions) > 0 {
+		setExtra(s, "definitions", s.Definitions)
+		s.Definitions = nil
+	}
+	if len(s.PrefixItems) > 0 {
+		setExtra(s, "items", s.PrefixItems)
+		if s.Items != nil {
+			setExtra(s, "additionalItems", s.Items)
+		}
+		s.PrefixItems = nil
+		s.Items = nil
+	}
+	if len(s.DependentRequired) > 0 || len(s.DependentSchemas) > 0 {
+		dependencies := make(map[string]any, len(s.DependentRequired)+len(s.DependentSchemas))
+		for name, required := range s.DependentRequired {
+			dependencies[name] = required
+		}
+		for name, schema := range s.DependentSchemas {
+			dependencies[name] = schema
+		}
+		setExtra(s, "dependencies", dependencies)
+		s.DependentRequired = nil
+		s.DependentSchemas = nil
+	}
+}
+
+func setExtra(s *jsonschema.Schema, key string, value any) {
+	if s.Extras == nil {
+		s.Extras = make(map[string]any)
+	}
+	s.Extras[key] = value
+}
+
+func subschemas(s *jsonschema.Schema) []*jsonschema.Schema {
+	subs := []*jsonschema.Schema{s.Not, s.If, s.Then, s.Else, s.Items, s.Contains, s.AdditionalProperties, s.PropertyNames, s.ContentSchema}
+	subs = append(subs, s.AllOf...)
+	subs = append(subs, s.AnyOf...)
+	subs = append(subs, s.OneOf...)
+	subs = append(subs, s.PrefixItems...)
+	for _, sub := range s.Definitions {
+		subs = append(subs, sub)
+	}
+	for _, sub := range s.DependentSchemas {
+		subs = append(subs, sub)
+	}
+	for _, sub := range s.PatternProperties {
+		subs = append(subs, sub)
+	}
+	if s.Properties != nil {
+		for pair := s.Properties.Oldest(); pair != nil; pair = pair.Next() {
+			subs = append(subs, pair.Value)
+		}
+	}
+	return subs
+}
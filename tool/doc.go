@@ -64,6 +64,24 @@ Tool with Context Variables:
 		Parameters("inputText"),
 	)
 
+Tool with Run State:
+
+	// the run state is shared by the tools of a run, but never shown to the model
+	func search(state *types.RunState, query string) string {
+		calls, _ := state.Get("search_calls")
+		n, _ := calls.(int)
+		state.Set("search_calls", n+1)
+		...
+	}
+
+Tool with Cancellation:
+
+	// the context of the run is passed as the first parameter, before the context variables
+	func fetchPage(ctx context.Context, url string) (string, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		...
+	}
+
 Generated Tool:
 
 	// bubo:agentTool
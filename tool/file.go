@@ -0,0 +1,10 @@
+package tool
+
+// File is returned by a tool that produces binary data, like a generated image or PDF.
+// The data is attached to the tool response instead of being inlined as text,
+// the description is the text content of the tool response.
+type File struct {
+	Data        []byte `json:"data"`
+	MIMEType    string `json:"mime_type"`
+	Description string `json:"description,omitempty"`
+}
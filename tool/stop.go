@@ -0,0 +1,22 @@
+package tool
+
+// StopRun is returned by a tool to end the run. The executor doesn't ask the model for
+// another completion, the final message becomes the result of the run.
+// The final message is plain text: a run with structured output fails with an
+// api.RunStoppedError that carries the final message instead.
+type StopRun struct {
+	FinalMessage string `json:"final_message"`
+}
+
+// Stop ends the run from within a tool with the final message as the result of the run,
+// for example when the conversation has to be escalated to a human.
+//
+// Example:
+//
+//	func escalate(reason string) tool.StopRun {
+//	    tickets.Open(reason)
+//	    return tool.Stop("A support engineer will contact you shortly.")
+//	}
+func Stop(finalMessage string) StopRun {
+	return StopRun{FinalMessage: finalMessage}
+}
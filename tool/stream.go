@@ -0,0 +1,117 @@
+package tool
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/invopop/jsonschema"
+)
+
+// ValidatePartialArguments checks the arguments of a call of the tool while they are being streamed.
+// partial is the JSON received so far. It's rejected as soon as a property has a value that clearly
+// doesn't match the type in the schema of the tool, incomplete values are checked as far as they go.
+// Missing properties aren't reported, they may still arrive.
+func (td Definition) ValidatePartialArguments(partial string) error {
+	_, schema := td.ToNameAndSchema()
+	return validatePartial(schema, partial)
+}
+
+func validatePartial(schema *jsonschema.Schema, partial string) error {
+	dec := json.NewDecoder(strings.NewReader(partial))
+	dec.UseNumber()
+
+	tok, err := dec.Token()
+	if err != nil {
+		// nothing to check yet
+		return nil
+	}
+	if tok != json.Delim('{') {
+		return fmt.Errorf("arguments must be a JSON object")
+	}
+
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil
+		}
+		key, ok := tok.(string)
+		if !ok {
+			// the end of the object
+			return nil
+		}
+
+		value := strings.TrimLeft(partial[dec.InputOffset():], " \t\r\n:")
+		if value == "" {
+			return nil
+		}
+		if schema.Properties != nil {
+			if prop, known := schema.Properties.Get(key); known {
+				if err := checkKind(key, prop, value); err != nil {
+					return err
+				}
+			}
+		}
+
+		if !skipValue(dec) {
+			return nil
+		}
+	}
+}
+
+// checkKind compares the kind of value, which may be incomplete, with the type of the property
+func checkKind(key string, prop *jsonschema.Schema, value string) error {
+	if prop.Type == "" {
+		return nil
+	}
+
+	var kind string
+	switch c := value[0]; {
+	case c == '"':
+		kind = "string"
+	case c == '{':
+		kind = "object"
+	case c == '[':
+		kind = "array"
+	case c == 't' || c == 'f':
+		kind = "boolean"
+	case c == 'n':
+		return nil
+	case c == '-' || (c >= '0' && c <= '9'):
+		end := strings.IndexFunc(value, func(r rune) bool { return !strings.ContainsRune("+-0123456789.eE", r) })
+		if end < 0 {
+			end = len(value)
+		}
+		kind = "integer"
+		if strings.ContainsAny(value[:end], ".eE") {
+			kind = "number"
+		}
+	default:
+		return fmt.Errorf("property %s has an invalid value", key)
+	}
+
+	if kind == prop.Type || (kind == "integer" && prop.Type == "number") {
+		return nil
+	}
+	return fmt.Errorf("property %s must be %s, got %s", key, prop.Type, kind)
+}
+
+// skipValue reads the next value from the decoder, it returns false when the value is incomplete
+func skipValue(dec *json.Decoder) bool {
+	var depth int
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return false
+		}
+		switch tok {
+		case json.Delim('{'), json.Delim('['):
+			depth++
+		case json.Delim('}'), json.Delim(']'):
+			depth--
+		}
+		if depth == 0 {
+			return true
+		}
+	}
+}
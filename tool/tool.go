@@ -1,10 +1,12 @@
 package tool
 
 import (
+	"context"
 	"fmt"
 	"reflect"
 	"runtime"
 	"strings"
+	"time"
 
 	"github.com/casualjim/bubo/pkg/reflectx"
 	"github.com/casualjim/bubo/pkg/stdx"
@@ -14,6 +16,11 @@ import (
 	orderedmap "github.com/wk8/go-ordered-map/v2"
 )
 
+var (
+	contextType  = reflect.TypeFor[context.Context]()
+	runStateType = reflect.TypeFor[*types.RunState]()
+)
+
 // Definition represents the definition of an agent function.
 // It includes the function's name, description, parameters, and the function itself.
 type Definition struct {
@@ -21,6 +28,37 @@ type Definition struct {
 	Description string
 	Parameters  map[string]string
 	Function    any
+	// RequiresApproval makes the executor ask a human to approve every call of the tool
+	RequiresApproval bool
+	// Builtin marks a tool that is executed by the provider, like web search or a code interpreter.
+	// Builtin tools have no function, the executor never calls them.
+	Builtin bool
+	// Examples are example invocations of the tool, the executor adds them to the instructions of the agent
+	Examples []ExampleCall
+	// RawJSONResult keeps the JSON-native representation of the result in the tool response,
+	// so numbers and booleans aren't turned into strings
+	RawJSONResult bool
+	// SchemaDialect is the JSON Schema dialect of the parameters schema, see Dialect
+	SchemaDialect SchemaDialect
+	// ValidateWhileStreaming makes the provider check the arguments of a call against the schema
+	// while they stream, see ValidatePartialArguments
+	ValidateWhileStreaming bool
+	// SideEffectOnly keeps the result of the tool from the model, it only sees an acknowledgment
+	// that the call completed. The tool response event still carries the result.
+	SideEffectOnly bool
+	// AwaitSignal is the name of the signal the Temporal executor waits on for the result of the tool,
+	// see AwaitSignal
+	AwaitSignal string
+	// SignalTimeout is how long the Temporal executor waits for the signal, see SignalTimeout
+	SignalTimeout time.Duration
+	// Defaults are the values of the parameters the model may omit, by parameter name, see ParamDefault
+	Defaults map[string]any
+}
+
+// ExampleCall is an example invocation of a tool with the arguments as JSON and the result the tool returns.
+type ExampleCall struct {
+	Arguments string
+	Result    string
 }
 
 var functionReflector = jsonschema.Reflector{
@@ -33,6 +71,10 @@ func (td Definition) ToNameAndSchema() (string, *jsonschema.Schema) {
 }
 
 func functionDefinitionJSON(reflector *jsonschema.Reflector, f Definition) (string, *jsonschema.Schema) {
+	if f.Builtin {
+		return f.Name, &jsonschema.Schema{Type: "object"}
+	}
+
 	// Get the type and value using reflection
 	val := reflect.ValueOf(f.Function)
 	typ := val.Type()
@@ -83,13 +125,16 @@ func functionDefinitionJSON(reflector *jsonschema.Reflector, f Definition) (stri
 		}
 
 		var required []string
+		var argIdx int
 		for i := startIdx; i < numIn; i++ {
 			paramType := typ.In(i)
-			if reflectx.IsRefinedType[types.ContextVars](paramType) {
+			// the context, context variables and run state are injected when the tool is called, they're not arguments for the model
+			if paramType == contextType || paramType == runStateType || reflectx.IsRefinedType[types.ContextVars](paramType) {
 				continue
 			}
 
-			paramName := fmt.Sprintf("param%d", i-startIdx)
+			paramName := fmt.Sprintf("param%d", argIdx)
+			argIdx++
 			if f.Parameters != nil {
 				if p, ok := f.Parameters[paramName]; ok {
 					paramName = p
@@ -99,6 +144,10 @@ func functionDefinitionJSON(reflector *jsonschema.Reflector, f Definition) (stri
 			propSchema := reflector.ReflectFromType(paramType)
 			propSchema.Version = ""
 			schema.Properties.Set(paramName, propSchema)
+			if value, ok := f.Defaults[paramName]; ok {
+				propSchema.Default = value
+				continue
+			}
 			required = append(required, paramName)
 		}
 		if len(required) > 0 {
@@ -106,6 +155,7 @@ func functionDefinitionJSON(reflector *jsonschema.Reflector, f Definition) (stri
 		}
 	}
 
+	applyDialect(schema, f.SchemaDialect)
 	return name, schema
 }
 
@@ -159,6 +209,21 @@ func New(f any, options ...Option) (Definition, error) {
 	return def, nil
 }
 
+// Builtin creates the definition of a tool that is executed by the provider instead of locally,
+// for example web search or a code interpreter. The name is the provider's name for the tool.
+// The executor doesn't dispatch calls to builtin tools, their results come back from the provider.
+// Providers reject the builtin tools they don't support, the openai provider only supports web_search.
+//
+// Example:
+//
+//	agent.New(agent.Tools(tool.Builtin("web_search")), ...)
+func Builtin(name string, options ...Option) Definition {
+	def := Definition{Name: name}
+	stdx.Must0(opts.Apply(&def, options))
+	def.Builtin = true
+	return def
+}
+
 // Name returns a function that sets the Name field of
 // agentFunctionOptions to the provided name. This can be used to
 // configure an agent function with a specific name.
@@ -195,3 +260,107 @@ func Parameters(parameters ...string) opts.Option[Definition] {
 		return nil
 	})
 }
+
+// ParamDefault returns an option that makes the parameter with the given name optional.
+// When the model omits the argument the tool is called with value instead of the zero value.
+// The name is the name of the parameter as set with Parameters.
+//
+// Example:
+//
+//	tool.Must(search, tool.Parameters("query", "limit"), tool.ParamDefault("limit", 10))
+func ParamDefault(name string, value any) opts.Option[Definition] {
+	return opts.Type[Definition](func(o *Definition) error {
+		if o.Defaults == nil {
+			o.Defaults = make(map[string]any)
+		}
+		o.Defaults[name] = value
+		return nil
+	})
+}
+
+// Example returns an option that adds an example invocation to the tool.
+// The arguments are the JSON object the model should send, the result is what the tool returns for them.
+// Examples are rendered into the instructions of the agent to make tool calls more reliable.
+func Example(args string, result string) opts.Option[Definition] {
+	return opts.Type[Definition](func(o *Definition) error {
+		o.Examples = append(o.Examples, ExampleCall{Arguments: args, Result: result})
+		return nil
+	})
+}
+
+// RawJSONResult returns an option that makes the tool response contain the result as JSON.
+// Numbers and booleans stay unquoted and text is quoted, instead of always being a plain string,
+// so typed consumers of the tool response can decode it.
+func RawJSONResult() opts.Option[Definition] {
+	return opts.Type[Definition](func(o *Definition) error {
+		o.RawJSONResult = true
+		return nil
+	})
+}
+
+// Dialect returns an option that selects the JSON Schema dialect of the parameters schema.
+// The schema gets the $schema of the dialect and uses the keywords of its draft.
+// Without it the schema has no $schema, which is what OpenAI expects.
+//
+// Example:
+//
+//	tool.Must(lookup, tool.Dialect(tool.Draft07))
+var Dialect = opts.ForName[Definition, SchemaDialect]("SchemaDialect")
+
+// ValidateWhileStreaming returns an option that validates the arguments of a call while the model
+// streams them. A call whose arguments clearly violate the schema is rejected before the
+// rest of the message arrives, instead of after the whole call was generated.
+func ValidateWhileStreaming() opts.Option[Definition] {
+	return opts.Type[Definition](func(o *Definition) error {
+		o.ValidateWhileStreaming = true
+		return nil
+	})
+}
+
+// SideEffectOnly returns an option for tools that are called for their side effects, like logging
+// or sending notifications. The executor still calls the tool and publishes its response,
+// but the model is only told that the call completed instead of getting the result.
+func SideEffectOnly() opts.Option[Definition] {
+	return opts.Type[Definition](func(o *Definition) error {
+		o.SideEffectOnly = true
+		return nil
+	})
+}
+
+// AwaitSignal returns an option for tools whose result comes from outside the run, like a human
+// filling in a form. The Temporal executor doesn't call the tool, the workflow waits until it
+// receives the signal with the given name and uses its value as the result of the call, see SignalTimeout.
+// The local executor can't receive signals, it calls the function of the tool instead.
+func AwaitSignal(name string) opts.Option[Definition] {
+	return opts.Type[Definition](func(o *Definition) error {
+		if name == "" {
+			return fmt.Errorf("signal name is required")
+		}
+		o.AwaitSignal = name
+		return nil
+	})
+}
+
+// SignalTimeout returns an option that limits how long the Temporal executor waits for the signal
+// of a tool that awaits one. The run fails when the signal doesn't arrive in time.
+// Without it the executor waits for a day.
+func SignalTimeout(timeout time.Duration) opts.Option[Definition] {
+	return opts.Type[Definition](func(o *Definition) error {
+		if timeout <= 0 {
+			return fmt.Errorf("signal timeout must be positive, got %s", timeout)
+		}
+		o.SignalTimeout = timeout
+		return nil
+	})
+}
+
+// RequireApproval returns an option that marks the tool as sensitive.
+// Before the tool is called, the executor publishes an approval request for the tool call
+// and waits for it to be approved. Denied calls, and calls that are not answered in time,
+// are not executed and the model is told the call was denied.
+func RequireApproval() opts.Option[Definition] {
+	return opts.Type[Definition](func(o *Definition) error {
+		o.RequiresApproval = true
+		return nil
+	})
+}
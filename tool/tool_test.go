@@ -1,11 +1,17 @@
 package tool
 
 import (
+	"context"
+	"encoding/json"
 	"reflect"
 	"testing"
+	"time"
 
+	"github.com/casualjim/bubo/types"
 	"github.com/invopop/jsonschema"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
 	orderedmap "github.com/wk8/go-ordered-map/v2"
 )
 
@@ -211,6 +217,22 @@ func TestToolDefinition_ToNameAndSchema(t *testing.T) {
 				Required:   []string{"value1"},
 			},
 		},
+		{
+			name: "injected context and context vars",
+			tool: Definition{
+				Name:        "test_tool",
+				Description: "A test tool",
+				Parameters:  map[string]string{"param0": "value1"},
+
+				Function: func(ctx context.Context, cv types.ContextVars, s string) string { return s },
+			},
+			wantName: "test_tool",
+			wantSchema: &jsonschema.Schema{
+				Type:       "object",
+				Properties: om,
+				Required:   []string{"value1"},
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -221,3 +243,93 @@ func TestToolDefinition_ToNameAndSchema(t *testing.T) {
 		})
 	}
 }
+
+type point [2]float64
+
+func (point) JSONSchema() *jsonschema.Schema {
+	return &jsonschema.Schema{
+		Type:        "array",
+		PrefixItems: []*jsonschema.Schema{{Type: "number"}, {Type: "number"}},
+	}
+}
+
+func TestDialect(t *testing.T) {
+	distance := func(from point, to point) float64 { return 0 }
+
+	t.Run("default has no $schema", func(t *testing.T) {
+		_, schema := Must(distance).ToNameAndSchema()
+		data, err := json.Marshal(schema)
+		require.NoError(t, err)
+		assert.False(t, gjson.GetBytes(data, "$schema").Exists())
+		assert.Equal(t, "number", gjson.GetBytes(data, "properties.param0.prefixItems.0.type").String())
+	})
+
+	t.Run("draft 2020-12", func(t *testing.T) {
+		_, schema := Must(distance, Dialect(Draft202012)).ToNameAndSchema()
+		data, err := json.Marshal(schema)
+		require.NoError(t, err)
+		assert.Equal(t, string(Draft202012), gjson.GetBytes(data, "$schema").String())
+		assert.Equal(t, "number", gjson.GetBytes(data, "properties.param0.prefixItems.0.type").String())
+	})
+
+	t.Run("draft-07", func(t *testing.T) {
+		_, schema := Must(distance, Dialect(Draft07)).ToNameAndSchema()
+		data, err := json.Marshal(schema)
+		require.NoError(t, err)
+		assert.Equal(t, string(Draft07), gjson.GetBytes(data, "$schema").String())
+		assert.False(t, gjson.GetBytes(data, "properties.param0.prefixItems").Exists())
+		items := gjson.GetBytes(data, "properties.param0.items")
+		require.True(t, items.IsArray())
+		assert.Equal(t, "number", items.Get("1.type").String())
+	})
+}
+
+func TestParamDefault(t *testing.T) {
+	def := Must(func(query string, limit int) string { return "" }, Parameters("query", "limit"), ParamDefault("limit", 10))
+	assert.Equal(t, map[string]any{"limit": 10}, def.Defaults)
+
+	_, schema := def.ToNameAndSchema()
+	data, err := json.Marshal(schema)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"query"}, schema.Required, "parameters with a default are optional")
+	assert.Equal(t, int64(10), gjson.GetBytes(data, "properties.limit.default").Int())
+}
+
+func TestSignalTimeout(t *testing.T) {
+	def := Must(func(question string) string { return "" }, AwaitSignal("answer"), SignalTimeout(time.Hour))
+	assert.Equal(t, "answer", def.AwaitSignal)
+	assert.Equal(t, time.Hour, def.SignalTimeout)
+
+	assert.Panics(t, func() { Must(func(question string) string { return "" }, SignalTimeout(0)) })
+}
+
+func TestValidatePartialArguments(t *testing.T) {
+	def := Must(func(name string, age int, score float64, tags []string) string { return "" }, Parameters("name", "age", "score", "tags"))
+
+	tests := []struct {
+		name    string
+		partial string
+		wantErr string
+	}{
+		{name: "nothing yet", partial: ""},
+		{name: "open object", partial: `{"na`},
+		{name: "incomplete string", partial: `{"name": "Ali`},
+		{name: "complete values", partial: `{"name": "Alice", "age": 30, "score": 1.5, "tags": ["a", "b"]}`},
+		{name: "integer for a number", partial: `{"score": 2`},
+		{name: "unknown property", partial: `{"extra": true, "name": "x"`},
+		{name: "string for an integer", partial: `{"name": "Alice", "age": "th`, wantErr: "property age must be integer, got string"},
+		{name: "decimal for an integer", partial: `{"age": 3.`, wantErr: "property age must be integer, got number"},
+		{name: "object for an array", partial: `{"tags": {`, wantErr: "property tags must be array, got object"},
+		{name: "not an object", partial: `["x"`, wantErr: "arguments must be a JSON object"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := def.ValidatePartialArguments(tt.partial)
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.EqualError(t, err, tt.wantErr)
+		})
+	}
+}
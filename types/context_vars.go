@@ -1,7 +1,24 @@
 // Package types provides core type definitions used throughout the Bubo framework.
 package types
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"maps"
+	"time"
+)
+
+// Built-in context variables that are available when rendering agent instructions.
+const (
+	// NowVar holds the current date and time, formatted with the now format.
+	NowVar = "now"
+	// TodayVar holds the current date, formatted with the today format.
+	TodayVar = "today"
+
+	// DefaultNowFormat is the layout used for NowVar when none is configured.
+	DefaultNowFormat = time.RFC3339
+	// DefaultTodayFormat is the layout used for TodayVar when none is configured.
+	DefaultTodayFormat = time.DateOnly
+)
 
 // ContextVars represents a key-value store of context variables used for template rendering.
 // It maps string keys to values of any type. These variables can be used to customize
@@ -67,3 +84,27 @@ func (cv ContextVars) String() string {
 	}
 	return string(jsonData)
 }
+
+// WithTime returns a copy of the ContextVars with the NowVar and TodayVar variables set
+// from the given time. Empty formats fall back to DefaultNowFormat and DefaultTodayFormat.
+// Variables that are already present are left untouched, so callers can override them.
+func (cv ContextVars) WithTime(now time.Time, nowFormat, todayFormat string) ContextVars {
+	if nowFormat == "" {
+		nowFormat = DefaultNowFormat
+	}
+	if todayFormat == "" {
+		todayFormat = DefaultTodayFormat
+	}
+
+	result := maps.Clone(cv)
+	if result == nil {
+		result = make(ContextVars, 2)
+	}
+	if _, ok := result[NowVar]; !ok {
+		result[NowVar] = now.Format(nowFormat)
+	}
+	if _, ok := result[TodayVar]; !ok {
+		result[TodayVar] = now.Format(todayFormat)
+	}
+	return result
+}
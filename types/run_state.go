@@ -0,0 +1,62 @@
+package types
+
+import (
+	"maps"
+	"sync"
+)
+
+// RunState is a key-value store scoped to a single run, for bookkeeping that the model
+// should never see, like counters or caches shared between tools.
+// Unlike ContextVars, the values are never rendered into the instructions of an agent.
+//
+// Tools get the run state by declaring a *RunState parameter:
+//
+//	func search(state *types.RunState, query string) string {
+//	    calls, _ := state.Get("search_calls")
+//	    n, _ := calls.(int)
+//	    state.Set("search_calls", n+1)
+//	    ...
+//	}
+//
+// RunState is safe for concurrent use, so tools that run in parallel can share it.
+type RunState struct {
+	mu     sync.RWMutex
+	values map[string]any
+}
+
+// NewRunState creates an empty run state.
+func NewRunState() *RunState {
+	return &RunState{values: make(map[string]any)}
+}
+
+// Get returns the value stored for the key and whether it was present.
+func (s *RunState) Get(key string) (any, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	value, ok := s.values[key]
+	return value, ok
+}
+
+// Set stores the value for the key.
+func (s *RunState) Set(key string, value any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.values == nil {
+		s.values = make(map[string]any)
+	}
+	s.values[key] = value
+}
+
+// Delete removes the value stored for the key.
+func (s *RunState) Delete(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.values, key)
+}
+
+// Snapshot returns a copy of all the values in the run state.
+func (s *RunState) Snapshot() map[string]any {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return maps.Clone(s.values)
+}
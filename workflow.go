@@ -0,0 +1,200 @@
+// Package bubo provides a framework for building conversational AI agents that can interact
+// in a structured manner. It supports multi-agent conversations, structured output,
+// and flexible execution contexts.
+package bubo
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/alphadose/haxmap"
+	"github.com/casualjim/bubo/agent"
+	"github.com/casualjim/bubo/api"
+	"github.com/casualjim/bubo/messages"
+	"github.com/fogfish/opts"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// MarshalJSON captures the definition of the workflow so it can be stored and rebuilt with FromJSON.
+// Agents are stored by name, they have to be in the agent registry when the workflow is loaded.
+//
+// The format is:
+//
+//	{
+//	  "name": "User",
+//	  "agents": ["forecaster", "planner"],
+//	  "steps": [
+//	    {"agent": "planner", "prompt": "Plan a trip to Lisbon"},
+//	    {"agent": "forecaster", "message": {...}}
+//	  ],
+//	  "validate_agents": true,
+//	  "refusal_policy": {"action": "fallback", "agent": "planner"}
+//	}
+func (p *Knot) MarshalJSON() ([]byte, error) {
+	result := []byte(`{"agents":[],"steps":[]}`)
+
+	var err error
+	result, err = sjson.SetBytes(result, "name", p.name)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	p.agents.ForEach(func(name string, _ api.Agent) bool {
+		names = append(names, name)
+		return true
+	})
+	slices.Sort(names)
+	for _, name := range names {
+		result, err = sjson.SetBytes(result, "agents.-1", name)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for i, step := range p.steps {
+		path := fmt.Sprintf("steps.%d", i)
+		result, err = sjson.SetBytes(result, path+".agent", step.agentName)
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := step.task.(type) {
+		case stringTask:
+			result, err = sjson.SetBytes(result, path+".prompt", string(t))
+		case messageTask:
+			var msg []byte
+			msg, err = json.Marshal(messages.Message[messages.UserMessage](t))
+			if err != nil {
+				return nil, fmt.Errorf("failed to marshal the message of step %d: %w", i, err)
+			}
+			result, err = sjson.SetRawBytes(result, path+".message", msg)
+		default:
+			err = fmt.Errorf("unknown task type: %T", t)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if p.validateAgents {
+		result, err = sjson.SetBytes(result, "validate_agents", true)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	switch p.refusalPolicy.action {
+	case abortOnRefusal:
+		result, err = sjson.SetBytes(result, "refusal_policy.action", "abort")
+	case fallbackOnRefusal:
+		result, err = sjson.SetBytes(result, "refusal_policy.action", "fallback")
+		if err == nil {
+			result, err = sjson.SetBytes(result, "refusal_policy.agent", p.refusalPolicy.fallback.Name())
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// FromJSON rebuilds a workflow from the definition produced by MarshalJSON.
+// The agents are looked up by name in the agent registry, unless they are registered with
+// the options. The options are applied before the definition, so the stored settings win.
+func FromJSON(data []byte, options ...opts.Option[Knot]) (*Knot, error) {
+	if !gjson.ValidBytes(data) {
+		return nil, fmt.Errorf("invalid json: %s", data)
+	}
+
+	p := &Knot{
+		name:   "User",
+		agents: haxmap.New[string, api.Agent](),
+	}
+	if err := opts.Apply(p, options); err != nil {
+		return nil, err
+	}
+
+	resolve := func(name string) (api.Agent, error) {
+		if a, ok := p.agents.Get(name); ok {
+			return a, nil
+		}
+		a, ok := agent.Get(name)
+		if !ok {
+			return nil, fmt.Errorf("agent %s is not registered", name)
+		}
+		p.agents.Set(name, a)
+		return a, nil
+	}
+
+	if name := gjson.GetBytes(data, "name"); name.Exists() {
+		p.name = name.String()
+	}
+
+	var errs error
+	for _, name := range gjson.GetBytes(data, "agents").Array() {
+		if _, err := resolve(name.String()); err != nil {
+			errs = errors.Join(errs, err)
+		}
+	}
+
+	for i, step := range gjson.GetBytes(data, "steps").Array() {
+		agentName := step.Get("agent").String()
+		if agentName == "" {
+			errs = errors.Join(errs, fmt.Errorf("step %d: missing required field 'agent'", i))
+			continue
+		}
+		if _, err := resolve(agentName); err != nil {
+			errs = errors.Join(errs, fmt.Errorf("step %d: %w", i, err))
+			continue
+		}
+
+		if msg := step.Get("message"); msg.Exists() {
+			var m messages.Message[messages.UserMessage]
+			if err := json.Unmarshal([]byte(msg.Raw), &m); err != nil {
+				errs = errors.Join(errs, fmt.Errorf("step %d: invalid message: %w", i, err))
+				continue
+			}
+			p.steps = append(p.steps, Step(agentName, m))
+			continue
+		}
+		p.steps = append(p.steps, Step(agentName, step.Get("prompt").String()))
+	}
+
+	if validate := gjson.GetBytes(data, "validate_agents"); validate.Exists() {
+		p.validateAgents = validate.Bool()
+	}
+
+	if policy := gjson.GetBytes(data, "refusal_policy"); policy.Exists() {
+		switch action := policy.Get("action").String(); action {
+		case "skip":
+			p.refusalPolicy = RefusalSkip
+		case "abort":
+			p.refusalPolicy = RefusalAbort
+		case "fallback":
+			fallback, err := resolve(policy.Get("agent").String())
+			if err != nil {
+				errs = errors.Join(errs, fmt.Errorf("refusal policy: %w", err))
+				break
+			}
+			p.refusalPolicy = RefusalFallback(fallback)
+		default:
+			errs = errors.Join(errs, fmt.Errorf("unknown refusal policy action: %s", action))
+		}
+	}
+
+	if errs != nil {
+		return nil, errs
+	}
+
+	if p.validateAgents {
+		if err := p.checkAgents(); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
@@ -0,0 +1,63 @@
+package bubo
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/casualjim/bubo/agent"
+	"github.com/casualjim/bubo/messages"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWorkflowJSON(t *testing.T) {
+	planner := agent.New(agent.Name("planner"), agent.Instructions("You plan trips"))
+	forecaster := agent.New(agent.Name("forecaster"), agent.Instructions("You forecast the weather"))
+	agent.Add(planner)
+	agent.Add(forecaster)
+	t.Cleanup(func() {
+		agent.Del(planner.Name())
+		agent.Del(forecaster.Name())
+	})
+
+	msg := messages.New().UserPrompt("What's the weather in Lisbon next week?")
+	knot := New(
+		Name("Traveller"),
+		Agents(planner, forecaster),
+		Steps(
+			Step(planner.Name(), "Plan a trip to Lisbon"),
+			Step(forecaster.Name(), msg),
+		),
+		OnRefusal(RefusalFallback(planner)),
+	)
+
+	data, err := json.Marshal(knot)
+	require.NoError(t, err)
+
+	loaded, err := FromJSON(data)
+	require.NoError(t, err)
+
+	assert.Equal(t, "Traveller", loaded.name)
+	require.Len(t, loaded.steps, 2)
+	assert.Equal(t, "planner", loaded.steps[0].agentName)
+	assert.Equal(t, stringTask("Plan a trip to Lisbon"), loaded.steps[0].task)
+	assert.Equal(t, "forecaster", loaded.steps[1].agentName)
+	loadedMsg, ok := loaded.steps[1].task.(messageTask)
+	require.True(t, ok)
+	assert.Equal(t, msg.Payload.Content, loadedMsg.Payload.Content)
+
+	a, ok := loaded.agents.Get("forecaster")
+	require.True(t, ok)
+	assert.Same(t, forecaster, a)
+	assert.Equal(t, fallbackOnRefusal, loaded.refusalPolicy.action)
+	assert.Same(t, planner, loaded.refusalPolicy.fallback)
+
+	again, err := json.Marshal(loaded)
+	require.NoError(t, err)
+	assert.JSONEq(t, string(data), string(again))
+
+	t.Run("unregistered agent", func(t *testing.T) {
+		_, err := FromJSON([]byte(`{"agents":["ghost"],"steps":[{"agent":"ghost","prompt":"boo"}]}`))
+		assert.ErrorContains(t, err, "agent ghost is not registered")
+	})
+}